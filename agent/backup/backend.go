@@ -0,0 +1,221 @@
+package backup
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// Types de backends supportés
+const (
+	BackendS3    = "s3"
+	BackendLocal = "local"
+	BackendSFTP  = "sftp"
+	BackendREST  = "rest"
+)
+
+// Backend décrit l'emplacement d'un dépôt restic et ses identifiants
+type Backend interface {
+	// Type du backend (s3, local, sftp, rest)
+	Type() string
+	// Repository retourne l'adresse restic du dépôt, sans secret
+	Repository() string
+	// Credentials retourne les identifiants du backend, transmis à restic
+	// hors de son environnement
+	Credentials() Credentials
+	// Options retourne les options restic (-o clé=valeur) du backend
+	Options() []string
+}
+
+// Credentials décrit les identifiants d'un backend
+type Credentials struct {
+	// Variables non secrètes
+	Env []string
+	// Fichiers de secrets : variable d'environnement → contenu du fichier
+	// (ex: AWS_SHARED_CREDENTIALS_FILE)
+	Files map[string]string
+	// Adresse complète du dépôt avec identifiants, transmise par --repository-file
+	Repository string
+}
+
+// S3Backend est un dépôt sur stockage objet compatible S3 (Scaleway, AWS,
+// MinIO, passerelles S3 devant Swift ou Azure)
+type S3Backend struct {
+	// Endpoint (ex: s3.fr-par.scw.cloud ou https://minio.local:9000)
+	Endpoint string
+	Bucket   string
+	// Chemin dans le bucket (ex: nom de l'hôte)
+	Path   string
+	Region string
+	// Adressage par chemin (endpoint/bucket) au lieu de sous-domaines, requis
+	// par la plupart des passerelles
+	PathStyle bool
+
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+func (b *S3Backend) Type() string { return BackendS3 }
+
+func (b *S3Backend) Repository() string {
+	repo := "s3:" + strings.TrimSuffix(b.Endpoint, "/") + "/" + b.Bucket
+	if b.Path != "" {
+		repo += "/" + strings.Trim(b.Path, "/")
+	}
+	return repo
+}
+
+// Credentials : fichier d'identifiants partagé AWS, lu par restic via
+// AWS_SHARED_CREDENTIALS_FILE (profil default)
+func (b *S3Backend) Credentials() Credentials {
+	if b.AccessKeyID == "" {
+		return Credentials{}
+	}
+	return Credentials{
+		Env: []string{"AWS_PROFILE=default"},
+		Files: map[string]string{
+			"AWS_SHARED_CREDENTIALS_FILE": fmt.Sprintf("[default]\naws_access_key_id = %s\naws_secret_access_key = %s\n",
+				b.AccessKeyID, b.SecretAccessKey),
+		},
+	}
+}
+
+func (b *S3Backend) Options() []string {
+	var opts []string
+	if b.Region != "" {
+		opts = append(opts, "s3.region="+b.Region)
+	}
+	if b.PathStyle {
+		opts = append(opts, "s3.bucket-lookup=path")
+	}
+	return opts
+}
+
+// LocalBackend est un dépôt sur un chemin local (disque USB, partage monté)
+type LocalBackend struct {
+	Path string
+}
+
+func (b *LocalBackend) Type() string             { return BackendLocal }
+func (b *LocalBackend) Repository() string       { return b.Path }
+func (b *LocalBackend) Credentials() Credentials { return Credentials{} }
+func (b *LocalBackend) Options() []string        { return nil }
+
+// SFTPBackend est un dépôt accessible en SFTP via le client ssh du système
+type SFTPBackend struct {
+	// Cible restic (ex: user@nas:/srv/restic ou //user@nas:2222//srv/restic)
+	Target string
+	// Clé privée SSH ; sinon configuration ssh de l'utilisateur
+	KeyFile string
+}
+
+func (b *SFTPBackend) Type() string             { return BackendSFTP }
+func (b *SFTPBackend) Repository() string       { return "sftp:" + b.Target }
+func (b *SFTPBackend) Credentials() Credentials { return Credentials{} }
+
+func (b *SFTPBackend) Options() []string {
+	// BatchMode : jamais de demande de mot de passe interactive
+	args := "-o BatchMode=yes"
+	if b.KeyFile != "" {
+		args = "-i " + b.KeyFile + " " + args
+	}
+	return []string{"sftp.args=" + args}
+}
+
+// RESTBackend est un dépôt sur un serveur restic REST (rest-server)
+type RESTBackend struct {
+	// URL du dépôt sans identifiants (ex: https://backup.mairie.fr:8000/agent-1/)
+	URL      string
+	Username string
+	Password string
+	// Serveur lancé en --append-only : les snapshots ne peuvent pas être
+	// supprimés depuis l'agent (rétention gérée côté serveur)
+	AppendOnly bool
+}
+
+func (b *RESTBackend) Type() string       { return BackendREST }
+func (b *RESTBackend) Repository() string { return "rest:" + b.URL }
+func (b *RESTBackend) Options() []string  { return nil }
+
+// Credentials : URL avec identifiants, jamais en argument ni dans l'environnement
+func (b *RESTBackend) Credentials() Credentials {
+	if b.Username == "" {
+		return Credentials{}
+	}
+	u, err := url.Parse(b.URL)
+	if err != nil {
+		return Credentials{}
+	}
+	u.User = url.UserPassword(b.Username, b.Password)
+	return Credentials{Repository: "rest:" + u.String()}
+}
+
+// IsAppendOnly indique si le dépôt interdit les suppressions
+func IsAppendOnly(b Backend) bool {
+	rest, ok := b.(*RESTBackend)
+	return ok && rest.AppendOnly
+}
+
+// ParseRepository construit un backend à partir d'une adresse restic :
+// s3:endpoint/bucket/chemin, sftp:user@hôte:/chemin, rest:https://... ou chemin local.
+// Les identifiants présents dans une URL REST sont extraits de l'adresse.
+func ParseRepository(repo string) (Backend, error) {
+	kind, rest, found := strings.Cut(repo, ":")
+	// Chemin Windows (C:\...) ou chemin sans préfixe
+	if !found || len(kind) == 1 {
+		return localBackend(repo)
+	}
+
+	switch kind {
+	case BackendLocal:
+		return localBackend(rest)
+
+	case BackendS3:
+		b := &S3Backend{}
+		scheme := ""
+		if s, r, ok := strings.Cut(rest, "://"); ok {
+			scheme, rest = s+"://", r
+		}
+		parts := strings.SplitN(strings.Trim(rest, "/"), "/", 3)
+		if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("dépôt S3 invalide %q (s3:endpoint/bucket[/chemin])", repo)
+		}
+		b.Endpoint, b.Bucket = scheme+parts[0], parts[1]
+		if len(parts) == 3 {
+			b.Path = parts[2]
+		}
+		return b, nil
+
+	case BackendSFTP:
+		if rest == "" {
+			return nil, fmt.Errorf("dépôt SFTP invalide %q", repo)
+		}
+		return &SFTPBackend{Target: rest}, nil
+
+	case BackendREST:
+		u, err := url.Parse(rest)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("dépôt REST invalide (rest:https://hôte:port/chemin)")
+		}
+		b := &RESTBackend{}
+		if u.User != nil {
+			b.Username = u.User.Username()
+			b.Password, _ = u.User.Password()
+			u.User = nil
+		}
+		b.URL = u.String()
+		return b, nil
+
+	default:
+		return nil, fmt.Errorf("backend %q non supporté (s3, local, sftp ou rest)", kind)
+	}
+}
+
+// localBackend valide un chemin de dépôt local
+func localBackend(path string) (Backend, error) {
+	if path == "" || !filepath.IsAbs(path) {
+		return nil, fmt.Errorf("dépôt local invalide %q : chemin absolu attendu", path)
+	}
+	return &LocalBackend{Path: path}, nil
+}
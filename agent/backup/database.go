@@ -0,0 +1,268 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Types de bases de données supportés
+const (
+	DatabasePostgres = "postgres"
+	DatabaseMySQL    = "mysql"
+	DatabaseSQLite   = "sqlite"
+)
+
+// Tag ajouté à tous les snapshots de bases de données
+const DatabaseTag = "database"
+
+// Taille maximale conservée de la sortie d'erreur d'un outil de dump
+const maxDumpStderr = 4 * 1024
+
+// DatabaseSource décrit une base de données sauvegardée par dump.
+// Le dump est envoyé directement à restic (--stdin) sans fichier temporaire.
+type DatabaseSource struct {
+	// Nom de la source, utilisé pour le fichier du snapshot et les tags
+	Name string
+	// Type : postgres, mysql (MySQL/MariaDB) ou sqlite
+	Type string
+
+	// Connexion (postgres, mysql)
+	Host     string
+	Port     int
+	User     string
+	Password string
+	// Base à sauvegarder ; vide pour mysql = toutes les bases
+	Database string
+
+	// Fichier de la base (sqlite)
+	Path string
+
+	// Exécutable de dump (défaut : pg_dump, mysqldump, sqlite3)
+	Command string
+	// Arguments supplémentaires passés à l'outil de dump
+	Args []string
+	// Tags ajoutés au snapshot
+	Tags []string
+}
+
+// Filename retourne le nom du fichier du dump dans le snapshot
+func (s DatabaseSource) Filename() string {
+	switch s.Type {
+	case DatabasePostgres:
+		// Format custom de pg_dump, restaurable avec pg_restore
+		return s.Name + ".pgdump"
+	default:
+		return s.Name + ".sql"
+	}
+}
+
+// SnapshotTags retourne les tags du snapshot de la source
+func (s DatabaseSource) SnapshotTags() []string {
+	tags := []string{DatabaseTag, "db:" + s.Type, "source:" + s.Name}
+	return append(tags, s.Tags...)
+}
+
+// dumpCommand construit la commande de dump de la source. Le mot de passe
+// est transmis par un fichier 0600 (PGPASSFILE, --defaults-extra-file) :
+// secrets.cleanup doit être appelé après le dump.
+func (s DatabaseSource) dumpCommand(ctx context.Context) (cmd *exec.Cmd, secrets *commandSecrets, err error) {
+	var (
+		name string
+		args []string
+		env  []string
+	)
+	secrets = &commandSecrets{}
+	defer func() {
+		if err != nil {
+			secrets.cleanup()
+		}
+	}()
+
+	switch s.Type {
+	case DatabasePostgres:
+		if s.Database == "" {
+			return nil, nil, fmt.Errorf("base postgres %q: nom de base manquant", s.Name)
+		}
+		name = "pg_dump"
+		args = []string{"--format=custom", "--no-password"}
+		if s.Host != "" {
+			args = append(args, "--host", s.Host)
+		}
+		if s.Port > 0 {
+			args = append(args, "--port", strconv.Itoa(s.Port))
+		}
+		if s.User != "" {
+			args = append(args, "--username", s.User)
+		}
+		args = append(args, s.Args...)
+		args = append(args, "--dbname", s.Database)
+		if s.Password != "" {
+			path, err := secrets.file("pgpass", "*:*:*:*:"+pgpassEscape(s.Password)+"\n")
+			if err != nil {
+				return nil, nil, err
+			}
+			env = append(env, "PGPASSFILE="+path)
+		}
+
+	case DatabaseMySQL:
+		name = "mysqldump"
+		// --defaults-extra-file doit être la première option
+		if s.Password != "" {
+			path, err := secrets.file("my.cnf", "[client]\npassword=\""+mysqlEscape(s.Password)+"\"\n")
+			if err != nil {
+				return nil, nil, err
+			}
+			args = append(args, "--defaults-extra-file="+path)
+		}
+		// --single-transaction : vue cohérente des tables InnoDB sans verrouiller la base
+		args = append(args, "--single-transaction", "--routines", "--triggers", "--events")
+		if s.Host != "" {
+			args = append(args, "--host", s.Host)
+		}
+		if s.Port > 0 {
+			args = append(args, "--port", strconv.Itoa(s.Port))
+		}
+		if s.User != "" {
+			args = append(args, "--user", s.User)
+		}
+		args = append(args, s.Args...)
+		if s.Database != "" {
+			args = append(args, "--databases", s.Database)
+		} else {
+			args = append(args, "--all-databases")
+		}
+
+	case DatabaseSQLite:
+		if s.Path == "" {
+			return nil, nil, fmt.Errorf("base sqlite %q: chemin du fichier manquant", s.Name)
+		}
+		if _, err := os.Stat(s.Path); err != nil {
+			return nil, nil, fmt.Errorf("base sqlite %q: %w", s.Name, err)
+		}
+		name = "sqlite3"
+		// .dump lit la base dans une transaction : export cohérent même si
+		// l'application écrit pendant la sauvegarde
+		args = append([]string{"-readonly"}, s.Args...)
+		args = append(args, s.Path, ".dump")
+
+	default:
+		return nil, nil, fmt.Errorf("base %q: type inconnu %q (postgres, mysql ou sqlite)", s.Name, s.Type)
+	}
+
+	if s.Command != "" {
+		name = s.Command
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("base %q: %s non trouvé: %w", s.Name, name, err)
+	}
+
+	cmd = exec.CommandContext(ctx, path, args...)
+	cmd.Env = childEnv(env...)
+	return cmd, secrets, nil
+}
+
+// pgpassEscape échappe un champ du fichier .pgpass
+func pgpassEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, ":", `\:`).Replace(value)
+}
+
+// mysqlEscape échappe une valeur entre guillemets d'un fichier d'options MySQL
+func mysqlEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value)
+}
+
+// BackupDatabase sauvegarde une base de données en envoyant son dump à restic.
+// Un dump en échec ne produit pas de snapshot.
+func (r *ResticWrapper) BackupDatabase(ctx context.Context, source DatabaseSource) (*BackupResult, error) {
+	result := &BackupResult{
+		Timestamp:     time.Now(),
+		StdinFilename: source.Filename(),
+		Tags:          source.SnapshotTags(),
+	}
+
+	slog.Info("🗄️  Sauvegarde de base de données", "name", source.Name, "type", source.Type)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cmd, secrets, err := source.dumpCommand(ctx)
+	if err != nil {
+		result.Error = err.Error()
+		return result, err
+	}
+	defer secrets.cleanup()
+
+	dump, err := startDump(cmd)
+	if err != nil {
+		result.Error = fmt.Sprintf("base %q: %v", source.Name, err)
+		return result, errors.New(result.Error)
+	}
+	// En cas d'échec de restic, l'outil de dump est arrêté
+	defer dump.close()
+
+	return r.BackupStream(ctx, source.Filename(), dump, source.SnapshotTags())
+}
+
+// dumpReader lit la sortie d'un outil de dump et ne signale la fin du flux
+// que si l'outil s'est terminé avec succès
+type dumpReader struct {
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	stderr *bytes.Buffer
+	done   bool
+}
+
+// startDump démarre l'outil de dump
+func startDump(cmd *exec.Cmd) (*dumpReader, error) {
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	d := &dumpReader{cmd: cmd, stdout: stdout, stderr: &bytes.Buffer{}}
+	cmd.Stderr = d.stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *dumpReader) Read(p []byte) (int, error) {
+	n, err := d.stdout.Read(p)
+	if err != io.EOF {
+		return n, err
+	}
+
+	// Fin de la sortie : le code de retour décide si le dump est complet
+	d.done = true
+	if waitErr := d.cmd.Wait(); waitErr != nil {
+		name := filepath.Base(d.cmd.Path)
+		if msg := strings.TrimSpace(tail(d.stderr.String(), maxDumpStderr)); msg != "" {
+			return n, fmt.Errorf("%s: %v - %s", name, waitErr, msg)
+		}
+		return n, fmt.Errorf("%s: %v", name, waitErr)
+	}
+	return n, io.EOF
+}
+
+// close arrête l'outil de dump s'il tourne encore
+func (d *dumpReader) close() {
+	if d.done {
+		return
+	}
+	d.done = true
+	if d.cmd.Process != nil {
+		d.cmd.Process.Kill()
+	}
+	d.cmd.Wait()
+}
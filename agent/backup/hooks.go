@@ -0,0 +1,147 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+const (
+	// Délai par défaut d'un hook
+	DefaultHookTimeout = 5 * time.Minute
+
+	// Taille maximale de sortie conservée par hook (fin de la sortie)
+	maxHookOutput = 16 * 1024
+)
+
+// Phases d'exécution des hooks
+const (
+	HookPreBackup  = "pre_backup"
+	HookPostBackup = "post_backup"
+	HookOnFailure  = "on_failure"
+)
+
+// HookSet décrit les commandes exécutées autour d'une sauvegarde
+type HookSet struct {
+	// Commandes avant la sauvegarde (arrêt d'un logiciel, dump...)
+	PreBackup []string
+	// Commandes après la sauvegarde, réussie ou non
+	PostBackup []string
+	// Commandes exécutées uniquement en cas d'échec
+	OnFailure []string
+	// Délai maximal par commande
+	Timeout time.Duration
+	// Si vrai, l'échec d'un hook pré-sauvegarde annule la sauvegarde ; sinon simple avertissement
+	AbortOnPreFailure bool
+}
+
+// HookResult représente l'exécution d'un hook
+type HookResult struct {
+	Phase    string  `json:"phase"`
+	Command  string  `json:"command"`
+	Success  bool    `json:"success"`
+	ExitCode int     `json:"exit_code"`
+	Output   string  `json:"output,omitempty"`
+	Duration float64 `json:"duration_seconds"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// runHooks exécute les commandes d'une phase dans l'ordre et s'arrête au premier échec.
+// env est ajouté à l'environnement des commandes.
+func runHooks(phase string, commands []string, timeout time.Duration, env []string) ([]HookResult, error) {
+	if timeout <= 0 {
+		timeout = DefaultHookTimeout
+	}
+
+	var results []HookResult
+	for _, command := range commands {
+		result := runHook(phase, command, timeout, env)
+		results = append(results, result)
+
+		if !result.Success {
+			slog.Warn("⚠️  Hook en échec", "phase", phase, "command", command, "error", result.Error)
+			return results, fmt.Errorf("hook %s %q: %s", phase, command, result.Error)
+		}
+		slog.Info("🪝 Hook exécuté", "phase", phase, "command", command,
+			"duration", fmt.Sprintf("%.1fs", result.Duration))
+	}
+	return results, nil
+}
+
+// runHook exécute une commande via le shell du système avec un délai maximal
+func runHook(phase, command string, timeout time.Duration, env []string) HookResult {
+	start := time.Now()
+	result := HookResult{Phase: phase, Command: command}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	// Environnement minimal : les hooks n'héritent pas des secrets de l'agent
+	cmd.Env = childEnv(append(env, "MONREMPART_HOOK_PHASE="+phase)...)
+	// Au délai dépassé, le shell et ses enfants sont terminés ;
+	// WaitDelay évite de rester bloqué sur une sortie restée ouverte
+	killProcessGroup(cmd)
+	cmd.WaitDelay = 5 * time.Second
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	err := cmd.Run()
+	result.Duration = time.Since(start).Seconds()
+	result.Output = tail(output.String(), maxHookOutput)
+
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		result.ExitCode = -1
+		result.Error = fmt.Sprintf("délai dépassé (%s)", timeout)
+	case err != nil:
+		result.ExitCode = -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			result.ExitCode = exitErr.ExitCode()
+		}
+		result.Error = err.Error()
+	default:
+		result.Success = true
+	}
+
+	return result
+}
+
+// outcomeEnv décrit le résultat d'une sauvegarde pour les hooks post-sauvegarde
+func outcomeEnv(result *BackupResult) []string {
+	status := "success"
+	if !result.Success {
+		status = "failed"
+	}
+	return []string{
+		"MONREMPART_BACKUP_STATUS=" + status,
+		"MONREMPART_SNAPSHOT_ID=" + result.SnapshotID,
+		"MONREMPART_BYTES_ADDED=" + strconv.FormatInt(result.BytesAdded, 10),
+		"MONREMPART_BYTES_PROCESSED=" + strconv.FormatInt(result.BytesProcessed, 10),
+		"MONREMPART_FILES_NEW=" + strconv.Itoa(result.FilesNew),
+		"MONREMPART_FILES_CHANGED=" + strconv.Itoa(result.FilesChanged),
+		"MONREMPART_BACKUP_ERROR=" + result.Error,
+	}
+}
+
+// tail retourne les max derniers octets de s
+func tail(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return "…" + s[len(s)-max:]
+}
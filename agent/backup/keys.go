@@ -0,0 +1,231 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Utilisateur restic des clés de secours détenues par le client
+const RecoveryKeyUser = "recovery"
+
+// Key représente une clé (mot de passe) du dépôt
+type Key struct {
+	ID       string `json:"id"`
+	UserName string `json:"userName"`
+	HostName string `json:"hostName"`
+	// Date de création au format restic (2006-01-02 15:04:05)
+	Created string `json:"created"`
+	// Clé utilisée par l'agent
+	Current bool `json:"current"`
+}
+
+// KeyRotation représente le résultat d'un changement de mot de passe du dépôt
+type KeyRotation struct {
+	Success  bool   `json:"success"`
+	OldKeyID string `json:"old_key_id,omitempty"`
+	NewKeyID string `json:"new_key_id,omitempty"`
+	// Ancienne clé conservée (dépôt en ajout seul ou suppression en échec)
+	OldKeyKept bool      `json:"old_key_kept,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// ListKeys retourne les clés du dépôt
+func (r *ResticWrapper) ListKeys() ([]Key, error) {
+	stdout, stderr, err := r.runCommand("key", "list", "--json")
+	if err != nil {
+		return nil, fmt.Errorf("échec liste des clés: %w - %s", err, strings.TrimSpace(stderr))
+	}
+
+	var keys []Key
+	if err := json.Unmarshal([]byte(stdout), &keys); err != nil {
+		return nil, fmt.Errorf("échec parsing clés: %w", err)
+	}
+	return keys, nil
+}
+
+// currentKey retourne la clé correspondant au mot de passe utilisé
+func (r *ResticWrapper) currentKey() (*Key, []Key, error) {
+	keys, err := r.ListKeys()
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range keys {
+		if keys[i].Current {
+			return &keys[i], keys, nil
+		}
+	}
+	return nil, keys, fmt.Errorf("clé courante introuvable")
+}
+
+// AddKey ajoute une clé au dépôt et retourne son ID.
+// Le mot de passe est transmis sur l'entrée standard de restic, jamais en argument.
+func (r *ResticWrapper) AddKey(password, user, host string) (string, error) {
+	if password == "" {
+		return "", fmt.Errorf("mot de passe vide")
+	}
+
+	_, before, err := r.currentKey()
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"key", "add"}
+	if user != "" {
+		args = append(args, "--user", user)
+	}
+	if host != "" {
+		args = append(args, "--host", host)
+	}
+
+	cmd, secrets, err := r.command(context.Background(), args...)
+	if err != nil {
+		return "", err
+	}
+	defer secrets.cleanup()
+	cmd.Stdin = strings.NewReader(password + "\n")
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("échec ajout de clé: %w - %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	// La nouvelle clé est celle absente de la liste précédente
+	after, err := r.ListKeys()
+	if err != nil {
+		return "", err
+	}
+	if id := newKeyID(before, after); id != "" {
+		slog.Info("🔑 Clé ajoutée au dépôt", "key", shortKeyID(id), "user", user)
+		return id, nil
+	}
+	return "", fmt.Errorf("clé ajoutée introuvable")
+}
+
+// RemoveKey supprime une clé du dépôt (jamais la clé courante)
+func (r *ResticWrapper) RemoveKey(id string) error {
+	if IsAppendOnly(r.backend) {
+		return fmt.Errorf("suppression de clé impossible: dépôt en ajout seul")
+	}
+
+	_, stderr, err := r.runCommand("key", "remove", id)
+	if err != nil {
+		return fmt.Errorf("échec suppression de clé %s: %w - %s", shortKeyID(id), err, strings.TrimSpace(stderr))
+	}
+	slog.Info("🗑️  Clé supprimée du dépôt", "key", shortKeyID(id))
+	return nil
+}
+
+// ChangePassword remplace directement la clé courante (restic key passwd).
+// Sans étape de vérification : préférer RotatePassword.
+func (r *ResticWrapper) ChangePassword(password string) error {
+	cmd, secrets, err := r.command(context.Background(), "key", "passwd")
+	if err != nil {
+		return err
+	}
+	defer secrets.cleanup()
+	cmd.Stdin = strings.NewReader(password + "\n")
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("échec changement de mot de passe: %w - %s", err, strings.TrimSpace(stderr.String()))
+	}
+	r.config.ResticPassword = password
+	return nil
+}
+
+// RotatePassword remplace le mot de passe du dépôt sans risque de perte d'accès :
+// ajout de la nouvelle clé, vérification de l'accès avec celle-ci, puis
+// suppression de l'ancienne. En cas d'échec de la vérification, la nouvelle
+// clé est retirée et l'ancien mot de passe reste valide.
+func (r *ResticWrapper) RotatePassword(newPassword, host string) (*KeyRotation, error) {
+	result := &KeyRotation{Timestamp: time.Now()}
+	fail := func(err error) (*KeyRotation, error) {
+		result.Error = err.Error()
+		slog.Error("❌ Rotation de clé échouée", "error", err)
+		return result, err
+	}
+
+	slog.Info("🔑 Rotation du mot de passe du dépôt...")
+
+	oldKey, _, err := r.currentKey()
+	if err != nil {
+		return fail(err)
+	}
+	result.OldKeyID = oldKey.ID
+
+	// 1. Ajout de la nouvelle clé
+	newID, err := r.AddKey(newPassword, oldKey.UserName, host)
+	if err != nil {
+		return fail(err)
+	}
+	result.NewKeyID = newID
+
+	// 2. Vérification : le dépôt s'ouvre avec la nouvelle clé
+	candidate := *r
+	candidate.config.ResticPassword = newPassword
+	current, _, err := candidate.currentKey()
+	if err == nil && current.ID != newID {
+		err = fmt.Errorf("clé %s utilisée au lieu de %s", shortKeyID(current.ID), shortKeyID(newID))
+	}
+	if err != nil {
+		// Retour arrière : l'ancienne clé reste la seule valide
+		if rbErr := r.RemoveKey(newID); rbErr != nil {
+			slog.Warn("⚠️  Nouvelle clé non retirée", "key", shortKeyID(newID), "error", rbErr)
+		}
+		result.NewKeyID = ""
+		return fail(fmt.Errorf("vérification de la nouvelle clé: %w", err))
+	}
+
+	// À partir d'ici, le nouveau mot de passe est le bon
+	r.config.ResticPassword = newPassword
+	result.Success = true
+
+	// 3. Suppression de l'ancienne clé avec le nouveau mot de passe
+	if err := r.RemoveKey(oldKey.ID); err != nil {
+		result.OldKeyKept = true
+		result.Error = err.Error()
+		slog.Warn("⚠️  Ancienne clé conservée", "key", shortKeyID(oldKey.ID), "error", err)
+	}
+
+	slog.Info("   ✅ Mot de passe du dépôt changé", "key", shortKeyID(newID))
+	return result, nil
+}
+
+// Password retourne le mot de passe qui ouvre le dépôt, à conserver localement
+// tant que le Dashboard ne le connaît pas (rotation non confirmée)
+func (r *ResticWrapper) Password() string {
+	return r.config.ResticPassword
+}
+
+// AddRecoveryKey ajoute une clé de secours détenue par le client, qui lui
+// permet de lire ses sauvegardes sans le Dashboard
+func (r *ResticWrapper) AddRecoveryKey(password, host string) (string, error) {
+	return r.AddKey(password, RecoveryKeyUser, host)
+}
+
+// newKeyID retourne l'ID présent dans after mais pas dans before
+func newKeyID(before, after []Key) string {
+	known := make(map[string]bool, len(before))
+	for _, k := range before {
+		known[k.ID] = true
+	}
+	for _, k := range after {
+		if !known[k.ID] {
+			return k.ID
+		}
+	}
+	return ""
+}
+
+// shortKeyID retourne l'ID court d'une clé, pour les logs
+func shortKeyID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
@@ -0,0 +1,163 @@
+package backup
+
+import (
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// Nombre d'éléments conservés dans les classements de l'aperçu
+	previewTopN = 10
+
+	// Nombre de fichiers mémorisés avant de réduire la liste au classement
+	previewCompactAt = 1000
+
+	// Profondeur des dossiers agrégés sous chaque racine sauvegardée
+	previewDirDepth = 2
+
+	// Octets par Go facturé (les hébergeurs S3 facturent en Go décimaux)
+	bytesPerBilledGB = 1000 * 1000 * 1000
+)
+
+// BackupPreview résume une sauvegarde simulée (restic backup --dry-run)
+type BackupPreview struct {
+	FilesTotal    int   `json:"files_total"`
+	BytesTotal    int64 `json:"bytes_total"`
+	FilesNew      int   `json:"files_new"`
+	FilesChanged  int   `json:"files_changed"`
+	BytesToUpload int64 `json:"bytes_to_upload"`
+
+	LargestDirs  []PreviewEntry `json:"largest_dirs"`
+	LargestFiles []PreviewEntry `json:"largest_files"`
+
+	// Estimation du coût de stockage mensuel
+	PricePerGBMonth      float64 `json:"price_per_gb_month_eur"`
+	EstimatedMonthlyCost float64 `json:"estimated_monthly_cost_eur"`
+
+	roots []string
+	dirs  map[string]*PreviewEntry
+	files []PreviewEntry
+}
+
+// PreviewEntry représente un fichier ou un dossier de l'aperçu
+type PreviewEntry struct {
+	Path  string `json:"path"`
+	Bytes int64  `json:"bytes"`
+	Files int    `json:"files,omitempty"`
+}
+
+// resticVerboseStatus représente une ligne verbose_status de restic backup --json -vv
+type resticVerboseStatus struct {
+	MessageType string `json:"message_type"`
+	Action      string `json:"action"`
+	Item        string `json:"item"`
+	DataSize    int64  `json:"data_size"`
+}
+
+// newBackupPreview prépare un aperçu pour les chemins sauvegardés
+func newBackupPreview(targetPaths []string) *BackupPreview {
+	p := &BackupPreview{
+		dirs: make(map[string]*PreviewEntry),
+	}
+	for _, t := range targetPaths {
+		if abs, err := filepath.Abs(t); err == nil {
+			t = abs
+		}
+		p.roots = append(p.roots, strings.TrimSuffix(filepath.ToSlash(t), "/"))
+	}
+	return p
+}
+
+// addItem comptabilise un fichier rapporté par restic
+func (p *BackupPreview) addItem(status resticVerboseStatus) {
+	// Les dossiers sont rapportés avec un / final
+	if status.Item == "" || strings.HasSuffix(status.Item, "/") {
+		return
+	}
+
+	item := status.Item
+	p.files = append(p.files, PreviewEntry{Path: item, Bytes: status.DataSize})
+	// Seuls les plus gros fichiers sont utiles : on borne la mémoire utilisée
+	if len(p.files) >= previewCompactAt {
+		p.files = topEntries(p.files)
+	}
+
+	dir := p.aggregateDir(item)
+	entry, ok := p.dirs[dir]
+	if !ok {
+		entry = &PreviewEntry{Path: dir}
+		p.dirs[dir] = entry
+	}
+	entry.Bytes += status.DataSize
+	entry.Files++
+}
+
+// aggregateDir retourne le dossier de regroupement d'un fichier :
+// son ancêtre situé au plus previewDirDepth niveaux sous la racine sauvegardée
+func (p *BackupPreview) aggregateDir(item string) string {
+	dir := path.Dir(item)
+
+	for _, root := range p.roots {
+		// restic préfixe les chemins Windows par /C/ au lieu de C:/
+		candidates := []string{root}
+		if len(root) > 2 && root[1] == ':' {
+			candidates = append(candidates, "/"+root[:1]+root[2:])
+		}
+
+		for _, r := range candidates {
+			if dir != r && !strings.HasPrefix(dir, r+"/") {
+				continue
+			}
+			rel := strings.TrimPrefix(strings.TrimPrefix(dir, r), "/")
+			if rel == "" {
+				return r
+			}
+			parts := strings.Split(rel, "/")
+			if len(parts) > previewDirDepth {
+				parts = parts[:previewDirDepth]
+			}
+			return r + "/" + strings.Join(parts, "/")
+		}
+	}
+
+	return dir
+}
+
+// finalize complète l'aperçu avec le résumé restic et établit les classements
+func (p *BackupPreview) finalize(summary resticSummary) {
+	p.FilesTotal = summary.TotalFilesProcessed
+	p.BytesTotal = summary.TotalBytesProcessed
+	p.FilesNew = summary.FilesNew
+	p.FilesChanged = summary.FilesChanged
+	p.BytesToUpload = summary.DataAdded
+
+	p.LargestFiles = topEntries(p.files)
+
+	dirs := make([]PreviewEntry, 0, len(p.dirs))
+	for _, d := range p.dirs {
+		dirs = append(dirs, *d)
+	}
+	p.LargestDirs = topEntries(dirs)
+}
+
+// EstimateCost calcule le coût mensuel estimé du stockage des données envoyées
+func (p *BackupPreview) EstimateCost(pricePerGBMonth float64) {
+	p.PricePerGBMonth = pricePerGBMonth
+	p.EstimatedMonthlyCost = float64(p.BytesToUpload) / bytesPerBilledGB * pricePerGBMonth
+}
+
+// topEntries retourne les previewTopN entrées les plus volumineuses
+func topEntries(entries []PreviewEntry) []PreviewEntry {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Bytes != entries[j].Bytes {
+			return entries[i].Bytes > entries[j].Bytes
+		}
+		return entries[i].Path < entries[j].Path
+	})
+	if len(entries) > previewTopN {
+		entries = entries[:previewTopN]
+	}
+	return append([]PreviewEntry{}, entries...)
+}
@@ -0,0 +1,46 @@
+//go:build !windows
+
+package backup
+
+import (
+	"context"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"syscall"
+)
+
+// killProcessGroup place la commande dans son propre groupe de processus et,
+// à l'expiration du contexte, termine tout le groupe (shell et processus enfants)
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// priorityCommand prépare une commande lancée par ionice (Linux) et nice :
+// la priorité est fixée avant le démarrage, tous les threads en héritent.
+// Sans ces outils, la commande garde la priorité de l'agent.
+func priorityCommand(ctx context.Context, p Priority, name string, args ...string) *exec.Cmd {
+	var prefix []string
+	if runtime.GOOS == "linux" && p.IOClass != "" && p.IOClass != "normal" {
+		if ionice, err := exec.LookPath("ionice"); err == nil {
+			// -t : priorité ignorée si le noyau la refuse (conteneur...)
+			class := []string{"-t", "-c", "2", "-n", "7"}
+			if p.IOClass == "idle" {
+				class = []string{"-t", "-c", "3"}
+			}
+			prefix = append(append(prefix, ionice), class...)
+		}
+	}
+	if p.Nice > 0 {
+		if nice, err := exec.LookPath("nice"); err == nil {
+			prefix = append(prefix, nice, "-n", strconv.Itoa(p.Nice))
+		}
+	}
+	if len(prefix) == 0 {
+		return exec.CommandContext(ctx, name, args...)
+	}
+	return exec.CommandContext(ctx, prefix[0], append(append(prefix[1:], name), args...)...)
+}
@@ -0,0 +1,26 @@
+//go:build windows
+
+package backup
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+)
+
+// Classe de priorité « inférieure à la normale » (CreateProcess)
+const belowNormalPriorityClass = 0x00004000
+
+// killProcessGroup : sous Windows, seul le processus principal est terminé
+// (WaitDelay évite de rester bloqué sur les processus enfants)
+func killProcessGroup(cmd *exec.Cmd) {}
+
+// priorityCommand prépare une commande en priorité inférieure à la normale
+// si une priorité processeur est demandée (pas de priorité disque)
+func priorityCommand(ctx context.Context, p Priority, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	if p.Nice > 0 {
+		cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: belowNormalPriorityClass}
+	}
+	return cmd
+}
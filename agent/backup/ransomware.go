@@ -0,0 +1,421 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Tags des snapshots liés à la détection de rançongiciel
+const (
+	// SuspectTag marque un snapshot pris pendant une attaque probable
+	SuspectTag = "suspect"
+	// ProtectedTag soustrait un snapshot à la rétention (restic forget --keep-tag)
+	ProtectedTag = "protected"
+)
+
+// Seuils de l'analyse
+const (
+	// Octets lus en tête de fichier pour l'entropie
+	entropySampleSize = 64 * 1024
+	// Entropie (bits/octet) d'un contenu chiffré, et d'un contenu encore lisible
+	highEntropy = 7.9
+	lowEntropy  = 7.5
+	// Pic de modifications : part minimale de fichiers modifiés, multiple de
+	// l'historique et nombre minimal de fichiers
+	spikeMinRatio    = 0.2
+	spikeFactor      = 4.0
+	spikeMinFiles    = 20
+	spikeMinHistory  = 3
+	ratioHistorySize = 10
+	// Fichiers cités en exemple dans un signal
+	maxSignalFiles = 10
+)
+
+// Extensions ajoutées par des rançongiciels connus
+var ransomwareExtensions = map[string]bool{
+	".locked": true, ".locky": true, ".crypt": true, ".crypted": true, ".crypto": true,
+	".encrypted": true, ".enc1": true, ".cry": true, ".cerber": true, ".cerber3": true,
+	".zepto": true, ".odin": true, ".thor": true, ".aesir": true, ".wncry": true,
+	".wnry": true, ".wcry": true, ".ryk": true, ".ryuk": true, ".conti": true,
+	".lockbit": true, ".akira": true, ".blackcat": true, ".phobos": true, ".djvu": true,
+	".stop": true, ".makop": true, ".clop": true, ".hive": true, ".basta": true,
+	".royal": true, ".medusa": true, ".8base": true, ".dharma": true, ".wallet": true,
+}
+
+// Fragments des noms de notes de rançon (en minuscules)
+var ransomNotePatterns = []string{
+	"how_to_decrypt", "how-to-decrypt", "how to decrypt", "decrypt_instructions",
+	"decrypt-instructions", "decryption_instructions", "how_to_restore", "how-to-restore",
+	"restore_files", "restore-my-files", "recover_files", "recover-files", "help_decrypt",
+	"readme_for_decrypt", "read_me_to_decrypt", "!!!readme", "_readme.txt", "readme.hta",
+	"#decrypt", "files_encrypted", "ransom",
+}
+
+// Signatures d'en-tête des documents analysés, par extension (nil : texte sans signature)
+var documentMagic = map[string][]byte{
+	".docx": []byte("PK\x03\x04"), ".xlsx": []byte("PK\x03\x04"), ".pptx": []byte("PK\x03\x04"),
+	".odt": []byte("PK\x03\x04"), ".ods": []byte("PK\x03\x04"),
+	".doc": {0xD0, 0xCF, 0x11, 0xE0}, ".xls": {0xD0, 0xCF, 0x11, 0xE0},
+	".pdf": []byte("%PDF"),
+	".txt": nil, ".csv": nil, ".rtf": []byte("{\\rtf"),
+}
+
+// RansomwareSignal est un indice relevé par l'analyse
+type RansomwareSignal struct {
+	Kind   string   `json:"kind"` // change_spike, entropy, extension, ransom_note
+	Score  int      `json:"score"`
+	Detail string   `json:"detail"`
+	Files  []string `json:"files,omitempty"`
+}
+
+// RansomwareReport est le résultat de l'analyse des fichiers avant sauvegarde
+type RansomwareReport struct {
+	Score        int                `json:"score"` // 0 à 100
+	Threshold    int                `json:"threshold"`
+	Suspect      bool               `json:"suspect"`
+	Signals      []RansomwareSignal `json:"signals,omitempty"`
+	FilesScanned int                `json:"files_scanned"`
+	FilesChanged int                `json:"files_changed"`
+	ChangeRatio  float64            `json:"change_ratio"`
+	Baseline     float64            `json:"baseline_ratio"` // Part habituelle de fichiers modifiés
+	Duration     float64            `json:"duration_seconds"`
+	Timestamp    time.Time          `json:"timestamp"`
+}
+
+// fileFingerprint résume un fichier entre deux analyses
+type fileFingerprint struct {
+	Size    int64   `json:"s"`
+	ModTime int64   `json:"m"`
+	Entropy float64 `json:"e,omitempty"` // Documents uniquement
+	Magic   bool    `json:"h,omitempty"` // En-tête conforme au format
+}
+
+// ransomwareState est l'index des fichiers et l'historique des modifications
+type ransomwareState struct {
+	Files     map[string]fileFingerprint `json:"files"`
+	Ratios    []float64                  `json:"ratios,omitempty"`
+	UpdatedAt time.Time                  `json:"updated_at"`
+}
+
+// RansomwareDetector compare les fichiers à sauvegarder avec l'analyse précédente
+type RansomwareDetector struct {
+	statePath string
+	threshold int
+}
+
+// NewRansomwareDetector crée un détecteur dont l'index est conservé dans statePath
+func NewRansomwareDetector(statePath string, threshold int) *RansomwareDetector {
+	return &RansomwareDetector{statePath: statePath, threshold: threshold}
+}
+
+// Analyze parcourt les chemins à sauvegarder et calcule le score de l'attaque
+// probable. L'index est mis à jour à chaque analyse ; l'historique des
+// modifications n'intègre pas une analyse suspecte. La première analyse ne
+// sert que de référence.
+func (d *RansomwareDetector) Analyze(paths, excludes []string) (*RansomwareReport, error) {
+	start := time.Now()
+	report := &RansomwareReport{Threshold: d.threshold, Timestamp: start}
+
+	previous, err := d.load()
+	if err != nil {
+		slog.Warn("⚠️  Index de détection réinitialisé", "error", err)
+		previous = &ransomwareState{}
+	}
+	current := &ransomwareState{Files: make(map[string]fileFingerprint), Ratios: previous.Ratios}
+
+	var entropyFiles, extensionFiles, noteFiles []string
+	noteDirs := make(map[string]bool)
+
+	for _, root := range paths {
+		walkErr := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return nil // Fichier illisible : restic le signalera
+			}
+			if MatchesExclude(path, excludes) {
+				if entry.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !entry.Type().IsRegular() {
+				return nil
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return nil
+			}
+
+			report.FilesScanned++
+			fp := fileFingerprint{Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+			old, known := previous.Files[path]
+			changed := !known || old.Size != fp.Size || old.ModTime != fp.ModTime
+			ext := strings.ToLower(filepath.Ext(path))
+
+			if magic, isDoc := documentMagic[ext]; isDoc {
+				if changed {
+					fp.Entropy, fp.Magic = sampleFile(path, magic)
+				} else {
+					fp.Entropy, fp.Magic = old.Entropy, old.Magic
+				}
+				// Document lisible devenu chiffré : entropie maximale et en-tête perdu
+				if changed && known && fp.Entropy >= highEntropy && (old.Entropy < lowEntropy || (old.Magic && !fp.Magic)) {
+					entropyFiles = append(entropyFiles, path)
+				}
+			}
+			current.Files[path] = fp
+
+			if !changed {
+				return nil
+			}
+			if known {
+				report.FilesChanged++
+			}
+			if ransomwareExtensions[ext] {
+				extensionFiles = append(extensionFiles, path)
+			}
+			if isRansomNote(entry.Name()) {
+				noteFiles = append(noteFiles, path)
+				noteDirs[filepath.Dir(path)] = true
+			}
+			return nil
+		})
+		if walkErr != nil {
+			return nil, fmt.Errorf("analyse de %s: %w", root, walkErr)
+		}
+	}
+
+	// Fichiers disparus (renommés avec une autre extension, supprimés) : comptés
+	// comme modifiés. Ceux des chemins non analysés cette fois (sauvegarde d'une
+	// partie des dossiers) restent dans l'index.
+	for path, fp := range previous.Files {
+		if _, ok := current.Files[path]; ok {
+			continue
+		}
+		if underAny(path, paths) {
+			report.FilesChanged++
+		} else {
+			current.Files[path] = fp
+		}
+	}
+
+	// Première analyse de ces chemins : simple référence
+	total := 0
+	for path := range previous.Files {
+		if underAny(path, paths) {
+			total++
+		}
+	}
+	firstScan := total == 0
+	if !firstScan {
+		if report.FilesScanned > total {
+			total = report.FilesScanned
+		}
+		report.ChangeRatio = float64(report.FilesChanged) / float64(total)
+		report.Baseline = average(previous.Ratios)
+
+		if len(previous.Ratios) >= spikeMinHistory && report.FilesChanged >= spikeMinFiles &&
+			report.ChangeRatio >= spikeMinRatio && report.ChangeRatio >= spikeFactor*math.Max(report.Baseline, 0.01) {
+			report.Signals = append(report.Signals, RansomwareSignal{
+				Kind:   "change_spike",
+				Score:  40,
+				Detail: fmt.Sprintf("%.0f%% des fichiers modifiés (habituellement %.1f%%)", report.ChangeRatio*100, report.Baseline*100),
+			})
+		}
+		if len(entropyFiles) > 0 {
+			report.Signals = append(report.Signals, RansomwareSignal{
+				Kind:   "entropy",
+				Score:  min(50, 10*len(entropyFiles)),
+				Detail: fmt.Sprintf("%d document(s) devenu(s) illisible(s) (contenu d'apparence chiffrée)", len(entropyFiles)),
+				Files:  firstFiles(entropyFiles),
+			})
+		}
+	}
+	if len(extensionFiles) > 0 {
+		report.Signals = append(report.Signals, RansomwareSignal{
+			Kind:   "extension",
+			Score:  min(60, 20*len(extensionFiles)),
+			Detail: fmt.Sprintf("%d fichier(s) avec une extension de rançongiciel connue", len(extensionFiles)),
+			Files:  firstFiles(extensionFiles),
+		})
+	}
+	if len(noteFiles) > 0 {
+		score := 40
+		if len(noteDirs) >= 3 {
+			score = 60 // Note déposée dans chaque dossier
+		}
+		report.Signals = append(report.Signals, RansomwareSignal{
+			Kind:   "ransom_note",
+			Score:  score,
+			Detail: fmt.Sprintf("%d note(s) de rançon probable(s) dans %d dossier(s)", len(noteFiles), len(noteDirs)),
+			Files:  firstFiles(noteFiles),
+		})
+	}
+
+	for _, s := range report.Signals {
+		report.Score += s.Score
+	}
+	report.Score = min(report.Score, 100)
+	report.Suspect = report.Score >= d.threshold
+	report.Duration = time.Since(start).Seconds()
+
+	// Une analyse suspecte ne doit pas relever la référence des modifications
+	if !firstScan && !report.Suspect {
+		current.Ratios = append(current.Ratios, report.ChangeRatio)
+		if len(current.Ratios) > ratioHistorySize {
+			current.Ratios = current.Ratios[len(current.Ratios)-ratioHistorySize:]
+		}
+	}
+	current.UpdatedAt = start
+	if err := d.save(current); err != nil {
+		slog.Warn("⚠️  Index de détection non enregistré", "error", err)
+	}
+
+	return report, nil
+}
+
+// load lit l'index de l'analyse précédente (absent : première analyse)
+func (d *RansomwareDetector) load() (*ransomwareState, error) {
+	data, err := os.ReadFile(d.statePath)
+	if os.IsNotExist(err) {
+		return &ransomwareState{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state ransomwareState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// save écrit l'index de façon atomique
+func (d *RansomwareDetector) save(state *ransomwareState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := d.statePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, d.statePath)
+}
+
+// sampleFile retourne l'entropie de Shannon (bits/octet) du début d'un fichier
+// et la conformité de son en-tête au format attendu
+func sampleFile(path string, magic []byte) (float64, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	buf := make([]byte, entropySampleSize)
+	n, _ := io.ReadFull(f, buf)
+	buf = buf[:n]
+	if n == 0 {
+		return 0, magic == nil
+	}
+	return shannonEntropy(buf), magic == nil || bytes.HasPrefix(buf, magic)
+}
+
+// shannonEntropy calcule l'entropie d'un échantillon : 8 pour des octets
+// aléatoires. La correction de Miller-Madow compense la sous-estimation sur
+// les petits fichiers (un fichier chiffré de 1 Ko mesure environ 7,8 sans elle).
+func shannonEntropy(data []byte) float64 {
+	var counts [256]int
+	for _, b := range data {
+		counts[b]++
+	}
+	entropy := 0.0
+	distinct := 0
+	size := float64(len(data))
+	for _, c := range counts {
+		if c == 0 {
+			continue
+		}
+		distinct++
+		p := float64(c) / size
+		entropy -= p * math.Log2(p)
+	}
+	entropy += float64(distinct-1) / (2 * size * math.Ln2)
+	return math.Min(entropy, 8)
+}
+
+// isRansomNote indique si un nom de fichier ressemble à une note de rançon
+func isRansomNote(name string) bool {
+	lower := strings.ToLower(name)
+	switch filepath.Ext(lower) {
+	case ".txt", ".html", ".htm", ".hta", ".url", ".png", ".bmp", "":
+	default:
+		return false
+	}
+	for _, pattern := range ransomNotePatterns {
+		if strings.Contains(lower, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesExclude applique approximativement les motifs --exclude de restic
+// (nom du fichier ou chemin complet)
+func MatchesExclude(path string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if pattern == "" {
+			continue
+		}
+		if ok, _ := filepath.Match(pattern, filepath.Base(path)); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+		if strings.HasPrefix(path, strings.TrimSuffix(pattern, string(filepath.Separator))+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// underAny indique si path est l'un des chemins roots ou se trouve sous l'un d'eux
+func underAny(path string, roots []string) bool {
+	for _, root := range roots {
+		if path == root || strings.HasPrefix(path, strings.TrimSuffix(root, string(filepath.Separator))+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// firstFiles retourne les premiers fichiers d'une liste, triée, pour les exemples
+func firstFiles(files []string) []string {
+	sort.Strings(files)
+	if len(files) > maxSignalFiles {
+		return files[:maxSignalFiles]
+	}
+	return files
+}
+
+// average retourne la moyenne d'une série (0 si vide)
+func average(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
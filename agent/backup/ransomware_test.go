@@ -0,0 +1,247 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestShannonEntropy(t *testing.T) {
+	random := make([]byte, entropySampleSize)
+	if _, err := rand.Read(random); err != nil {
+		t.Fatal(err)
+	}
+	smallRandom := make([]byte, 1024)
+	if _, err := rand.Read(smallRandom); err != nil {
+		t.Fatal(err)
+	}
+	text := []byte(strings.Repeat("Compte rendu du conseil municipal du 14 mars. ", 200))
+
+	tests := []struct {
+		name     string
+		data     []byte
+		min, max float64
+	}{
+		{"octet unique", bytes.Repeat([]byte{'a'}, 1000), 0, 0},
+		{"deux octets", bytes.Repeat([]byte{'a', 'b'}, 512), 1, 1.01},
+		{"texte", text, 3, 5},
+		{"aléatoire", random, highEntropy, 8},
+		// Sans la correction, un petit fichier chiffré passerait sous highEntropy
+		{"aléatoire 1 Ko", smallRandom, highEntropy, 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := shannonEntropy(tt.data)
+			if got < tt.min || got > tt.max {
+				t.Errorf("shannonEntropy() = %.4f, attendu entre %.2f et %.2f", got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestIsRansomNote(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"HOW_TO_DECRYPT.txt", true},
+		{"README_FOR_DECRYPT.hta", true},
+		{"restore-my-files.html", true},
+		{"_readme.txt", true},
+		{"RANSOM", true},
+		{"how_to_decrypt.docx", false},
+		{"readme.txt", false},
+		{"budget-2026.xlsx", false},
+	}
+	for _, tt := range tests {
+		if got := isRansomNote(tt.name); got != tt.want {
+			t.Errorf("isRansomNote(%q) = %v, attendu %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMatchesExclude(t *testing.T) {
+	tests := []struct {
+		path     string
+		patterns []string
+		want     bool
+	}{
+		{"/srv/docs/a.tmp", []string{"*.tmp"}, true},
+		{"/srv/docs/cache/a.txt", []string{"/srv/docs/cache"}, true},
+		{"/srv/docs/cache/a.txt", []string{"/srv/docs/cache/"}, true},
+		{"/srv/docs/cachette/a.txt", []string{"/srv/docs/cache"}, false},
+		{"/srv/docs/a.txt", []string{"/srv/*/a.txt"}, true},
+		{"/srv/docs/a.txt", []string{"", "*.log"}, false},
+	}
+	for _, tt := range tests {
+		if got := MatchesExclude(tt.path, tt.patterns); got != tt.want {
+			t.Errorf("MatchesExclude(%q, %q) = %v, attendu %v", tt.path, tt.patterns, got, tt.want)
+		}
+	}
+}
+
+// writeFile crée un fichier de test (dossiers parents compris)
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// randomBytes retourne un contenu d'apparence chiffrée
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// signal retourne le signal d'un type (nil : absent)
+func signal(report *RansomwareReport, kind string) *RansomwareSignal {
+	for i := range report.Signals {
+		if report.Signals[i].Kind == kind {
+			return &report.Signals[i]
+		}
+	}
+	return nil
+}
+
+func TestAnalyzeFirstScanIsReference(t *testing.T) {
+	dir := t.TempDir()
+	docs := filepath.Join(dir, "docs")
+	for i := 0; i < 5; i++ {
+		writeFile(t, filepath.Join(docs, fmt.Sprintf("note-%d.txt", i)), []byte("texte lisible"))
+	}
+	d := NewRansomwareDetector(filepath.Join(dir, "state.json"), 50)
+
+	report, err := d.Analyze([]string{docs}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.FilesScanned != 5 || report.FilesChanged != 0 || report.Score != 0 || report.Suspect {
+		t.Errorf("première analyse = %+v", report)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "state.json")); err != nil {
+		t.Errorf("index non enregistré: %v", err)
+	}
+}
+
+func TestAnalyzeEncryptedDocuments(t *testing.T) {
+	dir := t.TempDir()
+	docs := filepath.Join(dir, "docs")
+	readable := append([]byte("PK\x03\x04"), bytes.Repeat([]byte("contenu du document "), 100)...)
+	for i := 0; i < 3; i++ {
+		writeFile(t, filepath.Join(docs, fmt.Sprintf("rapport-%d.docx", i)), readable)
+	}
+	d := NewRansomwareDetector(filepath.Join(dir, "state.json"), 50)
+	if _, err := d.Analyze([]string{docs}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Documents chiffrés sur place, renommés pour l'un, et note de rançon
+	for i := 0; i < 2; i++ {
+		writeFile(t, filepath.Join(docs, fmt.Sprintf("rapport-%d.docx", i)), randomBytes(t, 4096))
+	}
+	os.Remove(filepath.Join(docs, "rapport-2.docx"))
+	writeFile(t, filepath.Join(docs, "rapport-2.docx.locked"), randomBytes(t, 4096))
+	writeFile(t, filepath.Join(docs, "HOW_TO_DECRYPT.txt"), []byte("payez"))
+
+	report, err := d.Analyze([]string{docs}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"entropy": 20, "extension": 20, "ransom_note": 40}
+	for kind, score := range want {
+		s := signal(report, kind)
+		if s == nil {
+			t.Errorf("signal %s absent: %+v", kind, report.Signals)
+			continue
+		}
+		if s.Score != score {
+			t.Errorf("signal %s: score %d, attendu %d", kind, s.Score, score)
+		}
+	}
+	if report.Score != 80 || !report.Suspect {
+		t.Errorf("score = %d (suspect %v), attendu 80 suspect", report.Score, report.Suspect)
+	}
+}
+
+func TestAnalyzeChangeSpike(t *testing.T) {
+	dir := t.TempDir()
+	docs := filepath.Join(dir, "docs")
+	const files = 50
+	for i := 0; i < files; i++ {
+		writeFile(t, filepath.Join(docs, fmt.Sprintf("f-%02d.dat", i)), []byte("v1"))
+	}
+	d := NewRansomwareDetector(filepath.Join(dir, "state.json"), 40)
+
+	// Référence puis historique de modifications habituelles (aucune)
+	for i := 0; i <= spikeMinHistory; i++ {
+		report, err := d.Analyze([]string{docs}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Score != 0 {
+			t.Fatalf("analyse %d: score %d", i, report.Score)
+		}
+	}
+
+	for i := 0; i < 30; i++ {
+		writeFile(t, filepath.Join(docs, fmt.Sprintf("f-%02d.dat", i)), []byte("version 2"))
+	}
+	report, err := d.Analyze([]string{docs}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := signal(report, "change_spike"); s == nil || report.FilesChanged != 30 || !report.Suspect {
+		t.Fatalf("pic non détecté: %+v", report)
+	}
+
+	// L'analyse suspecte ne relève pas la référence
+	state, err := d.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Ratios) != spikeMinHistory || average(state.Ratios) != 0 {
+		t.Errorf("historique = %v, attendu %d analyses sans modification", state.Ratios, spikeMinHistory)
+	}
+}
+
+func TestAnalyzeExcludesAndPartialPaths(t *testing.T) {
+	dir := t.TempDir()
+	docs := filepath.Join(dir, "docs")
+	other := filepath.Join(dir, "autre")
+	writeFile(t, filepath.Join(docs, "a.txt"), []byte("a"))
+	writeFile(t, filepath.Join(docs, "cache", "b.locked"), []byte("b"))
+	writeFile(t, filepath.Join(other, "c.txt"), []byte("c"))
+	d := NewRansomwareDetector(filepath.Join(dir, "state.json"), 50)
+
+	report, err := d.Analyze([]string{docs, other}, []string{filepath.Join(docs, "cache")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.FilesScanned != 2 || signal(report, "extension") != nil {
+		t.Errorf("dossier exclu analysé: %+v", report)
+	}
+
+	// Sauvegarde d'une partie des dossiers : les autres restent dans l'index
+	if _, err := d.Analyze([]string{docs}, nil); err != nil {
+		t.Fatal(err)
+	}
+	state, err := d.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := state.Files[filepath.Join(other, "c.txt")]; !ok {
+		t.Errorf("fichier hors des chemins analysés retiré de l'index")
+	}
+}
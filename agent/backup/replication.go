@@ -0,0 +1,238 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReplicationResult représente le résultat d'une copie vers le dépôt secondaire
+type ReplicationResult struct {
+	Success bool `json:"success"`
+	// Snapshots du dépôt principal présents dans le dépôt secondaire après la copie
+	Replicated int `json:"replicated"`
+	// Snapshots du dépôt principal absents du dépôt secondaire
+	Missing   int       `json:"missing"`
+	Duration  float64   `json:"duration_seconds"`
+	Error     string    `json:"error,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+
+	// IDs des snapshots principaux présents dans le dépôt secondaire
+	replicated map[string]bool
+}
+
+// NewReplicaWrapper crée le wrapper d'un dépôt secondaire.
+// Un dépôt S3 sans identifiants propres reprend ceux de r : restic copy
+// n'utilise qu'un jeu d'identifiants S3 pour les deux dépôts.
+// Sans mot de passe propre, celui de r est utilisé.
+func (r *ResticWrapper) NewReplicaWrapper(backend Backend, password string) (*ResticWrapper, error) {
+	if s3, ok := backend.(*S3Backend); ok && s3.AccessKeyID == "" {
+		if primary, ok := r.backend.(*S3Backend); ok {
+			s3.AccessKeyID = primary.AccessKeyID
+			s3.SecretAccessKey = primary.SecretAccessKey
+		}
+	}
+	if password == "" {
+		password = r.config.ResticPassword
+	}
+	return NewResticWrapper(ResticConfig{
+		Backend:        backend,
+		ResticPassword: password,
+		Priority:       r.config.Priority,
+	})
+}
+
+// replicaCommand exécute une commande restic sur le dépôt secondaire dst avec r comme source.
+// Les identifiants S3 sont partagés par les deux dépôts (limitation de restic) :
+// ceux de dst sont prioritaires.
+func (r *ResticWrapper) replicaCommand(ctx context.Context, dst *ResticWrapper, args ...string) (string, string, error) {
+	secrets := &commandSecrets{}
+	defer secrets.cleanup()
+
+	fromArgs, fromEnv, err := r.repositoryArgs(secrets, "from-")
+	if err != nil {
+		return "", "", err
+	}
+	dstArgs, dstEnv, err := dst.repositoryArgs(secrets, "")
+	if err != nil {
+		return "", "", err
+	}
+
+	args = append(dstArgs, append(args, fromArgs...)...)
+	cmd := priorityCommand(ctx, r.config.Priority, dst.resticPath, args...)
+	// En cas de doublon, exec retient la dernière valeur : celles de dst
+	cmd.Env = childEnv(append(append(fromEnv, dstEnv...), r.config.Priority.env()...)...)
+	cmd.ExtraFiles = secrets.pipes
+
+	var stdout, stderr strings.Builder
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	return stdout.String(), stderr.String(), err
+}
+
+// InitReplica initialise le dépôt secondaire dst s'il n'existe pas, avec les
+// paramètres de découpage du dépôt principal : sans eux, restic copy ne
+// déduplique pas et renvoie toutes les données.
+func (r *ResticWrapper) InitReplica(ctx context.Context, dst *ResticWrapper) error {
+	slog.Info("📦 Initialisation du dépôt secondaire...", "repository", dst.getRepository())
+
+	if _, _, err := dst.runCommand("cat", "config"); err == nil {
+		slog.Info("   ✅ Dépôt secondaire déjà initialisé")
+		return nil
+	}
+
+	stdout, stderr, err := r.replicaCommand(ctx, dst, "init", "--copy-chunker-params")
+	if err != nil {
+		return fmt.Errorf("échec init dépôt secondaire: %w - %s", err, strings.TrimSpace(stderr))
+	}
+
+	slog.Info("   ✅ Dépôt secondaire initialisé", "output", strings.TrimSpace(stdout))
+	return nil
+}
+
+// CopyTo copie vers dst les snapshots du dépôt principal (tous si aucun ID n'est donné).
+// restic ignore les snapshots déjà copiés : une copie manquée est rattrapée à la suivante.
+func (r *ResticWrapper) CopyTo(ctx context.Context, dst *ResticWrapper, snapshotIDs ...string) (*ReplicationResult, error) {
+	startTime := time.Now()
+	result := &ReplicationResult{Timestamp: startTime}
+
+	slog.Info("🔁 Réplication vers le dépôt secondaire", "snapshots", len(snapshotIDs))
+
+	args := append([]string{"copy"}, snapshotIDs...)
+	_, stderr, err := r.replicaCommand(ctx, dst, args...)
+	result.Duration = time.Since(startTime).Seconds()
+	if err != nil {
+		result.Error = fmt.Sprintf("échec réplication: %s - %s", err.Error(), strings.TrimSpace(stderr))
+		return result, errors.New(result.Error)
+	}
+
+	result.Success = true
+
+	// Bilan : snapshots principaux présents ou non dans le dépôt secondaire
+	sources, err := r.GetSnapshots()
+	if err != nil {
+		slog.Warn("⚠️  Bilan de réplication indisponible", "error", err)
+		return result, nil
+	}
+	copies, err := dst.GetSnapshots()
+	if err != nil {
+		slog.Warn("⚠️  Bilan de réplication indisponible", "error", err)
+		return result, nil
+	}
+
+	result.replicated = make(map[string]bool, len(copies))
+	for _, c := range copies {
+		// restic copy conserve l'ID du snapshot source dans "original"
+		if c.Original != "" {
+			result.replicated[c.Original] = true
+		}
+	}
+	for _, s := range sources {
+		if result.replicated[s.ID] {
+			result.Replicated++
+		} else {
+			result.Missing++
+		}
+	}
+
+	slog.Info("   ✅ Réplication terminée",
+		"replicated", result.Replicated,
+		"missing", result.Missing,
+		"duration", fmt.Sprintf("%.1fs", result.Duration),
+	)
+	return result, nil
+}
+
+// ReplicationState mémorise, par snapshot du dépôt principal, sa copie dans
+// le dépôt secondaire. Elle reste consultable quand le dépôt secondaire est
+// injoignable (disque USB débranché, NAS éteint).
+type ReplicationState struct {
+	// ID du snapshot principal → date à laquelle sa copie a été constatée
+	Snapshots map[string]time.Time `json:"snapshots"`
+
+	LastRun     time.Time `json:"last_run,omitempty"`
+	LastSuccess time.Time `json:"last_success,omitempty"`
+	LastError   string    `json:"last_error,omitempty"`
+
+	mu   sync.Mutex
+	path string
+}
+
+// LoadReplicationState charge l'état de réplication depuis path (vide s'il n'existe pas)
+func LoadReplicationState(path string) (*ReplicationState, error) {
+	state := &ReplicationState{Snapshots: make(map[string]time.Time), path: path}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return state, fmt.Errorf("état de réplication invalide: %w", err)
+	}
+	if state.Snapshots == nil {
+		state.Snapshots = make(map[string]time.Time)
+	}
+	return state, nil
+}
+
+// Record met à jour l'état après une réplication et l'enregistre sur disque
+func (s *ReplicationState) Record(result *ReplicationResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.LastRun = result.Timestamp
+	s.LastError = result.Error
+	if result.Success {
+		s.LastSuccess = result.Timestamp
+	}
+
+	// Sans bilan (échec), l'état connu est conservé
+	if result.replicated != nil {
+		snapshots := make(map[string]time.Time, len(result.replicated))
+		for id := range result.replicated {
+			if t, ok := s.Snapshots[id]; ok {
+				snapshots[id] = t
+			} else {
+				snapshots[id] = result.Timestamp
+			}
+		}
+		s.Snapshots = snapshots
+	}
+	return s.save()
+}
+
+// Replicated indique si un snapshot du dépôt principal a été copié, et quand
+func (s *ReplicationState) Replicated(snapshotID string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.Snapshots[snapshotID]
+	return t, ok
+}
+
+// save écrit l'état sur disque (écriture atomique)
+func (s *ReplicationState) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
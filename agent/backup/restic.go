@@ -3,17 +3,26 @@
 package backup
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 	"time"
 )
 
 // ResticConfig contient la configuration pour se connecter au dépôt Restic
 type ResticConfig struct {
+	// Emplacement du dépôt et identifiants ; si nil, dépôt S3 décrit par les champs S3
+	Backend Backend
+
 	// Endpoint S3 (ex: s3.fr-par.scw.cloud)
 	S3Endpoint string
 	// Nom du bucket
@@ -24,13 +33,36 @@ type ResticConfig struct {
 	AccessKeyID string
 	// Clé secrète S3
 	SecretAccessKey string
+	// Région S3 (optionnelle)
+	S3Region string
 	// Mot de passe de chiffrement du dépôt Restic
 	ResticPassword string
+	// Limites de débit en Kio/s (0 = illimité)
+	LimitUploadKiB   int
+	LimitDownloadKiB int
+	// Part du poste laissée à restic
+	Priority Priority
+}
+
+// Priority abaisse la priorité de restic pour ne pas gêner l'utilisateur du poste
+type Priority struct {
+	Nice     int    // Priorité processeur (nice, 0 : inchangée)
+	IOClass  string // Priorité disque sous Linux : low, idle ou normal (ionice)
+	MaxProcs int    // Processeurs utilisés (GOMAXPROCS, 0 : tous)
+}
+
+// env retourne les variables limitant les processeurs utilisés
+func (p Priority) env() []string {
+	if p.MaxProcs > 0 {
+		return []string{"GOMAXPROCS=" + strconv.Itoa(p.MaxProcs)}
+	}
+	return nil
 }
 
 // ResticWrapper encapsule les opérations Restic
 type ResticWrapper struct {
 	config     ResticConfig
+	backend    Backend
 	resticPath string
 }
 
@@ -46,6 +78,31 @@ type BackupResult struct {
 	Duration        float64   `json:"duration_seconds"`
 	Error           string    `json:"error,omitempty"`
 	Timestamp       time.Time `json:"timestamp"`
+
+	// Mode simulation : aucun snapshot n'est créé
+	DryRun  bool           `json:"dry_run,omitempty"`
+	Preview *BackupPreview `json:"preview,omitempty"`
+
+	// Hooks exécutés autour de la sauvegarde, avec leur sortie
+	Hooks []HookResult `json:"hooks,omitempty"`
+	// Sauvegarde annulée par l'échec d'un hook pré-sauvegarde (AbortOnPreFailure)
+	Aborted bool `json:"aborted,omitempty"`
+
+	// Sauvegarde d'un flux (base de données...) : nom du fichier dans le snapshot et tags
+	StdinFilename string   `json:"stdin_filename,omitempty"`
+	Tags          []string `json:"tags,omitempty"`
+}
+
+// BackupOptions contient les options d'une sauvegarde
+type BackupOptions struct {
+	// Simulation (restic backup --dry-run) : calcule ce qui serait envoyé sans rien écrire
+	DryRun bool
+	// Commandes exécutées avant/après la sauvegarde (ignorées en simulation)
+	Hooks *HookSet
+	// Motifs exclus (restic --exclude)
+	Excludes []string
+	// Tags ajoutés au snapshot (suspect après une détection de rançongiciel...)
+	Tags []string
 }
 
 // Snapshot représente un snapshot Restic
@@ -56,6 +113,8 @@ type Snapshot struct {
 	Hostname string    `json:"hostname"`
 	Paths    []string  `json:"paths"`
 	Tags     []string  `json:"tags,omitempty"`
+	// ID du snapshot source pour un snapshot copié (restic copy)
+	Original string `json:"original,omitempty"`
 }
 
 // resticSummary représente la sortie JSON de restic backup
@@ -84,50 +143,127 @@ func NewResticWrapper(config ResticConfig) (*ResticWrapper, error) {
 		return nil, fmt.Errorf("restic non trouvé dans le PATH: %w", err)
 	}
 
+	backend := config.Backend
+	if backend == nil {
+		backend = &S3Backend{
+			Endpoint:        config.S3Endpoint,
+			Bucket:          config.S3Bucket,
+			Path:            config.S3Path,
+			Region:          config.S3Region,
+			AccessKeyID:     config.AccessKeyID,
+			SecretAccessKey: config.SecretAccessKey,
+		}
+	}
+
 	return &ResticWrapper{
 		config:     config,
+		backend:    backend,
 		resticPath: resticPath,
 	}, nil
 }
 
-// getRepository retourne l'URL du dépôt S3
+// Backend retourne le backend du dépôt
+func (r *ResticWrapper) Backend() Backend {
+	return r.backend
+}
+
+// getRepository retourne l'adresse restic du dépôt
 func (r *ResticWrapper) getRepository() string {
-	return fmt.Sprintf("s3:%s/%s/%s", r.config.S3Endpoint, r.config.S3Bucket, r.config.S3Path)
+	return r.backend.Repository()
 }
 
-// getEnv retourne les variables d'environnement nécessaires pour Restic
-func (r *ResticWrapper) getEnv() []string {
-	env := os.Environ()
-	env = append(env,
-		fmt.Sprintf("AWS_ACCESS_KEY_ID=%s", r.config.AccessKeyID),
-		fmt.Sprintf("AWS_SECRET_ACCESS_KEY=%s", r.config.SecretAccessKey),
-		fmt.Sprintf("RESTIC_REPOSITORY=%s", r.getRepository()),
-		fmt.Sprintf("RESTIC_PASSWORD=%s", r.config.ResticPassword),
-	)
-	return env
+// repositoryArgs retourne les arguments et variables désignant le dépôt.
+// Les secrets (mot de passe, identifiants) passent par secrets, jamais en
+// clair dans l'environnement ou les arguments. prefix vaut "" pour le dépôt
+// de la commande et "from-" pour le dépôt source d'une copie.
+func (r *ResticWrapper) repositoryArgs(secrets *commandSecrets, prefix string) ([]string, []string, error) {
+	creds := r.backend.Credentials()
+	env := append([]string{}, creds.Env...)
+	for name, content := range creds.Files {
+		path, err := secrets.file(prefix+name, content)
+		if err != nil {
+			return nil, nil, err
+		}
+		env = append(env, name+"="+path)
+	}
+
+	var args []string
+	if creds.Repository != "" {
+		path, err := secrets.file(prefix+"repository", creds.Repository)
+		if err != nil {
+			return nil, nil, err
+		}
+		args = append(args, "--"+prefix+"repository-file", path)
+	} else {
+		args = append(args, "--"+prefix+"repo", r.getRepository())
+	}
+
+	path, err := secrets.pass(prefix+"password", r.config.ResticPassword)
+	if err != nil {
+		return nil, nil, err
+	}
+	args = append(args, "--"+prefix+"password-file", path)
+
+	// Les options -o (s3.*, sftp.*) s'appliquent aussi au dépôt source d'une copie
+	for _, o := range r.backend.Options() {
+		args = append(args, "-o", o)
+	}
+
+	// Limites de débit : options globales, portées par le dépôt de la commande
+	if prefix == "" {
+		if r.config.LimitUploadKiB > 0 {
+			args = append(args, "--limit-upload", strconv.Itoa(r.config.LimitUploadKiB))
+		}
+		if r.config.LimitDownloadKiB > 0 {
+			args = append(args, "--limit-download", strconv.Itoa(r.config.LimitDownloadKiB))
+		}
+	}
+	return args, env, nil
 }
 
-// runCommand exécute une commande Restic avec l'environnement configuré
+// command prépare une commande Restic avec un environnement minimal et les
+// options du backend. secrets.cleanup doit être appelé après la commande.
+func (r *ResticWrapper) command(ctx context.Context, args ...string) (*exec.Cmd, *commandSecrets, error) {
+	secrets := &commandSecrets{}
+	repoArgs, env, err := r.repositoryArgs(secrets, "")
+	if err != nil {
+		secrets.cleanup()
+		return nil, nil, err
+	}
+
+	cmd := priorityCommand(ctx, r.config.Priority, r.resticPath, append(repoArgs, args...)...)
+	cmd.Env = childEnv(append(env, r.config.Priority.env()...)...)
+	cmd.ExtraFiles = secrets.pipes
+	return cmd, secrets, nil
+}
+
+// runCommand exécute une commande Restic et retourne ses sorties
 func (r *ResticWrapper) runCommand(args ...string) (string, string, error) {
-	cmd := exec.Command(r.resticPath, args...)
-	cmd.Env = r.getEnv()
+	cmd, secrets, err := r.command(context.Background(), args...)
+	if err != nil {
+		return "", "", err
+	}
+	defer secrets.cleanup()
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	err := cmd.Run()
+	err = cmd.Run()
 	return stdout.String(), stderr.String(), err
 }
 
 // InitRepo initialise le dépôt Restic s'il n'existe pas
 func (r *ResticWrapper) InitRepo() error {
-	fmt.Println("📦 Initialisation du dépôt Restic...")
+	slog.Info("📦 Initialisation du dépôt Restic...", "backend", r.backend.Type())
+	if IsAppendOnly(r.backend) {
+		slog.Info("   🔒 Dépôt en ajout seul : suppression des snapshots réservée au serveur")
+	}
 
 	// Vérification si le dépôt existe déjà
 	_, stderr, err := r.runCommand("snapshots", "--json")
 	if err == nil {
-		fmt.Println("   ✅ Dépôt déjà initialisé")
+		slog.Info("   ✅ Dépôt déjà initialisé")
 		return nil
 	}
 
@@ -144,65 +280,165 @@ func (r *ResticWrapper) InitRepo() error {
 		return fmt.Errorf("échec init: %w - %s", err, stderr)
 	}
 
-	fmt.Printf("   ✅ Dépôt initialisé: %s\n", strings.TrimSpace(stdout))
+	slog.Info("   ✅ Dépôt initialisé", "output", strings.TrimSpace(stdout))
 	return nil
 }
 
-// RunBackup exécute une sauvegarde du chemin spécifié
-func (r *ResticWrapper) RunBackup(targetPath string) (*BackupResult, error) {
+// RunBackup exécute une sauvegarde des chemins spécifiés (un seul snapshot)
+func (r *ResticWrapper) RunBackup(targetPaths ...string) (*BackupResult, error) {
+	return r.RunBackupWithOptions(BackupOptions{}, targetPaths...)
+}
+
+// RunBackupWithOptions exécute une sauvegarde des chemins spécifiés avec des options,
+// encadrée par les hooks configurés
+func (r *ResticWrapper) RunBackupWithOptions(opts BackupOptions, targetPaths ...string) (*BackupResult, error) {
+	hooks := opts.Hooks
+	if hooks == nil || opts.DryRun {
+		return r.runBackup(opts, targetPaths)
+	}
+
+	// Hooks pré-sauvegarde : selon la politique, un échec annule ou non la sauvegarde
+	preResults, preErr := runHooks(HookPreBackup, hooks.PreBackup, hooks.Timeout, nil)
+	if preErr != nil && hooks.AbortOnPreFailure {
+		result := &BackupResult{
+			Timestamp: time.Now(),
+			Hooks:     preResults,
+			Error:     fmt.Sprintf("sauvegarde annulée: %v", preErr),
+			Aborted:   true,
+		}
+		failResults, _ := runHooks(HookOnFailure, hooks.OnFailure, hooks.Timeout, outcomeEnv(result))
+		result.Hooks = append(result.Hooks, failResults...)
+		return result, errors.New(result.Error)
+	}
+	if preErr != nil {
+		slog.Warn("⚠️  Hook pré-sauvegarde en échec, sauvegarde maintenue", "error", preErr)
+	}
+
+	result, err := r.runBackup(opts, targetPaths)
+	result.Hooks = append(preResults, result.Hooks...)
+
+	// Hooks post-sauvegarde (toujours) puis hooks d'échec
+	env := outcomeEnv(result)
+	postResults, _ := runHooks(HookPostBackup, hooks.PostBackup, hooks.Timeout, env)
+	result.Hooks = append(result.Hooks, postResults...)
+
+	if err != nil || !result.Success {
+		failResults, _ := runHooks(HookOnFailure, hooks.OnFailure, hooks.Timeout, env)
+		result.Hooks = append(result.Hooks, failResults...)
+	}
+
+	return result, err
+}
+
+// runBackup exécute restic backup et analyse son résumé
+func (r *ResticWrapper) runBackup(opts BackupOptions, targetPaths []string) (*BackupResult, error) {
 	startTime := time.Now()
 	result := &BackupResult{
 		Timestamp: startTime,
+		DryRun:    opts.DryRun,
+		Tags:      opts.Tags,
 	}
 
-	fmt.Printf("📁 Sauvegarde de: %s\n", targetPath)
+	if len(targetPaths) == 0 {
+		result.Error = "aucun chemin à sauvegarder"
+		return result, errors.New(result.Error)
+	}
 
-	// Vérification que le chemin existe
-	if _, err := os.Stat(targetPath); os.IsNotExist(err) {
-		result.Error = fmt.Sprintf("chemin inexistant: %s", targetPath)
-		return result, fmt.Errorf(result.Error)
+	slog.Info("📁 Sauvegarde", "paths", strings.Join(targetPaths, ", "), "dry_run", opts.DryRun)
+
+	// Vérification que les chemins existent
+	for _, targetPath := range targetPaths {
+		if _, err := os.Stat(targetPath); os.IsNotExist(err) {
+			result.Error = fmt.Sprintf("chemin inexistant: %s", targetPath)
+			return result, errors.New(result.Error)
+		}
 	}
 
 	// Exécution de la sauvegarde avec sortie JSON
-	stdout, stderr, err := r.runCommand("backup", targetPath, "--json")
-	result.Duration = time.Since(startTime).Seconds()
-
+	args := append([]string{"backup"}, targetPaths...)
+	args = append(args, "--json")
+	for _, exclude := range opts.Excludes {
+		args = append(args, "--exclude", exclude)
+	}
+	for _, tag := range opts.Tags {
+		args = append(args, "--tag", tag)
+	}
+	if opts.DryRun {
+		// -vv : restic détaille chaque fichier (verbose_status) pour l'aperçu
+		args = append(args, "--dry-run", "-vv")
+		result.Preview = newBackupPreview(targetPaths)
+	}
+	cmd, secrets, err := r.command(context.Background(), args...)
 	if err != nil {
-		result.Error = fmt.Sprintf("échec sauvegarde: %s - %s", err.Error(), stderr)
-		return result, fmt.Errorf(result.Error)
+		result.Error = fmt.Sprintf("échec sauvegarde: %v", err)
+		return result, errors.New(result.Error)
 	}
+	defer secrets.cleanup()
 
-	// Parsing de la sortie JSON (dernière ligne = summary)
-	lines := strings.Split(strings.TrimSpace(stdout), "\n")
-	if len(lines) == 0 {
-		result.Error = "sortie vide de restic"
-		return result, fmt.Errorf(result.Error)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		result.Error = fmt.Sprintf("échec sauvegarde: %v", err)
+		return result, errors.New(result.Error)
+	}
+	if err := cmd.Start(); err != nil {
+		result.Error = fmt.Sprintf("échec sauvegarde: %v", err)
+		return result, errors.New(result.Error)
 	}
 
-	// Recherche de la ligne summary
-	for _, line := range lines {
-		var summary resticSummary
-		if err := json.Unmarshal([]byte(line), &summary); err != nil {
-			continue
+	// Sortie lue au fil de l'eau : en simulation, restic rapporte chaque
+	// fichier (verbose_status) et la sortie complète peut peser des centaines de Mo
+	var summary *resticSummary
+	reader := bufio.NewReader(stdout)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		var msg resticSummary
+		if json.Unmarshal(line, &msg) == nil {
+			switch {
+			case msg.MessageType == "verbose_status" && result.Preview != nil:
+				var status resticVerboseStatus
+				if err := json.Unmarshal(line, &status); err == nil {
+					result.Preview.addItem(status)
+				}
+			case msg.MessageType == "summary":
+				summary = &msg
+			}
+		}
+		if readErr != nil {
+			break
 		}
+	}
+	err = cmd.Wait()
+	result.Duration = time.Since(startTime).Seconds()
 
-		if summary.MessageType == "summary" {
-			result.Success = true
-			result.SnapshotID = summary.SnapshotID
-			result.FilesNew = summary.FilesNew
-			result.FilesChanged = summary.FilesChanged
-			result.FilesUnmodified = summary.FilesUnmodified
-			result.BytesAdded = summary.DataAdded
-			result.BytesProcessed = summary.TotalBytesProcessed
-			result.Duration = summary.TotalDuration
-
-			fmt.Printf("   ✅ Snapshot créé: %s\n", summary.SnapshotID)
-			fmt.Printf("   📊 %d nouveaux, %d modifiés, %d inchangés\n",
-				summary.FilesNew, summary.FilesChanged, summary.FilesUnmodified)
-			fmt.Printf("   💾 %s ajoutés\n", formatBytes(summary.DataAdded))
+	if err != nil {
+		result.Error = fmt.Sprintf("échec sauvegarde: %s - %s", err.Error(), stderr.String())
+		return result, errors.New(result.Error)
+	}
+
+	if summary != nil {
+		result.applySummary(*summary)
 
+		if result.Preview != nil {
+			result.Preview.finalize(*summary)
+			slog.Info("   🔍 Simulation terminée",
+				"files", summary.TotalFilesProcessed,
+				"bytes", FormatBytes(summary.TotalBytesProcessed),
+				"to_upload", FormatBytes(summary.DataAdded),
+			)
 			return result, nil
 		}
+
+		slog.Info("   ✅ Snapshot créé",
+			"snapshot", summary.SnapshotID,
+			"files_new", summary.FilesNew,
+			"files_changed", summary.FilesChanged,
+			"files_unmodified", summary.FilesUnmodified,
+			"data_added", FormatBytes(summary.DataAdded),
+		)
+
+		return result, nil
 	}
 
 	// Si on n'a pas trouvé de summary mais pas d'erreur non plus
@@ -210,6 +446,140 @@ func (r *ResticWrapper) RunBackup(targetPath string) (*BackupResult, error) {
 	return result, nil
 }
 
+// BackupStream sauvegarde le contenu d'un flux dans un snapshot (restic backup --stdin),
+// sous le nom name, sans fichier temporaire.
+// Si la lecture de input échoue, restic est arrêté avant la fin du flux :
+// aucun snapshot tronqué n'est créé. L'annulation de ctx interrompt la sauvegarde.
+func (r *ResticWrapper) BackupStream(ctx context.Context, name string, input io.Reader, tags []string) (*BackupResult, error) {
+	startTime := time.Now()
+	result := &BackupResult{
+		Timestamp:     startTime,
+		StdinFilename: name,
+		Tags:          tags,
+	}
+
+	if name == "" {
+		result.Error = "nom du fichier manquant pour la sauvegarde du flux"
+		return result, errors.New(result.Error)
+	}
+
+	args := []string{"backup", "--stdin", "--stdin-filename", name, "--json"}
+	for _, tag := range tags {
+		args = append(args, "--tag", tag)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cmd, secrets, err := r.command(ctx, args...)
+	if err != nil {
+		result.Error = fmt.Sprintf("échec sauvegarde: %v", err)
+		return result, errors.New(result.Error)
+	}
+	defer secrets.cleanup()
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		result.Error = fmt.Sprintf("échec sauvegarde: %v", err)
+		return result, errors.New(result.Error)
+	}
+	if err := cmd.Start(); err != nil {
+		result.Error = fmt.Sprintf("échec sauvegarde: %v", err)
+		return result, errors.New(result.Error)
+	}
+
+	source := &sourceReader{r: input}
+	io.Copy(stdin, source)
+	if source.err != nil {
+		// restic ne doit pas voir la fin du flux, sinon il enregistre des données incomplètes
+		cancel()
+	}
+	stdin.Close()
+	err = cmd.Wait()
+	result.Duration = time.Since(startTime).Seconds()
+
+	switch {
+	case ctx.Err() != nil && source.err == nil:
+		result.Error = fmt.Sprintf("sauvegarde interrompue: %v", ctx.Err())
+	case source.err != nil:
+		result.Error = fmt.Sprintf("échec lecture du flux: %v", source.err)
+	case err != nil:
+		result.Error = fmt.Sprintf("échec sauvegarde: %s - %s", err.Error(), stderr.String())
+	}
+	if result.Error != "" {
+		return result, errors.New(result.Error)
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(stdout.String()), "\n") {
+		var summary resticSummary
+		if err := json.Unmarshal([]byte(line), &summary); err == nil && summary.MessageType == "summary" {
+			result.applySummary(summary)
+			break
+		}
+	}
+	result.Success = true
+
+	slog.Info("   ✅ Snapshot créé",
+		"snapshot", result.SnapshotID,
+		"filename", name,
+		"data_added", FormatBytes(result.BytesAdded),
+	)
+	return result, nil
+}
+
+// sourceReader mémorise l'erreur de lecture du flux sauvegardé, pour la
+// distinguer d'une erreur d'écriture vers restic
+type sourceReader struct {
+	r   io.Reader
+	err error
+}
+
+func (s *sourceReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if err != nil && err != io.EOF {
+		s.err = err
+	}
+	return n, err
+}
+
+// applySummary reporte le résumé restic dans le résultat
+func (result *BackupResult) applySummary(summary resticSummary) {
+	result.Success = true
+	result.SnapshotID = summary.SnapshotID
+	result.FilesNew = summary.FilesNew
+	result.FilesChanged = summary.FilesChanged
+	result.FilesUnmodified = summary.FilesUnmodified
+	result.BytesAdded = summary.DataAdded
+	result.BytesProcessed = summary.TotalBytesProcessed
+	result.Duration = summary.TotalDuration
+}
+
+// Dump écrit dans w le contenu d'un fichier d'un snapshot (restic dump), sans fichier temporaire.
+// snapshotID accepte "latest". En cas d'erreur, w peut avoir reçu une partie du contenu.
+func (r *ResticWrapper) Dump(ctx context.Context, snapshotID, path string, w io.Writer) error {
+	cmd, secrets, err := r.command(ctx, "dump", snapshotID, path)
+	if err != nil {
+		return err
+	}
+	defer secrets.cleanup()
+
+	var stderr bytes.Buffer
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("dump interrompu: %w", ctx.Err())
+		}
+		return fmt.Errorf("échec dump %s:%s: %w - %s", snapshotID, path, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
 // GetSnapshots retourne la liste des snapshots du dépôt
 func (r *ResticWrapper) GetSnapshots() ([]Snapshot, error) {
 	stdout, stderr, err := r.runCommand("snapshots", "--json")
@@ -237,8 +607,9 @@ type RestoreResult struct {
 	Timestamp     time.Time `json:"timestamp"`
 }
 
-// Restore restaure un snapshot vers un chemin cible
-func (r *ResticWrapper) Restore(snapshotID, targetPath string) (*RestoreResult, error) {
+// Restore restaure un snapshot vers un chemin cible.
+// Les motifs include limitent la restauration à certains fichiers ou dossiers.
+func (r *ResticWrapper) Restore(snapshotID, targetPath string, include ...string) (*RestoreResult, error) {
 	startTime := time.Now()
 	result := &RestoreResult{
 		SnapshotID: snapshotID,
@@ -246,32 +617,54 @@ func (r *ResticWrapper) Restore(snapshotID, targetPath string) (*RestoreResult,
 		Timestamp:  startTime,
 	}
 
-	fmt.Printf("🔄 Restauration du snapshot %s vers %s\n", snapshotID, targetPath)
+	slog.Info("🔄 Restauration du snapshot", "snapshot", snapshotID, "target", targetPath)
 
 	// Exécution de la restauration
-	stdout, stderr, err := r.runCommand("restore", snapshotID, "--target", targetPath)
+	args := []string{"restore", snapshotID, "--target", targetPath}
+	for _, pattern := range include {
+		args = append(args, "--include", pattern)
+	}
+	stdout, stderr, err := r.runCommand(args...)
 	result.Duration = time.Since(startTime).Seconds()
 
 	if err != nil {
 		result.Error = fmt.Sprintf("échec restauration: %s - %s", err.Error(), stderr)
-		return result, fmt.Errorf(result.Error)
+		return result, errors.New(result.Error)
 	}
 
 	// La restauration a réussi
 	result.Success = true
-	fmt.Printf("   ✅ Restauration terminée en %.2fs\n", result.Duration)
-	fmt.Printf("   📁 Fichiers restaurés vers: %s\n", targetPath)
+	slog.Info("   ✅ Restauration terminée",
+		"duration", fmt.Sprintf("%.2fs", result.Duration),
+		"target", targetPath,
+	)
 
 	// Log de la sortie restic si disponible
 	if stdout != "" {
-		fmt.Printf("   📝 %s\n", strings.TrimSpace(stdout))
+		slog.Debug("   📝 Sortie restic", "output", strings.TrimSpace(stdout))
 	}
 
 	return result, nil
 }
 
-// formatBytes formate une taille en octets de manière lisible
-func formatBytes(bytes int64) string {
+// ResticVersion retourne la version de l'exécutable restic trouvé dans le PATH
+func ResticVersion() (string, error) {
+	resticPath, err := exec.LookPath("restic")
+	if err != nil {
+		return "", fmt.Errorf("restic non trouvé dans le PATH: %w", err)
+	}
+
+	cmd := exec.Command(resticPath, "version")
+	cmd.Env = childEnv()
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("échec restic version: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// FormatBytes formate une taille en octets de manière lisible
+func FormatBytes(bytes int64) string {
 	const (
 		KB = 1024
 		MB = KB * 1024
@@ -0,0 +1,121 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetentionPolicy décrit les snapshots conservés par restic forget
+type RetentionPolicy struct {
+	KeepLast    int
+	KeepDaily   int
+	KeepWeekly  int
+	KeepMonthly int
+	KeepYearly  int
+	// Snapshots portant l'un de ces tags toujours conservés (restic --keep-tag)
+	KeepTags []string
+}
+
+// args retourne les options --keep-* de la politique
+func (p RetentionPolicy) args() []string {
+	var args []string
+	for _, rule := range []struct {
+		flag  string
+		value int
+	}{
+		{"--keep-last", p.KeepLast},
+		{"--keep-daily", p.KeepDaily},
+		{"--keep-weekly", p.KeepWeekly},
+		{"--keep-monthly", p.KeepMonthly},
+		{"--keep-yearly", p.KeepYearly},
+	} {
+		if rule.value > 0 {
+			args = append(args, rule.flag, strconv.Itoa(rule.value))
+		}
+	}
+	// Sans règle --keep-*, --keep-tag seul supprimerait tous les autres snapshots
+	if len(args) == 0 {
+		return nil
+	}
+	for _, tag := range p.KeepTags {
+		args = append(args, "--keep-tag", tag)
+	}
+	return args
+}
+
+// ForgetResult représente le résultat de l'application de la rétention
+type ForgetResult struct {
+	Kept      int       `json:"kept"`
+	Removed   []string  `json:"removed,omitempty"`
+	Duration  float64   `json:"duration_seconds"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// resticForgetGroup représente un groupe de la sortie JSON de restic forget
+type resticForgetGroup struct {
+	Keep   []Snapshot `json:"keep"`
+	Remove []Snapshot `json:"remove"`
+}
+
+// Forget supprime les snapshots hors de la politique de rétention puis les
+// données devenues inutiles (restic forget --prune). Refusé sur un dépôt en
+// ajout seul : la suppression y est réservée au serveur.
+func (r *ResticWrapper) Forget(policy RetentionPolicy) (*ForgetResult, error) {
+	keep := policy.args()
+	if len(keep) == 0 {
+		return nil, fmt.Errorf("aucune règle de rétention")
+	}
+	if IsAppendOnly(r.backend) {
+		return nil, fmt.Errorf("dépôt en ajout seul : rétention appliquée par le serveur")
+	}
+
+	slog.Info("🧹 Application de la rétention", "rules", strings.Join(keep, " "))
+	start := time.Now()
+	args := append([]string{"forget", "--prune", "--json"}, keep...)
+	stdout, stderr, err := r.runCommand(args...)
+	if err != nil {
+		return nil, fmt.Errorf("échec rétention: %w - %s", err, strings.TrimSpace(stderr))
+	}
+
+	result := &ForgetResult{Timestamp: start, Duration: time.Since(start).Seconds()}
+	// La sortie JSON est suivie des messages de prune : seule la première ligne est lue
+	line, _, _ := strings.Cut(strings.TrimSpace(stdout), "\n")
+	var groups []resticForgetGroup
+	if err := json.Unmarshal([]byte(line), &groups); err != nil {
+		return nil, fmt.Errorf("échec parsing rétention: %w", err)
+	}
+	for _, g := range groups {
+		result.Kept += len(g.Keep)
+		for _, s := range g.Remove {
+			result.Removed = append(result.Removed, s.ShortID)
+		}
+	}
+
+	slog.Info("   ✅ Rétention appliquée", "kept", result.Kept, "removed", len(result.Removed))
+	return result, nil
+}
+
+// AddTags ajoute des tags à des snapshots (restic tag --add). restic réécrit
+// les snapshots concernés : leurs identifiants changent.
+func (r *ResticWrapper) AddTags(snapshotIDs []string, tags ...string) error {
+	if len(snapshotIDs) == 0 || len(tags) == 0 {
+		return nil
+	}
+	if IsAppendOnly(r.backend) {
+		return fmt.Errorf("dépôt en ajout seul : tags non modifiables")
+	}
+
+	args := []string{"tag"}
+	for _, tag := range tags {
+		args = append(args, "--add", tag)
+	}
+	args = append(args, snapshotIDs...)
+	if _, stderr, err := r.runCommand(args...); err != nil {
+		return fmt.Errorf("échec ajout des tags: %w - %s", err, strings.TrimSpace(stderr))
+	}
+	return nil
+}
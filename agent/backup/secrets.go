@@ -0,0 +1,88 @@
+package backup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Variables d'environnement transmises aux processus enfants (restic, hooks,
+// outils de dump). Tout le reste, en particulier les variables MONREMPART_*
+// et les identifiants du service, n'est jamais hérité.
+var allowedEnv = []string{
+	"PATH", "HOME", "USER", "LOGNAME", "SHELL", "LANG", "LANGUAGE", "TZ",
+	"TMPDIR", "TMP", "TEMP",
+	"XDG_CACHE_HOME", "RESTIC_CACHE_DIR", "SSH_AUTH_SOCK",
+	"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "http_proxy", "https_proxy", "no_proxy",
+	// Windows
+	"SYSTEMROOT", "SYSTEMDRIVE", "WINDIR", "COMSPEC", "PATHEXT",
+	"USERPROFILE", "APPDATA", "LOCALAPPDATA", "PROGRAMDATA", "PROGRAMFILES",
+}
+
+// childEnv retourne l'environnement minimal d'un processus enfant, complété par extra
+func childEnv(extra ...string) []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if isAllowedEnv(name) {
+			env = append(env, kv)
+		}
+	}
+	return append(env, extra...)
+}
+
+// isAllowedEnv indique si une variable peut être héritée (comparaison sans
+// casse : les noms de variables Windows ne sont pas sensibles à la casse)
+func isAllowedEnv(name string) bool {
+	if strings.HasPrefix(name, "LC_") {
+		return true
+	}
+	for _, allowed := range allowedEnv {
+		if strings.EqualFold(name, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// commandSecrets transmet les secrets d'une commande hors de son
+// environnement et de ses arguments : mot de passe par un tube hérité,
+// identifiants dans des fichiers temporaires 0600 supprimés après la commande.
+// cleanup doit être appelé une fois la commande terminée.
+type commandSecrets struct {
+	// Répertoire privé (0700) des fichiers de secrets, créé à la demande
+	dir string
+	// Extrémités en lecture des tubes, transmises au processus enfant
+	pipes []*os.File
+}
+
+// file écrit un secret dans un fichier lisible par le seul utilisateur
+// courant et retourne son chemin
+func (s *commandSecrets) file(name, content string) (string, error) {
+	if s.dir == "" {
+		dir, err := os.MkdirTemp("", "monrempart-")
+		if err != nil {
+			return "", fmt.Errorf("répertoire des secrets: %w", err)
+		}
+		s.dir = dir
+	}
+
+	path := filepath.Join(s.dir, name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		return "", fmt.Errorf("fichier de secret: %w", err)
+	}
+	return path, nil
+}
+
+// cleanup ferme les tubes et supprime les fichiers de secrets
+func (s *commandSecrets) cleanup() {
+	for _, p := range s.pipes {
+		p.Close()
+	}
+	s.pipes = nil
+	if s.dir != "" {
+		os.RemoveAll(s.dir)
+		s.dir = ""
+	}
+}
@@ -0,0 +1,30 @@
+//go:build !windows
+
+package backup
+
+import (
+	"fmt"
+	"os"
+)
+
+// pass transmet un secret par un tube hérité par le processus enfant et
+// retourne le chemin à lui indiquer (/dev/fd/N). Le secret n'apparaît ni
+// dans l'environnement (/proc/<pid>/environ) ni sur le disque.
+// Les tubes doivent être ajoutés à cmd.ExtraFiles dans l'ordre de création.
+func (s *commandSecrets) pass(name, value string) (string, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return "", fmt.Errorf("tube de secret %s: %w", name, err)
+	}
+	// Le secret est bien plus petit que le tampon du tube : l'écriture ne bloque pas
+	_, err = w.WriteString(value)
+	w.Close()
+	if err != nil {
+		r.Close()
+		return "", fmt.Errorf("tube de secret %s: %w", name, err)
+	}
+
+	s.pipes = append(s.pipes, r)
+	// Descripteurs 0-2 : entrées/sorties standard, puis ExtraFiles
+	return fmt.Sprintf("/dev/fd/%d", 2+len(s.pipes)), nil
+}
@@ -0,0 +1,11 @@
+//go:build windows
+
+package backup
+
+// pass transmet un secret au processus enfant. Windows ne permet pas
+// d'hériter d'un descripteur par un chemin : le secret est écrit dans un
+// fichier temporaire du profil de l'utilisateur (ACL privées), supprimé
+// après la commande.
+func (s *commandSecrets) pass(name, value string) (string, error) {
+	return s.file(name, value)
+}
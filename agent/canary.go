@@ -0,0 +1,560 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mon-rempart/agent/fswatch"
+)
+
+// Documents leurres déposés dans chaque dossier sauvegardé. Le préfixe les
+// place en tête des listes : un rançongiciel qui parcourt le dossier dans
+// l'ordre les chiffre parmi les premiers.
+var canaryTemplates = []struct {
+	name    string
+	content func(token string) ([]byte, error)
+}{
+	{"_Comptabilite_confidentiel.docx", canaryDocx},
+	{"_Releves_bancaires.pdf", canaryPDF},
+}
+
+// CanaryTrigger décrit le déclenchement d'un fichier témoin
+type CanaryTrigger struct {
+	Time   time.Time `json:"time"`
+	Path   string    `json:"path"`
+	Reason string    `json:"reason"` // modifié, supprimé ou renommé
+	// Autres fichiers témoins touchés lors de la même vérification
+	Others []string `json:"others,omitempty"`
+}
+
+// CanaryStatus est l'état des fichiers témoins envoyé avec le heartbeat
+type CanaryStatus struct {
+	Files     int            `json:"files"`
+	Triggered *CanaryTrigger `json:"triggered,omitempty"`
+}
+
+// canaryFile est un fichier témoin déposé et son empreinte
+type canaryFile struct {
+	Path   string `json:"path"`
+	Root   string `json:"root"`
+	SHA256 string `json:"sha256"`
+}
+
+// canaryState est l'état conservé dans canaries.json
+type canaryState struct {
+	Files   []canaryFile   `json:"files"`
+	Trigger *CanaryTrigger `json:"trigger,omitempty"`
+}
+
+var (
+	// canaryMu sérialise les opérations sur les fichiers témoins et leur état
+	canaryMu sync.Mutex
+
+	// État en mémoire pour la planification et le heartbeat
+	canaryViewMu sync.Mutex
+	canaryView   CanaryStatus
+
+	// Fichiers témoins non déposés lors du dernier signalement (canaryMu pris) :
+	// un nouvel avertissement seulement si la liste change
+	canaryMissingReported string
+)
+
+// isCanaryFile indique si path porte le nom d'un fichier témoin
+func isCanaryFile(path string) bool {
+	name := filepath.Base(path)
+	for _, tpl := range canaryTemplates {
+		if tpl.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// canaryStatePath retourne le fichier d'état des fichiers témoins
+func canaryStatePath() string {
+	return filepath.Join(currentConfig().Dir(), "canaries.json")
+}
+
+// loadCanaryState lit l'état des fichiers témoins (absent : aucun fichier déposé)
+func loadCanaryState() (*canaryState, error) {
+	data, err := os.ReadFile(canaryStatePath())
+	if os.IsNotExist(err) {
+		return &canaryState{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state canaryState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// save écrit l'état de façon atomique
+func (s *canaryState) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := canaryStatePath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, canaryStatePath())
+}
+
+// publish met à jour l'état vu par la planification et le heartbeat
+func (s *canaryState) publish() {
+	canaryViewMu.Lock()
+	defer canaryViewMu.Unlock()
+	canaryView = CanaryStatus{Files: len(s.Files), Triggered: s.Trigger}
+}
+
+// loadCanaryTrigger relit un déclenchement antérieur au démarrage : les
+// sauvegardes planifiées restent suspendues jusqu'à la réinitialisation
+func loadCanaryTrigger() {
+	state, err := loadCanaryState()
+	if err != nil {
+		slog.Warn("⚠️  État des fichiers témoins illisible", "error", err)
+		return
+	}
+	state.publish()
+	if t := state.Trigger; t != nil {
+		slog.Error("🚨 Fichier témoin déclenché - sauvegardes planifiées suspendues",
+			"path", t.Path,
+			"reason", t.Reason,
+			"since", t.Time.Local().Format("02/01/2006 15:04"),
+		)
+	}
+}
+
+// canaryTriggered retourne le déclenchement en cours (nil : aucun)
+func canaryTriggered() *CanaryTrigger {
+	canaryViewMu.Lock()
+	defer canaryViewMu.Unlock()
+	return canaryView.Triggered
+}
+
+// canaryStatus retourne l'état des fichiers témoins pour le heartbeat (nil : désactivés)
+func canaryStatus() *CanaryStatus {
+	canaryViewMu.Lock()
+	defer canaryViewMu.Unlock()
+	if !currentConfig().Canary.Enabled && canaryView.Triggered == nil {
+		return nil
+	}
+	status := canaryView
+	return &status
+}
+
+// canaryLoop dépose les fichiers témoins et les surveille : notifications du
+// système (Linux) et vérification périodique des empreintes
+func canaryLoop() {
+	if !currentConfig().Canary.Enabled {
+		return
+	}
+
+	var events <-chan fswatch.Event
+	watcher, err := fswatch.New()
+	if err != nil {
+		slog.Info("🐤 Fichiers témoins : vérification périodique seule", "reason", err)
+	} else {
+		defer watcher.Close()
+		events = watcher.Events
+	}
+
+	watched := make(map[string]bool)
+	refresh := func() {
+		state := refreshCanaries()
+		if watcher == nil || state == nil {
+			return
+		}
+		// Surveillance des dossiers contenant des fichiers témoins
+		roots := make(map[string]bool)
+		for _, f := range state.Files {
+			roots[f.Root] = true
+		}
+		for root := range roots {
+			if watched[root] {
+				continue
+			}
+			if err := watcher.Add(root); err != nil {
+				slog.Warn("⚠️  Dossier non surveillé - vérification périodique seule", "path", root, "error", err)
+				continue
+			}
+			watched[root] = true
+		}
+		for root := range watched {
+			if !roots[root] {
+				watcher.Remove(root)
+				delete(watched, root)
+			}
+		}
+	}
+
+	refresh()
+	ticker := time.NewTicker(time.Duration(currentConfig().Canary.CheckMinutes) * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			// Événement sur un dossier surveillé : vérification immédiate des empreintes
+			if event.Op&fswatch.Overflow != 0 || watched[filepath.Dir(event.Name)] || watched[event.Name] {
+				checkCanaries()
+			}
+		case <-ticker.C:
+			refresh()
+		}
+	}
+}
+
+// refreshCanaries vérifie les fichiers témoins puis, sans déclenchement en
+// cours, dépose ceux des nouveaux dossiers sauvegardés et retire ceux des
+// dossiers qui ne le sont plus
+func refreshCanaries() *canaryState {
+	state := checkCanaries()
+	if state == nil || state.Trigger != nil {
+		return state
+	}
+
+	canaryMu.Lock()
+	defer canaryMu.Unlock()
+	if err := placeCanaries(state, false); err != nil {
+		slog.Warn("⚠️  Fichiers témoins non enregistrés", "error", err)
+	}
+	state.publish()
+	return state
+}
+
+// placeCanaries dépose les fichiers témoins manquants et met à jour l'état ;
+// fresh remplace le contenu des fichiers déjà présents (réinitialisation)
+func placeCanaries(state *canaryState, fresh bool) error {
+	roots := make(map[string]bool)
+	for _, root := range currentConfig().BackupPaths {
+		if info, err := os.Stat(root); err == nil && info.IsDir() {
+			roots[filepath.Clean(root)] = true
+		}
+	}
+
+	changed := false
+	tracked := make(map[string]bool)
+	kept := state.Files[:0]
+	for _, f := range state.Files {
+		if !roots[f.Root] {
+			// Dossier retiré de la sauvegarde : le témoin intact est supprimé
+			if sum, err := fileSHA256(f.Path); err == nil && sum == f.SHA256 {
+				os.Remove(f.Path)
+			}
+			changed = true
+			continue
+		}
+		kept = append(kept, f)
+		tracked[f.Path] = true
+	}
+	state.Files = kept
+
+	missing := make(map[string]string)
+	for root := range roots {
+		for _, tpl := range canaryTemplates {
+			path := filepath.Join(root, tpl.name)
+			if tracked[path] {
+				continue
+			}
+			sum, err := writeCanary(path, tpl.content, fresh)
+			if err != nil {
+				missing[path] = err.Error()
+				continue
+			}
+			state.Files = append(state.Files, canaryFile{Path: path, Root: root, SHA256: sum})
+			changed = true
+			slog.Info("🐤 Fichier témoin déposé", "path", path)
+		}
+	}
+	reportMissingCanaries(len(state.Files), missing)
+
+	if !changed {
+		return nil
+	}
+	return state.save()
+}
+
+// reportMissingCanaries signale les fichiers témoins qui n'ont pas pu être
+// déposés (dossier en lecture seule pour le service...) : sans eux, la
+// protection est partielle, voire inactive
+func reportMissingCanaries(placed int, missing map[string]string) {
+	paths := make([]string, 0, len(missing))
+	for path := range missing {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	key := fmt.Sprint(placed, paths)
+	if key == canaryMissingReported {
+		return
+	}
+	canaryMissingReported = key
+	if placed > 0 && len(missing) == 0 {
+		return
+	}
+
+	message := fmt.Sprintf("%d fichier(s) témoin(s) non déposé(s)", len(missing))
+	if placed == 0 {
+		message = "Aucun fichier témoin déposé : détection par fichiers témoins inactive"
+	}
+	const hint = "dossier en lecture seule pour le service : relancer mon-rempart-agent install pour déposer les fichiers témoins"
+	slog.Warn("⚠️  "+message, "placed", placed, "missing", paths, "hint", hint)
+	go sendActivityLog("warning", message, map[string]interface{}{
+		"placed":  placed,
+		"missing": missing,
+		"hint":    hint,
+	})
+}
+
+// canaryPaths retourne les fichiers témoins des dossiers sauvegardés existants
+func canaryPaths(roots []string) []string {
+	var paths []string
+	for _, root := range roots {
+		if info, err := os.Stat(root); err != nil || !info.IsDir() {
+			continue
+		}
+		for _, tpl := range canaryTemplates {
+			paths = append(paths, filepath.Join(filepath.Clean(root), tpl.name))
+		}
+	}
+	return paths
+}
+
+// installCanaries dépose les fichiers témoins à l'installation du service,
+// avant le bac à sable : les dossiers sauvegardés y sont en lecture seule et
+// seuls ces fichiers restent accessibles en écriture. Retourne ceux déposés.
+func installCanaries(paths []string) []string {
+	var placed []string
+	for _, path := range paths {
+		for _, tpl := range canaryTemplates {
+			if tpl.name != filepath.Base(path) {
+				continue
+			}
+			if _, err := writeCanary(path, tpl.content, false); err != nil {
+				slog.Warn("⚠️  Fichier témoin non déposé", "path", path, "error", err)
+				continue
+			}
+			placed = append(placed, path)
+		}
+	}
+	return placed
+}
+
+// writeCanary crée un fichier témoin au contenu unique et retourne son
+// empreinte ; sans fresh, un fichier déjà présent (état perdu, déposé à
+// l'installation) est adopté tel quel. Un fichier existant est réécrit sur
+// place : sous le service, il est le seul accessible en écriture du dossier.
+func writeCanary(path string, content func(token string) ([]byte, error), fresh bool) (string, error) {
+	if _, err := os.Stat(path); err == nil && !fresh {
+		return fileSHA256(path)
+	}
+
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	data, err := content(hex.EncodeToString(token))
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// checkCanaries compare chaque fichier témoin à son empreinte ; le premier
+// écart déclenche l'alerte. Retourne l'état relu (nil : illisible).
+func checkCanaries() *canaryState {
+	canaryMu.Lock()
+	defer canaryMu.Unlock()
+
+	// L'état sur disque fait foi : une réinitialisation (canary reset) est prise en compte
+	state, err := loadCanaryState()
+	if err != nil {
+		slog.Warn("⚠️  État des fichiers témoins illisible", "error", err)
+		return nil
+	}
+	defer state.publish()
+	if state.Trigger != nil {
+		return state
+	}
+
+	var trigger *CanaryTrigger
+	for _, f := range state.Files {
+		reason := ""
+		sum, err := fileSHA256(f.Path)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			reason = "supprimé ou renommé"
+		case err != nil:
+			reason = fmt.Sprintf("illisible (%v)", err)
+		case sum != f.SHA256:
+			reason = "modifié"
+		default:
+			continue
+		}
+		if trigger == nil {
+			trigger = &CanaryTrigger{Time: time.Now(), Path: f.Path, Reason: reason}
+		} else {
+			trigger.Others = append(trigger.Others, f.Path)
+		}
+	}
+	if trigger == nil {
+		return state
+	}
+
+	state.Trigger = trigger
+	if err := state.save(); err != nil {
+		slog.Warn("⚠️  Déclenchement du fichier témoin non enregistré", "error", err)
+	}
+
+	slog.Error("🚨 Fichier témoin déclenché - attaque probable, sauvegardes planifiées suspendues",
+		"path", trigger.Path,
+		"reason", trigger.Reason,
+		"others", len(trigger.Others),
+	)
+	go sendActivityLog("critical", fmt.Sprintf("Fichier témoin %s : attaque probable, sauvegardes planifiées suspendues", trigger.Reason), map[string]interface{}{
+		"path":   trigger.Path,
+		"reason": trigger.Reason,
+		"others": trigger.Others,
+		"time":   trigger.Time,
+	})
+	return state
+}
+
+// resetCanaries lève l'alerte après vérification du poste : les fichiers
+// témoins sont remplacés et les sauvegardes planifiées reprennent
+func resetCanaries() (*CanaryStatus, error) {
+	canaryMu.Lock()
+	defer canaryMu.Unlock()
+
+	state, err := loadCanaryState()
+	if err != nil {
+		state = &canaryState{}
+	}
+	previous := state.Trigger
+
+	// État enregistré avant la suppression : le service en cours ignore les
+	// événements des anciens fichiers
+	old := state.Files
+	state.Files, state.Trigger = nil, nil
+	if err := state.save(); err != nil {
+		return nil, err
+	}
+	cfg := currentConfig()
+	kept := make(map[string]bool)
+	if cfg.Canary.Enabled {
+		for _, root := range cfg.BackupPaths {
+			kept[filepath.Clean(root)] = true
+		}
+	}
+	for _, f := range old {
+		// Réécrits avec un nouveau contenu s'ils restent sauvegardés : sous
+		// le service, leur dossier est en lecture seule
+		if !kept[f.Root] {
+			os.Remove(f.Path)
+		}
+	}
+	if cfg.Canary.Enabled {
+		if err := placeCanaries(state, true); err != nil {
+			return nil, err
+		}
+	}
+	state.publish()
+
+	if previous != nil {
+		slog.Info("🐤 Alerte des fichiers témoins levée - sauvegardes planifiées reprises", "triggered_at", previous.Time.Local().Format("02/01/2006 15:04"))
+	}
+	return &CanaryStatus{Files: len(state.Files)}, nil
+}
+
+// fileSHA256 retourne l'empreinte SHA-256 d'un fichier
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// canaryDocx construit un document Word minimal mais valide
+func canaryDocx(token string) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	files := []struct{ name, body string }{
+		{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/></Types>`},
+		{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/></Relationships>`},
+		{"word/document.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body><w:p><w:r><w:t>Comptabilité - document confidentiel</w:t></w:r></w:p><w:p><w:r><w:t>Référence ` + token + `</w:t></w:r></w:p></w:body></w:document>`},
+	}
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(w, f.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// canaryPDF construit un PDF minimal d'une page
+func canaryPDF(token string) ([]byte, error) {
+	text := fmt.Sprintf("BT /F1 14 Tf 72 720 Td (Releves bancaires - ref. %s) Tj ET", token)
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(text), text),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes(), nil
+}
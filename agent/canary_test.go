@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteCanary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), canaryTemplates[0].name)
+	content := canaryTemplates[0].content
+
+	first, err := writeCanary(path, content, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Déposé à l'installation : adopté tel quel
+	if adopted, err := writeCanary(path, content, false); err != nil || adopted != first {
+		t.Errorf("fichier existant = %s, %v ; attendu adopté (%s)", adopted, err, first)
+	}
+	// Réinitialisation : nouveau contenu écrit sur place
+	replaced, err := writeCanary(path, content, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replaced == first {
+		t.Error("contenu inchangé après réinitialisation")
+	}
+	if sum, _ := fileSHA256(path); sum != replaced {
+		t.Errorf("empreinte = %s, attendu %s", sum, replaced)
+	}
+}
+
+func TestPlaceCanariesReportsMissing(t *testing.T) {
+	d := withFakeDashboard(t)
+	dir := t.TempDir()
+	docs := filepath.Join(dir, "docs")
+	// Témoin impossible à déposer : un dossier occupe son nom
+	if err := os.MkdirAll(filepath.Join(docs, canaryTemplates[0].name), 0700); err != nil {
+		t.Fatal(err)
+	}
+	cfg := *currentConfig()
+	cfg.ConfigPath, cfg.BackupPaths = filepath.Join(dir, "config.json"), []string{docs}
+	activeConfig.Store(&cfg)
+	previous := canaryMissingReported
+	t.Cleanup(func() { canaryMissingReported = previous })
+
+	state := &canaryState{}
+	if err := placeCanaries(state, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Files) != len(canaryTemplates)-1 {
+		t.Fatalf("témoins déposés = %d, attendu %d", len(state.Files), len(canaryTemplates)-1)
+	}
+	if log := d.waitActivity(t, "warning"); log.Details["placed"] != float64(1) {
+		t.Errorf("avertissement = %+v", log)
+	}
+	if got := canaryPaths([]string{docs, filepath.Join(dir, "absent")}); len(got) != len(canaryTemplates) {
+		t.Errorf("canaryPaths = %v", got)
+	}
+}
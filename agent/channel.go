@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"time"
+)
+
+// Canal de commandes temps réel : flux SSE ouvert par l'agent vers le
+// Dashboard, avec repli sur des requêtes longues. Les heartbeats restent le
+// signal de vie ; ils portent encore une commande pour les anciens Dashboards.
+const (
+	commandStreamPath = "/api/agent/commands/stream"
+	commandPollPath   = "/api/agent/commands"
+	commandAckPath    = "/api/agent/commands/ack"
+
+	// Attente maximale d'une requête longue côté serveur
+	commandPollWait = 25 * time.Second
+	// Sans donnée ni commentaire keepalive pendant ce délai, le flux est considéré coupé
+	commandStreamIdle = 90 * time.Second
+	// Après un repli sur les requêtes longues, nouvel essai du flux
+	commandStreamRetry = 15 * time.Minute
+
+	// Reconnexion : délai doublé à chaque échec
+	commandBackoffMin = time.Second
+	commandBackoffMax = 2 * time.Minute
+)
+
+// commandBatch est un lot de commandes en attente (événement SSE ou réponse longue)
+type commandBatch struct {
+	Success  bool           `json:"success"`
+	Commands []AgentCommand `json:"commands"`
+}
+
+// errStreamUnsupported : le Dashboard ne sert pas le flux SSE (ancienne version, proxy)
+var errStreamUnsupported = errors.New("flux de commandes non disponible")
+
+// commandLoop maintient le canal de commandes ouvert, en reconnectant avec
+// un délai croissant
+func commandLoop() {
+	backoff := commandBackoffMin
+	var streamRetryAt time.Time
+
+	for {
+		if currentAgentID() == "" {
+			// ID attribué au premier heartbeat réussi
+			time.Sleep(backoff)
+			backoff = min(backoff*2, commandBackoffMax)
+			continue
+		}
+
+		start := time.Now()
+		var err error
+		if time.Now().After(streamRetryAt) {
+			err = streamCommands()
+			if errors.Is(err, errStreamUnsupported) {
+				slog.Info("↩️  Flux de commandes indisponible - requêtes longues", "error", err)
+				streamRetryAt = time.Now().Add(commandStreamRetry)
+				continue
+			}
+			// Fermeture immédiate du flux : comptée comme un échec (pas de boucle serrée)
+			if err == nil && time.Since(start) < 5*time.Second {
+				err = fmt.Errorf("flux fermé par le serveur")
+			}
+		} else {
+			err = pollCommands()
+			// Réponse sans attendre (proxy, Dashboard qui ignore wait) : une
+			// requête au plus par commandPollWait, pas de boucle serrée
+			if err == nil {
+				time.Sleep(commandPollWait - time.Since(start))
+			}
+		}
+
+		// Fin normale : le serveur ferme le flux ou répond à la requête longue
+		if err == nil {
+			backoff = commandBackoffMin
+			continue
+		}
+		// Connexion restée ouverte longtemps : la panne est nouvelle
+		if time.Since(start) > time.Minute {
+			backoff = commandBackoffMin
+		}
+		slog.Warn("⚠️  Canal de commandes interrompu", "error", err, "retry_in", backoff)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, commandBackoffMax)
+	}
+}
+
+// commandsURL retourne l'adresse d'une route du canal de commandes
+func commandsURL(path string) string {
+	return currentConfig().APIEndpoint + path +
+		"?agent_id=" + neturl.QueryEscape(currentAgentID()) +
+		"&hostname=" + neturl.QueryEscape(hostname)
+}
+
+// streamCommands lit le flux SSE jusqu'à sa fermeture
+func streamCommands() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", commandsURL(commandStreamPath), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("User-Agent", fmt.Sprintf("%s/%s", AppName, Version))
+
+	// Pas de délai global : le flux reste ouvert ; l'inactivité est surveillée plus bas
+	resp, err := newDashboardClient(0).Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errDashboardUnreachable, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed ||
+		resp.StatusCode == http.StatusNotAcceptable:
+		return fmt.Errorf("%w: statut %d", errStreamUnsupported, resp.StatusCode)
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("statut %d", resp.StatusCode)
+	case !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream"):
+		return fmt.Errorf("%w: réponse %s", errStreamUnsupported, resp.Header.Get("Content-Type"))
+	}
+
+	slog.Info("📡 Canal de commandes connecté", "mode", "sse")
+	idle := time.AfterFunc(commandStreamIdle, cancel)
+	defer idle.Stop()
+
+	var event string
+	var data strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		idle.Reset(commandStreamIdle)
+		line := scanner.Text()
+		switch {
+		case line == "":
+			// Fin de l'événement
+			if data.Len() > 0 && (event == "" || event == "commands") {
+				handleCommandBatch([]byte(data.String()))
+			}
+			event = ""
+			data.Reset()
+		case strings.HasPrefix(line, ":"):
+			// Commentaire keepalive
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("flux inactif depuis %s", commandStreamIdle)
+		}
+		return fmt.Errorf("%w: %v", errDashboardUnreachable, err)
+	}
+	return nil
+}
+
+// pollCommands attend les commandes en attente par une requête longue
+func pollCommands() error {
+	url := commandsURL(commandPollPath) + fmt.Sprintf("&wait=%d", int(commandPollWait.Seconds()))
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", fmt.Sprintf("%s/%s", AppName, Version))
+
+	client := newDashboardClient(commandPollWait + 15*time.Second)
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errDashboardUnreachable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("statut %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errDashboardUnreachable, err)
+	}
+	handleCommandBatch(body)
+	return nil
+}
+
+// handleCommandBatch traite un lot de commandes reçu par le canal
+func handleCommandBatch(data []byte) {
+	var batch commandBatch
+	if err := json.Unmarshal(data, &batch); err != nil {
+		slog.Warn("⚠️  Lot de commandes illisible", "error", err)
+		return
+	}
+	if len(batch.Commands) > 0 {
+		receiveCommands(batch.Commands)
+	}
+}
+
+// ackCommands accuse réception de commandes ; sans accusé, le Dashboard les
+// redistribue
+func ackCommands(ids []string) {
+	if len(ids) == 0 {
+		return
+	}
+
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"agent_id": currentAgentID(),
+		"ids":      ids,
+	})
+	if err != nil {
+		slog.Error("❌ Erreur sérialisation accusé de réception", "error", err)
+		return
+	}
+
+	req, err := http.NewRequest("POST", currentConfig().APIEndpoint+commandAckPath, bytes.NewBuffer(jsonData))
+	if err != nil {
+		slog.Error("❌ Erreur création requête accusé de réception", "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", fmt.Sprintf("%s/%s", AppName, Version))
+
+	client := newDashboardClient(10 * time.Second)
+	resp, err := client.Do(req)
+	if err != nil {
+		slog.Warn("⚠️  Accusé de réception non envoyé", "error", err)
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		slog.Warn("⚠️  Accusé de réception refusé", "status", resp.StatusCode)
+	}
+}
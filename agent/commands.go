@@ -0,0 +1,1303 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	neturl "net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mon-rempart/agent/backup"
+	"github.com/mon-rempart/agent/config"
+	"github.com/mon-rempart/agent/governor"
+	"github.com/mon-rempart/agent/logging"
+	"github.com/mon-rempart/agent/service"
+	"github.com/mon-rempart/agent/tlspolicy"
+)
+
+// Codes de sortie des sous-commandes (utilisables dans les scripts)
+const (
+	exitOK           = 0 // Succès
+	exitError        = 1 // Erreur générique
+	exitUsage        = 2 // Arguments invalides
+	exitConfig       = 3 // Configuration invalide ou indisponible (dashboard, restic)
+	exitBackupFailed = 4 // Échec de l'opération sur le dépôt (sauvegarde, restauration...)
+)
+
+// runSubcommand exécute une sous-commande et retourne le code de sortie
+func runSubcommand(name string, args []string) int {
+	switch name {
+	case "run":
+		runAgent()
+		return exitOK
+	case "backup":
+		return cmdBackup(args)
+	case "snapshots":
+		return cmdSnapshots(args)
+	case "restore":
+		return cmdRestore(args)
+	case "dump":
+		return cmdDump(args)
+	case "replicate":
+		return cmdReplicate(args)
+	case "key":
+		return cmdKey(args)
+	case "tls":
+		return cmdTLS(args)
+	case "canary":
+		return cmdCanary(args)
+	case "status":
+		return cmdStatus(args)
+	case "config":
+		return cmdConfig(args)
+	case "version", "--version":
+		return cmdVersion(args)
+	case "install":
+		return cmdInstall(args)
+	case "uninstall":
+		return cmdUninstall(args)
+	case "help", "-h", "--help":
+		printUsage()
+		return exitOK
+	default:
+		fmt.Fprintf(os.Stderr, "Commande inconnue: %s\n\n", name)
+		printUsage()
+		return exitUsage
+	}
+}
+
+// printUsage affiche l'aide des sous-commandes
+func printUsage() {
+	fmt.Fprintf(os.Stderr, `%s v%s
+
+Usage:
+  mon-rempart-agent [run]                       Lance l'agent (mode service)
+  mon-rempart-agent backup [chemins...]         Sauvegarde immédiate (défaut: chemins configurés)
+  mon-rempart-agent backup --dry-run [--price <€/Go>] [chemins...]
+                                                Aperçu : volume, plus gros dossiers, coût mensuel estimé
+  mon-rempart-agent snapshots                   Liste les snapshots du dépôt
+  mon-rempart-agent restore <id> --target <dossier> [--include <motif>]...
+                                                Restaure un snapshot
+  mon-rempart-agent dump <id|latest> <fichier> [--output <fichier>]
+                                                Extrait un fichier d'un snapshot (défaut: sortie standard)
+  mon-rempart-agent replicate                   Copie les snapshots vers le dépôt secondaire
+  mon-rempart-agent key list|add-recovery|remove <id>
+                                                Gère les clés du dépôt (clé de secours du client)
+  mon-rempart-agent tls check|csr [--force]     Vérifie la connexion TLS au Dashboard ou crée la demande de certificat client
+  mon-rempart-agent canary status|reset         État des fichiers témoins ou levée de l'alerte après vérification
+  mon-rempart-agent status                      État de l'agent, du dépôt et du service
+  mon-rempart-agent config show|validate        Affiche ou vérifie la configuration locale
+  mon-rempart-agent version                     Versions de l'agent et de restic
+  mon-rempart-agent install                     Installe l'agent comme service systemd
+  mon-rempart-agent uninstall                   Désinstalle le service systemd
+
+Options communes:
+  --json        Sortie JSON (scripts)
+  -v            Affiche les logs détaillés sur la sortie d'erreur
+
+Codes de sortie:
+  0 succès, 1 erreur, 2 arguments invalides, 3 configuration indisponible, 4 échec sur le dépôt
+`, AppName, Version)
+}
+
+// cliFlags regroupe les options communes aux sous-commandes
+type cliFlags struct {
+	json    bool
+	verbose bool
+}
+
+// newFlagSet crée le jeu d'options d'une sous-commande avec les options communes
+func newFlagSet(name string) (*flag.FlagSet, *cliFlags) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	common := &cliFlags{}
+	fs.BoolVar(&common.json, "json", false, "sortie JSON")
+	fs.BoolVar(&common.verbose, "v", false, "logs détaillés")
+	return fs, common
+}
+
+// parseArgs analyse les options en acceptant qu'elles suivent les arguments positionnels
+// (ex: restore <id> --target /tmp)
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// setupCLI charge la configuration et envoie les logs sur la sortie d'erreur,
+// pour que la sortie standard reste exploitable (--json)
+func setupCLI(common *cliFlags) {
+	level := "warn"
+	if common.verbose {
+		level = "info"
+	}
+	logging.Setup(logging.Options{Level: level, Output: os.Stderr})
+
+	activeConfig.Store(config.LoadConfig())
+	loadAppliedPolicy()
+	setupDashboardTransport()
+
+	var err error
+	hostname, err = os.Hostname()
+	if err != nil {
+		hostname = "inconnu"
+	}
+
+	// ID de l'agent installé : les logs envoyés au Dashboard lui sont rattachés
+	loadIdentity()
+	if agentIdentity != nil {
+		setAgentID(agentIdentity.ID())
+	}
+}
+
+// openRepository récupère la config distante et prépare le wrapper Restic
+func openRepository(initRepo bool) (*backup.ResticWrapper, int) {
+	// Dashboard injoignable : dernière configuration valide du service
+	remote, ok := loadConfig()
+	if !ok {
+		slog.Error("❌ Configuration distante indisponible (dashboard injoignable ou S3 non configuré)")
+		return nil, exitConfig
+	}
+
+	wrapper, err := newResticWrapper(remote)
+	remote.clearSecrets()
+	if err != nil {
+		slog.Error("❌ Restic non disponible", "error", err)
+		return nil, exitConfig
+	}
+
+	if initRepo {
+		if err := wrapper.InitRepo(); err != nil {
+			slog.Error("❌ Échec initialisation dépôt", "error", err)
+			return nil, exitBackupFailed
+		}
+	}
+
+	return wrapper, exitOK
+}
+
+// printJSON écrit v en JSON indenté sur la sortie standard
+func printJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// cmdBackup lance une sauvegarde immédiate
+func cmdBackup(args []string) int {
+	fs, common := newFlagSet("backup")
+	dryRun := fs.Bool("dry-run", false, "simulation : aperçu sans créer de snapshot")
+	price := fs.Float64("price", -1, "prix du stockage en €/Go/mois (défaut: configuration)")
+	noDatabases := fs.Bool("no-databases", false, "ne pas sauvegarder les bases de données configurées")
+	paths, err := parseArgs(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	setupCLI(common)
+	cfg := currentConfig()
+
+	// Les bases configurées sont sauvegardées avec les chemins de la configuration,
+	// pas lorsque des chemins sont donnés explicitement
+	withDatabases := len(paths) == 0 && !*noDatabases && !*dryRun && len(cfg.Databases) > 0
+	explicitPaths := len(paths) > 0
+	if len(paths) == 0 {
+		paths = cfg.BackupPaths
+	}
+	if len(paths) == 0 && !withDatabases {
+		fmt.Fprintln(os.Stderr, "Aucun chemin à sauvegarder (arguments ou backup_paths dans la configuration)")
+		return exitUsage
+	}
+
+	wrapper, code := openRepository(true)
+	if wrapper == nil {
+		return code
+	}
+
+	if *dryRun {
+		if *price < 0 {
+			*price = cfg.StoragePricePerGB
+		}
+		return runPreviewCLI(wrapper, paths, *price, common)
+	}
+
+	var (
+		result *backup.BackupResult
+		failed bool
+		// Faux après une sauvegarde suspecte dont l'historique n'a pas pu être protégé
+		historySafe = true
+	)
+	if len(paths) > 0 {
+		// L'index de la détection couvre les chemins configurés uniquement
+		opts := backupOptions()
+		var report *backup.RansomwareReport
+		if !explicitPaths {
+			report = checkRansomware(&opts, paths)
+			recordBackupAttempt(time.Now())
+		}
+		result, err = wrapper.RunBackupWithOptions(opts, paths...)
+		if !explicitPaths {
+			recordLastBackup("manuelle", result, err, true)
+		}
+		historySafe = handleSuspectBackup(wrapper, report, result)
+		if err != nil {
+			sendLogWithDetails("failed", err.Error(), 0, 0, 0, 0, hookDetails(result))
+		} else if result.Success {
+			sendLogWithDetails("success",
+				fmt.Sprintf("Snapshot %s créé (manuel)", result.SnapshotID),
+				result.BytesProcessed,
+				result.FilesNew,
+				result.FilesChanged,
+				int(result.Duration),
+				hookDetails(result),
+			)
+		}
+		failed = err != nil || !result.Success
+
+		if !common.json {
+			printBackupResult(result, err)
+		}
+	}
+
+	var dbResults []*backup.BackupResult
+	if withDatabases {
+		var dbFailed int
+		dbResults, dbFailed = runDatabaseBackups(wrapper)
+		failed = failed || dbFailed > 0
+
+		if !common.json {
+			for _, r := range dbResults {
+				if r.Error != "" {
+					fmt.Fprintf(os.Stderr, "❌ %s: %s\n", r.StdinFilename, r.Error)
+				} else {
+					fmt.Printf("✅ %s : snapshot %s (%s ajoutés)\n",
+						r.StdinFilename, r.SnapshotID, backup.FormatBytes(r.BytesAdded))
+				}
+			}
+		}
+	}
+
+	// Rétention après une sauvegarde réussie de la configuration, comme en mode service
+	if !explicitPaths && result != nil && result.Success && historySafe {
+		applyRetention(wrapper)
+	}
+
+	// La copie vers le dépôt secondaire suit la sauvegarde, comme en mode service
+	if historySafe && cfg.Replication.Enabled() && cfg.Replication.Mode == "after_backup" {
+		if err := initReplication(wrapper); err != nil {
+			slog.Error("❌ Réplication indisponible", "error", err)
+		} else if r := runReplication(wrapper); r != nil && !r.Success {
+			failed = true
+		}
+	}
+
+	if common.json {
+		if withDatabases {
+			printJSON(struct {
+				Files     *backup.BackupResult   `json:"files,omitempty"`
+				Databases []*backup.BackupResult `json:"databases"`
+			}{result, dbResults})
+		} else {
+			printJSON(result)
+		}
+	}
+
+	if failed {
+		return exitBackupFailed
+	}
+	return exitOK
+}
+
+// printBackupResult affiche le résultat d'une sauvegarde de fichiers
+func printBackupResult(result *backup.BackupResult, err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Échec sauvegarde: %v\n", err)
+		return
+	}
+	fmt.Printf("✅ Snapshot %s créé\n", result.SnapshotID)
+	fmt.Printf("   %d nouveaux, %d modifiés, %d inchangés\n",
+		result.FilesNew, result.FilesChanged, result.FilesUnmodified)
+	fmt.Printf("   %s ajoutés en %.1fs\n", backup.FormatBytes(result.BytesAdded), result.Duration)
+}
+
+// runPreviewCLI affiche l'aperçu d'une sauvegarde simulée
+func runPreviewCLI(wrapper *backup.ResticWrapper, paths []string, price float64, common *cliFlags) int {
+	result, err := wrapper.RunBackupWithOptions(backup.BackupOptions{DryRun: true}, paths...)
+	if err == nil && result.Preview == nil {
+		err = fmt.Errorf("aperçu indisponible")
+	}
+	if err != nil {
+		if common.json {
+			printJSON(result)
+		} else {
+			fmt.Fprintf(os.Stderr, "❌ Échec simulation: %v\n", err)
+		}
+		return exitBackupFailed
+	}
+
+	preview := result.Preview
+	preview.EstimateCost(price)
+
+	if common.json {
+		printJSON(preview)
+		return exitOK
+	}
+
+	fmt.Printf("🔍 Aperçu de sauvegarde (%s)\n\n", strings.Join(paths, ", "))
+	fmt.Printf("Fichiers analysés:   %d (%s)\n", preview.FilesTotal, backup.FormatBytes(preview.BytesTotal))
+	fmt.Printf("Nouveaux / modifiés: %d / %d\n", preview.FilesNew, preview.FilesChanged)
+	fmt.Printf("À envoyer (estimé):  %s\n", backup.FormatBytes(preview.BytesToUpload))
+	fmt.Printf("Coût mensuel estimé: %.2f € (%.4f €/Go/mois)\n", preview.EstimatedMonthlyCost, preview.PricePerGBMonth)
+
+	if len(preview.LargestDirs) > 0 {
+		fmt.Println("\nPlus gros dossiers:")
+		for _, d := range preview.LargestDirs {
+			fmt.Printf("  %12s  %6d fichiers  %s\n", backup.FormatBytes(d.Bytes), d.Files, d.Path)
+		}
+	}
+	if len(preview.LargestFiles) > 0 {
+		fmt.Println("\nPlus gros fichiers:")
+		for _, f := range preview.LargestFiles {
+			fmt.Printf("  %12s  %s\n", backup.FormatBytes(f.Bytes), f.Path)
+		}
+	}
+	return exitOK
+}
+
+// cmdSnapshots liste les snapshots du dépôt
+func cmdSnapshots(args []string) int {
+	fs, common := newFlagSet("snapshots")
+	if _, err := parseArgs(fs, args); err != nil {
+		return exitUsage
+	}
+	setupCLI(common)
+
+	wrapper, code := openRepository(false)
+	if wrapper == nil {
+		return code
+	}
+
+	snapshots, err := wrapper.GetSnapshots()
+	if err != nil {
+		slog.Error("❌ Échec récupération snapshots", "error", err)
+		return exitBackupFailed
+	}
+
+	if common.json {
+		if snapshots == nil {
+			snapshots = []backup.Snapshot{}
+		}
+		printJSON(snapshots)
+		return exitOK
+	}
+
+	if len(snapshots) == 0 {
+		fmt.Println("Aucun snapshot dans le dépôt")
+		return exitOK
+	}
+
+	fmt.Printf("%-10s  %-16s  %-20s  %s\n", "ID", "Date", "Hôte", "Chemins")
+	for _, s := range snapshots {
+		line := fmt.Sprintf("%-10s  %-16s  %-20s  %s",
+			s.ShortID, s.Time.Local().Format("02/01/2006 15:04"), s.Hostname, strings.Join(s.Paths, ", "))
+		if len(s.Tags) > 0 {
+			line += fmt.Sprintf("  [%s]", strings.Join(s.Tags, ", "))
+		}
+		fmt.Println(line)
+	}
+	fmt.Printf("\n%d snapshot(s)\n", len(snapshots))
+	return exitOK
+}
+
+// stringList est une option répétable (--include a --include b)
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// cmdRestore restaure un snapshot localement
+func cmdRestore(args []string) int {
+	fs, common := newFlagSet("restore")
+	target := fs.String("target", "", "dossier de destination (obligatoire)")
+	var include stringList
+	fs.Var(&include, "include", "motif de fichiers à restaurer (répétable)")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(positional) != 1 || *target == "" {
+		fmt.Fprintln(os.Stderr, "Usage: mon-rempart-agent restore <snapshot-id> --target <dossier> [--include <motif>]...")
+		return exitUsage
+	}
+	setupCLI(common)
+
+	snapshotID := positional[0]
+
+	wrapper, code := openRepository(false)
+	if wrapper == nil {
+		return code
+	}
+
+	result, err := wrapper.Restore(snapshotID, *target, include...)
+	if err != nil {
+		sendActivityLog("error", fmt.Sprintf("Restauration locale échouée: %v", err), nil)
+	} else {
+		sendActivityLog("info", fmt.Sprintf("Restauration locale du snapshot %s vers %s réussie",
+			snapshotID, *target), map[string]interface{}{"include": []string(include)})
+	}
+
+	if common.json {
+		printJSON(result)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Échec restauration: %v\n", err)
+	} else {
+		fmt.Printf("✅ Snapshot %s restauré vers %s en %.1fs\n", snapshotID, *target, result.Duration)
+	}
+
+	if err != nil || !result.Success {
+		return exitBackupFailed
+	}
+	return exitOK
+}
+
+// cmdDump extrait un fichier d'un snapshot vers la sortie standard ou un fichier,
+// par exemple un dump de base : dump latest /compta.pgdump | pg_restore ...
+func cmdDump(args []string) int {
+	fs, common := newFlagSet("dump")
+	output := fs.String("output", "", "fichier de destination (défaut: sortie standard)")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(positional) != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: mon-rempart-agent dump <id|latest> <fichier> [--output <fichier>]")
+		return exitUsage
+	}
+	setupCLI(common)
+
+	wrapper, code := openRepository(false)
+	if wrapper == nil {
+		return code
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *output == "" {
+		if err := wrapper.Dump(ctx, positional[0], positional[1], os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return exitBackupFailed
+		}
+		return exitOK
+	}
+
+	f, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+	err = wrapper.Dump(ctx, positional[0], positional[1], f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		// Pas de fichier partiel
+		os.Remove(*output)
+		return exitBackupFailed
+	}
+	return exitOK
+}
+
+// cmdCanary affiche l'état des fichiers témoins ou lève l'alerte
+func cmdCanary(args []string) int {
+	fs, common := newFlagSet("canary")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(positional) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: mon-rempart-agent canary status|reset")
+		return exitUsage
+	}
+	setupCLI(common)
+
+	switch positional[0] {
+	case "status":
+		// Vérification des empreintes, comme le service
+		state := checkCanaries()
+		if state == nil {
+			return exitError
+		}
+		status := CanaryStatus{Files: len(state.Files), Triggered: state.Trigger}
+		if common.json {
+			printJSON(status)
+		} else if t := status.Triggered; t != nil {
+			fmt.Printf("🚨 Fichier témoin %s : %s (%s)\n", t.Reason, t.Path, t.Time.Local().Format("02/01/2006 15:04"))
+			for _, other := range t.Others {
+				fmt.Printf("   aussi touché : %s\n", other)
+			}
+			fmt.Println("Sauvegardes planifiées suspendues. Après vérification du poste : mon-rempart-agent canary reset")
+		} else {
+			fmt.Printf("✅ %d fichier(s) témoin(s) intact(s)\n", status.Files)
+			for _, f := range state.Files {
+				fmt.Printf("   %s\n", f.Path)
+			}
+		}
+		if status.Triggered != nil {
+			return exitError
+		}
+		return exitOK
+
+	case "reset":
+		status, err := resetCanaries()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return exitError
+		}
+		sendActivityLog("info", "Fichiers témoins réinitialisés, sauvegardes planifiées reprises", nil)
+		if common.json {
+			printJSON(status)
+		} else {
+			fmt.Printf("✅ Alerte levée, %d fichier(s) témoin(s) déposé(s)\n", status.Files)
+		}
+		return exitOK
+
+	default:
+		fmt.Fprintf(os.Stderr, "Action inconnue: %s\n", positional[0])
+		return exitUsage
+	}
+}
+
+// cmdReplicate copie vers le dépôt secondaire les snapshots qui n'y sont pas encore
+func cmdReplicate(args []string) int {
+	fs, common := newFlagSet("replicate")
+	if _, err := parseArgs(fs, args); err != nil {
+		return exitUsage
+	}
+	setupCLI(common)
+
+	if !currentConfig().Replication.Enabled() {
+		fmt.Fprintln(os.Stderr, "Aucun dépôt secondaire configuré (replication.repository)")
+		return exitConfig
+	}
+
+	wrapper, code := openRepository(false)
+	if wrapper == nil {
+		return code
+	}
+	if err := initReplication(wrapper); err != nil {
+		slog.Error("❌ Réplication indisponible", "error", err)
+		return exitConfig
+	}
+
+	result := runReplication(wrapper)
+	if common.json {
+		printJSON(result)
+	} else if result.Success {
+		fmt.Printf("✅ %d snapshot(s) présents dans le dépôt secondaire, %d manquant(s) (%.1fs)\n",
+			result.Replicated, result.Missing, result.Duration)
+	} else {
+		fmt.Fprintf(os.Stderr, "❌ %s\n", result.Error)
+	}
+
+	if !result.Success {
+		return exitBackupFailed
+	}
+	return exitOK
+}
+
+// cmdKey gère les clés du dépôt : liste, clé de secours du client, suppression.
+// La rotation du mot de passe principal se fait depuis le Dashboard (commande rotate_key).
+func cmdKey(args []string) int {
+	fs, common := newFlagSet("key")
+	passwordFile := fs.String("password-file", "", "fichier contenant le mot de passe de la clé de secours")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(positional) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: mon-rempart-agent key list|add-recovery [--password-file <fichier>]|remove <id>")
+		return exitUsage
+	}
+	setupCLI(common)
+
+	action := positional[0]
+	if (action == "remove") != (len(positional) == 2) || len(positional) > 2 {
+		fmt.Fprintln(os.Stderr, "Usage: mon-rempart-agent key list|add-recovery [--password-file <fichier>]|remove <id>")
+		return exitUsage
+	}
+
+	wrapper, code := openRepository(false)
+	if wrapper == nil {
+		return code
+	}
+
+	switch action {
+	case "list":
+		keys, err := wrapper.ListKeys()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return exitBackupFailed
+		}
+		if common.json {
+			printJSON(keys)
+			return exitOK
+		}
+		fmt.Printf("  %-10s  %-12s  %-20s  %s\n", "ID", "Utilisateur", "Hôte", "Créée le")
+		for _, k := range keys {
+			mark := " "
+			if k.Current {
+				mark = "*"
+			}
+			fmt.Printf("%s %-10s  %-12s  %-20s  %s\n", mark, shortID(k.ID), k.UserName, k.HostName, k.Created)
+		}
+		fmt.Println("\n* clé utilisée par l'agent")
+		return exitOK
+
+	case "add-recovery":
+		password, err := readRecoveryPassword(*passwordFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return exitUsage
+		}
+		id, err := wrapper.AddRecoveryKey(password, hostname)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return exitBackupFailed
+		}
+		sendActivityLog("info", "Clé de secours ajoutée au dépôt", map[string]interface{}{"key_id": id})
+		if common.json {
+			printJSON(map[string]string{"key_id": id})
+		} else {
+			fmt.Printf("✅ Clé de secours %s ajoutée. Conservez le mot de passe hors ligne : il donne accès à toutes les sauvegardes.\n", shortID(id))
+		}
+		return exitOK
+
+	case "remove":
+		if err := wrapper.RemoveKey(positional[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return exitBackupFailed
+		}
+		sendActivityLog("warning", "Clé supprimée du dépôt", map[string]interface{}{"key_id": positional[1]})
+		if !common.json {
+			fmt.Println("✅ Clé supprimée")
+		}
+		return exitOK
+
+	default:
+		fmt.Fprintf(os.Stderr, "Action inconnue: %s\n", action)
+		return exitUsage
+	}
+}
+
+// tlsCertificate décrit un certificat de la chaîne présentée par le Dashboard
+type tlsCertificate struct {
+	Subject  string    `json:"subject"`
+	Issuer   string    `json:"issuer"`
+	SPKI     string    `json:"spki_sha256"`
+	NotAfter time.Time `json:"not_after"`
+}
+
+// tlsCheck est le résultat de tls check
+type tlsCheck struct {
+	Endpoint    string           `json:"endpoint"`
+	Chain       []tlsCertificate `json:"chain"`
+	Verified    bool             `json:"verified"`
+	Intercepted bool             `json:"intercepted"`
+	Error       string           `json:"error,omitempty"`
+}
+
+// cmdTLS vérifie la connexion TLS au Dashboard ou prépare le certificat client
+func cmdTLS(args []string) int {
+	fs, common := newFlagSet("tls")
+	force := fs.Bool("force", false, "remplace la clé client existante (csr)")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(positional) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: mon-rempart-agent tls check|csr [--force]")
+		return exitUsage
+	}
+	setupCLI(common)
+
+	switch positional[0] {
+	case "check":
+		return tlsCheckCommand(common)
+	case "csr":
+		return tlsCSRCommand(common, *force)
+	default:
+		fmt.Fprintf(os.Stderr, "Action inconnue: %s\n", positional[0])
+		return exitUsage
+	}
+}
+
+// tlsCheckCommand affiche la chaîne présentée par le Dashboard (empreintes à
+// épingler) et le résultat de la vérification selon la politique TLS
+func tlsCheckCommand(common *cliFlags) int {
+	cfg := currentConfig()
+	u, err := neturl.Parse(cfg.APIEndpoint)
+	if err != nil || u.Scheme != "https" {
+		fmt.Fprintf(os.Stderr, "❌ api_endpoint n'est pas en https: %s\n", cfg.APIEndpoint)
+		return exitConfig
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "443")
+	}
+
+	check := tlsCheck{Endpoint: cfg.APIEndpoint}
+	// Lecture seule de la chaîne, pour l'afficher même si elle est refusée
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", addr,
+		&tls.Config{ServerName: u.Hostname(), InsecureSkipVerify: true})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Connexion impossible: %v\n", err)
+		return exitConfig
+	}
+	for _, cert := range conn.ConnectionState().PeerCertificates {
+		check.Chain = append(check.Chain, tlsCertificate{
+			Subject:  cert.Subject.CommonName,
+			Issuer:   cert.Issuer.CommonName,
+			SPKI:     tlspolicy.SPKIFingerprint(cert),
+			NotAfter: cert.NotAfter,
+		})
+	}
+	conn.Close()
+
+	// Vérification réelle, avec la politique de l'agent
+	code := exitOK
+	resp, err := newDashboardClient(10 * time.Second).Get(cfg.APIEndpoint)
+	if err != nil {
+		check.Error = err.Error()
+		check.Intercepted = errors.Is(err, tlspolicy.ErrIntercepted)
+		code = exitConfig
+	} else {
+		resp.Body.Close()
+		check.Verified = true
+	}
+
+	if common.json {
+		printJSON(check)
+		return code
+	}
+	for i, c := range check.Chain {
+		fmt.Printf("[%d] %s\n    émetteur: %s\n    expire:   %s\n    spki:     %s\n",
+			i, c.Subject, c.Issuer, c.NotAfter.Local().Format("02/01/2006"), c.SPKI)
+	}
+	switch {
+	case check.Verified:
+		fmt.Println("✅ Connexion vérifiée")
+	case check.Intercepted:
+		fmt.Printf("🚨 %s\n", check.Error)
+	default:
+		fmt.Printf("❌ %s\n", check.Error)
+	}
+	return code
+}
+
+// tlsCSRCommand crée la clé du certificat client (client.key, 0600) et la
+// demande de certificat (client.csr) à faire signer par l'autorité qui
+// délivre les certificats des agents ; le certificat signé se place dans
+// client.crt, utilisé au prochain démarrage
+func tlsCSRCommand(common *cliFlags, force bool) int {
+	cfg := currentConfig()
+	keyPath := filepath.Join(cfg.Dir(), config.ClientKeyFile)
+	csrPath := filepath.Join(cfg.Dir(), "client.csr")
+	if _, err := os.Stat(keyPath); err == nil && !force {
+		fmt.Fprintf(os.Stderr, "❌ %s existe déjà (--force pour la remplacer)\n", keyPath)
+		return exitError
+	}
+
+	name := hostname
+	if id := currentAgentID(); id != "" {
+		name = id
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: name, Organization: []string{AppName}},
+		DNSNames: []string{hostname},
+	}, key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+
+	csrPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER})
+	if err := os.MkdirAll(cfg.Dir(), 0700); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+	if err := os.WriteFile(csrPath, csrPEM, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitError
+	}
+
+	if common.json {
+		printJSON(map[string]string{"key": keyPath, "csr": csrPath, "common_name": name, "pem": string(csrPEM)})
+		return exitOK
+	}
+	fmt.Print(string(csrPEM))
+	fmt.Fprintf(os.Stderr, "✅ Demande créée (%s). Placez le certificat signé dans %s\n",
+		csrPath, filepath.Join(cfg.Dir(), config.ClientCertFile))
+	return exitOK
+}
+
+// shortID retourne l'identifiant court (8 caractères) d'un objet restic
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+// readRecoveryPassword lit le mot de passe de la clé de secours depuis un
+// fichier ou l'entrée standard (première ligne)
+func readRecoveryPassword(path string) (string, error) {
+	var data []byte
+	var err error
+	if path != "" {
+		data, err = os.ReadFile(path)
+	} else {
+		fmt.Fprint(os.Stderr, "Mot de passe de la clé de secours: ")
+		var line string
+		line, err = bufio.NewReader(os.Stdin).ReadString('\n')
+		data = []byte(line)
+		if err == io.EOF && line != "" {
+			err = nil
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	password := strings.TrimRight(strings.SplitN(string(data), "\n", 2)[0], "\r")
+	if len(password) < 12 {
+		return "", fmt.Errorf("mot de passe trop court (12 caractères minimum)")
+	}
+	return password, nil
+}
+
+// agentStatus représente l'état local de l'agent
+type agentStatus struct {
+	Version      string         `json:"version"`
+	Hostname     string         `json:"hostname"`
+	ConfigPath   string         `json:"config_path"`
+	APIEndpoint  string         `json:"api_endpoint"`
+	Dashboard    string         `json:"dashboard"`
+	Repository   string         `json:"repository"`
+	Backend      string         `json:"backend,omitempty"`
+	Snapshots    int            `json:"snapshots"`
+	LastSnapshot *time.Time     `json:"last_snapshot,omitempty"`
+	Service      *service.State `json:"service,omitempty"`
+
+	Replication *backup.ReplicationState `json:"replication,omitempty"`
+	// Mode du service : en ligne ou hors ligne (configuration en cache)
+	Connectivity *ConnectivityState `json:"connectivity,omitempty"`
+	// Logs en attente d'envoi au Dashboard
+	Outbox int `json:"outbox"`
+	// Version de la politique de sauvegarde du Dashboard en vigueur (0 : aucune)
+	PolicyVersion int `json:"policy_version"`
+	// Fichiers témoins (absent : désactivés)
+	Canary *CanaryStatus `json:"canary,omitempty"`
+	// Raisons actuelles de reporter une sauvegarde planifiée (vide : poste disponible)
+	Busy []governor.Reason `json:"busy,omitempty"`
+	// Dernières sauvegardes complètes et plages des sauvegardes automatiques
+	History *BackupHistory `json:"history,omitempty"`
+	Window  string         `json:"window,omitempty"` // Raison de l'attente (vide : plage ouverte)
+}
+
+// cmdStatus affiche l'état de l'agent, du dépôt et du service
+func cmdStatus(args []string) int {
+	fs, common := newFlagSet("status")
+	if _, err := parseArgs(fs, args); err != nil {
+		return exitUsage
+	}
+	setupCLI(common)
+	cfg := currentConfig()
+
+	status := agentStatus{
+		Version:     Version,
+		Hostname:    hostname,
+		ConfigPath:  cfg.ConfigPath,
+		APIEndpoint: cfg.APIEndpoint,
+		Dashboard:   "injoignable ou non configuré",
+		Repository:  "inconnu",
+	}
+	code := exitOK
+
+	if state, err := service.Query(); err == nil {
+		status.Service = state
+	}
+
+	// État de la dernière réplication, sans contacter le dépôt secondaire
+	if cfg.Replication.Enabled() {
+		if state, err := backup.LoadReplicationState(replicationStatePath()); err == nil {
+			status.Replication = state
+		}
+	}
+
+	if state, err := loadConnectivityState(); err == nil {
+		status.Connectivity = state
+	}
+	status.Outbox = outboxDepth()
+	status.PolicyVersion = appliedPolicyVersion()
+	loadCanaryTrigger()
+	status.Canary = canaryStatus()
+	_, status.Busy = busyReasons()
+	status.History = loadBackupHistory()
+	if ok, reason := backupWindows().Allows(time.Now()); !ok {
+		status.Window = reason
+	}
+
+	wrapper, c := openRepository(false)
+	switch {
+	case connectivity.interception() != "":
+		status.Dashboard = "connexion interceptée"
+		if status.Connectivity == nil {
+			status.Connectivity = &ConnectivityState{Mode: ModeOnline}
+		}
+		status.Connectivity.Intercepted = connectivity.interception()
+	case currentRemoteConfig() != nil && connectivity.Offline():
+		status.Dashboard = "injoignable (configuration en cache)"
+	case currentRemoteConfig() != nil:
+		status.Dashboard = "ok"
+	}
+	if wrapper == nil {
+		code = c
+	} else {
+		status.Backend = wrapper.Backend().Type()
+		snapshots, err := wrapper.GetSnapshots()
+		if err != nil {
+			status.Repository = err.Error()
+			code = exitBackupFailed
+		} else {
+			status.Repository = "ok"
+			status.Snapshots = len(snapshots)
+			for _, s := range snapshots {
+				if status.LastSnapshot == nil || s.Time.After(*status.LastSnapshot) {
+					t := s.Time
+					status.LastSnapshot = &t
+				}
+			}
+		}
+	}
+
+	if common.json {
+		printJSON(status)
+		return code
+	}
+
+	fmt.Printf("Agent:            %s v%s (%s)\n", AppName, status.Version, status.Hostname)
+	fmt.Printf("Configuration:    %s\n", status.ConfigPath)
+	fmt.Printf("Dashboard:        %s (%s)\n", status.Dashboard, status.APIEndpoint)
+	if status.Backend != "" {
+		fmt.Printf("Dépôt:            %s (%s)\n", status.Repository, status.Backend)
+	} else {
+		fmt.Printf("Dépôt:            %s\n", status.Repository)
+	}
+	if status.Repository == "ok" {
+		fmt.Printf("Snapshots:        %d\n", status.Snapshots)
+		if status.LastSnapshot != nil {
+			fmt.Printf("Dernier snapshot: %s\n", status.LastSnapshot.Local().Format("02/01/2006 15:04"))
+		}
+	}
+	if r := status.Replication; r != nil {
+		switch {
+		case r.LastRun.IsZero():
+			fmt.Println("Réplication:      jamais exécutée")
+		case r.LastError != "":
+			fmt.Printf("Réplication:      échec le %s (%s)\n", r.LastRun.Local().Format("02/01/2006 15:04"), r.LastError)
+		default:
+			fmt.Printf("Réplication:      %d snapshot(s) copiés, dernière copie le %s\n",
+				len(r.Snapshots), r.LastSuccess.Local().Format("02/01/2006 15:04"))
+		}
+	}
+	if c := status.Connectivity; c != nil && c.Mode == ModeOffline {
+		fmt.Printf("Mode:             hors ligne depuis le %s (%d sauvegarde(s))\n",
+			c.Since.Local().Format("02/01/2006 15:04"), c.OfflineBackups)
+	}
+	if c := status.Connectivity; c != nil && c.Intercepted != "" {
+		fmt.Printf("TLS:              🚨 %s\n", c.Intercepted)
+	}
+	if c := status.Canary; c != nil && c.Triggered != nil {
+		fmt.Printf("Témoins:          🚨 %s (%s) le %s - sauvegardes planifiées suspendues\n",
+			c.Triggered.Path, c.Triggered.Reason, c.Triggered.Time.Local().Format("02/01/2006 15:04"))
+	} else if c != nil {
+		fmt.Printf("Témoins:          %d fichier(s) intact(s)\n", c.Files)
+	}
+	if h := status.History; !h.LastAttempt.IsZero() {
+		success := "aucune réussie"
+		if !h.LastSuccess.IsZero() {
+			success = "dernière réussie le " + h.LastSuccess.Local().Format("02/01/2006 15:04")
+		}
+		fmt.Printf("Sauvegardes:      %s (tentative le %s)\n", success, h.LastAttempt.Local().Format("02/01/2006 15:04"))
+	}
+	if status.Window != "" {
+		fmt.Printf("Plages:           ⏸️  %s - prochaine ouverture %s\n", status.Window, formatNext(backupWindows().NextAllowed(time.Now())))
+	}
+	if len(status.Busy) > 0 {
+		fmt.Printf("Poste:            ⏳ %s - sauvegardes planifiées reportées\n", governor.Messages(status.Busy))
+	}
+	if status.PolicyVersion > 0 {
+		fmt.Printf("Politique:        version %d (planification %s)\n", status.PolicyVersion, cfg.BackupSchedule)
+	}
+	if status.Outbox > 0 {
+		fmt.Printf("Logs en attente:  %d\n", status.Outbox)
+	}
+	if status.Service != nil {
+		if status.Service.Installed {
+			fmt.Printf("Service:          %s (%s)\n", status.Service.Active, status.Service.Enabled)
+		} else {
+			fmt.Println("Service:          non installé")
+		}
+	}
+	return code
+}
+
+// cmdConfig affiche ou valide la configuration locale
+func cmdConfig(args []string) int {
+	fs, common := newFlagSet("config")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(positional) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: mon-rempart-agent config show|validate [--json]")
+		return exitUsage
+	}
+
+	level := "error"
+	if common.verbose {
+		level = "info"
+	}
+	logging.Setup(logging.Options{Level: level, Output: os.Stderr})
+	localConfig, loadErr := config.Load()
+
+	switch positional[0] {
+	case "show":
+		if loadErr != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  %s ignoré: %v\n", localConfig.ConfigPath, loadErr)
+		}
+		if !common.json {
+			fmt.Printf("# %s (secrets masqués)\n", localConfig.ConfigPath)
+		}
+		printJSON(localConfig.Redacted())
+		return exitOK
+
+	case "validate":
+		var problems []string
+		if loadErr != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", localConfig.ConfigPath, loadErr))
+		}
+		if err := localConfig.Validate(); err != nil {
+			problems = append(problems, strings.Split(err.Error(), "\n")...)
+		}
+
+		if common.json {
+			if problems == nil {
+				problems = []string{}
+			}
+			printJSON(map[string]interface{}{
+				"config_path": localConfig.ConfigPath,
+				"valid":       len(problems) == 0,
+				"errors":      problems,
+			})
+		} else if len(problems) == 0 {
+			fmt.Printf("✅ Configuration valide (%s)\n", localConfig.ConfigPath)
+		} else {
+			fmt.Printf("❌ Configuration invalide (%s)\n", localConfig.ConfigPath)
+			for _, p := range problems {
+				fmt.Printf("   • %s\n", p)
+			}
+		}
+
+		if len(problems) > 0 {
+			return exitConfig
+		}
+		return exitOK
+
+	default:
+		fmt.Fprintf(os.Stderr, "Sous-commande config inconnue: %s (show ou validate)\n", positional[0])
+		return exitUsage
+	}
+}
+
+// cmdVersion affiche les versions de l'agent et de restic
+func cmdVersion(args []string) int {
+	fs, common := newFlagSet("version")
+	if _, err := parseArgs(fs, args); err != nil {
+		return exitUsage
+	}
+
+	resticVersion, err := backup.ResticVersion()
+	if err != nil {
+		resticVersion = "non disponible"
+	}
+
+	info := map[string]string{
+		"version":    Version,
+		"go_version": runtime.Version(),
+		"os":         runtime.GOOS,
+		"arch":       runtime.GOARCH,
+		"restic":     resticVersion,
+	}
+
+	if common.json {
+		printJSON(info)
+		return exitOK
+	}
+
+	fmt.Printf("%s v%s (%s, %s/%s)\n", AppName, Version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Printf("Restic: %s\n", resticVersion)
+	return exitOK
+}
+
+// cmdInstall installe le service systemd
+func cmdInstall(args []string) int {
+	fs := flag.NewFlagSet("install", flag.ContinueOnError)
+	binPath := fs.String("bin", service.DefaultBinaryPath, "emplacement du binaire installé")
+	user := fs.String("user", service.DefaultUser, "utilisateur système dédié")
+	envFile := fs.String("env-file", service.DefaultEnvFile, "fichier d'environnement")
+	stateDir := fs.String("state-dir", service.DefaultStateDir, "dossier d'état du service")
+	paths := fs.String("paths", "", "répertoires sauvegardés (séparés par des virgules)")
+	restoreDir := fs.String("restore-dir", "", "répertoire de restauration accessible en écriture")
+	watchdog := fs.Int("watchdog", service.DefaultWatchdogSec, "délai du watchdog en secondes (0 = désactivé)")
+	canaries := fs.Bool("canaries", os.Getenv("MONREMPART_CANARY_ENABLED") == "true", "dépose les fichiers témoins dans les répertoires sauvegardés")
+	printOnly := fs.Bool("print", false, "affiche l'unité générée sans rien installer")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	logging.Setup(logging.Options{Level: "info", Output: os.Stderr})
+
+	opts := service.Options{
+		BinaryPath:  *binPath,
+		User:        *user,
+		EnvFile:     *envFile,
+		StateDir:    *stateDir,
+		BackupPaths: splitList(*paths),
+		WatchdogSec: *watchdog,
+		Environment: agentEnvironment(),
+	}
+	if *restoreDir != "" {
+		opts.WritablePaths = []string{*restoreDir}
+	}
+	// Déposés avant le bac à sable : le service ne peut pas écrire dans les
+	// répertoires sauvegardés, seulement réécrire ces fichiers
+	if *canaries {
+		opts.CanaryFiles = canaryPaths(opts.BackupPaths)
+		if !*printOnly && os.Geteuid() == 0 {
+			opts.CanaryFiles = installCanaries(opts.CanaryFiles)
+		}
+	}
+
+	if *printOnly {
+		unit, err := service.UnitFile(opts)
+		if err != nil {
+			slog.Error("❌ Génération de l'unité impossible", "error", err)
+			return exitError
+		}
+		fmt.Print(unit)
+		return exitOK
+	}
+
+	if err := service.Install(opts); err != nil {
+		slog.Error("❌ Installation du service échouée", "error", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// cmdUninstall désinstalle le service systemd
+func cmdUninstall(args []string) int {
+	fs := flag.NewFlagSet("uninstall", flag.ContinueOnError)
+	binPath := fs.String("bin", service.DefaultBinaryPath, "emplacement du binaire installé")
+	user := fs.String("user", service.DefaultUser, "utilisateur système dédié")
+	envFile := fs.String("env-file", service.DefaultEnvFile, "fichier d'environnement")
+	stateDir := fs.String("state-dir", service.DefaultStateDir, "dossier d'état du service")
+	purge := fs.Bool("purge", false, "supprime aussi la configuration, les données et l'utilisateur")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	logging.Setup(logging.Options{Level: "info", Output: os.Stderr})
+
+	opts := service.Options{
+		BinaryPath: *binPath,
+		User:       *user,
+		EnvFile:    *envFile,
+		StateDir:   *stateDir,
+	}
+
+	if err := service.Uninstall(opts, *purge); err != nil {
+		slog.Error("❌ Désinstallation du service échouée", "error", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// agentEnvironment retourne les variables MONREMPART_* de l'environnement courant
+func agentEnvironment() map[string]string {
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		key, value, ok := strings.Cut(kv, "=")
+		if ok && strings.HasPrefix(key, "MONREMPART_") {
+			env[key] = value
+		}
+	}
+	return env
+}
+
+// splitList découpe une liste séparée par des virgules en ignorant les éléments vides
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -2,63 +2,649 @@
 package config
 
 import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mon-rempart/agent/schedule"
+	"github.com/mon-rempart/agent/tlspolicy"
 )
 
-// Config contient toutes les configurations de l'agent
+// Config contient toutes les configurations de l'agent.
+// Ordre de priorité : valeurs par défaut < fichier config.json < variables d'environnement.
 type Config struct {
 	// Chemins
-	ConfigPath   string   // Chemin du fichier de configuration
-	BackupPaths  []string // Répertoires à sauvegarder
-	ExcludePaths []string // Répertoires à exclure
+	ConfigPath   string   `json:"-"`                       // Chemin du fichier de configuration
+	BackupPaths  []string `json:"backup_paths,omitempty"`  // Répertoires à sauvegarder
+	ExcludePaths []string `json:"exclude_paths,omitempty"` // Répertoires à exclure
 
 	// API Dashboard
-	APIEndpoint string // URL de l'API du Dashboard
-	APIKey      string // Clé d'authentification
+	APIEndpoint string `json:"api_endpoint,omitempty"` // URL de l'API du Dashboard
+	APIKey      string `json:"api_key,omitempty"`      // Clé d'authentification
 
 	// Stockage S3 (Scaleway)
-	S3Endpoint  string // Endpoint S3 Scaleway
-	S3Bucket    string // Nom du bucket
-	S3AccessKey string // Clé d'accès S3
-	S3SecretKey string // Clé secrète S3
+	S3Endpoint  string `json:"s3_endpoint,omitempty"`   // Endpoint S3 Scaleway
+	S3Bucket    string `json:"s3_bucket,omitempty"`     // Nom du bucket
+	S3AccessKey string `json:"s3_access_key,omitempty"` // Clé d'accès S3
+	S3SecretKey string `json:"s3_secret_key,omitempty"` // Clé secrète S3
 
 	// Restic
-	ResticPath     string // Chemin vers l'exécutable Restic
-	ResticPassword string // Mot de passe du dépôt Restic
+	ResticPath     string `json:"restic_path,omitempty"`     // Chemin vers l'exécutable Restic
+	ResticPassword string `json:"restic_password,omitempty"` // Mot de passe du dépôt Restic
 
 	// Planification
-	BackupSchedule string // Expression cron pour les sauvegardes
+	BackupSchedule string   `json:"backup_schedule,omitempty"` // Expression cron pour les sauvegardes
+	BackupWindows  []string `json:"backup_windows,omitempty"`  // Plages des sauvegardes automatiques ("22:00-06:00", "lun-ven 12:00-14:00")
+	BlackoutDates  []string `json:"blackout_dates,omitempty"`  // Jours sans sauvegarde automatique ("2027-03-14", "2027-03-14/2027-03-21")
+	// Décalage maximal des sauvegardes planifiées, propre à chaque agent : un
+	// parc sur la même planification n'écrit pas dans le stockage à la même seconde
+	ScheduleJitterMinutes int `json:"schedule_jitter_minutes,omitempty"`
+
+	// Sauvegardes déclenchées par les modifications des dossiers sauvegardés
+	Continuous ContinuousConfig `json:"continuous,omitempty"`
+
+	// Snapshots conservés après chaque sauvegarde (restic forget --prune)
+	Retention RetentionConfig `json:"retention,omitempty"`
+
+	// Limites de débit de restic
+	Bandwidth BandwidthConfig `json:"bandwidth,omitempty"`
+
+	// Priorité de restic et report des sauvegardes quand le poste est chargé
+	Resources ResourcesConfig `json:"resources,omitempty"`
+
+	// Détection de rançongiciel avant chaque sauvegarde
+	Ransomware RansomwareConfig `json:"ransomware,omitempty"`
+
+	// Fichiers témoins déposés dans les dossiers sauvegardés
+	Canary CanaryConfig `json:"canary,omitempty"`
+
+	// Accepte les hooks de la politique du Dashboard : ils s'exécutent sur le
+	// poste, désactivé par défaut
+	AllowRemoteHooks bool `json:"allow_remote_hooks,omitempty"`
+
+	// Politique TLS de la connexion au Dashboard
+	TLS TLSConfig `json:"tls,omitempty"`
+
+	// Clé publique Ed25519 (base64) des commandes signées du Dashboard, fournie
+	// à l'installation ; à défaut, celle annoncée au premier heartbeat est épinglée
+	CommandPublicKey string `json:"command_public_key,omitempty"`
+
+	// Hooks exécutés autour des sauvegardes
+	Hooks HooksConfig `json:"hooks,omitempty"`
+
+	// Bases de données sauvegardées par dump (pg_dump, mysqldump, sqlite3)
+	Databases []DatabaseConfig `json:"databases,omitempty"`
+
+	// Dépôt principal fourni localement (serveur REST départemental, NAS...),
+	// prioritaire sur le stockage défini dans le Dashboard
+	Storage RepositoryConfig `json:"storage,omitempty"`
+
+	// Copie des snapshots vers un dépôt secondaire (règle 3-2-1)
+	Replication ReplicationConfig `json:"replication,omitempty"`
+
+	// Estimation des coûts
+	StoragePricePerGB float64 `json:"storage_price_eur_gb,omitempty"` // Prix du stockage en €/Go/mois
+
+	// Journalisation
+	LogLevel      string `json:"log_level,omitempty"`        // Niveau minimal (debug, info, warn, error)
+	LogFormat     string `json:"log_format,omitempty"`       // Format des logs structurés (text ou json)
+	LogDir        string `json:"log_dir,omitempty"`          // Dossier des fichiers de log rotatifs
+	LogMaxSizeMB  int    `json:"log_max_size_mb,omitempty"`  // Taille maximale d'un fichier avant rotation
+	LogMaxAgeDays int    `json:"log_max_age_days,omitempty"` // Durée de conservation des anciens fichiers
+}
+
+// HooksConfig décrit les commandes exécutées autour des sauvegardes
+type HooksConfig struct {
+	PreBackup        []string `json:"pre_backup,omitempty"`          // Avant la sauvegarde (arrêt d'un logiciel, dump...)
+	PostBackup       []string `json:"post_backup,omitempty"`         // Après la sauvegarde, avec le résultat en variables MONREMPART_*
+	OnFailure        []string `json:"on_failure,omitempty"`          // Uniquement en cas d'échec
+	TimeoutSeconds   int      `json:"timeout_seconds,omitempty"`     // Délai maximal par commande
+	OnPreHookFailure string   `json:"on_pre_hook_failure,omitempty"` // "abort" (défaut) ou "warn"
+}
+
+// ContinuousConfig règle la protection quasi continue : les dossiers modifiés
+// sont sauvegardés peu après, en plus de la planification
+type ContinuousConfig struct {
+	Enabled            bool `json:"enabled,omitempty"`              // Surveille les dossiers sauvegardés
+	DebounceSeconds    int  `json:"debounce_seconds,omitempty"`     // Calme requis après la dernière modification
+	MinIntervalMinutes int  `json:"min_interval_minutes,omitempty"` // Délai minimal entre deux sauvegardes continues
+	MaxPerHour         int  `json:"max_per_hour,omitempty"`         // Nombre maximal de sauvegardes continues par heure
+}
+
+// RetentionConfig décrit les snapshots conservés ; sans aucune règle, rien n'est supprimé
+type RetentionConfig struct {
+	KeepLast    int `json:"keep_last,omitempty"`    // N derniers snapshots
+	KeepDaily   int `json:"keep_daily,omitempty"`   // Un par jour sur N jours
+	KeepWeekly  int `json:"keep_weekly,omitempty"`  // Un par semaine sur N semaines
+	KeepMonthly int `json:"keep_monthly,omitempty"` // Un par mois sur N mois
+	KeepYearly  int `json:"keep_yearly,omitempty"`  // Un par an sur N ans
 }
 
-// LoadConfig charge la configuration depuis les variables d'environnement
-// ou utilise des valeurs par défaut
+// Enabled indique si une règle de rétention est définie
+func (r RetentionConfig) Enabled() bool {
+	return r.KeepLast > 0 || r.KeepDaily > 0 || r.KeepWeekly > 0 || r.KeepMonthly > 0 || r.KeepYearly > 0
+}
+
+// RansomwareConfig règle l'analyse des fichiers avant chaque sauvegarde
+type RansomwareConfig struct {
+	Disabled  bool `json:"disabled,omitempty"`  // Désactive l'analyse
+	Threshold int  `json:"threshold,omitempty"` // Score (1 à 100) à partir duquel le snapshot est suspect
+}
+
+// CanaryConfig règle les fichiers témoins : des documents leurres dont toute
+// modification signale une attaque en cours
+type CanaryConfig struct {
+	Enabled      bool `json:"enabled,omitempty"`       // Dépose et surveille les fichiers témoins
+	CheckMinutes int  `json:"check_minutes,omitempty"` // Période de vérification des empreintes
+}
+
+// BandwidthConfig limite le débit de restic en Kio/s (0 = illimité)
+type BandwidthConfig struct {
+	UploadKiB   int `json:"upload_kib,omitempty"`   // Envoi vers le dépôt
+	DownloadKiB int `json:"download_kib,omitempty"` // Lecture depuis le dépôt (restauration)
+}
+
+// ResourcesConfig ménage le poste : restic tourne en priorité basse et les
+// sauvegardes automatiques attendent que le poste soit disponible
+type ResourcesConfig struct {
+	Nice            int     `json:"nice,omitempty"`              // Priorité processeur de restic (0 à 19, 0 : inchangée)
+	IOClass         string  `json:"io_class,omitempty"`          // Priorité disque sous Linux : low (défaut), idle ou normal
+	MaxProcs        int     `json:"max_procs,omitempty"`         // Processeurs utilisés par restic (GOMAXPROCS, 0 : la moitié)
+	MaxLoad         float64 `json:"max_load,omitempty"`          // Charge moyenne par processeur au-delà de laquelle la sauvegarde attend (0 : ignorée)
+	MaxCPUPercent   int     `json:"max_cpu_percent,omitempty"`   // Occupation du processeur au-delà de laquelle la sauvegarde attend (0 : ignorée)
+	RunOnBattery    bool    `json:"run_on_battery,omitempty"`    // Sauvegarde aussi quand le portable est sur batterie
+	MaxDeferMinutes int     `json:"max_defer_minutes,omitempty"` // Report maximal d'une sauvegarde planifiée, ensuite lancée quand même
+}
+
+// TLSConfig est la politique TLS de la connexion au Dashboard
+type TLSConfig struct {
+	CAFile     string   `json:"ca_file,omitempty"`     // Autorités supplémentaires (PEM) : proxy d'inspection approuvé
+	PinnedSPKI []string `json:"pinned_spki,omitempty"` // Empreintes SHA-256 (base64) des clés publiques acceptées
+	ClientCert string   `json:"client_cert,omitempty"` // Certificat client mTLS (défaut: client.crt du dossier de configuration)
+	ClientKey  string   `json:"client_key,omitempty"`  // Clé privée du certificat client (défaut: client.key)
+}
+
+// Options retourne la politique TLS à appliquer
+func (t TLSConfig) Options() tlspolicy.Options {
+	return tlspolicy.Options{
+		CAFile:     t.CAFile,
+		Pins:       t.PinnedSPKI,
+		ClientCert: t.ClientCert,
+		ClientKey:  t.ClientKey,
+	}
+}
+
+// Fichiers du certificat client délivré à l'enrôlement, dans le dossier de configuration
+const (
+	ClientCertFile = "client.crt"
+	ClientKeyFile  = "client.key"
+)
+
+// DatabaseConfig décrit une base de données sauvegardée par dump
+type DatabaseConfig struct {
+	Name     string   `json:"name"`               // Nom de la source (fichier du snapshot, tags)
+	Type     string   `json:"type"`               // postgres, mysql ou sqlite
+	Host     string   `json:"host,omitempty"`     // Hôte ou socket (postgres, mysql)
+	Port     int      `json:"port,omitempty"`     // Port (postgres, mysql)
+	User     string   `json:"user,omitempty"`     // Utilisateur (postgres, mysql)
+	Password string   `json:"password,omitempty"` // Mot de passe (postgres, mysql)
+	Database string   `json:"database,omitempty"` // Base à sauvegarder (vide pour mysql = toutes)
+	Path     string   `json:"path,omitempty"`     // Fichier de la base (sqlite)
+	Command  string   `json:"command,omitempty"`  // Exécutable de dump si hors du PATH
+	Args     []string `json:"args,omitempty"`     // Arguments supplémentaires de l'outil de dump
+	Tags     []string `json:"tags,omitempty"`     // Tags ajoutés au snapshot
+}
+
+// RepositoryConfig décrit un dépôt restic et ses identifiants
+type RepositoryConfig struct {
+	Repository   string `json:"repository,omitempty"`    // Adresse restic : s3:..., sftp:..., rest:https://... ou chemin local
+	Password     string `json:"password,omitempty"`      // Mot de passe du dépôt (défaut: celui du Dashboard)
+	AccessKey    string `json:"access_key,omitempty"`    // S3 : clé d'accès
+	SecretKey    string `json:"secret_key,omitempty"`    // S3 : clé secrète
+	Region       string `json:"region,omitempty"`        // S3 : région
+	PathStyle    bool   `json:"path_style,omitempty"`    // S3 : adressage par chemin (MinIO, passerelles Swift/Azure)
+	RESTUsername string `json:"rest_username,omitempty"` // REST : utilisateur HTTP
+	RESTPassword string `json:"rest_password,omitempty"` // REST : mot de passe HTTP
+	AppendOnly   bool   `json:"append_only,omitempty"`   // REST : serveur en --append-only
+	SSHKeyFile   string `json:"ssh_key_file,omitempty"`  // SFTP : clé privée SSH
+}
+
+// ReplicationConfig décrit le dépôt secondaire recevant une copie des snapshots
+type ReplicationConfig struct {
+	RepositoryConfig
+	Mode            string `json:"mode,omitempty"`             // "after_backup" (défaut) ou "interval"
+	IntervalMinutes int    `json:"interval_minutes,omitempty"` // Période de copie en mode interval
+}
+
+// Enabled indique si la réplication est configurée
+func (r ReplicationConfig) Enabled() bool {
+	return r.Repository != ""
+}
+
+// LoadConfig charge la configuration et signale un fichier illisible
+// sans bloquer le démarrage de l'agent
 func LoadConfig() *Config {
+	cfg, err := Load()
+	if err != nil {
+		slog.Warn("⚠️  Fichier de configuration ignoré", "path", cfg.ConfigPath, "error", err)
+	}
+	return cfg
+}
+
+// Load charge la configuration : valeurs par défaut, puis fichier config.json
+// s'il existe, puis variables d'environnement. En cas d'erreur de lecture du
+// fichier, la configuration retournée reste utilisable (défauts + environnement).
+func Load() (*Config, error) {
 	homeDir, _ := os.UserHomeDir()
-	configPath := filepath.Join(homeDir, ".monrempart", "config.json")
+	configDir := filepath.Join(homeDir, ".monrempart")
+	configPath := getEnvOrDefault("MONREMPART_CONFIG", filepath.Join(configDir, "config.json"))
 
-	return &Config{
+	cfg := &Config{
 		ConfigPath:   configPath,
 		BackupPaths:  []string{},
 		ExcludePaths: []string{},
 
 		// URL de production par défaut
-		APIEndpoint: getEnvOrDefault("MONREMPART_API_URL", "https://mon-rempart.fr"),
-		APIKey:      getEnvOrDefault("MONREMPART_API_KEY", ""),
+		APIEndpoint: "https://mon-rempart.fr",
 
 		// Configuration S3 (à remplir en production)
-		S3Endpoint:  getEnvOrDefault("MONREMPART_S3_ENDPOINT", "s3.fr-par.scw.cloud"),
-		S3Bucket:    getEnvOrDefault("MONREMPART_S3_BUCKET", ""),
-		S3AccessKey: getEnvOrDefault("MONREMPART_S3_ACCESS_KEY", ""),
-		S3SecretKey: getEnvOrDefault("MONREMPART_S3_SECRET_KEY", ""),
+		S3Endpoint: "s3.fr-par.scw.cloud",
 
 		// Restic
-		ResticPath:     getEnvOrDefault("MONREMPART_RESTIC_PATH", "restic"),
-		ResticPassword: getEnvOrDefault("MONREMPART_RESTIC_PASSWORD", ""),
+		ResticPath: "restic",
 
 		// Sauvegarde quotidienne à 2h du matin par défaut
-		BackupSchedule: getEnvOrDefault("MONREMPART_BACKUP_SCHEDULE", "0 2 * * *"),
+		BackupSchedule: "0 2 * * *",
+		// Lancée entre 2h00 et 2h30 selon l'agent
+		ScheduleJitterMinutes: 30,
+
+		// Protection continue (si activée) : 1 minute de calme, 15 minutes
+		// entre deux sauvegardes, 4 par heure au plus
+		Continuous: ContinuousConfig{
+			DebounceSeconds:    60,
+			MinIntervalMinutes: 15,
+			MaxPerHour:         4,
+		},
+
+		// Restic en priorité basse ; sauvegarde planifiée reportée de 4 heures au
+		// plus si le poste est chargé, le processeur occupé à plus de 60 % ou sur batterie
+		Resources: ResourcesConfig{
+			Nice:            10,
+			IOClass:         "low",
+			MaxLoad:         1.0,
+			MaxCPUPercent:   60,
+			MaxDeferMinutes: 240,
+		},
+
+		// Snapshot suspect à partir d'un score de 50 (ex. note de rançon et documents chiffrés)
+		Ransomware: RansomwareConfig{Threshold: 50},
+
+		// Fichiers témoins vérifiés toutes les 5 minutes, s'ils sont activés
+		Canary: CanaryConfig{CheckMinutes: 5},
+
+		// Hooks : 5 minutes par commande, sauvegarde annulée si un hook pré-sauvegarde échoue
+		Hooks: HooksConfig{
+			TimeoutSeconds:   300,
+			OnPreHookFailure: "abort",
+		},
+
+		// Réplication après chaque sauvegarde, ou toutes les 6 heures en mode interval
+		Replication: ReplicationConfig{
+			Mode:            "after_backup",
+			IntervalMinutes: 360,
+		},
+
+		// Tarif indicatif du stockage objet Scaleway (€/Go/mois)
+		StoragePricePerGB: 0.015,
+
+		// Logs dans ~/.monrempart/logs, rotation à 10 Mo, conservation 30 jours
+		LogLevel:      "info",
+		LogFormat:     "text",
+		LogDir:        filepath.Join(filepath.Dir(configPath), "logs"),
+		LogMaxSizeMB:  10,
+		LogMaxAgeDays: 30,
+	}
+
+	err := cfg.loadFile()
+	cfg.applyEnv()
+
+	// Certificat client délivré à l'enrôlement : utilisé dès qu'il est présent
+	if cfg.TLS.ClientCert == "" && cfg.TLS.ClientKey == "" {
+		certFile := filepath.Join(cfg.Dir(), ClientCertFile)
+		keyFile := filepath.Join(cfg.Dir(), ClientKeyFile)
+		if fileExists(certFile) && fileExists(keyFile) {
+			cfg.TLS.ClientCert, cfg.TLS.ClientKey = certFile, keyFile
+		}
+	}
+	return cfg, err
+}
+
+// loadFile superpose le contenu de config.json s'il existe
+func (c *Config) loadFile() error {
+	data, err := os.ReadFile(c.ConfigPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("JSON invalide: %w", err)
+	}
+	return nil
+}
+
+// applyEnv applique les variables d'environnement MONREMPART_*
+func (c *Config) applyEnv() {
+	c.BackupPaths = getEnvListOrDefault("MONREMPART_BACKUP_PATHS", c.BackupPaths)
+	c.ExcludePaths = getEnvListOrDefault("MONREMPART_EXCLUDE_PATHS", c.ExcludePaths)
+
+	c.Bandwidth.UploadKiB = getEnvIntOrDefault("MONREMPART_LIMIT_UPLOAD_KIB", c.Bandwidth.UploadKiB)
+	c.Bandwidth.DownloadKiB = getEnvIntOrDefault("MONREMPART_LIMIT_DOWNLOAD_KIB", c.Bandwidth.DownloadKiB)
+	c.Resources.RunOnBattery = getEnvOrDefault("MONREMPART_RUN_ON_BATTERY", strconv.FormatBool(c.Resources.RunOnBattery)) == "true"
+	c.Ransomware.Disabled = getEnvOrDefault("MONREMPART_RANSOMWARE_DISABLED", strconv.FormatBool(c.Ransomware.Disabled)) == "true"
+	c.Ransomware.Threshold = getEnvIntOrDefault("MONREMPART_RANSOMWARE_THRESHOLD", c.Ransomware.Threshold)
+	c.Canary.Enabled = getEnvOrDefault("MONREMPART_CANARY_ENABLED", strconv.FormatBool(c.Canary.Enabled)) == "true"
+	c.AllowRemoteHooks = getEnvOrDefault("MONREMPART_ALLOW_REMOTE_HOOKS", strconv.FormatBool(c.AllowRemoteHooks)) == "true"
+	c.CommandPublicKey = getEnvOrDefault("MONREMPART_COMMAND_PUBLIC_KEY", c.CommandPublicKey)
+
+	c.TLS.CAFile = getEnvOrDefault("MONREMPART_TLS_CA_FILE", c.TLS.CAFile)
+	c.TLS.PinnedSPKI = getEnvListOrDefault("MONREMPART_TLS_PINS", c.TLS.PinnedSPKI)
+	c.TLS.ClientCert = getEnvOrDefault("MONREMPART_TLS_CLIENT_CERT", c.TLS.ClientCert)
+	c.TLS.ClientKey = getEnvOrDefault("MONREMPART_TLS_CLIENT_KEY", c.TLS.ClientKey)
+
+	c.APIEndpoint = getEnvOrDefault("MONREMPART_API_URL", c.APIEndpoint)
+	c.APIKey = getEnvOrDefault("MONREMPART_API_KEY", c.APIKey)
+
+	c.S3Endpoint = getEnvOrDefault("MONREMPART_S3_ENDPOINT", c.S3Endpoint)
+	c.S3Bucket = getEnvOrDefault("MONREMPART_S3_BUCKET", c.S3Bucket)
+	c.S3AccessKey = getEnvOrDefault("MONREMPART_S3_ACCESS_KEY", c.S3AccessKey)
+	c.S3SecretKey = getEnvOrDefault("MONREMPART_S3_SECRET_KEY", c.S3SecretKey)
+
+	c.ResticPath = getEnvOrDefault("MONREMPART_RESTIC_PATH", c.ResticPath)
+	c.ResticPassword = getEnvOrDefault("MONREMPART_RESTIC_PASSWORD", c.ResticPassword)
+
+	c.BackupSchedule = getEnvOrDefault("MONREMPART_BACKUP_SCHEDULE", c.BackupSchedule)
+	c.ScheduleJitterMinutes = getEnvIntOrDefault("MONREMPART_SCHEDULE_JITTER_MINUTES", c.ScheduleJitterMinutes)
+	c.Continuous.Enabled = getEnvOrDefault("MONREMPART_CONTINUOUS_ENABLED", strconv.FormatBool(c.Continuous.Enabled)) == "true"
+
+	c.Storage.Repository = getEnvOrDefault("MONREMPART_REPOSITORY", c.Storage.Repository)
+
+	c.Replication.Repository = getEnvOrDefault("MONREMPART_REPLICATION_REPOSITORY", c.Replication.Repository)
+	c.Replication.Password = getEnvOrDefault("MONREMPART_REPLICATION_PASSWORD", c.Replication.Password)
+
+	c.StoragePricePerGB = getEnvFloatOrDefault("MONREMPART_STORAGE_PRICE_EUR_GB", c.StoragePricePerGB)
+
+	c.LogLevel = getEnvOrDefault("MONREMPART_LOG_LEVEL", c.LogLevel)
+	c.LogFormat = getEnvOrDefault("MONREMPART_LOG_FORMAT", c.LogFormat)
+	c.LogDir = getEnvOrDefault("MONREMPART_LOG_DIR", c.LogDir)
+	c.LogMaxSizeMB = getEnvIntOrDefault("MONREMPART_LOG_MAX_SIZE_MB", c.LogMaxSizeMB)
+	c.LogMaxAgeDays = getEnvIntOrDefault("MONREMPART_LOG_MAX_AGE_DAYS", c.LogMaxAgeDays)
+}
+
+// Dir retourne le dossier de configuration de l'agent
+func (c *Config) Dir() string {
+	return filepath.Dir(c.ConfigPath)
+}
+
+// Redacted retourne une copie de la configuration sans les secrets, pour affichage
+func (c *Config) Redacted() *Config {
+	r := *c
+	r.BackupPaths = append([]string{}, c.BackupPaths...)
+	r.ExcludePaths = append([]string{}, c.ExcludePaths...)
+	r.APIKey = redact(c.APIKey)
+	r.S3SecretKey = redact(c.S3SecretKey)
+	r.ResticPassword = redact(c.ResticPassword)
+	r.Storage = c.Storage.redacted()
+	r.Replication.RepositoryConfig = c.Replication.redacted()
+	r.Databases = make([]DatabaseConfig, len(c.Databases))
+	for i, db := range c.Databases {
+		db.Password = redact(db.Password)
+		r.Databases[i] = db
+	}
+	return &r
+}
+
+// redacted retourne une copie sans les secrets
+func (r RepositoryConfig) redacted() RepositoryConfig {
+	r.Password = redact(r.Password)
+	r.SecretKey = redact(r.SecretKey)
+	r.RESTPassword = redact(r.RESTPassword)
+	if u, err := url.Parse(strings.TrimPrefix(r.Repository, "rest:")); err == nil && u.User != nil {
+		u.User = url.User(u.User.Username())
+		r.Repository = "rest:" + u.String()
 	}
+	return r
+}
+
+// validate vérifie l'adresse du dépôt
+func (r RepositoryConfig) validate(field string) error {
+	kind, rest, found := strings.Cut(r.Repository, ":")
+	if !found || len(kind) == 1 {
+		kind, rest = "local", r.Repository
+	}
+	switch kind {
+	case "local":
+		if !filepath.IsAbs(rest) {
+			return fmt.Errorf("%s.repository: chemin absolu attendu", field)
+		}
+	case "s3", "sftp":
+	case "rest":
+		if u, err := url.Parse(rest); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%s.repository: URL REST invalide", field)
+		}
+	default:
+		return fmt.Errorf("%s.repository: backend %q non supporté (s3, local, sftp ou rest)", field, kind)
+	}
+	return nil
+}
+
+// Validate vérifie la cohérence de la configuration et retourne toutes les erreurs trouvées
+func (c *Config) Validate() error {
+	var errs []error
+
+	if u, err := url.Parse(c.APIEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("api_endpoint invalide: %q", c.APIEndpoint))
+	}
+
+	for _, p := range c.BackupPaths {
+		if _, err := os.Stat(p); err != nil {
+			errs = append(errs, fmt.Errorf("backup_paths: %w", err))
+		}
+	}
+
+	if _, err := schedule.Parse(c.BackupSchedule); err != nil {
+		errs = append(errs, fmt.Errorf("backup_schedule: %w", err))
+	}
+	if _, err := schedule.ParseWindows(c.BackupWindows, c.BlackoutDates); err != nil {
+		errs = append(errs, fmt.Errorf("backup_windows / blackout_dates: %w", err))
+	}
+	if c.ScheduleJitterMinutes < 0 {
+		errs = append(errs, fmt.Errorf("schedule_jitter_minutes ne peut pas être négatif"))
+	}
+	errs = append(errs, c.Retention.validate(), c.Bandwidth.validate(), c.Resources.validate(), c.Continuous.validate(), c.Ransomware.validate(), c.Canary.validate(), c.Hooks.validate())
+
+	errs = append(errs, c.TLS.validate(c.APIEndpoint))
+	if c.CommandPublicKey != "" {
+		if _, err := ParseCommandKey(c.CommandPublicKey); err != nil {
+			errs = append(errs, fmt.Errorf("command_public_key: %w", err))
+		}
+	}
+
+	names := make(map[string]bool)
+	for i, db := range c.Databases {
+		switch {
+		case db.Name == "":
+			errs = append(errs, fmt.Errorf("databases[%d]: nom manquant", i))
+		case names[db.Name]:
+			errs = append(errs, fmt.Errorf("databases: nom %q en double", db.Name))
+		case strings.ContainsAny(db.Name, "/\\,"):
+			errs = append(errs, fmt.Errorf("databases: nom %q invalide (sans / \\ ni virgule)", db.Name))
+		}
+		names[db.Name] = true
+
+		switch db.Type {
+		case "postgres":
+			if db.Database == "" {
+				errs = append(errs, fmt.Errorf("databases %q: database requis pour postgres", db.Name))
+			}
+		case "mysql":
+		case "sqlite":
+			if db.Path == "" {
+				errs = append(errs, fmt.Errorf("databases %q: path requis pour sqlite", db.Name))
+			} else if _, err := os.Stat(db.Path); err != nil {
+				errs = append(errs, fmt.Errorf("databases %q: %w", db.Name, err))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("databases %q: type inconnu %q (postgres, mysql ou sqlite)", db.Name, db.Type))
+		}
+	}
+
+	if c.Storage.Repository != "" {
+		if err := c.Storage.validate("storage"); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.Replication.Enabled() {
+		if err := c.Replication.validate("replication"); err != nil {
+			errs = append(errs, err)
+		}
+		switch c.Replication.Mode {
+		case "after_backup":
+		case "interval":
+			if c.Replication.IntervalMinutes <= 0 {
+				errs = append(errs, fmt.Errorf("replication.interval_minutes doit être positif"))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("replication.mode inconnu: %q (after_backup ou interval)", c.Replication.Mode))
+		}
+	}
+
+	if c.StoragePricePerGB < 0 {
+		errs = append(errs, fmt.Errorf("storage_price_eur_gb ne peut pas être négatif"))
+	}
+
+	switch strings.ToLower(c.LogLevel) {
+	case "debug", "info", "warn", "warning", "error":
+	default:
+		errs = append(errs, fmt.Errorf("log_level inconnu: %q", c.LogLevel))
+	}
+
+	switch strings.ToLower(c.LogFormat) {
+	case "text", "json":
+	default:
+		errs = append(errs, fmt.Errorf("log_format inconnu: %q (text ou json)", c.LogFormat))
+	}
+
+	if c.LogMaxSizeMB <= 0 {
+		errs = append(errs, fmt.Errorf("log_max_size_mb doit être positif"))
+	}
+	if c.LogMaxAgeDays <= 0 {
+		errs = append(errs, fmt.Errorf("log_max_age_days doit être positif"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// validate vérifie les règles de rétention
+func (r RetentionConfig) validate() error {
+	if r.KeepLast < 0 || r.KeepDaily < 0 || r.KeepWeekly < 0 || r.KeepMonthly < 0 || r.KeepYearly < 0 {
+		return fmt.Errorf("retention: les valeurs ne peuvent pas être négatives")
+	}
+	return nil
+}
+
+// validate vérifie les limites de débit
+func (b BandwidthConfig) validate() error {
+	if b.UploadKiB < 0 || b.DownloadKiB < 0 {
+		return fmt.Errorf("bandwidth: les limites ne peuvent pas être négatives")
+	}
+	return nil
+}
+
+// validate vérifie les priorités et les seuils de report
+func (r ResourcesConfig) validate() error {
+	var errs []error
+	if r.Nice < 0 || r.Nice > 19 {
+		errs = append(errs, fmt.Errorf("resources.nice doit être compris entre 0 et 19"))
+	}
+	if r.IOClass != "low" && r.IOClass != "idle" && r.IOClass != "normal" {
+		errs = append(errs, fmt.Errorf("resources.io_class inconnu: %q (low, idle ou normal)", r.IOClass))
+	}
+	if r.MaxProcs < 0 || r.MaxLoad < 0 || r.MaxCPUPercent < 0 || r.MaxCPUPercent > 100 {
+		errs = append(errs, fmt.Errorf("resources: max_procs, max_load et max_cpu_percent (0 à 100) ne peuvent pas être négatifs"))
+	}
+	if r.MaxDeferMinutes <= 0 {
+		errs = append(errs, fmt.Errorf("resources.max_defer_minutes doit être positif"))
+	}
+	return errors.Join(errs...)
+}
+
+// validate vérifie les limites de la protection continue
+func (c ContinuousConfig) validate() error {
+	if c.DebounceSeconds <= 0 || c.MinIntervalMinutes <= 0 || c.MaxPerHour <= 0 {
+		return fmt.Errorf("continuous: debounce_seconds, min_interval_minutes et max_per_hour doivent être positifs")
+	}
+	return nil
+}
+
+// validate vérifie le seuil de détection
+func (r RansomwareConfig) validate() error {
+	if r.Threshold < 1 || r.Threshold > 100 {
+		return fmt.Errorf("ransomware.threshold doit être compris entre 1 et 100")
+	}
+	return nil
+}
+
+// validate vérifie la période de vérification des fichiers témoins
+func (c CanaryConfig) validate() error {
+	if c.CheckMinutes <= 0 {
+		return fmt.Errorf("canary.check_minutes doit être positif")
+	}
+	return nil
+}
+
+// validate vérifie la politique TLS : fichiers lisibles, empreintes valides
+func (t TLSConfig) validate(endpoint string) error {
+	if _, err := tlspolicy.Config(t.Options()); err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+	if len(t.PinnedSPKI) > 0 && !strings.HasPrefix(endpoint, "https://") {
+		return fmt.Errorf("tls.pinned_spki: api_endpoint doit être en https")
+	}
+	return nil
+}
+
+// validate vérifie le délai et la politique d'échec des hooks
+func (h HooksConfig) validate() error {
+	var errs []error
+	if h.TimeoutSeconds <= 0 {
+		errs = append(errs, fmt.Errorf("hooks.timeout_seconds doit être positif"))
+	}
+	switch h.OnPreHookFailure {
+	case "abort", "warn":
+	default:
+		errs = append(errs, fmt.Errorf("hooks.on_pre_hook_failure inconnu: %q (abort ou warn)", h.OnPreHookFailure))
+	}
+	return errors.Join(errs...)
+}
+
+// redact masque une valeur secrète
+func redact(value string) string {
+	if value == "" {
+		return ""
+	}
+	return "********"
 }
 
 // getEnvOrDefault retourne la valeur d'une variable d'environnement
@@ -69,3 +655,60 @@ func getEnvOrDefault(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvIntOrDefault retourne la valeur entière d'une variable d'environnement
+// ou une valeur par défaut si elle est absente ou invalide
+func getEnvIntOrDefault(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return defaultValue
+}
+
+// getEnvFloatOrDefault retourne la valeur décimale d'une variable d'environnement
+// ou une valeur par défaut si elle est absente ou invalide
+func getEnvFloatOrDefault(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if f, err := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64); err == nil {
+			return f
+		}
+	}
+	return defaultValue
+}
+
+// getEnvListOrDefault retourne une liste séparée par le séparateur de PATH du système
+// (":" sous Unix, ";" sous Windows) ou une valeur par défaut
+func getEnvListOrDefault(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var items []string
+	for _, item := range filepath.SplitList(value) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// ParseCommandKey décode une clé publique Ed25519 en base64
+func ParseCommandKey(encoded string) (ed25519.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("base64 invalide: %w", err)
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("clé Ed25519 de %d octets attendue, %d reçus", ed25519.PublicKeySize, len(raw))
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// fileExists indique si un fichier existe
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
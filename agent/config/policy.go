@@ -0,0 +1,195 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/mon-rempart/agent/schedule"
+)
+
+// Policy est la politique de sauvegarde versionnée définie dans le Dashboard.
+// Les champs renseignés remplacent ceux de config.json ; les autres restent
+// ceux de la configuration locale.
+type Policy struct {
+	// Version croissante, renvoyée au Dashboard une fois appliquée
+	Version int `json:"version"`
+
+	// Chemins avec variables du système : %USERPROFILE%\Documents, $HOME/Documents, ~/Bureau
+	BackupPaths  []string `json:"backup_paths,omitempty"`
+	ExcludePaths []string `json:"exclude_paths,omitempty"`
+	Schedule     string   `json:"schedule,omitempty"`
+	// Plages des sauvegardes automatiques et jours sans sauvegarde (élections...)
+	BackupWindows []string         `json:"backup_windows,omitempty"`
+	BlackoutDates []string         `json:"blackout_dates,omitempty"`
+	Retention     *RetentionConfig `json:"retention,omitempty"`
+	Bandwidth     *BandwidthConfig `json:"bandwidth,omitempty"`
+	// Exécutés sur le poste : acceptés seulement avec allow_remote_hooks
+	Hooks *HooksConfig `json:"hooks,omitempty"`
+}
+
+// Variables %NOM% (Windows)
+var windowsVar = regexp.MustCompile(`%([A-Za-z_][A-Za-z0-9_()]*)%`)
+
+// ExpandPath développe les variables d'un chemin (%USERPROFILE%, $HOME,
+// ${HOME}, ~). Une variable non définie est une erreur : le chemin ne doit
+// pas devenir un autre dossier.
+func ExpandPath(path string) (string, error) {
+	var missing []string
+	lookup := func(name string) string {
+		value, ok := os.LookupEnv(name)
+		if !ok || value == "" {
+			missing = append(missing, name)
+		}
+		return value
+	}
+
+	if path == "~" || strings.HasPrefix(path, "~/") || strings.HasPrefix(path, `~\`) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("%s: dossier personnel inconnu", path)
+		}
+		path = home + path[1:]
+	}
+
+	expanded := windowsVar.ReplaceAllStringFunc(path, func(m string) string {
+		return lookup(m[1 : len(m)-1])
+	})
+	expanded = os.Expand(expanded, lookup)
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("%s: variable non définie %s", path, strings.Join(missing, ", "))
+	}
+	return filepath.Clean(expanded), nil
+}
+
+// Variable en tête d'un motif d'exclusion : %NOM% ou ${NOM}
+var leadingVar = regexp.MustCompile(`^(%([A-Za-z_][A-Za-z0-9_()]*)%|\$\{([A-Za-z_][A-Za-z0-9_]*)\})`)
+
+// ExpandExclude développe le début d'un motif d'exclusion restic : ~, %NOM%
+// ou ${NOM}. Le reste est conservé tel quel : ~$* (fichiers verrous Office),
+// $RECYCLE.BIN ou un séparateur final ont un sens pour restic.
+func ExpandExclude(pattern string) (string, error) {
+	if pattern == "~" || strings.HasPrefix(pattern, "~/") || strings.HasPrefix(pattern, `~\`) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("%s: dossier personnel inconnu", pattern)
+		}
+		return home + pattern[1:], nil
+	}
+
+	m := leadingVar.FindStringSubmatch(pattern)
+	if m == nil {
+		return pattern, nil
+	}
+	name := m[2] + m[3]
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return "", fmt.Errorf("%s: variable non définie %s", pattern, name)
+	}
+	return value + pattern[len(m[0]):], nil
+}
+
+// Validate vérifie la politique et développe les variables de ses chemins.
+// Une politique commune peut mêler chemins Windows et Linux : ceux dont une
+// variable n'existe pas sur le poste sont ignorés, comme les chemins absents,
+// avec un avertissement. allowHooks autorise les hooks.
+func (p *Policy) Validate(allowHooks bool) (warnings []string, err error) {
+	var errs []error
+
+	if p.Version <= 0 {
+		errs = append(errs, fmt.Errorf("version: entier positif attendu"))
+	}
+
+	expand := func(field string, paths []string, expandPath func(string) (string, error), mustBeAbs bool) []string {
+		var out []string
+		for _, raw := range paths {
+			path, err := expandPath(raw)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("%s: %v (ignoré)", field, err))
+				continue
+			}
+			if mustBeAbs && !filepath.IsAbs(path) {
+				errs = append(errs, fmt.Errorf("%s: chemin absolu attendu: %q", field, raw))
+				continue
+			}
+			out = append(out, path)
+		}
+		return out
+	}
+
+	requested := len(p.BackupPaths)
+	p.BackupPaths = expand("backup_paths", p.BackupPaths, ExpandPath, true)
+	if requested > 0 && len(p.BackupPaths) == 0 {
+		errs = append(errs, fmt.Errorf("backup_paths: aucun chemin utilisable sur ce poste"))
+	}
+	for _, path := range p.BackupPaths {
+		if _, err := os.Stat(path); err != nil {
+			warnings = append(warnings, fmt.Sprintf("backup_paths: %s absent du poste", path))
+		}
+	}
+	// Les exclusions sont des motifs restic (*.tmp) : seul leur début est développé
+	p.ExcludePaths = expand("exclude_paths", p.ExcludePaths, ExpandExclude, false)
+
+	if p.Schedule != "" {
+		if _, err := schedule.Parse(p.Schedule); err != nil {
+			errs = append(errs, fmt.Errorf("schedule: %w", err))
+		}
+	}
+	if _, err := schedule.ParseWindows(p.BackupWindows, p.BlackoutDates); err != nil {
+		errs = append(errs, fmt.Errorf("backup_windows / blackout_dates: %w", err))
+	}
+	if p.Retention != nil {
+		errs = append(errs, p.Retention.validate())
+	}
+	if p.Bandwidth != nil {
+		errs = append(errs, p.Bandwidth.validate())
+	}
+	if p.Hooks != nil {
+		if !allowHooks {
+			errs = append(errs, fmt.Errorf("hooks: refusés par l'agent (allow_remote_hooks désactivé)"))
+		} else {
+			errs = append(errs, p.Hooks.validate())
+		}
+	}
+
+	return warnings, errors.Join(errs...)
+}
+
+// WithPolicy retourne la configuration effective : config.json complété
+// par les champs renseignés de la politique
+func (c *Config) WithPolicy(p *Policy) *Config {
+	effective := *c
+	if p == nil {
+		return &effective
+	}
+
+	if len(p.BackupPaths) > 0 {
+		effective.BackupPaths = p.BackupPaths
+	}
+	if len(p.ExcludePaths) > 0 {
+		effective.ExcludePaths = p.ExcludePaths
+	}
+	if p.Schedule != "" {
+		effective.BackupSchedule = p.Schedule
+	}
+	if len(p.BackupWindows) > 0 {
+		effective.BackupWindows = p.BackupWindows
+	}
+	if len(p.BlackoutDates) > 0 {
+		effective.BlackoutDates = p.BlackoutDates
+	}
+	if p.Retention != nil {
+		effective.Retention = *p.Retention
+	}
+	if p.Bandwidth != nil {
+		effective.Bandwidth = *p.Bandwidth
+	}
+	if p.Hooks != nil && c.AllowRemoteHooks {
+		effective.Hooks = *p.Hooks
+	}
+	return &effective
+}
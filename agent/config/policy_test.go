@@ -0,0 +1,66 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestExpandExclude(t *testing.T) {
+	t.Setenv("MR_DOCS", "/srv/docs")
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("dossier personnel inconnu")
+	}
+
+	tests := []struct {
+		pattern string
+		want    string
+		wantErr bool
+	}{
+		// Motifs restic conservés tels quels
+		{"~$*", "~$*", false},
+		{"$RECYCLE.BIN", "$RECYCLE.BIN", false},
+		{"*.tmp", "*.tmp", false},
+		{"/srv/cache/", "/srv/cache/", false},
+		{"/srv/a/../b", "/srv/a/../b", false},
+		{"/srv/$RECYCLE.BIN/%TEMP%", "/srv/$RECYCLE.BIN/%TEMP%", false},
+		// Variable ou dossier personnel en tête
+		{"~/Téléchargements/", home + "/Téléchargements/", false},
+		{"%MR_DOCS%\\*.tmp", "/srv/docs\\*.tmp", false},
+		{"${MR_DOCS}/cache/", "/srv/docs/cache/", false},
+		{"%MR_INCONNUE%\\Temp", "", true},
+		{"${MR_INCONNUE}/cache", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ExpandExclude(tt.pattern)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ExpandExclude(%q) = %q ; erreur attendue", tt.pattern, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ExpandExclude(%q) = %q, %v ; attendu %q", tt.pattern, got, err, tt.want)
+		}
+	}
+}
+
+func TestValidateKeepsExcludePatterns(t *testing.T) {
+	t.Setenv("MR_DOCS", "/srv/docs")
+	p := Policy{
+		Version:      1,
+		ExcludePaths: []string{"~$*", "$RECYCLE.BIN", "${MR_DOCS}/cache/", "${MR_INCONNUE}/tmp"},
+	}
+	warnings, err := p.Validate(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"~$*", "$RECYCLE.BIN", "/srv/docs/cache/"}
+	if !reflect.DeepEqual(p.ExcludePaths, want) {
+		t.Errorf("ExcludePaths = %q, attendu %q", p.ExcludePaths, want)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("avertissements = %q, attendu la seule variable non définie", warnings)
+	}
+}
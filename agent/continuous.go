@@ -0,0 +1,293 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mon-rempart/agent/backup"
+	"github.com/mon-rempart/agent/fswatch"
+	"github.com/mon-rempart/agent/governor"
+)
+
+// Tag des snapshots déclenchés par une modification des dossiers
+const continuousTag = "continuous"
+
+// Période d'évaluation des modifications en attente
+const continuousTick = 5 * time.Second
+
+// continuousWatch suit les modifications des dossiers sauvegardés
+type continuousWatch struct {
+	watcher *fswatch.Watcher
+	roots   []string
+
+	// Dossiers sauvegardés modifiés depuis la dernière sauvegarde continue
+	pending    map[string]bool
+	lastChange time.Time
+
+	lastRun time.Time
+	runs    []time.Time // Sauvegardes continues de la dernière heure
+	// Sauvegarde continue en cours ; done reçoit à sa fin les dossiers à
+	// resauvegarder (sauvegarde refusée)
+	running bool
+	done    chan []string
+	// Dernière raison d'attente journalisée, pour ne pas la répéter
+	deferred string
+	// Limite du système signalée une fois par surveillance
+	limitReported bool
+}
+
+// continuousLoop sauvegarde les dossiers modifiés, après un délai de calme,
+// dans les limites d'intervalle et de budget horaire de la configuration
+func continuousLoop() {
+	if !currentConfig().Continuous.Enabled {
+		return
+	}
+
+	c := &continuousWatch{pending: make(map[string]bool), done: make(chan []string, 1)}
+	if err := c.start(); err != nil {
+		slog.Warn("⚠️  Protection continue indisponible - sauvegardes planifiées seules", "error", err)
+		return
+	}
+	defer func() { c.watcher.Close() }()
+
+	ticker := time.NewTicker(continuousTick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event, ok := <-c.watcher.Events:
+			if !ok {
+				slog.Warn("⚠️  Surveillance des dossiers interrompue - redémarrage")
+				if err := c.start(); err != nil {
+					slog.Error("❌ Protection continue arrêtée", "error", err)
+					return
+				}
+				continue
+			}
+			c.handle(event)
+		case retry := <-c.done:
+			c.running = false
+			for _, root := range retry {
+				c.pending[root] = true
+			}
+		case <-ticker.C:
+			// Politique modifiée : nouveaux dossiers sauvegardés
+			if !sameRoots(c.roots, watchedRoots()) {
+				slog.Info("👁️  Dossiers sauvegardés modifiés - surveillance reconstruite")
+				if err := c.start(); err != nil {
+					slog.Error("❌ Protection continue arrêtée", "error", err)
+					return
+				}
+			}
+			c.maybeBackup()
+		}
+	}
+}
+
+// watchedRoots retourne les dossiers sauvegardés existants
+func watchedRoots() []string {
+	var roots []string
+	for _, root := range currentConfig().BackupPaths {
+		if info, err := os.Stat(root); err == nil && info.IsDir() {
+			roots = append(roots, filepath.Clean(root))
+		}
+	}
+	sort.Strings(roots)
+	return roots
+}
+
+// start (re)crée la surveillance récursive des dossiers sauvegardés
+func (c *continuousWatch) start() error {
+	if c.watcher != nil {
+		c.watcher.Close()
+		// Événements restants ignorés : les dossiers sont marqués modifiés
+		for range c.watcher.Events {
+		}
+	}
+	watcher, err := fswatch.New()
+	if err != nil {
+		return err
+	}
+	c.watcher = watcher
+	c.roots = watchedRoots()
+	c.limitReported = false
+
+	dirs := 0
+	for _, root := range c.roots {
+		n, err := watcher.AddRecursive(root, c.skip)
+		dirs += n
+		if err != nil {
+			c.reportLimit(root, err)
+			break
+		}
+	}
+	slog.Info("👁️  Protection continue active", "roots", len(c.roots), "directories", dirs)
+	return nil
+}
+
+// skip exclut de la surveillance les dossiers exclus de la sauvegarde
+func (c *continuousWatch) skip(path string) bool {
+	return backup.MatchesExclude(path, currentConfig().ExcludePaths)
+}
+
+// reportLimit signale une surveillance partielle (limite inotify atteinte) :
+// les dossiers non surveillés restent couverts par la planification
+func (c *continuousWatch) reportLimit(root string, err error) {
+	if c.limitReported || !errors.Is(err, fswatch.ErrWatchLimit) {
+		return
+	}
+	c.limitReported = true
+
+	limit := ""
+	if data, readErr := os.ReadFile("/proc/sys/fs/inotify/max_user_watches"); readErr == nil {
+		limit = strings.TrimSpace(string(data))
+	}
+	slog.Warn("⚠️  Limite de surveillance atteinte - protection continue partielle",
+		"root", root,
+		"max_user_watches", limit,
+		"hint", "sysctl fs.inotify.max_user_watches=524288",
+	)
+	go sendActivityLog("warning", "Protection continue partielle : limite de dossiers surveillés atteinte", map[string]interface{}{
+		"root":             root,
+		"watched":          c.watcher.Watched(),
+		"max_user_watches": limit,
+	})
+}
+
+// handle enregistre une modification et surveille les nouveaux dossiers
+func (c *continuousWatch) handle(event fswatch.Event) {
+	if event.Op&fswatch.Overflow != 0 {
+		// Événements perdus : tous les dossiers sont à sauvegarder, et les
+		// dossiers créés entre-temps à surveiller
+		slog.Warn("⚠️  File d'événements saturée - surveillance reconstruite")
+		for _, root := range c.roots {
+			c.pending[root] = true
+		}
+		c.lastChange = time.Now()
+		if err := c.start(); err != nil {
+			slog.Error("❌ Surveillance non reconstruite", "error", err)
+		}
+		return
+	}
+	// Attributs seuls (droits, horodatage) : pas de nouvelle donnée à sauvegarder
+	if event.Op == fswatch.Chmod {
+		return
+	}
+	if c.skip(event.Name) || isCanaryFile(event.Name) {
+		return
+	}
+
+	root := rootOf(event.Name, c.roots)
+	if root == "" {
+		return
+	}
+	if event.IsDir && event.Op&fswatch.Create != 0 {
+		if _, err := c.watcher.AddRecursive(event.Name, c.skip); err != nil {
+			c.reportLimit(root, err)
+		}
+	}
+	if !c.pending[root] {
+		slog.Debug("👁️  Modification détectée", "root", root, "path", event.Name, "op", event.Op.String())
+	}
+	c.pending[root] = true
+	c.lastChange = time.Now()
+}
+
+// maybeBackup lance la sauvegarde des dossiers modifiés si le délai de
+// calme, l'intervalle minimal et le budget horaire le permettent
+func (c *continuousWatch) maybeBackup() {
+	cfg := currentConfig()
+	if len(c.pending) == 0 {
+		return
+	}
+	now := time.Now()
+	if now.Sub(c.lastChange) < time.Duration(cfg.Continuous.DebounceSeconds)*time.Second {
+		return
+	}
+
+	recent := c.runs[:0]
+	for _, t := range c.runs {
+		if now.Sub(t) < time.Hour {
+			recent = append(recent, t)
+		}
+	}
+	c.runs = recent
+
+	var reason string
+	switch {
+	case now.Sub(c.lastRun) < time.Duration(cfg.Continuous.MinIntervalMinutes)*time.Minute:
+		reason = fmt.Sprintf("intervalle minimal (%d min)", cfg.Continuous.MinIntervalMinutes)
+	case len(c.runs) >= cfg.Continuous.MaxPerHour:
+		reason = fmt.Sprintf("budget horaire atteint (%d/h)", cfg.Continuous.MaxPerHour)
+	case c.running || backupRunning.Load():
+		reason = "sauvegarde en cours"
+	default:
+		reason = backupPausedReason()
+	}
+	// Comparée à la précédente : codes pour l'état du poste, dont les mesures varient
+	key := reason
+	if reason == "" {
+		// Poste chargé, processeur occupé ou sur batterie : même report que les sauvegardes
+		// planifiées, sans échéance (les modifications attendent)
+		if _, reasons := busyReasons(); len(reasons) > 0 {
+			reason, key = governor.Messages(reasons), governor.Codes(reasons)
+		}
+	}
+	if reason != "" {
+		if key != c.deferred {
+			slog.Debug("⏳ Sauvegarde continue différée", "reason", reason, "roots", len(c.pending))
+			c.deferred = key
+		}
+		return
+	}
+	c.deferred = ""
+
+	roots := make([]string, 0, len(c.pending))
+	for root := range c.pending {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+	c.pending = make(map[string]bool)
+	c.lastRun = now
+	c.runs = append(c.runs, now)
+
+	// Exécution hors de la boucle : les événements continuent d'être lus
+	// pendant la sauvegarde et la file du noyau ne sature pas
+	c.running = true
+	go func() {
+		var retry []string
+		if _, err := runPathsBackup("continue", roots, []string{continuousTag}, false); errors.Is(err, errBackupRunning) {
+			retry = roots
+		}
+		c.done <- retry
+	}()
+}
+
+// rootOf retourne le dossier sauvegardé contenant path (vide : aucun)
+func rootOf(path string, roots []string) string {
+	for _, root := range roots {
+		if path == root || strings.HasPrefix(path, root+string(filepath.Separator)) {
+			return root
+		}
+	}
+	return ""
+}
+
+// sameRoots compare deux listes triées de dossiers
+func sameRoots(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
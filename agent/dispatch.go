@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mon-rempart/agent/logging"
+)
+
+// États d'une commande signalés au Dashboard
+const (
+	CommandQueued  = "queued"
+	CommandRunning = "running"
+	CommandDone    = "done"
+	CommandFailed  = "failed"
+	// Refusée sans exécution (expirée, signature invalide)
+	CommandRejected = "rejected"
+)
+
+const (
+	commandStatusPath = "/api/agent/commands/status"
+
+	// Commandes reçues, dans le dossier de configuration : une commande déjà
+	// reçue n'est jamais réexécutée, même après un redémarrage
+	commandJournalFile = "commands.json"
+	// Au-delà, les plus anciennes sont oubliées ; leur expiration empêche de les rejouer
+	maxCommandJournal = 500
+
+	// Commandes en attente d'exécution
+	commandQueueSize = 100
+)
+
+// AgentCommand est une commande du Dashboard
+type AgentCommand struct {
+	ID      string          `json:"id"`
+	Command string          `json:"command"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	// Au-delà, la commande est refusée sans être exécutée
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// Enveloppe signée (base64) et signature Ed25519 des commandes sensibles
+	SignedPayload string `json:"signed_payload,omitempty"`
+	Signature     string `json:"signature,omitempty"`
+
+	// Niveau de log des commandes portées par le heartbeat des anciens
+	// Dashboards (set_log_level, non signée)
+	LogLevel string `json:"log_level,omitempty"`
+}
+
+// decodeParams lit les paramètres de la commande dans v
+func (c AgentCommand) decodeParams(v interface{}) error {
+	if len(c.Params) == 0 || string(c.Params) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(c.Params, v); err != nil {
+		return fmt.Errorf("paramètres invalides: %w", err)
+	}
+	return nil
+}
+
+// CommandStatus est un changement d'état d'une commande envoyé au Dashboard
+type CommandStatus struct {
+	AgentID string      `json:"agent_id"`
+	ID      string      `json:"id"`
+	Command string      `json:"command"`
+	Status  string      `json:"status"`
+	Error   string      `json:"error,omitempty"`
+	Result  interface{} `json:"result,omitempty"`
+	At      time.Time   `json:"at"`
+}
+
+// commandRecord est l'état d'une commande reçue
+type commandRecord struct {
+	ID         string    `json:"id"`
+	Command    string    `json:"command"`
+	Status     string    `json:"status"`
+	ReceivedAt time.Time `json:"received_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// commandJournal conserve les commandes reçues, dans l'ordre d'arrivée
+type commandJournal struct {
+	mu      sync.Mutex
+	path    string
+	records []*commandRecord
+	byID    map[string]*commandRecord
+}
+
+var (
+	commands     = &commandJournal{byID: make(map[string]*commandRecord)}
+	commandQueue = make(chan AgentCommand, commandQueueSize)
+)
+
+// loadCommandJournal charge les commandes reçues (mode service). Une commande
+// interrompue par l'arrêt de l'agent est signalée en échec, pas relancée.
+func loadCommandJournal() {
+	commands.mu.Lock()
+	commands.path = filepath.Join(currentConfig().Dir(), commandJournalFile)
+	data, err := os.ReadFile(commands.path)
+	if err == nil {
+		if err := json.Unmarshal(data, &commands.records); err != nil {
+			slog.Warn("⚠️  Journal des commandes illisible", "error", err)
+			commands.records = nil
+		}
+	}
+	var interrupted []*commandRecord
+	for _, r := range commands.records {
+		commands.byID[r.ID] = r
+		if r.Status == CommandQueued || r.Status == CommandRunning {
+			interrupted = append(interrupted, r)
+		}
+	}
+	commands.mu.Unlock()
+
+	for _, r := range interrupted {
+		reportCommand(AgentCommand{ID: r.ID, Command: r.Command}, CommandFailed, nil,
+			errors.New("interrompue par l'arrêt de l'agent"))
+	}
+}
+
+// record enregistre une commande reçue ; false si elle l'a déjà été
+func (j *commandJournal) record(cmd AgentCommand) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, ok := j.byID[cmd.ID]; ok {
+		return false
+	}
+	now := time.Now()
+	r := &commandRecord{ID: cmd.ID, Command: cmd.Command, ReceivedAt: now, UpdatedAt: now}
+	j.records = append(j.records, r)
+	j.byID[cmd.ID] = r
+	if len(j.records) > maxCommandJournal {
+		delete(j.byID, j.records[0].ID)
+		j.records = j.records[1:]
+	}
+	j.save()
+	return true
+}
+
+// update enregistre le nouvel état d'une commande
+func (j *commandJournal) update(id, status string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if r, ok := j.byID[id]; ok {
+		r.Status = status
+		r.UpdatedAt = time.Now()
+		j.save()
+	}
+}
+
+// save écrit le journal (verrou pris) ; hors mode service, rien n'est écrit
+func (j *commandJournal) save() {
+	if j.path == "" {
+		return
+	}
+	data, err := json.Marshal(j.records)
+	if err != nil {
+		return
+	}
+	tmp := j.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		slog.Warn("⚠️  Journal des commandes non enregistré", "error", err)
+		return
+	}
+	if err := os.Rename(tmp, j.path); err != nil {
+		slog.Warn("⚠️  Journal des commandes non enregistré", "error", err)
+	}
+}
+
+// receiveCommands accuse réception des commandes puis place les nouvelles
+// dans la file d'exécution, dans l'ordre. Une commande déjà reçue est
+// acquittée sans être réexécutée ; une commande sensible mal signée est refusée.
+func receiveCommands(received []AgentCommand) {
+	ids := make([]string, 0, len(received))
+	var fresh []AgentCommand
+	for _, cmd := range received {
+		if cmd.ID == "" {
+			continue
+		}
+		ids = append(ids, cmd.ID)
+
+		// Vérifiée avant d'être enregistrée : une commande forgée ne consomme
+		// pas l'ID d'une vraie commande
+		verified, err := verifyCommand(cmd)
+		if err != nil {
+			rejectCommand(cmd, err)
+			continue
+		}
+		switch {
+		case commands.record(verified):
+			fresh = append(fresh, verified)
+		case signedCommands[cmd.Command]:
+			slog.Warn("🔁 Commande sensible rejouée - ignorée", "id", cmd.ID, "command", cmd.Command)
+			sendActivityLog("warning", fmt.Sprintf("Commande %s rejouée ignorée", cmd.Command), map[string]interface{}{
+				"command_id": cmd.ID,
+			})
+		default:
+			slog.Debug("Commande déjà reçue - ignorée", "id", cmd.ID, "command", cmd.Command)
+		}
+	}
+
+	ackCommands(ids)
+	for _, cmd := range fresh {
+		if cmd.ExpiresAt != nil && time.Now().After(*cmd.ExpiresAt) {
+			slog.Warn("⏰ Commande expirée - ignorée", "id", cmd.ID, "command", cmd.Command, "expires_at", cmd.ExpiresAt)
+			reportCommand(cmd, CommandRejected, nil, errors.New("commande expirée"))
+			continue
+		}
+		enqueueCommand(cmd)
+	}
+}
+
+// enqueueCommand place une commande dans la file d'exécution. L'état queued
+// est signalé avant : le worker peut prendre la commande aussitôt.
+func enqueueCommand(cmd AgentCommand) {
+	reportCommand(cmd, CommandQueued, nil, nil)
+	select {
+	case commandQueue <- cmd:
+		slog.Debug("📨 Commande en file", "id", cmd.ID, "command", cmd.Command)
+	default:
+		reportCommand(cmd, CommandFailed, nil, errors.New("file de commandes pleine"))
+	}
+}
+
+// commandWorker exécute les commandes une à une, dans l'ordre de réception
+func commandWorker() {
+	for cmd := range commandQueue {
+		reportCommand(cmd, CommandRunning, nil, nil)
+		result, err := executeCommand(cmd)
+		if err != nil {
+			reportCommand(cmd, CommandFailed, result, err)
+		} else {
+			reportCommand(cmd, CommandDone, result, nil)
+		}
+	}
+}
+
+// executeCommand exécute une commande du Dashboard et retourne son résultat
+func executeCommand(cmd AgentCommand) (interface{}, error) {
+	switch cmd.Command {
+	case "backup_now":
+		slog.Info("📦 Commande de sauvegarde reçue!")
+		return runBackupJob("manuelle")
+
+	case "restore":
+		// Paramètres signés seulement (restore_config n'est pas couvert par la signature)
+		restoreConfig := &RestoreConfig{}
+		if err := cmd.decodeParams(restoreConfig); err != nil {
+			return nil, err
+		}
+		if restoreConfig.SnapshotID == "" || restoreConfig.TargetPath == "" {
+			return nil, errors.New("snapshot_id et target_path requis")
+		}
+		slog.Info("🔄 Commande de restauration reçue!")
+		return nil, runRestore(restoreConfig)
+
+	case "preview_backup":
+		slog.Info("🔍 Aperçu de sauvegarde demandé par le serveur")
+		return runPreview()
+
+	case "sync_snapshots":
+		slog.Info("📸 Synchronisation des snapshots demandée")
+		return nil, syncSnapshots()
+
+	case "set_log_level":
+		level := cmd.LogLevel
+		if level == "" {
+			var params struct {
+				LogLevel string `json:"log_level"`
+			}
+			if err := cmd.decodeParams(&params); err != nil {
+				return nil, err
+			}
+			level = params.LogLevel
+		}
+		if err := logging.SetLevel(level); err != nil {
+			slog.Warn("⚠️  Niveau de log refusé", "level", level, "error", err)
+			sendActivityLog("warning", fmt.Sprintf("Niveau de log refusé: %v", err), nil)
+			return nil, err
+		}
+		slog.Info("🔧 Niveau de log modifié par le serveur", "level", logging.Level().String())
+		sendActivityLog("info", "Niveau de log modifié", map[string]interface{}{
+			"log_level": logging.Level().String(),
+		})
+		return map[string]string{"log_level": logging.Level().String()}, nil
+
+	case "reset_canaries":
+		slog.Info("🐤 Réinitialisation des fichiers témoins demandée par le serveur")
+		status, err := resetCanaries()
+		if err == nil {
+			sendActivityLog("info", "Fichiers témoins réinitialisés, sauvegardes planifiées reprises", nil)
+		}
+		return status, err
+
+	case "rotate_key":
+		rotation := &KeyRotationConfig{}
+		if err := cmd.decodeParams(rotation); err != nil {
+			return nil, err
+		}
+		slog.Info("🔑 Rotation de clé demandée par le serveur")
+		return nil, runKeyRotation(rotation)
+
+	case "shutdown":
+		slog.Info("🛑 Arrêt demandé par le serveur")
+		reportCommand(cmd, CommandDone, nil, nil)
+		os.Exit(0)
+	}
+
+	return nil, fmt.Errorf("commande inconnue: %s", cmd.Command)
+}
+
+// reportCommand enregistre et envoie au Dashboard l'état d'une commande.
+// Un envoi impossible est conservé dans l'outbox : l'historique reste complet.
+func reportCommand(cmd AgentCommand, status string, result interface{}, cmdErr error) {
+	// Commande sans ID (ancien Dashboard) : pas de suivi
+	if cmd.ID == "" {
+		return
+	}
+	commands.update(cmd.ID, status)
+
+	payload := CommandStatus{
+		AgentID: currentAgentID(),
+		ID:      cmd.ID,
+		Command: cmd.Command,
+		Status:  status,
+		Result:  result,
+		At:      time.Now(),
+	}
+	if cmdErr != nil {
+		payload.Error = cmdErr.Error()
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("❌ Erreur sérialisation état de commande", "error", err)
+		return
+	}
+
+	req, err := http.NewRequest("POST", currentConfig().APIEndpoint+commandStatusPath, bytes.NewBuffer(jsonData))
+	if err != nil {
+		slog.Error("❌ Erreur création requête état de commande", "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", fmt.Sprintf("%s/%s", AppName, Version))
+
+	client := newDashboardClient(10 * time.Second)
+	resp, err := client.Do(req)
+	if err != nil {
+		slog.Warn("⚠️  État de commande non envoyé - conservé pour envoi ultérieur", "error", err)
+		enqueueOutbox(commandStatusPath, jsonData)
+		return
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated:
+		slog.Debug("📝 État de commande envoyé", "id", cmd.ID, "status", status)
+	case resp.StatusCode >= 500:
+		enqueueOutbox(commandStatusPath, jsonData)
+	default:
+		slog.Warn("⚠️  Erreur envoi état de commande", "status", resp.StatusCode)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mon-rempart/agent/config"
+)
+
+// fakeDashboard enregistre les accusés de réception, états de commande et
+// logs d'activité
+type fakeDashboard struct {
+	mu       sync.Mutex
+	acked    []string
+	statuses []CommandStatus
+	activity []ActivityLogPayload
+}
+
+// withFakeDashboard oriente l'agent vers un Dashboard de test, avec un
+// journal des commandes vide dans un dossier temporaire
+func withFakeDashboard(t *testing.T) *fakeDashboard {
+	t.Helper()
+	d := &fakeDashboard{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		switch r.URL.Path {
+		case commandAckPath:
+			var ack struct {
+				IDs []string `json:"ids"`
+			}
+			json.NewDecoder(r.Body).Decode(&ack)
+			d.acked = append(d.acked, ack.IDs...)
+		case commandStatusPath:
+			var status CommandStatus
+			json.NewDecoder(r.Body).Decode(&status)
+			d.statuses = append(d.statuses, status)
+		case "/api/agent/log":
+			var log ActivityLogPayload
+			json.NewDecoder(r.Body).Decode(&log)
+			d.activity = append(d.activity, log)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	previousCfg, previousJournal := currentConfig(), commands
+	activeConfig.Store(&config.Config{APIEndpoint: server.URL})
+	commands = &commandJournal{
+		path: filepath.Join(t.TempDir(), commandJournalFile),
+		byID: make(map[string]*commandRecord),
+	}
+	t.Cleanup(func() {
+		activeConfig.Store(previousCfg)
+		commands = previousJournal
+		drainCommandQueue()
+	})
+	return d
+}
+
+// drainCommandQueue vide la file d'exécution et retourne les commandes en attente
+func drainCommandQueue() []AgentCommand {
+	var queued []AgentCommand
+	for {
+		select {
+		case cmd := <-commandQueue:
+			queued = append(queued, cmd)
+		default:
+			return queued
+		}
+	}
+}
+
+// waitActivity attend un log d'activité du niveau demandé (envoyé en arrière-plan)
+func (d *fakeDashboard) waitActivity(t *testing.T, level string) ActivityLogPayload {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		d.mu.Lock()
+		for _, log := range d.activity {
+			if log.Level == level {
+				d.mu.Unlock()
+				return log
+			}
+		}
+		d.mu.Unlock()
+	}
+	t.Fatalf("aucun log d'activité %s", level)
+	return ActivityLogPayload{}
+}
+
+// statusOf retourne le dernier état signalé pour une commande
+func (d *fakeDashboard) statusOf(id string) CommandStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := len(d.statuses) - 1; i >= 0; i-- {
+		if d.statuses[i].ID == id {
+			return d.statuses[i]
+		}
+	}
+	return CommandStatus{}
+}
+
+func TestReceiveCommandsIgnoresDuplicate(t *testing.T) {
+	d := withFakeDashboard(t)
+	cmd := AgentCommand{ID: "cmd-1", Command: "sync_snapshots"}
+
+	receiveCommands([]AgentCommand{cmd})
+	receiveCommands([]AgentCommand{cmd})
+
+	if queued := drainCommandQueue(); len(queued) != 1 || queued[0].ID != "cmd-1" {
+		t.Errorf("file = %+v, attendu cmd-1 une seule fois", queued)
+	}
+	// Redistribuée : acquittée à nouveau pour que le Dashboard cesse de l'envoyer
+	if len(d.acked) != 2 {
+		t.Errorf("accusés = %v, attendu deux accusés", d.acked)
+	}
+	if got := d.statusOf("cmd-1").Status; got != CommandQueued {
+		t.Errorf("état = %q, attendu %q", got, CommandQueued)
+	}
+}
+
+func TestReceiveCommandsRejectsExpired(t *testing.T) {
+	d := withFakeDashboard(t)
+	expired := time.Now().Add(-time.Minute)
+	valid := time.Now().Add(time.Hour)
+
+	receiveCommands([]AgentCommand{
+		{ID: "cmd-old", Command: "sync_snapshots", ExpiresAt: &expired},
+		{ID: "cmd-new", Command: "sync_snapshots", ExpiresAt: &valid},
+	})
+
+	queued := drainCommandQueue()
+	if len(queued) != 1 || queued[0].ID != "cmd-new" {
+		t.Errorf("file = %+v, attendu cmd-new seule", queued)
+	}
+	status := d.statusOf("cmd-old")
+	if status.Status != CommandRejected || status.Error == "" {
+		t.Errorf("état de la commande expirée = %+v, attendu %q", status, CommandRejected)
+	}
+	// Enregistrée : une redistribution n'est pas réévaluée
+	if r := commands.byID["cmd-old"]; r == nil || r.Status != CommandRejected {
+		t.Errorf("journal = %+v", r)
+	}
+}
+
+func TestCommandJournalTrim(t *testing.T) {
+	withFakeDashboard(t)
+	const extra = 10
+	for i := 0; i < maxCommandJournal+extra; i++ {
+		if !commands.record(AgentCommand{ID: fmt.Sprintf("cmd-%03d", i), Command: "sync_snapshots"}) {
+			t.Fatalf("cmd-%03d déjà reçue", i)
+		}
+	}
+
+	if len(commands.records) != maxCommandJournal || len(commands.byID) != maxCommandJournal {
+		t.Fatalf("journal = %d commandes (%d indexées), attendu %d", len(commands.records), len(commands.byID), maxCommandJournal)
+	}
+	if first := commands.records[0].ID; first != fmt.Sprintf("cmd-%03d", extra) {
+		t.Errorf("plus ancienne = %s, attendu cmd-%03d", first, extra)
+	}
+	if _, ok := commands.byID["cmd-000"]; ok {
+		t.Error("cmd-000 toujours indexée")
+	}
+	last := fmt.Sprintf("cmd-%03d", maxCommandJournal+extra-1)
+	if commands.record(AgentCommand{ID: last, Command: "sync_snapshots"}) {
+		t.Errorf("%s réenregistrée", last)
+	}
+
+	// Le fichier suit le journal en mémoire
+	data, err := os.ReadFile(commands.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved []commandRecord
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != maxCommandJournal || saved[len(saved)-1].ID != last {
+		t.Errorf("journal enregistré = %d commandes, dernière %s", len(saved), saved[len(saved)-1].ID)
+	}
+}
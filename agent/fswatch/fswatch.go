@@ -0,0 +1,79 @@
+// Package fswatch - Notifications de modification de fichiers
+// inotify sous Linux ; ailleurs, New retourne ErrUnsupported : les fichiers
+// témoins sont alors vérifiés périodiquement et la protection continue est
+// désactivée (sauvegardes planifiées seules)
+package fswatch
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// Op décrit les opérations signalées sur un fichier
+type Op uint32
+
+const (
+	Create   Op = 1 << iota // Fichier créé ou déplacé dans le dossier
+	Write                   // Contenu modifié
+	Remove                  // Fichier supprimé
+	Rename                  // Fichier déplacé hors du dossier ou renommé
+	Chmod                   // Attributs modifiés
+	Overflow                // File d'événements du noyau saturée : des événements ont été perdus
+)
+
+// String retourne les opérations lisibles (CREATE|WRITE...)
+func (op Op) String() string {
+	var names []string
+	for _, o := range []struct {
+		op   Op
+		name string
+	}{
+		{Create, "CREATE"}, {Write, "WRITE"}, {Remove, "REMOVE"},
+		{Rename, "RENAME"}, {Chmod, "CHMOD"}, {Overflow, "OVERFLOW"},
+	} {
+		if op&o.op != 0 {
+			names = append(names, o.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// Event est une modification dans un dossier surveillé
+type Event struct {
+	Name  string // Chemin complet du fichier concerné
+	Op    Op
+	IsDir bool
+}
+
+var (
+	// ErrUnsupported : pas de notifications sur ce système
+	ErrUnsupported = errors.New("surveillance des fichiers non prise en charge sur ce système")
+	// ErrWatchLimit : limite de dossiers surveillés atteinte (fs.inotify.max_user_watches)
+	ErrWatchLimit = errors.New("limite de dossiers surveillés atteinte")
+)
+
+// AddRecursive surveille root et ses sous-dossiers, sauf ceux pour lesquels
+// skip retourne vrai. Retourne le nombre de dossiers ajoutés ; à la limite du
+// système (ErrWatchLimit), les dossiers déjà ajoutés restent surveillés.
+func (w *Watcher) AddRecursive(root string, skip func(path string) bool) (int, error) {
+	added := 0
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() {
+			return nil // Dossier illisible : ignoré
+		}
+		if skip != nil && path != root && skip(path) {
+			return filepath.SkipDir
+		}
+		if err := w.Add(path); err != nil {
+			if errors.Is(err, ErrWatchLimit) || errors.Is(err, ErrUnsupported) {
+				return err
+			}
+			return nil // Dossier supprimé entre-temps, droits insuffisants...
+		}
+		added++
+		return nil
+	})
+	return added, err
+}
@@ -0,0 +1,174 @@
+//go:build linux
+
+package fswatch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+// Événements inotify demandés pour chaque dossier
+const watchMask = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE |
+	syscall.IN_ATTRIB | syscall.IN_DELETE | syscall.IN_DELETE_SELF |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_MOVE_SELF
+
+// Watcher surveille des dossiers (non récursif : un appel à Add par dossier)
+type Watcher struct {
+	// Events reçoit les modifications ; fermé à l'arrêt
+	Events chan Event
+	// Errors reçoit les erreurs de lecture
+	Errors chan error
+
+	file *os.File
+	fd   int
+
+	mu      sync.Mutex
+	watches map[int32]string // descripteur -> dossier
+	paths   map[string]int32
+}
+
+// New démarre une surveillance inotify
+func New() (*Watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify: %w", err)
+	}
+	// Descripteur non bloquant : géré par le poller du runtime, Close débloque la lecture
+	w := &Watcher{
+		Events:  make(chan Event, 256),
+		Errors:  make(chan error, 8),
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		fd:      fd,
+		watches: make(map[int32]string),
+		paths:   make(map[string]int32),
+	}
+	go w.readLoop()
+	return w, nil
+}
+
+// Add surveille un dossier. ErrWatchLimit signale la limite du système atteinte.
+func (w *Watcher) Add(dir string) error {
+	dir = filepath.Clean(dir)
+	wd, err := syscall.InotifyAddWatch(w.fd, dir, watchMask)
+	if err != nil {
+		if errors.Is(err, syscall.ENOSPC) {
+			return fmt.Errorf("%s: %w", dir, ErrWatchLimit)
+		}
+		return fmt.Errorf("%s: %w", dir, err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.watches[int32(wd)] = dir
+	w.paths[dir] = int32(wd)
+	return nil
+}
+
+// Remove arrête la surveillance d'un dossier
+func (w *Watcher) Remove(dir string) error {
+	dir = filepath.Clean(dir)
+	w.mu.Lock()
+	wd, ok := w.paths[dir]
+	if ok {
+		delete(w.paths, dir)
+		delete(w.watches, wd)
+	}
+	w.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	if _, err := syscall.InotifyRmWatch(w.fd, uint32(wd)); err != nil && !errors.Is(err, syscall.EINVAL) {
+		return fmt.Errorf("%s: %w", dir, err)
+	}
+	return nil
+}
+
+// Watched retourne le nombre de dossiers surveillés
+func (w *Watcher) Watched() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.paths)
+}
+
+// Close arrête la surveillance ; Events est fermé
+func (w *Watcher) Close() error {
+	return w.file.Close()
+}
+
+// readLoop décode les événements du noyau
+func (w *Watcher) readLoop() {
+	defer close(w.Events)
+	defer close(w.Errors)
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				w.sendError(err)
+			}
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			raw := buf[offset:]
+			wd := int32(binary.NativeEndian.Uint32(raw[0:4]))
+			mask := binary.NativeEndian.Uint32(raw[4:8])
+			nameLen := int(binary.NativeEndian.Uint32(raw[12:16]))
+			name := string(bytes.TrimRight(raw[syscall.SizeofInotifyEvent:syscall.SizeofInotifyEvent+nameLen], "\x00"))
+			offset += syscall.SizeofInotifyEvent + nameLen
+
+			if mask&syscall.IN_Q_OVERFLOW != 0 {
+				w.Events <- Event{Op: Overflow}
+				continue
+			}
+
+			w.mu.Lock()
+			dir, known := w.watches[wd]
+			if mask&syscall.IN_IGNORED != 0 && known {
+				// Dossier supprimé ou démonté : le noyau a retiré la surveillance
+				delete(w.watches, wd)
+				delete(w.paths, dir)
+			}
+			w.mu.Unlock()
+			if !known || mask&syscall.IN_IGNORED != 0 {
+				continue
+			}
+
+			event := Event{Name: dir, IsDir: mask&syscall.IN_ISDIR != 0}
+			if name != "" {
+				event.Name = filepath.Join(dir, name)
+			}
+			if mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+				event.Op |= Create
+			}
+			if mask&(syscall.IN_MODIFY|syscall.IN_CLOSE_WRITE) != 0 {
+				event.Op |= Write
+			}
+			if mask&(syscall.IN_DELETE|syscall.IN_DELETE_SELF) != 0 {
+				event.Op |= Remove
+			}
+			if mask&(syscall.IN_MOVED_FROM|syscall.IN_MOVE_SELF) != 0 {
+				event.Op |= Rename
+			}
+			if mask&syscall.IN_ATTRIB != 0 {
+				event.Op |= Chmod
+			}
+			w.Events <- event
+		}
+	}
+}
+
+// sendError transmet une erreur sans bloquer la lecture
+func (w *Watcher) sendError(err error) {
+	select {
+	case w.Errors <- err:
+	default:
+	}
+}
@@ -0,0 +1,34 @@
+//go:build !linux
+
+package fswatch
+
+// Watcher n'est pas disponible sur ce système
+type Watcher struct {
+	Events chan Event
+	Errors chan error
+}
+
+// New retourne ErrUnsupported : aucune notification sur ce système
+func New() (*Watcher, error) {
+	return nil, ErrUnsupported
+}
+
+// Add n'est pas pris en charge
+func (w *Watcher) Add(dir string) error {
+	return ErrUnsupported
+}
+
+// Remove n'est pas pris en charge
+func (w *Watcher) Remove(dir string) error {
+	return ErrUnsupported
+}
+
+// Watched retourne 0
+func (w *Watcher) Watched() int {
+	return 0
+}
+
+// Close ne fait rien
+func (w *Watcher) Close() error {
+	return nil
+}
@@ -0,0 +1,226 @@
+// Package governor - État du poste avant une sauvegarde automatique
+// Charge, occupation du processeur et alimentation sont lues dans /proc et
+// /sys (Linux) ; une mesure indisponible (autre système) ne retarde rien.
+// L'activité de l'utilisateur (clavier, souris) n'est pas mesurée : un poste
+// utilisé mais peu chargé ne retarde pas la sauvegarde.
+package governor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits décrit quand une sauvegarde automatique doit attendre
+type Limits struct {
+	MaxLoad       float64 // Charge moyenne (1 min) par processeur, 0 : ignorée
+	MaxCPUPercent int     // Occupation du processeur, 0 : ignorée
+	RunOnBattery  bool    // Sauvegarde aussi sur batterie
+}
+
+// Sample est l'état mesuré du poste
+type Sample struct {
+	Load       float64 `json:"load"`              // Charge moyenne sur 1 minute
+	CPUs       int     `json:"cpus"`              // Nombre de processeurs
+	CPUPercent float64 `json:"cpu_percent"`       // Occupation du processeur depuis la mesure précédente
+	OnBattery  bool    `json:"on_battery"`        // Portable débranché
+	Battery    int     `json:"battery,omitempty"` // Charge de la batterie en %
+	hasLoad    bool
+	hasCPU     bool
+}
+
+// Reason est une raison d'attendre : Code stable (load, cpu, battery) et message lisible
+type Reason struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Codes des raisons
+const (
+	ReasonLoad    = "load"
+	ReasonCPU     = "cpu"
+	ReasonBattery = "battery"
+)
+
+// Au-delà, la mesure précédente du processeur est trop ancienne pour
+// refléter l'activité actuelle : nouvelle mesure sur SampleInterval
+const maxSampleAge = 5 * time.Minute
+
+// Governor mesure l'état du poste. Root est la racine de /proc et /sys :
+// "/" en production, une arborescence factice pour les tests.
+type Governor struct {
+	Root string
+	// Première mesure de l'occupation du processeur (sinon : écart avec la précédente)
+	SampleInterval time.Duration
+
+	mu       sync.Mutex
+	prevBusy uint64
+	prevAll  uint64
+	prevTime time.Time
+}
+
+// New retourne un Governor sur le système réel
+func New() *Governor {
+	return &Governor{Root: "/", SampleInterval: time.Second}
+}
+
+// Sample mesure l'état du poste
+func (g *Governor) Sample() Sample {
+	s := Sample{CPUs: runtime.NumCPU()}
+	if load, err := g.loadAverage(); err == nil {
+		s.Load, s.hasLoad = load, true
+	}
+	if percent, err := g.cpuPercent(); err == nil {
+		s.CPUPercent, s.hasCPU = percent, true
+	}
+	s.OnBattery, s.Battery = g.battery()
+	return s
+}
+
+// Reasons retourne les raisons d'attendre, vides si la sauvegarde peut partir
+func (s Sample) Reasons(limits Limits) []Reason {
+	var reasons []Reason
+	if limits.MaxLoad > 0 && s.hasLoad && s.CPUs > 0 && s.Load/float64(s.CPUs) > limits.MaxLoad {
+		reasons = append(reasons, Reason{ReasonLoad, fmt.Sprintf("charge élevée (%.2f pour %d processeurs)", s.Load, s.CPUs)})
+	}
+	if limits.MaxCPUPercent > 0 && s.hasCPU && s.CPUPercent > float64(limits.MaxCPUPercent) {
+		reasons = append(reasons, Reason{ReasonCPU, fmt.Sprintf("processeur occupé (%.0f %%)", s.CPUPercent)})
+	}
+	if !limits.RunOnBattery && s.OnBattery {
+		reasons = append(reasons, Reason{ReasonBattery, fmt.Sprintf("sur batterie (%d %%)", s.Battery)})
+	}
+	return reasons
+}
+
+// Codes retourne les codes des raisons, séparés par des virgules
+func Codes(reasons []Reason) string {
+	codes := make([]string, len(reasons))
+	for i, r := range reasons {
+		codes[i] = r.Code
+	}
+	return strings.Join(codes, ",")
+}
+
+// Messages retourne les messages des raisons, séparés par des virgules
+func Messages(reasons []Reason) string {
+	messages := make([]string, len(reasons))
+	for i, r := range reasons {
+		messages[i] = r.Message
+	}
+	return strings.Join(messages, ", ")
+}
+
+// loadAverage lit la charge moyenne sur 1 minute (/proc/loadavg)
+func (g *Governor) loadAverage() (float64, error) {
+	data, err := os.ReadFile(filepath.Join(g.Root, "proc", "loadavg"))
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("loadavg vide")
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+// cpuPercent retourne l'occupation du processeur depuis l'appel précédent ;
+// au premier appel ou après maxSampleAge, sur SampleInterval
+func (g *Governor) cpuPercent() (float64, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	busy, all, err := g.cpuTimes()
+	if err != nil {
+		return 0, err
+	}
+	if time.Since(g.prevTime) > maxSampleAge && g.SampleInterval > 0 {
+		g.prevBusy, g.prevAll = busy, all
+		time.Sleep(g.SampleInterval)
+		if busy, all, err = g.cpuTimes(); err != nil {
+			return 0, err
+		}
+	}
+	prevBusy, prevAll := g.prevBusy, g.prevAll
+	g.prevBusy, g.prevAll, g.prevTime = busy, all, time.Now()
+	if all <= prevAll || busy < prevBusy {
+		return 0, fmt.Errorf("mesure du processeur indisponible")
+	}
+	return 100 * float64(busy-prevBusy) / float64(all-prevAll), nil
+}
+
+// cpuTimes lit les temps cumulés du processeur (/proc/stat, ligne "cpu") :
+// occupé (hors idle et iowait) et total
+func (g *Governor) cpuTimes() (busy, all uint64, err error) {
+	data, err := os.ReadFile(filepath.Join(g.Root, "proc", "stat"))
+	if err != nil {
+		return 0, 0, err
+	}
+	line, _, _ := strings.Cut(string(data), "\n")
+	fields := strings.Fields(line)
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return 0, 0, fmt.Errorf("format de /proc/stat inconnu")
+	}
+	var idle uint64
+	// user nice system idle iowait irq softirq steal (guest inclus dans user)
+	for i, field := range fields[1:] {
+		if i >= 8 {
+			break
+		}
+		value, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("/proc/stat: %w", err)
+		}
+		all += value
+		if i == 3 || i == 4 {
+			idle += value
+		}
+	}
+	return all - idle, all, nil
+}
+
+// battery indique si le poste fonctionne sur batterie (/sys/class/power_supply) :
+// une batterie se décharge et aucun secteur n'est branché
+func (g *Governor) battery() (onBattery bool, percent int) {
+	dir := filepath.Join(g.Root, "sys", "class", "power_supply")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false, 0
+	}
+
+	mains, discharging := false, false
+	for _, entry := range entries {
+		supply := filepath.Join(dir, entry.Name())
+		switch readValue(supply, "type") {
+		case "Mains", "USB", "USB_C", "USB_PD":
+			if readValue(supply, "online") == "1" {
+				mains = true
+			}
+		case "Battery":
+			// Batteries de périphériques (souris...) : scope Device
+			if readValue(supply, "scope") == "Device" {
+				continue
+			}
+			if readValue(supply, "status") == "Discharging" {
+				discharging = true
+				if capacity, err := strconv.Atoi(readValue(supply, "capacity")); err == nil {
+					percent = capacity
+				}
+			}
+		}
+	}
+	return discharging && !mains, percent
+}
+
+// readValue lit un attribut sysfs (vide : absent)
+func readValue(dir, name string) string {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,184 @@
+package governor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeRoot crée une arborescence /proc et /sys factice : chemin relatif -> contenu
+func fakeRoot(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// supply décrit une alimentation de /sys/class/power_supply
+func supply(name string, attrs map[string]string) map[string]string {
+	files := make(map[string]string)
+	for attr, value := range attrs {
+		files[filepath.Join("sys", "class", "power_supply", name, attr)] = value
+	}
+	return files
+}
+
+// merge regroupe plusieurs arborescences
+func merge(trees ...map[string]string) map[string]string {
+	files := make(map[string]string)
+	for _, tree := range trees {
+		for name, content := range tree {
+			files[name] = content
+		}
+	}
+	return files
+}
+
+func TestBattery(t *testing.T) {
+	discharging := map[string]string{"type": "Battery", "status": "Discharging", "capacity": "42"}
+	tests := []struct {
+		name        string
+		files       map[string]string
+		wantBattery bool
+		wantPercent int
+	}{
+		{"sans power_supply", nil, false, 0},
+		{"batterie en décharge", supply("BAT0", discharging), true, 42},
+		{"batterie en charge", supply("BAT0", map[string]string{"type": "Battery", "status": "Charging", "capacity": "80"}), false, 0},
+		{"secteur branché", merge(supply("BAT0", discharging), supply("AC", map[string]string{"type": "Mains", "online": "1"})), false, 42},
+		{"secteur débranché", merge(supply("BAT0", discharging), supply("AC", map[string]string{"type": "Mains", "online": "0"})), true, 42},
+		{"chargeur USB-C", merge(supply("BAT0", discharging), supply("ucsi", map[string]string{"type": "USB_C", "online": "1"})), false, 42},
+		{"batterie de souris", supply("hidpp_battery_0", map[string]string{"type": "Battery", "scope": "Device", "status": "Discharging", "capacity": "10"}), false, 0},
+		{"capacité absente", supply("BAT0", map[string]string{"type": "Battery", "status": "Discharging"}), true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &Governor{Root: fakeRoot(t, tt.files)}
+			onBattery, percent := g.battery()
+			if onBattery != tt.wantBattery || percent != tt.wantPercent {
+				t.Errorf("battery() = %v, %d ; attendu %v, %d", onBattery, percent, tt.wantBattery, tt.wantPercent)
+			}
+		})
+	}
+}
+
+func TestCPUTimes(t *testing.T) {
+	tests := []struct {
+		name     string
+		stat     string
+		wantBusy uint64
+		wantAll  uint64
+		wantErr  bool
+	}{
+		{"complet", "cpu  100 10 50 800 40 5 5 0 20 0\ncpu0 1 2 3 4", 170, 1010, false},
+		{"guest ignoré", "cpu  100 0 0 900 0 0 0 0 500 500", 100, 1000, false},
+		{"ancien noyau", "cpu  100 0 50 850", 150, 1000, false},
+		{"trop court", "cpu  100 0 50", 0, 0, true},
+		{"ligne cpu absente", "intr 12345", 0, 0, true},
+		{"valeur invalide", "cpu  100 x 50 850 0", 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &Governor{Root: fakeRoot(t, map[string]string{"proc/stat": tt.stat})}
+			busy, all, err := g.cpuTimes()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("cpuTimes() = %d, %d ; erreur attendue", busy, all)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if busy != tt.wantBusy || all != tt.wantAll {
+				t.Errorf("cpuTimes() = %d, %d ; attendu %d, %d", busy, all, tt.wantBusy, tt.wantAll)
+			}
+		})
+	}
+}
+
+func TestCPUTimesMissing(t *testing.T) {
+	g := &Governor{Root: t.TempDir()}
+	if _, _, err := g.cpuTimes(); err == nil {
+		t.Error("cpuTimes() sans /proc/stat : erreur attendue")
+	}
+}
+
+func TestCPUPercent(t *testing.T) {
+	root := fakeRoot(t, map[string]string{"proc/stat": "cpu  100 0 0 900 0 0 0 0"})
+	g := &Governor{Root: root}
+
+	// Première mesure sans SampleInterval : moyenne depuis le démarrage
+	if percent, err := g.cpuPercent(); err != nil || percent != 10 {
+		t.Errorf("première mesure = %.1f, %v ; attendu 10", percent, err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "proc", "stat"), []byte("cpu  400 0 0 1000 0 0 0 0\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	percent, err := g.cpuPercent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if percent != 75 {
+		t.Errorf("cpuPercent() = %.1f, attendu 75", percent)
+	}
+
+	// Compteurs inchangés : pas d'écart mesurable
+	if _, err := g.cpuPercent(); err == nil {
+		t.Error("mesure sans écart : erreur attendue")
+	}
+}
+
+func TestSample(t *testing.T) {
+	root := fakeRoot(t, merge(
+		map[string]string{"proc/loadavg": "3.50 2.00 1.00 2/300 4242"},
+		supply("BAT0", map[string]string{"type": "Battery", "status": "Discharging", "capacity": "55"}),
+	))
+	s := (&Governor{Root: root, SampleInterval: time.Millisecond}).Sample()
+	if !s.hasLoad || s.Load != 3.5 || s.hasCPU || !s.OnBattery || s.Battery != 55 {
+		t.Errorf("Sample() = %+v", s)
+	}
+}
+
+func TestReasons(t *testing.T) {
+	busy := Sample{Load: 6, CPUs: 2, CPUPercent: 90, OnBattery: true, Battery: 30, hasLoad: true, hasCPU: true}
+	tests := []struct {
+		name   string
+		sample Sample
+		limits Limits
+		want   string
+	}{
+		{"tout au-delà", busy, Limits{MaxLoad: 2, MaxCPUPercent: 80}, "load,cpu,battery"},
+		{"limites désactivées", busy, Limits{RunOnBattery: true}, ""},
+		{"charge par processeur", busy, Limits{MaxLoad: 3, RunOnBattery: true}, ""},
+		{"processeur à la limite", busy, Limits{MaxCPUPercent: 90, RunOnBattery: true}, ""},
+		{"processeur au-delà", busy, Limits{MaxCPUPercent: 89, RunOnBattery: true}, "cpu"},
+		{"mesures indisponibles", Sample{Load: 6, CPUs: 2, CPUPercent: 90}, Limits{MaxLoad: 1, MaxCPUPercent: 10}, ""},
+		{"secteur", Sample{}, Limits{}, ""},
+		{"batterie", Sample{OnBattery: true, Battery: 12}, Limits{}, "battery"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reasons := tt.sample.Reasons(tt.limits)
+			if got := Codes(reasons); got != tt.want {
+				t.Errorf("Reasons() = %q (%s), attendu %q", got, Messages(reasons), tt.want)
+			}
+		})
+	}
+}
+
+func TestMessages(t *testing.T) {
+	reasons := Sample{OnBattery: true, Battery: 12, CPUPercent: 95, hasCPU: true}.Reasons(Limits{MaxCPUPercent: 50})
+	if got, want := Messages(reasons), "processeur occupé (95 %), sur batterie (12 %)"; got != want {
+		t.Errorf("Messages() = %q, attendu %q", got, want)
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mon-rempart/agent/backup"
+)
+
+// Démarrage de l'agent, pour l'uptime envoyé au Dashboard
+var startedAt = time.Now()
+
+// La version de restic est relue périodiquement (mise à jour du poste)
+const resticVersionTTL = 6 * time.Hour
+
+// DiskSpace est l'espace disque du volume d'un chemin sauvegardé
+type DiskSpace struct {
+	Path       string `json:"path"`
+	FreeBytes  uint64 `json:"free_bytes"`
+	TotalBytes uint64 `json:"total_bytes"`
+}
+
+// LastBackup est le résultat de la dernière sauvegarde des chemins configurés
+type LastBackup struct {
+	Time       time.Time `json:"time"`
+	Status     string    `json:"status"` // success ou failed
+	SnapshotID string    `json:"snapshot_id,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Trigger    string    `json:"trigger,omitempty"`
+}
+
+var (
+	lastBackupMu sync.Mutex
+	lastBackup   *LastBackup
+
+	// Tâches en cours (backup, restore...), avec leur nombre d'exécutions simultanées
+	jobsMu      sync.Mutex
+	runningJobs = make(map[string]int)
+
+	resticVersionMu   sync.Mutex
+	resticVersion     string
+	resticVersionTime time.Time
+)
+
+// BackupHistory conserve les dernières sauvegardes complètes (chemins
+// configurés) entre deux démarrages : une échéance sans tentative depuis
+// est rattrapée (voir scheduleLoop)
+type BackupHistory struct {
+	LastAttempt time.Time   `json:"last_attempt,omitempty"`
+	LastSuccess time.Time   `json:"last_success,omitempty"`
+	Last        *LastBackup `json:"last,omitempty"`
+}
+
+// Le service et la ligne de commande écrivent le même fichier
+var historyMu sync.Mutex
+
+// backupHistoryPath retourne le fichier des dernières sauvegardes
+func backupHistoryPath() string {
+	return filepath.Join(currentConfig().Dir(), "backup-state.json")
+}
+
+// loadBackupHistory lit les dernières sauvegardes (vide : aucune)
+func loadBackupHistory() *BackupHistory {
+	var history BackupHistory
+	data, err := os.ReadFile(backupHistoryPath())
+	if err == nil {
+		err = json.Unmarshal(data, &history)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		slog.Warn("⚠️  Historique des sauvegardes illisible", "error", err)
+	}
+	return &history
+}
+
+// updateBackupHistory modifie l'historique et l'écrit de façon atomique
+func updateBackupHistory(update func(h *BackupHistory)) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	history := loadBackupHistory()
+	update(history)
+	data, err := json.MarshalIndent(history, "", "  ")
+	if err == nil {
+		tmp := backupHistoryPath() + ".tmp"
+		if err = os.WriteFile(tmp, data, 0600); err == nil {
+			err = os.Rename(tmp, backupHistoryPath())
+		}
+	}
+	if err != nil {
+		slog.Warn("⚠️  Historique des sauvegardes non enregistré", "error", err)
+	}
+}
+
+// recordBackupAttempt enregistre le début d'une sauvegarde complète
+func recordBackupAttempt(at time.Time) {
+	updateBackupHistory(func(h *BackupHistory) { h.LastAttempt = at })
+}
+
+// restoreLastBackup reprend au démarrage le résultat de la dernière
+// sauvegarde complète pour le heartbeat
+func restoreLastBackup() {
+	if last := loadBackupHistory().Last; last != nil {
+		lastBackupMu.Lock()
+		lastBackup = last
+		lastBackupMu.Unlock()
+	}
+}
+
+// recordLastBackup enregistre le résultat d'une sauvegarde ; full : sauvegarde
+// des chemins configurés, conservée dans l'historique
+func recordLastBackup(trigger string, result *backup.BackupResult, err error, full bool) {
+	last := &LastBackup{Time: time.Now(), Status: "failed", Trigger: trigger}
+	switch {
+	case err != nil:
+		last.Error = err.Error()
+	case result != nil && result.Success:
+		last.Status = "success"
+		last.SnapshotID = result.SnapshotID
+	case result != nil:
+		last.Error = result.Error
+	}
+
+	lastBackupMu.Lock()
+	lastBackup = last
+	lastBackupMu.Unlock()
+
+	if full {
+		updateBackupHistory(func(h *BackupHistory) {
+			h.Last = last
+			if last.Status == "success" {
+				h.LastSuccess = last.Time
+			}
+		})
+	}
+}
+
+// lastBackupResult retourne le résultat de la dernière sauvegarde (nil : aucune)
+func lastBackupResult() *LastBackup {
+	lastBackupMu.Lock()
+	defer lastBackupMu.Unlock()
+	if lastBackup == nil {
+		return nil
+	}
+	last := *lastBackup
+	return &last
+}
+
+// trackJob signale une tâche en cours jusqu'à l'appel de la fonction retournée
+func trackJob(name string) (done func()) {
+	jobsMu.Lock()
+	runningJobs[name]++
+	jobsMu.Unlock()
+
+	return func() {
+		jobsMu.Lock()
+		defer jobsMu.Unlock()
+		if runningJobs[name]--; runningJobs[name] <= 0 {
+			delete(runningJobs, name)
+		}
+	}
+}
+
+// currentJob retourne les tâches en cours, séparées par des virgules
+func currentJob() string {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+
+	names := make([]string, 0, len(runningJobs))
+	for name := range runningJobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// cachedResticVersion retourne la version de restic, relue toutes les 6 heures
+func cachedResticVersion() string {
+	resticVersionMu.Lock()
+	defer resticVersionMu.Unlock()
+
+	if time.Since(resticVersionTime) > resticVersionTTL {
+		version, err := backup.ResticVersion()
+		if err != nil {
+			version = ""
+		}
+		// "restic 0.16.4 compiled with go1.21.6 on linux/amd64" : numéro seul
+		if fields := strings.Fields(version); len(fields) >= 2 && fields[0] == "restic" {
+			version = fields[1]
+		}
+		resticVersion, resticVersionTime = version, time.Now()
+	}
+	return resticVersion
+}
+
+// localIPs retourne l'adresse utilisée pour joindre le Dashboard et toutes
+// les adresses locales (hors loopback et lien local)
+func localIPs() (primary string, all []string) {
+	if u, err := neturl.Parse(currentConfig().APIEndpoint); err == nil && u.Hostname() != "" {
+		port := u.Port()
+		if port == "" {
+			port = "443"
+		}
+		// UDP : aucun paquet envoyé, seule la route est choisie
+		if conn, err := net.Dial("udp", net.JoinHostPort(u.Hostname(), port)); err == nil {
+			if addr, ok := conn.LocalAddr().(*net.UDPAddr); ok && !addr.IP.IsLoopback() {
+				primary = addr.IP.String()
+			}
+			conn.Close()
+		}
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return primary, nil
+	}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		all = append(all, ipNet.IP.String())
+	}
+	if primary == "" && len(all) > 0 {
+		primary = all[0]
+	}
+	return primary, all
+}
+
+// backupDiskSpace retourne l'espace libre des volumes des chemins sauvegardés
+func backupDiskSpace() []DiskSpace {
+	var disks []DiskSpace
+	for _, path := range currentConfig().BackupPaths {
+		free, total, err := diskSpace(path)
+		if err != nil {
+			continue
+		}
+		disks = append(disks, DiskSpace{Path: path, FreeBytes: free, TotalBytes: total})
+	}
+	return disks
+}
+
+// fillHealth complète le heartbeat avec l'état de l'agent et des sauvegardes
+func fillHealth(payload *HeartbeatPayload) {
+	payload.AgentVersion = Version
+	payload.OS = runtime.GOOS
+	payload.Arch = runtime.GOARCH
+	payload.UptimeSeconds = int64(time.Since(startedAt).Seconds())
+	payload.IPAddress, payload.IPAddresses = localIPs()
+	payload.Disks = backupDiskSpace()
+	payload.ResticVersion = cachedResticVersion()
+	payload.ConfigVersion = remoteConfigETag()
+	payload.PolicyVersion = appliedPolicyVersion()
+	payload.LastBackup = lastBackupResult()
+	if h := loadBackupHistory(); !h.LastSuccess.IsZero() {
+		payload.LastSuccessAt = &h.LastSuccess
+	}
+	payload.CurrentJob = currentJob()
+	payload.OutboxDepth = outboxDepth()
+	payload.Canary = canaryStatus()
+	payload.BackupDeferred = currentDeferral()
+}
@@ -0,0 +1,193 @@
+// Package identity - Identité persistante de l'agent Mon Rempart
+// Conserve l'ID attribué par le Dashboard et un secret d'installation, dont
+// sont dérivées les clés de chiffrement des données locales (cache de config...)
+package identity
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Nom du fichier d'identité dans le dossier de configuration
+const FileName = "identity.json"
+
+// Taille du secret d'installation
+const secretSize = 32
+
+// ErrDecrypt est retourné quand des données ne peuvent pas être déchiffrées :
+// fichier altéré, identité régénérée ou copié depuis une autre machine
+var ErrDecrypt = errors.New("déchiffrement impossible (données altérées ou autre machine)")
+
+// Identity est l'identité persistante de l'agent
+type Identity struct {
+	// ID attribué par le Dashboard au premier heartbeat
+	AgentID string `json:"agent_id,omitempty"`
+	// Secret aléatoire généré à l'installation, jamais transmis
+	Secret []byte `json:"secret"`
+	// Clé publique Ed25519 des commandes signées, épinglée à l'enrôlement
+	CommandKey []byte    `json:"command_key,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+
+	mu   sync.Mutex
+	path string
+}
+
+// Load charge l'identité du dossier dir, ou la crée au premier lancement
+func Load(dir string) (*Identity, error) {
+	path := filepath.Join(dir, FileName)
+	id := &Identity{path: path}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, id); err != nil {
+			return nil, fmt.Errorf("identité illisible %s: %w", path, err)
+		}
+		if len(id.Secret) != secretSize {
+			return nil, fmt.Errorf("identité invalide %s: secret absent", path)
+		}
+		return id, nil
+
+	case errors.Is(err, os.ErrNotExist):
+		id.Secret = make([]byte, secretSize)
+		if _, err := rand.Read(id.Secret); err != nil {
+			return nil, fmt.Errorf("génération du secret d'installation: %w", err)
+		}
+		id.CreatedAt = time.Now()
+		if err := id.save(); err != nil {
+			return nil, err
+		}
+		return id, nil
+
+	default:
+		return nil, fmt.Errorf("lecture identité %s: %w", path, err)
+	}
+}
+
+// ID retourne l'ID attribué par le Dashboard (vide avant le premier heartbeat)
+func (i *Identity) ID() string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.AgentID
+}
+
+// SetAgentID enregistre l'ID attribué par le Dashboard s'il a changé
+func (i *Identity) SetAgentID(agentID string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if agentID == "" || agentID == i.AgentID {
+		return nil
+	}
+	i.AgentID = agentID
+	return i.save()
+}
+
+// PinnedCommandKey retourne la clé des commandes signées (nil : aucune épinglée)
+func (i *Identity) PinnedCommandKey() ed25519.PublicKey {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if len(i.CommandKey) != ed25519.PublicKeySize {
+		return nil
+	}
+	return ed25519.PublicKey(i.CommandKey)
+}
+
+// PinCommandKey épingle la clé des commandes signées
+func (i *Identity) PinCommandKey(key ed25519.PublicKey) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("clé Ed25519 invalide (%d octets)", len(key))
+	}
+	if bytes.Equal(key, i.CommandKey) {
+		return nil
+	}
+	i.CommandKey = append([]byte(nil), key...)
+	return i.save()
+}
+
+// save écrit l'identité (écriture atomique, lisible par le seul utilisateur du service)
+func (i *Identity) save() error {
+	data, err := json.MarshalIndent(i, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(i.path), 0700); err != nil {
+		return fmt.Errorf("dossier de l'identité: %w", err)
+	}
+
+	tmp := i.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("écriture identité: %w", err)
+	}
+	return os.Rename(tmp, i.path)
+}
+
+// key dérive une clé AES-256 propre à un usage, liée au secret d'installation
+// et à l'identifiant de la machine : copiées sur un autre poste, les données
+// chiffrées sont illisibles
+func (i *Identity) key(purpose string) []byte {
+	mac := hmac.New(sha256.New, i.Secret)
+	mac.Write([]byte("monrempart/" + purpose + "\x00" + machineID()))
+	return mac.Sum(nil)
+}
+
+// Seal chiffre data (AES-256-GCM) avec la clé dérivée pour purpose
+func (i *Identity) Seal(purpose string, data []byte) ([]byte, error) {
+	gcm, err := newGCM(i.key(purpose))
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	// L'usage est authentifié : des données d'un usage ne s'ouvrent pas pour un autre
+	return gcm.Seal(nonce, nonce, data, []byte(purpose)), nil
+}
+
+// Open déchiffre des données produites par Seal pour le même usage
+func (i *Identity) Open(purpose string, sealed []byte) ([]byte, error) {
+	gcm, err := newGCM(i.key(purpose))
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	data, err := gcm.Open(nil, nonce, ciphertext, []byte(purpose))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return data, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// hostnameID : identifiant de repli quand la machine n'en expose pas
+func hostnameID() string {
+	name, _ := os.Hostname()
+	return "hostname:" + name
+}
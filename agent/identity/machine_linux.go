@@ -0,0 +1,21 @@
+//go:build linux
+
+package identity
+
+import (
+	"os"
+	"strings"
+)
+
+// machineID retourne l'identifiant de la machine (systemd/dbus), ou le
+// hostname à défaut
+func machineID() string {
+	for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		if data, err := os.ReadFile(path); err == nil {
+			if id := strings.TrimSpace(string(data)); id != "" {
+				return id
+			}
+		}
+	}
+	return hostnameID()
+}
@@ -0,0 +1,21 @@
+//go:build !linux && !windows
+
+package identity
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// machineID retourne l'UUID matériel (macOS), ou le hostname à défaut
+func machineID() string {
+	out, err := exec.Command("ioreg", "-rd1", "-c", "IOPlatformExpertDevice").Output()
+	if err == nil {
+		for _, line := range strings.Split(string(out), "\n") {
+			if key, value, ok := strings.Cut(line, "="); ok && strings.Contains(key, "IOPlatformUUID") {
+				return strings.Trim(strings.TrimSpace(value), `"`)
+			}
+		}
+	}
+	return hostnameID()
+}
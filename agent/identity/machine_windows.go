@@ -0,0 +1,22 @@
+//go:build windows
+
+package identity
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// machineID retourne le MachineGuid de Windows, ou le hostname à défaut
+func machineID() string {
+	out, err := exec.Command("reg", "query", `HKLM\SOFTWARE\Microsoft\Cryptography`, "/v", "MachineGuid").Output()
+	if err == nil {
+		for _, line := range strings.Split(string(out), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 3 && fields[0] == "MachineGuid" {
+				return fields[2]
+			}
+		}
+	}
+	return hostnameID()
+}
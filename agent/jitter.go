@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Délai maximal accepté d'une consigne de ralentissement du Dashboard : une
+// valeur aberrante ne doit pas rendre l'agent muet
+const maxServerBackoff = time.Hour
+
+// agentJitter retourne un décalage dans [0, max), stable d'un démarrage à
+// l'autre et propre à chaque agent et à chaque usage (scope) : les postes
+// d'un parc ne contactent pas le Dashboard ou le stockage à la même seconde
+func agentJitter(scope string, max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	seed := currentAgentID()
+	if seed == "" {
+		seed = hostname
+	}
+	sum := sha256.Sum256([]byte(seed + "/" + scope))
+	return time.Duration(binary.BigEndian.Uint64(sum[:8]) % uint64(max))
+}
+
+// nextSlot retourne le premier créneau strictement après t : multiples de
+// interval depuis l'origine des temps, décalés de offset. Le créneau d'un
+// agent ne dépend pas de l'heure de son démarrage.
+func nextSlot(t time.Time, interval, offset time.Duration) time.Time {
+	slot := t.Truncate(interval).Add(offset)
+	for !slot.After(t) {
+		slot = slot.Add(interval)
+	}
+	return slot
+}
+
+// serverBackoff retient le délai demandé par le Dashboard pour un appel
+// (Retry-After, backoff_seconds) afin de le soulager pendant un incident
+type serverBackoff struct {
+	name  string
+	mu    sync.Mutex
+	until time.Time
+}
+
+var (
+	heartbeatBackoff = &serverBackoff{name: "heartbeat"}
+	configBackoff    = &serverBackoff{name: "config"}
+)
+
+// observe relève la consigne d'une réponse : en-tête Retry-After (secondes
+// ou date HTTP) ou champ backoff_seconds du corps JSON
+func (b *serverBackoff) observe(resp *http.Response, body []byte) {
+	delay := retryAfter(resp.Header.Get("Retry-After"))
+	var hint struct {
+		BackoffSeconds int `json:"backoff_seconds"`
+	}
+	if json.Unmarshal(body, &hint) == nil && hint.BackoffSeconds > 0 {
+		delay = max(delay, time.Duration(hint.BackoffSeconds)*time.Second)
+	}
+	if delay <= 0 {
+		return
+	}
+	delay = min(delay, maxServerBackoff)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	until := time.Now().Add(delay)
+	if until.After(b.until) {
+		slog.Warn("🐢 Dashboard surchargé - appels espacés", "call", b.name, "status", resp.StatusCode, "delay", delay.Round(time.Second))
+		b.until = until
+	}
+}
+
+// next retourne le prochain créneau de l'appel, après la fin du délai demandé
+func (b *serverBackoff) next(now time.Time, interval, offset time.Duration) time.Time {
+	b.mu.Lock()
+	until := b.until
+	b.mu.Unlock()
+	if until.After(now) {
+		now = until
+	}
+	return nextSlot(now, interval, offset)
+}
+
+// retryAfter analyse un en-tête Retry-After : secondes ou date HTTP (0 : absent)
+func retryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
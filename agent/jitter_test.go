@@ -0,0 +1,161 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// withAgentID fixe l'identité utilisée par agentJitter le temps d'un test
+func withAgentID(t *testing.T, id, host string) {
+	t.Helper()
+	previousID, previousHost := currentAgentID(), hostname
+	setAgentID(id)
+	hostname = host
+	t.Cleanup(func() {
+		setAgentID(previousID)
+		hostname = previousHost
+	})
+}
+
+func TestAgentJitter(t *testing.T) {
+	withAgentID(t, "agent-1", "poste-1")
+	max := 30 * time.Minute
+
+	first := agentJitter("backup", max)
+	if first < 0 || first >= max {
+		t.Fatalf("agentJitter = %s, attendu dans [0, %s)", first, max)
+	}
+	if again := agentJitter("backup", max); again != first {
+		t.Errorf("agentJitter instable: %s puis %s", first, again)
+	}
+	if other := agentJitter("config", max); other == first {
+		t.Errorf("même décalage pour deux usages: %s", other)
+	}
+	if got := agentJitter("backup", 0); got != 0 {
+		t.Errorf("agentJitter(max=0) = %s", got)
+	}
+
+	// Autre agent : autre créneau
+	withAgentID(t, "agent-2", "poste-1")
+	if other := agentJitter("backup", max); other == first {
+		t.Errorf("même décalage pour deux agents: %s", other)
+	}
+
+	// Avant l'enrôlement : décalage issu du hostname
+	withAgentID(t, "", "poste-1")
+	byHost := agentJitter("backup", max)
+	withAgentID(t, "poste-1", "autre")
+	if byID := agentJitter("backup", max); byID != byHost {
+		t.Errorf("décalage sans agent_id = %s, attendu celui du hostname %s", byID, byHost)
+	}
+}
+
+func TestNextSlot(t *testing.T) {
+	base := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		t        time.Time
+		interval time.Duration
+		offset   time.Duration
+		want     time.Time
+	}{
+		{"avant le créneau", base.Add(10 * time.Second), time.Minute, 20 * time.Second, base.Add(20 * time.Second)},
+		{"sur le créneau", base.Add(20 * time.Second), time.Minute, 20 * time.Second, base.Add(80 * time.Second)},
+		{"après le créneau", base.Add(30 * time.Second), time.Minute, 20 * time.Second, base.Add(80 * time.Second)},
+		{"sans décalage", base, 5 * time.Minute, 0, base.Add(5 * time.Minute)},
+		{"décalage long", base.Add(time.Minute), 5 * time.Minute, 4 * time.Minute, base.Add(4 * time.Minute)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nextSlot(tt.t, tt.interval, tt.offset); !got.Equal(tt.want) {
+				t.Errorf("nextSlot = %s, attendu %s", got.Format("15:04:05"), tt.want.Format("15:04:05"))
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		value    string
+		min, max time.Duration
+	}{
+		{"", 0, 0},
+		{"120", 2 * time.Minute, 2 * time.Minute},
+		{" 30 ", 30 * time.Second, 30 * time.Second},
+		{"bientôt", 0, 0},
+		{time.Now().Add(10 * time.Minute).UTC().Format(http.TimeFormat), 9 * time.Minute, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := retryAfter(tt.value); got < tt.min || got > tt.max {
+			t.Errorf("retryAfter(%q) = %s, attendu entre %s et %s", tt.value, got, tt.min, tt.max)
+		}
+	}
+}
+
+// backoffResponse construit une réponse du Dashboard avec un éventuel Retry-After
+func backoffResponse(status int, retry string) *http.Response {
+	resp := &http.Response{StatusCode: status, Header: make(http.Header)}
+	if retry != "" {
+		resp.Header.Set("Retry-After", retry)
+	}
+	return resp
+}
+
+func TestServerBackoff(t *testing.T) {
+	interval, offset := time.Minute, 10*time.Second
+
+	tests := []struct {
+		name     string
+		resp     *http.Response
+		body     string
+		min, max time.Duration // Délai retenu
+	}{
+		{"sans consigne", backoffResponse(200, ""), `{"success":true}`, 0, 0},
+		{"Retry-After", backoffResponse(503, "300"), "", 5 * time.Minute, 5 * time.Minute},
+		{"backoff_seconds", backoffResponse(200, ""), `{"backoff_seconds":600}`, 10 * time.Minute, 10 * time.Minute},
+		{"le plus long", backoffResponse(429, "60"), `{"backoff_seconds":120}`, 2 * time.Minute, 2 * time.Minute},
+		{"plafonné", backoffResponse(503, "86400"), "", maxServerBackoff, maxServerBackoff},
+		{"corps non JSON", backoffResponse(502, ""), "<html>", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &serverBackoff{name: "test"}
+			before := time.Now()
+			b.observe(tt.resp, []byte(tt.body))
+			var delay time.Duration
+			if !b.until.IsZero() {
+				delay = b.until.Sub(before)
+			}
+			if delay < tt.min || delay > tt.max+time.Second {
+				t.Fatalf("délai = %s, attendu entre %s et %s", delay, tt.min, tt.max)
+			}
+
+			// Prochain appel : premier créneau de l'agent après la fin du délai
+			now := time.Now()
+			next := b.next(now, interval, offset)
+			start := now
+			if b.until.After(now) {
+				start = b.until
+			}
+			if !next.Equal(nextSlot(start, interval, offset)) {
+				t.Errorf("next = %s, attendu le créneau suivant %s", next, start)
+			}
+		})
+	}
+}
+
+func TestServerBackoffKeepsLongest(t *testing.T) {
+	b := &serverBackoff{name: "test"}
+	b.observe(backoffResponse(503, "600"), nil)
+	until := b.until
+	// Une consigne plus courte ne raccourcit pas le délai en cours
+	b.observe(backoffResponse(503, "60"), nil)
+	if !b.until.Equal(until) {
+		t.Errorf("délai raccourci: %s puis %s", until, b.until)
+	}
+	b.observe(backoffResponse(503, "1200"), nil)
+	if !b.until.After(until) {
+		t.Errorf("délai non prolongé: %s", b.until)
+	}
+}
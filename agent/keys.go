@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mon-rempart/agent/backup"
+)
+
+// Chemin de l'API des rotations de clé
+const keyRotationPath = "/api/agent/key-rotation"
+
+// Mots de passe de dépôt non confirmés par le Dashboard, chiffrés par l'identité
+const (
+	repositoryKeysFile    = "repository-keys.enc"
+	repositoryKeysPurpose = "repository-keys"
+)
+
+// KeyRotationConfig contient les paramètres d'une rotation de clé demandée par le serveur
+type KeyRotationConfig struct {
+	RequestID   string `json:"request_id"`
+	NewPassword string `json:"new_password"`
+}
+
+// RepositoryKeys conserve les mots de passe issus d'une rotation que le
+// Dashboard ne sert pas encore : sans eux, un redémarrage ou une reconstruction
+// du wrapper rouvrirait le dépôt avec une clé supprimée
+type RepositoryKeys struct {
+	RequestID string `json:"request_id,omitempty"`
+	// Nouveau mot de passe du dépôt principal, utilisé tant que
+	// /api/agent/config renvoie l'ancien
+	Password string `json:"password,omitempty"`
+	// Mot de passe du dépôt secondaire sans mot de passe propre dont la
+	// rotation a échoué : l'ancien, jusqu'à une rotation réussie
+	ReplicaPassword string    `json:"replica_password,omitempty"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// Une seule rotation à la fois ; protège aussi le fichier des mots de passe.
+// Pris après replicationMu.
+var keyRotationMu sync.Mutex
+
+// runKeyRotation change le mot de passe du dépôt (et du dépôt secondaire s'il
+// partage le même mot de passe) puis confirme le résultat au Dashboard.
+// Le nouveau mot de passe est conservé localement jusqu'à ce que le Dashboard
+// le serve.
+func runKeyRotation(rotation *KeyRotationConfig) error {
+	if rotation == nil || rotation.NewPassword == "" {
+		slog.Warn("⚠️  Rotation de clé sans nouveau mot de passe - ignorée")
+		return errors.New("rotation sans nouveau mot de passe")
+	}
+
+	// Ordre des verrous : tâche, réplication (le dépôt secondaire change de
+	// clé), puis mots de passe
+	wrapper, end := beginJob()
+	defer end()
+	replicationMu.Lock()
+	defer replicationMu.Unlock()
+	keyRotationMu.Lock()
+	defer keyRotationMu.Unlock()
+	defer trackJob("rotate_key")()
+
+	if wrapper == nil {
+		updateKeyRotationStatus(rotation.RequestID, "failed", "Système de sauvegarde non initialisé", nil)
+		return errors.New("système de sauvegarde non initialisé")
+	}
+	keys, err := loadRepositoryKeys()
+	if err != nil {
+		msg := fmt.Sprintf("Nouveau mot de passe non conservable localement: %v", err)
+		updateKeyRotationStatus(rotation.RequestID, "failed", msg, nil)
+		return errors.New(msg)
+	}
+
+	updateKeyRotationStatus(rotation.RequestID, "running", "Rotation en cours", nil)
+
+	// Mot de passe du dépôt secondaire avant la rotation, s'il suit le principal
+	replicaPassword := ""
+	if replicaWrapper != nil && currentConfig().Replication.Password == "" {
+		replicaPassword = replicaWrapper.Password()
+	}
+
+	result, err := wrapper.RotatePassword(rotation.NewPassword, hostname)
+	if err != nil {
+		updateKeyRotationStatus(rotation.RequestID, "failed", err.Error(), result)
+		sendActivityLog("error", "Échec de la rotation de clé", map[string]interface{}{"error": err.Error()})
+		return err
+	}
+
+	keys.RequestID = rotation.RequestID
+	keys.Password = rotation.NewPassword
+	if err := saveRepositoryKeys(keys); err != nil {
+		slog.Error("❌ Nouveau mot de passe non conservé localement", "error", err)
+	}
+
+	message := "Mot de passe du dépôt changé"
+	if result.OldKeyKept {
+		message += " (ancienne clé conservée: " + result.Error + ")"
+	}
+
+	// Le dépôt secondaire sans mot de passe propre suit le dépôt principal ;
+	// en cas d'échec il garde l'ancien, conservé localement, jusqu'à la
+	// prochaine tentative (avant chaque réplication)
+	if replicaPassword != "" {
+		if _, err := replicaWrapper.RotatePassword(rotation.NewPassword, hostname); err != nil {
+			keys.ReplicaPassword = replicaPassword
+			if saveErr := saveRepositoryKeys(keys); saveErr != nil {
+				slog.Error("❌ Mot de passe du dépôt secondaire non conservé localement", "error", saveErr)
+			}
+			message += fmt.Sprintf(" - dépôt secondaire inchangé (nouvelle tentative avant la prochaine réplication): %v", err)
+			sendActivityLog("error", "Échec de la rotation de clé du dépôt secondaire",
+				map[string]interface{}{"error": err.Error()})
+		}
+	}
+
+	updateKeyRotationStatus(rotation.RequestID, "success", message, result)
+	sendActivityLog("info", "Rotation de clé terminée", map[string]interface{}{
+		"new_key_id":   result.NewKeyID,
+		"old_key_kept": result.OldKeyKept,
+	})
+	return nil
+}
+
+// retryReplicaRotation aligne le mot de passe du dépôt secondaire sur celui
+// du dépôt principal après une rotation en échec (appelé verrou de
+// réplication pris)
+func retryReplicaRotation(primary *backup.ResticWrapper) {
+	if replicaWrapper == nil || currentConfig().Replication.Password != "" {
+		return
+	}
+
+	keyRotationMu.Lock()
+	defer keyRotationMu.Unlock()
+
+	keys, err := loadRepositoryKeys()
+	if err != nil || keys.ReplicaPassword == "" {
+		return
+	}
+	if _, err := replicaWrapper.RotatePassword(primary.Password(), hostname); err != nil {
+		slog.Warn("⚠️  Rotation de clé du dépôt secondaire toujours en échec", "error", err)
+		return
+	}
+
+	keys.ReplicaPassword = ""
+	if err := saveRepositoryKeys(keys); err != nil {
+		slog.Warn("⚠️  Mots de passe locaux non mis à jour", "error", err)
+	}
+	sendActivityLog("info", "Rotation de clé du dépôt secondaire terminée", nil)
+}
+
+// applyRepositoryKeys remplace le mot de passe reçu du Dashboard par celui
+// d'une rotation qu'il ne sert pas encore ; quand il le renvoie, la rotation
+// est confirmée et la copie locale supprimée
+func applyRepositoryKeys(config *RemoteConfig) {
+	keyRotationMu.Lock()
+	defer keyRotationMu.Unlock()
+
+	keys, err := loadRepositoryKeys()
+	if err != nil || keys.Password == "" {
+		return
+	}
+	if config.RepoPassword == keys.Password {
+		slog.Info("🔑 Nouveau mot de passe du dépôt confirmé par le Dashboard", "request", keys.RequestID)
+		keys.RequestID, keys.Password = "", ""
+		if err := saveRepositoryKeys(keys); err != nil {
+			slog.Warn("⚠️  Mots de passe locaux non mis à jour", "error", err)
+		}
+		return
+	}
+	slog.Debug("Mot de passe du dépôt issu d'une rotation non confirmée", "request", keys.RequestID)
+	config.RepoPassword = keys.Password
+}
+
+// storedReplicaPassword retourne le mot de passe conservé du dépôt secondaire
+// (vide : celui du dépôt principal)
+func storedReplicaPassword() string {
+	keyRotationMu.Lock()
+	defer keyRotationMu.Unlock()
+
+	keys, err := loadRepositoryKeys()
+	if err != nil {
+		return ""
+	}
+	return keys.ReplicaPassword
+}
+
+// loadRepositoryKeys déchiffre les mots de passe non confirmés (vides si aucun)
+func loadRepositoryKeys() (*RepositoryKeys, error) {
+	if agentIdentity == nil {
+		return nil, errors.New("identité de l'agent indisponible")
+	}
+
+	keys := &RepositoryKeys{}
+	sealed, err := os.ReadFile(filepath.Join(currentConfig().Dir(), repositoryKeysFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return keys, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err := agentIdentity.Open(repositoryKeysPurpose, sealed)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, keys); err != nil {
+		return nil, fmt.Errorf("mots de passe locaux illisibles: %w", err)
+	}
+	return keys, nil
+}
+
+// saveRepositoryKeys chiffre et enregistre les mots de passe non confirmés ;
+// le fichier est supprimé quand il n'y en a plus
+func saveRepositoryKeys(keys *RepositoryKeys) error {
+	path := filepath.Join(currentConfig().Dir(), repositoryKeysFile)
+	if keys.Password == "" && keys.ReplicaPassword == "" {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	if agentIdentity == nil {
+		return errors.New("identité de l'agent indisponible")
+	}
+
+	keys.UpdatedAt = time.Now()
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+	sealed, err := agentIdentity.Seal(repositoryKeysPurpose, data)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, sealed, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// updateKeyRotationStatus envoie l'état d'une rotation de clé au serveur.
+// Un envoi impossible est conservé dans l'outbox : le Dashboard doit
+// apprendre la réussite pour servir le nouveau mot de passe.
+func updateKeyRotationStatus(requestID, status, message string, result *backup.KeyRotation) {
+	payload := map[string]interface{}{
+		"agent_id":   currentAgentID(),
+		"request_id": requestID,
+		"status":     status,
+		"message":    message,
+	}
+	if result != nil {
+		payload["new_key_id"] = result.NewKeyID
+		payload["old_key_kept"] = result.OldKeyKept
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("❌ Erreur sérialisation statut rotation", "error", err)
+		return
+	}
+
+	req, err := http.NewRequest("POST", currentConfig().APIEndpoint+keyRotationPath, bytes.NewBuffer(jsonData))
+	if err != nil {
+		slog.Error("❌ Erreur création requête statut rotation", "error", err)
+		return
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", fmt.Sprintf("%s/%s", AppName, Version))
+
+	client := newDashboardClient(10 * time.Second)
+	resp, err := client.Do(req)
+	if err != nil {
+		slog.Warn("⚠️  Statut de rotation non envoyé - conservé pour envoi ultérieur", "error", err)
+		enqueueOutbox(keyRotationPath, jsonData)
+		return
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated:
+		slog.Info("📝 Statut de rotation envoyé", "status", status)
+	case resp.StatusCode >= 500:
+		slog.Warn("⚠️  Dashboard en erreur - statut de rotation conservé pour envoi ultérieur", "status", resp.StatusCode)
+		enqueueOutbox(keyRotationPath, jsonData)
+	default:
+		slog.Warn("⚠️  Erreur envoi statut de rotation", "status", resp.StatusCode)
+	}
+}
@@ -0,0 +1,105 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// consoleHandler affiche les logs de manière lisible pour un lancement interactif :
+// [2006-01-02 15:04:05] 💓 Heartbeat OK  cle=valeur
+type consoleHandler struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	level  slog.Leveler
+	attrs  []slog.Attr
+	groups []string
+}
+
+func newConsoleHandler(w io.Writer, level slog.Leveler) *consoleHandler {
+	return &consoleHandler{mu: &sync.Mutex{}, w: w, level: level}
+}
+
+func (h *consoleHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= h.level.Level()
+}
+
+func (h *consoleHandler) Handle(_ context.Context, r slog.Record) error {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "[%s] ", r.Time.Format("2006-01-02 15:04:05"))
+	if r.Level < slog.LevelInfo {
+		buf.WriteString("[debug] ")
+	}
+	buf.WriteString(r.Message)
+
+	// Attributs hérités (déjà rattachés à leurs groupes) puis attributs de l'enregistrement
+	for _, a := range h.attrs {
+		h.appendAttr(&buf, nil, a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		h.appendAttr(&buf, h.groups, a)
+		return true
+	})
+	buf.WriteString("\n")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(buf.Bytes())
+	return err
+}
+
+// appendAttr ajoute " cle=valeur" en aplatissant les groupes
+func (h *consoleHandler) appendAttr(buf *bytes.Buffer, groups []string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		sub := groups
+		if a.Key != "" {
+			sub = append(append([]string{}, groups...), a.Key)
+		}
+		for _, ga := range a.Value.Group() {
+			h.appendAttr(buf, sub, ga)
+		}
+		return
+	}
+
+	key := a.Key
+	if len(groups) > 0 {
+		key = strings.Join(groups, ".") + "." + key
+	}
+
+	value := a.Value.String()
+	if strings.ContainsAny(value, " \t\n\"") {
+		value = fmt.Sprintf("%q", value)
+	}
+	fmt.Fprintf(buf, " %s=%s", key, value)
+}
+
+func (h *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	// Les attributs ajoutés après un groupe en font partie
+	for _, a := range attrs {
+		if len(h.groups) > 0 {
+			a = slog.Attr{Key: strings.Join(h.groups, "."), Value: slog.GroupValue(a)}
+		}
+		h2.attrs = append(append([]slog.Attr{}, h2.attrs...), a)
+	}
+	return &h2
+}
+
+func (h *consoleHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.groups = append(append([]string{}, h.groups...), name)
+	return &h2
+}
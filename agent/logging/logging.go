@@ -0,0 +1,183 @@
+// Package logging - Journalisation structurée de l'agent Mon Rempart
+// Fournit un logger slog avec niveaux, sortie console lisible et fichier rotatif
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Options contient les paramètres de journalisation
+type Options struct {
+	// Niveau minimal (debug, info, warn, error)
+	Level string
+	// Format des handlers non interactifs (text ou json)
+	Format string
+	// Dossier des fichiers de log (vide = pas de fichier)
+	Dir string
+	// Taille maximale d'un fichier avant rotation (Mo)
+	MaxSizeMB int
+	// Durée de conservation des anciens fichiers (jours)
+	MaxAgeDays int
+	// Sortie console (os.Stdout par défaut)
+	Output io.Writer
+}
+
+// level est partagé par tous les handlers, ce qui permet de le modifier à chaud
+var level = new(slog.LevelVar)
+
+// Setup configure le logger par défaut et retourne le fichier de log ouvert
+// (à fermer à l'arrêt de l'agent, nil si aucun fichier n'est utilisé)
+func Setup(opts Options) (io.Closer, error) {
+	// Un niveau invalide ne doit pas priver l'agent de logs : repli sur info
+	levelErr := SetLevel(opts.Level)
+	if levelErr != nil {
+		level.Set(slog.LevelInfo)
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: level}
+
+	output := opts.Output
+	if output == nil {
+		output = os.Stdout
+	}
+
+	// Console : format lisible en interactif, format structuré en service
+	var console slog.Handler
+	if isTerminal(output) {
+		console = newConsoleHandler(output, level)
+	} else {
+		console = newHandler(output, opts.Format, handlerOpts)
+	}
+
+	handlers := []slog.Handler{console}
+
+	var file *RotatingFile
+	if opts.Dir != "" {
+		var err error
+		file, err = OpenRotatingFile(
+			filepath.Join(opts.Dir, "agent.log"),
+			int64(opts.MaxSizeMB)*1024*1024,
+			time.Duration(opts.MaxAgeDays)*24*time.Hour,
+		)
+		if err != nil {
+			// Le fichier est un plus : on continue avec la console seule
+			slog.SetDefault(slog.New(console))
+			return nil, fmt.Errorf("ouverture du fichier de log: %w", err)
+		}
+		handlers = append(handlers, newHandler(file, opts.Format, handlerOpts))
+	}
+
+	slog.SetDefault(slog.New(&multiHandler{handlers: handlers}))
+
+	if file == nil {
+		return nil, levelErr
+	}
+	return file, levelErr
+}
+
+// SetLevel modifie le niveau de journalisation à chaud
+func SetLevel(name string) error {
+	l, err := ParseLevel(name)
+	if err != nil {
+		return err
+	}
+	level.Set(l)
+	return nil
+}
+
+// Level retourne le niveau de journalisation courant
+func Level() slog.Level {
+	return level.Level()
+}
+
+// ParseLevel convertit un nom de niveau en slog.Level
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return slog.LevelInfo, fmt.Errorf("niveau de log inconnu: %q", name)
+	}
+}
+
+// IsInteractive indique si la sortie standard est un terminal
+func IsInteractive() bool {
+	return isTerminal(os.Stdout)
+}
+
+// isTerminal indique si w est un terminal
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// newHandler crée un handler texte ou JSON
+func newHandler(w io.Writer, format string, opts *slog.HandlerOptions) slog.Handler {
+	if strings.EqualFold(format, "json") {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+// multiHandler diffuse chaque enregistrement vers plusieurs handlers
+type multiHandler struct {
+	handlers []slog.Handler
+}
+
+func (m *multiHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	for _, h := range m.handlers {
+		if h.Enabled(ctx, l) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *multiHandler) Handle(ctx context.Context, r slog.Record) error {
+	var firstErr error
+	for _, h := range m.handlers {
+		if !h.Enabled(ctx, r.Level) {
+			continue
+		}
+		if err := h.Handle(ctx, r.Clone()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (m *multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make([]slog.Handler, len(m.handlers))
+	for i, h := range m.handlers {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+	return &multiHandler{handlers: handlers}
+}
+
+func (m *multiHandler) WithGroup(name string) slog.Handler {
+	handlers := make([]slog.Handler, len(m.handlers))
+	for i, h := range m.handlers {
+		handlers[i] = h.WithGroup(name)
+	}
+	return &multiHandler{handlers: handlers}
+}
@@ -0,0 +1,183 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Taille maximale par défaut d'un fichier de log
+	defaultMaxSize = 10 * 1024 * 1024
+
+	// Durée de conservation par défaut des anciens fichiers
+	defaultMaxAge = 30 * 24 * time.Hour
+
+	// Format horodaté des fichiers archivés (agent-2006-01-02T15-04-05.log)
+	archiveTimeFormat = "2006-01-02T15-04-05"
+)
+
+// RotatingFile est un io.Writer qui écrit dans un fichier et le fait tourner
+// lorsqu'il dépasse une taille maximale ou qu'un nouveau jour commence.
+// Les archives plus anciennes que maxAge sont supprimées.
+type RotatingFile struct {
+	mu       sync.Mutex
+	path     string
+	maxSize  int64
+	maxAge   time.Duration
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+// OpenRotatingFile ouvre (ou crée) le fichier de log en mode ajout
+func OpenRotatingFile(path string, maxSize int64, maxAge time.Duration) (*RotatingFile, error) {
+	if maxSize <= 0 {
+		maxSize = defaultMaxSize
+	}
+	if maxAge <= 0 {
+		maxAge = defaultMaxAge
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	r := &RotatingFile{
+		path:    path,
+		maxSize: maxSize,
+		maxAge:  maxAge,
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	r.cleanup()
+	return r, nil
+}
+
+// Write écrit p dans le fichier courant en déclenchant une rotation si nécessaire
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if r.shouldRotate(int64(len(p))) {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Close ferme le fichier courant
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// open ouvre le fichier courant et relève sa taille
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	r.file = f
+	r.size = info.Size()
+	r.openedAt = info.ModTime()
+	if r.size == 0 {
+		r.openedAt = time.Now()
+	}
+	return nil
+}
+
+// shouldRotate indique si l'écriture de n octets impose une rotation
+func (r *RotatingFile) shouldRotate(n int64) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.size+n > r.maxSize {
+		return true
+	}
+	now := time.Now()
+	y1, m1, d1 := r.openedAt.Date()
+	y2, m2, d2 := now.Date()
+	return y1 != y2 || m1 != m2 || d1 != d2
+}
+
+// rotate archive le fichier courant et en ouvre un nouveau
+func (r *RotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	r.file = nil
+
+	archive := r.archiveName(time.Now())
+	if err := os.Rename(r.path, archive); err != nil {
+		return fmt.Errorf("rotation du log: %w", err)
+	}
+
+	if err := r.open(); err != nil {
+		return err
+	}
+	r.cleanup()
+	return nil
+}
+
+// archiveName retourne un nom d'archive unique basé sur l'horodatage
+func (r *RotatingFile) archiveName(t time.Time) string {
+	ext := filepath.Ext(r.path)
+	base := strings.TrimSuffix(r.path, ext)
+	name := fmt.Sprintf("%s-%s%s", base, t.Format(archiveTimeFormat), ext)
+
+	// Plusieurs rotations dans la même seconde
+	for i := 1; ; i++ {
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			return name
+		}
+		name = fmt.Sprintf("%s-%s.%d%s", base, t.Format(archiveTimeFormat), i, ext)
+	}
+}
+
+// cleanup supprime les archives plus anciennes que maxAge
+func (r *RotatingFile) cleanup() {
+	ext := filepath.Ext(r.path)
+	pattern := strings.TrimSuffix(r.path, ext) + "-*" + ext
+
+	archives, err := filepath.Glob(pattern)
+	if err != nil {
+		return
+	}
+	cutoff := time.Now().Add(-r.maxAge)
+	for _, archive := range archives {
+		info, err := os.Stat(archive)
+		if err != nil {
+			continue
+		}
+		if info.ModTime().Before(cutoff) {
+			os.Remove(archive)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFileShouldRotate(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		size     int64
+		write    int64
+		openedAt time.Time
+		want     bool
+	}{
+		{"fichier vide", 0, 200, now, false},
+		{"sous la limite", 50, 50, now, false},
+		{"limite atteinte", 50, 50 + 1, now, true},
+		{"nouveau jour", 10, 10, now.AddDate(0, 0, -1), true},
+		{"fichier vide d'hier", 0, 10, now.AddDate(0, 0, -1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &RotatingFile{maxSize: 100, size: tt.size, openedAt: tt.openedAt}
+			if got := r.shouldRotate(tt.write); got != tt.want {
+				t.Errorf("shouldRotate(%d) = %v, attendu %v", tt.write, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRotatingFileRotatesOnSize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "agent.log")
+	r, err := OpenRotatingFile(path, 16, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for _, line := range []string{"0123456789\n", "abcdefghij\n", "ABCDEFGHIJ\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	archives, _ := filepath.Glob(filepath.Join(dir, "agent-*.log"))
+	if len(archives) != 2 {
+		t.Fatalf("archives = %v, attendu 2", archives)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "ABCDEFGHIJ\n" {
+		t.Errorf("fichier courant = %q", data)
+	}
+}
+
+func TestRotatingFileArchiveNameUnique(t *testing.T) {
+	dir := t.TempDir()
+	r := &RotatingFile{path: filepath.Join(dir, "agent.log")}
+	at := time.Date(2026, 3, 14, 2, 0, 0, 0, time.Local)
+
+	first := r.archiveName(at)
+	if filepath.Base(first) != "agent-2026-03-14T02-00-00.log" {
+		t.Fatalf("archiveName = %q", first)
+	}
+	if err := os.WriteFile(first, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if second := r.archiveName(at); filepath.Base(second) != "agent-2026-03-14T02-00-00.1.log" {
+		t.Errorf("archiveName (même seconde) = %q", second)
+	}
+}
+
+func TestRotatingFileCleanup(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "agent.log")
+	old := filepath.Join(dir, "agent-2020-01-01T00-00-00.log")
+	recent := filepath.Join(dir, "agent-2026-01-01T00-00-00.log")
+	other := filepath.Join(dir, "autre-2020-01-01T00-00-00.log")
+	for _, name := range []string{old, recent, other} {
+		if err := os.WriteFile(name, []byte("x"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	past := time.Now().Add(-48 * time.Hour)
+	for _, name := range []string{old, other} {
+		if err := os.Chtimes(name, past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := OpenRotatingFile(path, 0, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for name, want := range map[string]bool{old: false, recent: true, other: true} {
+		_, err := os.Stat(name)
+		if exists := err == nil; exists != want {
+			t.Errorf("%s présent = %v, attendu %v", strings.TrimPrefix(name, dir), exists, want)
+		}
+	}
+}
@@ -4,23 +4,31 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	neturl "net/url"
 	"os"
 	"os/signal"
+	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/mon-rempart/agent/backup"
 	"github.com/mon-rempart/agent/config"
+	"github.com/mon-rempart/agent/logging"
+	"github.com/mon-rempart/agent/service"
 )
 
-const (
-	// Version de l'agent
-	Version = "0.4"
+// Version de l'agent (surchargée au build via -ldflags "-X main.Version=...")
+var Version = "0.4"
 
+const (
 	// Nom de l'application
 	AppName = "Mon Rempart Agent"
 
@@ -36,15 +44,47 @@ type HeartbeatPayload struct {
 	Hostname  string `json:"hostname"`
 	Status    string `json:"status"`
 	IPAddress string `json:"ip_address,omitempty"`
+	// Fonctions prises en charge (command_ack : commandes acquittées par l'agent)
+	Capabilities []string `json:"capabilities,omitempty"`
+
+	// État de l'agent et des sauvegardes (voir health.go)
+	AgentVersion  string      `json:"agent_version"`
+	OS            string      `json:"os"`
+	Arch          string      `json:"arch"`
+	UptimeSeconds int64       `json:"uptime_seconds"`
+	IPAddresses   []string    `json:"ip_addresses,omitempty"`
+	Disks         []DiskSpace `json:"disks,omitempty"`
+	ResticVersion string      `json:"restic_version,omitempty"`
+	// ETag de la configuration distante et version de la politique appliquées
+	ConfigVersion string      `json:"config_version,omitempty"`
+	PolicyVersion int         `json:"policy_version"`
+	LastBackup    *LastBackup `json:"last_backup,omitempty"`
+	// Dernière sauvegarde complète réussie, conservée entre deux démarrages
+	LastSuccessAt *time.Time `json:"last_success_at,omitempty"`
+	CurrentJob    string     `json:"current_job,omitempty"`
+	OutboxDepth   int        `json:"outbox_depth"`
+	// Fichiers témoins (absent : désactivés)
+	Canary *CanaryStatus `json:"canary,omitempty"`
+	// Sauvegarde planifiée reportée : poste chargé, processeur occupé ou sur batterie
+	BackupDeferred *BackupDeferral `json:"backup_deferred,omitempty"`
 }
 
 // HeartbeatResponse représente la réponse du Dashboard
 type HeartbeatResponse struct {
-	Success       bool           `json:"success"`
-	Command       string         `json:"command"`
-	Message       string         `json:"message,omitempty"`
-	AgentID       string         `json:"agent_id,omitempty"`
-	RestoreConfig *RestoreConfig `json:"restore_config,omitempty"`
+	Success   bool            `json:"success"`
+	Command   string          `json:"command"`
+	CommandID string          `json:"command_id,omitempty"`
+	Message   string          `json:"message,omitempty"`
+	AgentID   string          `json:"agent_id,omitempty"`
+	Params    json.RawMessage `json:"params,omitempty"`
+	ExpiresAt *time.Time      `json:"expires_at,omitempty"`
+	LogLevel  string          `json:"log_level,omitempty"`
+
+	// Commande signée (voir AgentCommand)
+	SignedPayload string `json:"signed_payload,omitempty"`
+	Signature     string `json:"signature,omitempty"`
+	// Clé publique des commandes signées, épinglée au premier heartbeat
+	CommandPublicKey string `json:"command_public_key,omitempty"`
 }
 
 // RestoreConfig contient les paramètres pour une restauration
@@ -61,10 +101,24 @@ type RemoteConfig struct {
 	Endpoint     string `json:"endpoint,omitempty"`
 	Bucket       string `json:"bucket,omitempty"`
 	Region       string `json:"region,omitempty"`
-	AccessKey    string `json:"accessKey,omitempty"`
-	SecretKey    string `json:"secretKey,omitempty"`
-	RepoPassword string `json:"repoPassword,omitempty"`
+	AccessKey    string `json:"accessKey,omitempty" secret:"true"`
+	SecretKey    string `json:"secretKey,omitempty" secret:"true"`
+	RepoPassword string `json:"repoPassword,omitempty" secret:"true"`
 	Message      string `json:"message,omitempty"`
+	// Version de la configuration (ETag du Dashboard)
+	Version string `json:"version,omitempty"`
+
+	// Stockage hors Scaleway : s3 (défaut), local, sftp ou rest.
+	// Repository est l'adresse de base, complétée par le hostname de l'agent.
+	Backend      string `json:"backend,omitempty"`
+	Repository   string `json:"repository,omitempty"`
+	PathStyle    bool   `json:"pathStyle,omitempty"`
+	RestUsername string `json:"restUsername,omitempty"`
+	RestPassword string `json:"restPassword,omitempty" secret:"true"`
+	AppendOnly   bool   `json:"appendOnly,omitempty"`
+
+	// Politique de sauvegarde (chemins, exclusions, planification, rétention...)
+	Policy *config.Policy `json:"policy,omitempty"`
 }
 
 // LogPayload représente les données de log envoyées à l'API (backups)
@@ -78,6 +132,8 @@ type LogPayload struct {
 	DataAdded       int64  `json:"data_added,omitempty"`
 	DurationSeconds int    `json:"duration_seconds,omitempty"`
 	LogType         string `json:"log_type,omitempty"`
+
+	Details map[string]interface{} `json:"details,omitempty"`
 }
 
 // ActivityLogPayload représente les logs d'activité générale
@@ -92,314 +148,836 @@ type ActivityLogPayload struct {
 
 // Agent global state
 var (
-	agentID       string
 	hostname      string
-	cfg           *config.Config
-	remoteConfig  *RemoteConfig
 	resticWrapper *backup.ResticWrapper
 	configReady   = make(chan bool, 1)
+
+	// Configuration distante publiée par la boucle de configuration, lue par
+	// le heartbeat et les commandes : remplacée d'un bloc, jamais modifiée
+	remoteState atomic.Pointer[publishedRemoteConfig]
+
+	// ID attribué par le Dashboard : écrit par le heartbeat, lu par le canal
+	// de commandes et la vérification des signatures
+	agentIDValue atomic.Value
+
+	// Prochain tour prévu de la boucle de heartbeat (UnixNano), surveillé par le watchdog
+	nextHeartbeatTick atomic.Int64
+
+	// Configuration effective (locale + politique), remplacée entre deux
+	// tâches : lue par currentConfig, un instantané par tâche ou par tour de boucle
+	activeConfig atomic.Pointer[config.Config]
 )
 
+// publishedRemoteConfig est la dernière configuration distante chargée
+type publishedRemoteConfig struct {
+	config *RemoteConfig // Secrets effacés
+	// Secrets remplacés par leur empreinte : détection des changements
+	// sans conserver les secrets
+	loaded RemoteConfig
+	etag   string
+}
+
+// currentConfig retourne la configuration effective
+func currentConfig() *config.Config {
+	return activeConfig.Load()
+}
+
+// currentAgentID retourne l'ID de l'agent ("" avant l'enrôlement)
+func currentAgentID() string {
+	id, _ := agentIDValue.Load().(string)
+	return id
+}
+
+// setAgentID publie l'ID de l'agent
+func setAgentID(id string) {
+	agentIDValue.Store(id)
+}
+
+// currentRemoteConfig retourne la configuration distante sans ses secrets
+// (nil avant le premier chargement)
+func currentRemoteConfig() *RemoteConfig {
+	if state := remoteState.Load(); state != nil {
+		return state.config
+	}
+	return nil
+}
+
+// remoteConfigETag retourne l'ETag de la configuration distante chargée
+func remoteConfigETag() string {
+	if state := remoteState.Load(); state != nil {
+		return state.etag
+	}
+	return ""
+}
+
+// loadedRemoteConfig retourne la configuration distante chargée, secrets
+// remplacés par leur empreinte
+func loadedRemoteConfig() RemoteConfig {
+	if state := remoteState.Load(); state != nil {
+		return state.loaded
+	}
+	return RemoteConfig{}
+}
+
 func main() {
-	var err error
+	// Sous-commandes (backup, restore, status, install...) ; sans argument : mode service
+	if len(os.Args) > 1 {
+		os.Exit(runSubcommand(os.Args[1], os.Args[2:]))
+	}
 
-	// Affichage du message de démarrage
-	fmt.Printf("🛡️  Démarrage de l'agent %s v%s\n", AppName, Version)
-	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	runAgent()
+}
+
+// runAgent lance l'agent en mode service jusqu'à SIGINT/SIGTERM
+func runAgent() {
+	var err error
 
 	// Chargement de la configuration locale
-	cfg = config.LoadConfig()
-	fmt.Printf("📁 Configuration locale: %s\n", cfg.ConfigPath)
+	activeConfig.Store(config.LoadConfig())
+	loadAppliedPolicy()
+	cfg := currentConfig()
+
+	// Mise en place de la journalisation (console + fichier rotatif)
+	logFile, err := logging.Setup(logging.Options{
+		Level:      cfg.LogLevel,
+		Format:     cfg.LogFormat,
+		Dir:        cfg.LogDir,
+		MaxSizeMB:  cfg.LogMaxSizeMB,
+		MaxAgeDays: cfg.LogMaxAgeDays,
+	})
+	if err != nil {
+		slog.Warn("⚠️  Journalisation dégradée", "error", err)
+	}
+	if logFile != nil {
+		defer logFile.Close()
+	}
+
+	// Affichage du message de démarrage
+	slog.Info("🛡️  Démarrage de l'agent", "app", AppName, "version", Version)
+	slog.Info("📁 Configuration locale", "path", cfg.ConfigPath, "logs", cfg.LogDir)
 
 	// Récupération du hostname
 	hostname, err = os.Hostname()
 	if err != nil {
 		hostname = "inconnu"
-		fmt.Printf("⚠️  Impossible de récupérer le hostname: %v\n", err)
+		slog.Warn("⚠️  Impossible de récupérer le hostname", "error", err)
 	} else {
-		fmt.Printf("💻 Hostname: %s\n", hostname)
+		slog.Info("💻 Hostname", "hostname", hostname)
 	}
 
-	fmt.Printf("🔗 API Dashboard: %s\n", cfg.APIEndpoint)
-	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	slog.Info("🔗 API Dashboard", "url", cfg.APIEndpoint)
+	setupDashboardTransport()
+
+	// Identité persistante : ID connu même si le Dashboard est injoignable
+	loadIdentity()
+	if agentIdentity != nil {
+		setAgentID(agentIdentity.ID())
+	}
+	loadCommandKey()
+	trackConnectivity()
+
+	// Commandes déjà reçues (ignorées si redistribuées) et file d'exécution
+	loadCommandJournal()
+	go commandWorker()
+
+	// Fichier témoin déclenché avant l'arrêt : les sauvegardes planifiées restent suspendues
+	loadCanaryTrigger()
+	// Dernière sauvegarde avant l'arrêt, pour le heartbeat
+	restoreLastBackup()
 
 	// Premier heartbeat pour récupérer l'agent_id
-	agentID = sendHeartbeat()
+	sendHeartbeat()
 
 	// Récupération de la configuration distante
 	go configLoop()
 
+	// Canal de commandes temps réel (les heartbeats restent le signal de vie)
+	go commandLoop()
+
 	// Canal pour gérer l'arrêt propre
 	stopChan := make(chan os.Signal, 1)
 	signal.Notify(stopChan, syscall.SIGINT, syscall.SIGTERM)
 
 	// Lancement de la boucle de heartbeat
+	nextHeartbeatTick.Store(time.Now().Add(HeartbeatInterval).UnixNano())
 	go heartbeatLoop()
 
 	// Attente de la configuration puis lancement de la sauvegarde
 	go func() {
 		<-configReady
-		runInitialBackup()
+		go replicationLoop()
+		go scheduleLoop()
+		go canaryLoop()
+		go continuousLoop()
 	}()
 
-	fmt.Println("\n🟢 Agent prêt. Ctrl+C pour arrêter.")
+	slog.Info("🟢 Agent prêt. Ctrl+C pour arrêter.")
+	service.Ready()
+	service.SetStatus("Agent prêt")
+
+	// Watchdog systemd : ping à mi-délai tant que la boucle de heartbeat tourne
+	var watchdogC <-chan time.Time
+	if interval := service.WatchdogInterval(); interval > 0 {
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		watchdogC = ticker.C
+		slog.Debug("🐕 Watchdog systemd actif", "interval", interval)
+	}
 
 	// Attente du signal d'arrêt
-	<-stopChan
-	fmt.Println("\n\n🛑 Arrêt de l'agent demandé...")
-	fmt.Println("👋 Agent Mon Rempart arrêté proprement.")
+	for running := true; running; {
+		select {
+		case <-stopChan:
+			running = false
+		case <-watchdogC:
+			if agentHealthy() {
+				service.WatchdogPing()
+			} else {
+				slog.Error("❌ Boucle de heartbeat bloquée - watchdog non notifié")
+			}
+		}
+	}
+
+	service.Stopping()
+	slog.Info("🛑 Arrêt de l'agent demandé...")
+	slog.Info("👋 Agent Mon Rempart arrêté proprement.")
 }
 
-// configLoop vérifie périodiquement la configuration distante
+// configLoop vérifie périodiquement la configuration distante et applique
+// ses changements entre deux tâches. Dashboard injoignable : la dernière
+// configuration valide (cache chiffré) permet de sauvegarder hors ligne.
 func configLoop() {
 	// Première tentative immédiate
-	if fetchRemoteConfig() {
-		initBackupSystem()
+	if config, ok := loadConfig(); ok {
+		applyPolicy(config.Policy)
+		initBackupSystem(config)
+		config.clearSecrets()
 		configReady <- true
 	}
 
-	ticker := time.NewTicker(ConfigCheckInterval)
-	defer ticker.Stop()
+	// Créneau propre à l'agent, repoussé si le Dashboard demande de ralentir
+	offset := agentJitter("config", ConfigCheckInterval)
+	for {
+		time.Sleep(time.Until(configBackoff.next(time.Now(), ConfigCheckInterval, offset)))
 
-	for range ticker.C {
-		if remoteConfig == nil || !remoteConfig.Configured {
-			if fetchRemoteConfig() {
-				initBackupSystem()
+		if remote := currentRemoteConfig(); remote == nil || !remote.Configured {
+			if config, ok := loadConfig(); ok {
+				applyPolicy(config.Policy)
+				initBackupSystem(config)
+				config.clearSecrets()
 				select {
 				case configReady <- true:
 				default:
 				}
 			}
+			continue
+		}
+
+		previous := loadedRemoteConfig()
+		config, err := loadRemoteConfig()
+		if err != nil {
+			continue
 		}
+		if changes := diffRemoteConfig(previous, loadedRemoteConfig()); len(changes) > 0 {
+			applyPolicy(config.Policy)
+			applyConfigChanges(config, changes)
+		}
+		config.clearSecrets()
+		// Retour du Dashboard après un fonctionnement hors ligne
+		reconcileOnline()
 	}
 }
 
-// fetchRemoteConfig récupère la configuration depuis l'API
-func fetchRemoteConfig() bool {
-	timestamp := time.Now().Format("15:04:05")
+// loadConfig charge la configuration distante ou, Dashboard injoignable, la
+// dernière configuration valide en cache. La configuration retournée porte
+// les secrets : l'appelant les efface dès le wrapper Restic créé.
+func loadConfig() (*RemoteConfig, bool) {
+	config, err := loadRemoteConfig()
+	if err == nil {
+		return config, config != nil
+	}
+	if errors.Is(err, errDashboardUnreachable) {
+		config = useCachedConfig()
+		return config, config != nil
+	}
+	return nil, false
+}
 
-	url := cfg.APIEndpoint + "/api/agent/config"
+// loadRemoteConfig récupère la configuration depuis l'API et la met en cache.
+// Elle est retournée avec ses secrets (nil si inchangée, 304) ; seule une
+// copie sans secrets est publiée.
+// errDashboardUnreachable signale un Dashboard injoignable (réseau, erreur serveur).
+func loadRemoteConfig() (*RemoteConfig, error) {
+	cfg := currentConfig()
+	// Le hostname permet au serveur de fournir le mot de passe propre à l'agent (après rotation)
+	url := cfg.APIEndpoint + "/api/agent/config?hostname=" + neturl.QueryEscape(hostname)
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		fmt.Printf("[%s] ❌ Erreur création requête config: %v\n", timestamp, err)
-		return false
+		slog.Error("❌ Erreur création requête config", "error", err)
+		return nil, err
 	}
 
 	req.Header.Set("User-Agent", fmt.Sprintf("%s/%s", AppName, Version))
+	// Configuration déjà chargée : réponse 304 si elle n'a pas changé
+	if state := remoteState.Load(); state != nil && state.etag != "" && state.config.Configured {
+		req.Header.Set("If-None-Match", state.etag)
+	}
 
-	client := &http.Client{Timeout: 10 * time.Second}
+	client := newDashboardClient(10 * time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
-		fmt.Printf("[%s] ⚠️  Dashboard injoignable pour config: %v\n", timestamp, err)
-		return false
+		slog.Warn("⚠️  Dashboard injoignable pour config", "error", err)
+		return nil, fmt.Errorf("%w: %v", errDashboardUnreachable, err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
+	configBackoff.observe(resp, body)
+	if resp.StatusCode == http.StatusNotModified {
+		slog.Debug("Configuration distante inchangée", "etag", remoteConfigETag())
+		return nil, nil
+	}
+	// 429 : Dashboard surchargé, traité comme injoignable (configuration en cache)
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		slog.Warn("⚠️  Dashboard en erreur pour config", "status", resp.StatusCode)
+		return nil, fmt.Errorf("%w: statut %d", errDashboardUnreachable, resp.StatusCode)
+	}
 	if err != nil {
-		fmt.Printf("[%s] ❌ Erreur lecture config: %v\n", timestamp, err)
-		return false
+		slog.Error("❌ Erreur lecture config", "error", err)
+		return nil, fmt.Errorf("%w: %v", errDashboardUnreachable, err)
 	}
 
 	var config RemoteConfig
 	if err := json.Unmarshal(body, &config); err != nil {
-		fmt.Printf("[%s] ❌ Erreur parsing config: %v\n", timestamp, err)
-		return false
+		slog.Error("❌ Erreur parsing config", "error", err)
+		return nil, err
 	}
 
 	if !config.Success {
-		fmt.Printf("[%s] ⚠️  Erreur API: %s\n", timestamp, config.Message)
-		return false
+		slog.Warn("⚠️  Erreur API", "message", config.Message)
+		return nil, fmt.Errorf("erreur API: %s", config.Message)
 	}
 
 	if !config.Configured {
-		fmt.Printf("[%s] ⏳ En attente de configuration... (%s)\n", timestamp, config.Message)
-		fmt.Printf("[%s]    Configurez les paramètres S3 dans le Dashboard: %s/settings\n", timestamp, cfg.APIEndpoint)
-		return false
+		slog.Info("⏳ En attente de configuration...", "message", config.Message)
+		slog.Info("   Configurez les paramètres S3 dans le Dashboard", "url", cfg.APIEndpoint+"/settings")
+		return nil, fmt.Errorf("configuration en attente")
+	}
+
+	// Mot de passe d'une rotation que le Dashboard ne sert pas encore
+	applyRepositoryKeys(&config)
+
+	// Sans changement (serveur sans ETag), pas de nouveau message
+	unchanged := len(diffRemoteConfig(loadedRemoteConfig(), sanitizedConfig(&config))) == 0
+	setRemoteConfig(config, resp.Header.Get("ETag"))
+	saveConfigCache(&config)
+	if unchanged {
+		return &config, nil
 	}
 
-	remoteConfig = &config
-	fmt.Printf("[%s] ✅ Configuration récupérée depuis le Dashboard\n", timestamp)
-	fmt.Printf("   📦 Bucket: %s\n", config.Bucket)
-	fmt.Printf("   🌍 Endpoint: %s\n", config.Endpoint)
-	return true
+	if config.Backend == "" || config.Backend == backup.BackendS3 {
+		slog.Info("✅ Configuration récupérée depuis le Dashboard",
+			"bucket", config.Bucket,
+			"endpoint", config.Endpoint,
+			"version", config.Version,
+		)
+	} else {
+		slog.Info("✅ Configuration récupérée depuis le Dashboard", "backend", config.Backend, "version", config.Version)
+	}
+	return &config, nil
+}
+
+// setRemoteConfig publie la configuration reçue sans ses secrets : ils ne
+// restent en mémoire que dans le wrapper Restic
+func setRemoteConfig(config RemoteConfig, etag string) {
+	state := &publishedRemoteConfig{loaded: sanitizedConfig(&config), etag: etag}
+	config.clearSecrets()
+	state.config = &config
+	remoteState.Store(state)
 }
 
 // initBackupSystem initialise le wrapper Restic avec la config distante
-func initBackupSystem() {
-	if remoteConfig == nil || !remoteConfig.Configured {
-		fmt.Println("⚠️  Configuration non disponible - sauvegarde désactivée")
+// chargée (secrets compris)
+func initBackupSystem(remote *RemoteConfig) {
+	if remote == nil || !remote.Configured {
+		slog.Warn("⚠️  Configuration non disponible - sauvegarde désactivée")
 		return
 	}
 
-	fmt.Println("\n📦 Initialisation du système de sauvegarde...")
-
-	// Configuration Restic depuis la config distante
-	resticConfig := backup.ResticConfig{
-		S3Endpoint:      remoteConfig.Endpoint,
-		S3Bucket:        remoteConfig.Bucket,
-		S3Path:          hostname,
-		AccessKeyID:     remoteConfig.AccessKey,
-		SecretAccessKey: remoteConfig.SecretKey,
-		ResticPassword:  remoteConfig.RepoPassword,
-	}
+	slog.Info("📦 Initialisation du système de sauvegarde...")
 
 	// Création du wrapper
-	wrapper, err := backup.NewResticWrapper(resticConfig)
+	wrapper, err := newResticWrapper(remote)
 	if err != nil {
-		fmt.Printf("⚠️  Restic non disponible: %v\n", err)
-		fmt.Println("   Installez Restic: https://restic.net/")
+		slog.Warn("⚠️  Restic non disponible - installez Restic: https://restic.net/", "error", err)
 		return
 	}
 
 	// Initialisation du dépôt
 	if err := wrapper.InitRepo(); err != nil {
-		fmt.Printf("❌ Échec initialisation dépôt: %v\n", err)
+		slog.Error("❌ Échec initialisation dépôt", "error", err)
 		sendLog("failed", fmt.Sprintf("Échec init repo: %v", err), 0, 0, 0, 0)
 		return
 	}
 
-	resticWrapper = wrapper
-	fmt.Println("✅ Système de sauvegarde prêt")
+	// Remplacement entre deux tâches : une sauvegarde en cours garde son wrapper
+	swapWrappers(func() {
+		resticWrapper = wrapper
+		replicaWrapper = nil
+		slog.Info("✅ Système de sauvegarde prêt")
+
+		// Dépôt secondaire : son indisponibilité ne bloque pas les sauvegardes
+		if err := initReplication(wrapper); err != nil {
+			slog.Error("❌ Réplication indisponible", "error", err)
+			sendActivityLog("error", "Dépôt secondaire indisponible", map[string]interface{}{"error": err.Error()})
+		}
+	})
+}
+
+// newResticWrapper crée le wrapper Restic : dépôt local de config.json s'il est
+// défini, sinon stockage défini dans le Dashboard (config distante chargée)
+func newResticWrapper(remote *RemoteConfig) (*backup.ResticWrapper, error) {
+	cfg := currentConfig()
+	resticConfig := backup.ResticConfig{
+		ResticPassword:   remote.RepoPassword,
+		LimitUploadKiB:   cfg.Bandwidth.UploadKiB,
+		LimitDownloadKiB: cfg.Bandwidth.DownloadKiB,
+		Priority:         resticPriority(),
+	}
+
+	switch {
+	case cfg.Storage.Repository != "":
+		backend, err := repositoryBackend(cfg.Storage)
+		if err != nil {
+			return nil, err
+		}
+		resticConfig.Backend = backend
+		if cfg.Storage.Password != "" {
+			resticConfig.ResticPassword = cfg.Storage.Password
+		}
+
+	case remote.Backend != "" && remote.Backend != backup.BackendS3:
+		// Un dépôt par agent sous l'adresse de base fournie par le Dashboard
+		base := strings.TrimSuffix(remote.Repository, "/")
+		backend, err := repositoryBackend(config.RepositoryConfig{
+			Repository:   base + "/" + hostname,
+			RESTUsername: remote.RestUsername,
+			RESTPassword: remote.RestPassword,
+			AppendOnly:   remote.AppendOnly,
+		})
+		if err != nil {
+			return nil, err
+		}
+		resticConfig.Backend = backend
+
+	default:
+		resticConfig.Backend = &backup.S3Backend{
+			Endpoint:        remote.Endpoint,
+			Bucket:          remote.Bucket,
+			Path:            hostname,
+			Region:          remote.Region,
+			PathStyle:       remote.PathStyle,
+			AccessKeyID:     remote.AccessKey,
+			SecretAccessKey: remote.SecretKey,
+		}
+	}
+
+	wrapper, err := backup.NewResticWrapper(resticConfig)
+	if err != nil {
+		return nil, err
+	}
+	// Les secrets ne restent que dans le wrapper, pas dans la config globale
+	remote.clearSecrets()
+	return wrapper, nil
 }
 
-// runInitialBackup lance la première sauvegarde
-func runInitialBackup() {
-	if resticWrapper == nil {
-		fmt.Println("⚠️  Wrapper Restic non initialisé - sauvegarde ignorée")
+// clearSecrets retire les secrets de la configuration reçue une fois le
+// wrapper Restic créé
+func (c *RemoteConfig) clearSecrets() {
+	if c == nil {
 		return
 	}
+	c.AccessKey = ""
+	c.SecretKey = ""
+	c.RepoPassword = ""
+	c.RestPassword = ""
+}
 
-	// Petit délai
-	time.Sleep(2 * time.Second)
+// repositoryBackend construit le backend d'un dépôt décrit dans la configuration
+func repositoryBackend(rc config.RepositoryConfig) (backup.Backend, error) {
+	backend, err := backup.ParseRepository(rc.Repository)
+	if err != nil {
+		return nil, err
+	}
 
-	fmt.Println("\n🔄 Lancement de la sauvegarde initiale...")
+	switch b := backend.(type) {
+	case *backup.S3Backend:
+		b.AccessKeyID = rc.AccessKey
+		b.SecretAccessKey = rc.SecretKey
+		b.Region = rc.Region
+		b.PathStyle = rc.PathStyle
+	case *backup.RESTBackend:
+		if rc.RESTUsername != "" {
+			b.Username = rc.RESTUsername
+			b.Password = rc.RESTPassword
+		}
+		b.AppendOnly = rc.AppendOnly
+	case *backup.SFTPBackend:
+		b.KeyFile = rc.SSHKeyFile
+	}
+	return backend, nil
+}
 
-	// Création d'un dossier de test
-	testDir := "./test_data"
-	if _, err := os.Stat(testDir); os.IsNotExist(err) {
-		os.MkdirAll(testDir, 0755)
-		testFile := testDir + "/test.txt"
-		os.WriteFile(testFile, []byte("Mon Rempart - Fichier de test\n"+time.Now().String()), 0644)
-		fmt.Printf("   📝 Dossier de test créé: %s\n", testDir)
+// errBackupRunning : une sauvegarde des fichiers est déjà en cours
+var errBackupRunning = errors.New("sauvegarde déjà en cours")
+
+// runBackupJob sauvegarde les fichiers puis les bases, applique la rétention
+// et réplique ; trigger indique l'origine (initiale, planifiée)
+func runBackupJob(trigger string) (*backup.BackupResult, error) {
+	return runPathsBackup(trigger, backupPaths(), nil, true)
+}
+
+// runPathsBackup sauvegarde des chemins avec des tags supplémentaires ; full
+// ajoute les bases, la rétention et la réplication (sauvegarde complète)
+func runPathsBackup(trigger string, paths, tags []string, full bool) (*backup.BackupResult, error) {
+	if !backupRunning.CompareAndSwap(false, true) {
+		slog.Warn("⏭️  Sauvegarde déjà en cours - sauvegarde ignorée", "trigger", trigger)
+		return nil, errBackupRunning
+	}
+	defer backupRunning.Store(false)
+
+	wrapper, end := beginJob()
+	defer end()
+	defer trackJob("backup")()
+
+	if wrapper == nil {
+		slog.Warn("⚠️  Wrapper Restic non initialisé - sauvegarde ignorée")
+		return nil, errors.New("système de sauvegarde non initialisé")
+	}
+
+	slog.Info("🔄 Lancement de la sauvegarde...", "trigger", trigger)
+	if full {
+		recordBackupAttempt(time.Now())
 	}
 
-	// Exécution de la sauvegarde
-	result, err := resticWrapper.RunBackup(testDir)
+	// Analyse anti-rançongiciel puis exécution de la sauvegarde
+	opts := backupOptions()
+	opts.Tags = append(opts.Tags, tags...)
+	if !full {
+		// Hooks (arrêt d'un logiciel, dump...) réservés aux sauvegardes complètes
+		opts.Hooks = nil
+	}
+	report := checkRansomware(&opts, paths)
+	result, err := wrapper.RunBackupWithOptions(opts, paths...)
+	recordLastBackup(trigger, result, err, full)
+	historySafe := handleSuspectBackup(wrapper, report, result)
 	if err != nil {
-		fmt.Printf("❌ Échec sauvegarde: %v\n", err)
-		sendLog("failed", err.Error(), 0, 0, 0, 0)
-		return
+		slog.Error("❌ Échec sauvegarde", "error", err)
+		sendLogWithDetails("failed", err.Error(), 0, 0, 0, 0, hookDetails(result))
+		// Les bases restent sauvegardées, sauf si un hook pré-sauvegarde a
+		// annulé la tâche ; la réplication attend une sauvegarde réussie
+		if full && (result == nil || !result.Aborted) {
+			runDatabaseBackups(wrapper)
+		}
+		return result, err
 	}
 
 	if result.Success {
-		fmt.Println("✅ Sauvegarde initiale réussie!")
-		sendLog("success",
+		slog.Info("✅ Sauvegarde réussie!", "trigger", trigger)
+		connectivity.recordBackup()
+		sendLogWithDetails("success",
 			fmt.Sprintf("Snapshot %s créé", result.SnapshotID),
 			result.BytesProcessed,
 			result.FilesNew,
 			result.FilesChanged,
 			int(result.Duration),
+			hookDetails(result),
 		)
 
 		// Affichage des snapshots
-		snapshots, err := resticWrapper.GetSnapshots()
+		snapshots, err := wrapper.GetSnapshots()
 		if err == nil {
-			fmt.Printf("\n📋 Snapshots dans le dépôt: %d\n", len(snapshots))
+			slog.Info("📋 Snapshots dans le dépôt", "count", len(snapshots))
 			for _, s := range snapshots {
-				fmt.Printf("   • %s - %s\n", s.ShortID, s.Time.Format("02/01/2006 15:04"))
+				slog.Debug("   • Snapshot", "id", s.ShortID, "time", s.Time.Format("02/01/2006 15:04"))
+			}
+		}
+
+		// Attaque probable sans historique protégé : rien n'est supprimé ni copié
+		if full {
+			runDatabaseBackups(wrapper)
+			if historySafe {
+				applyRetention(wrapper)
+				replicateAfterBackup(wrapper)
 			}
 		}
 
 		// Synchroniser les snapshots avec le serveur
 		go syncSnapshots()
 	}
+	return result, nil
 }
 
-// heartbeatLoop envoie des signaux de vie
-func heartbeatLoop() {
-	ticker := time.NewTicker(HeartbeatInterval)
-	defer ticker.Stop()
+// databaseSources convertit les bases de données configurées en sources de sauvegarde
+func databaseSources() []backup.DatabaseSource {
+	cfg := currentConfig()
+	sources := make([]backup.DatabaseSource, 0, len(cfg.Databases))
+	for _, db := range cfg.Databases {
+		sources = append(sources, backup.DatabaseSource{
+			Name:     db.Name,
+			Type:     db.Type,
+			Host:     db.Host,
+			Port:     db.Port,
+			User:     db.User,
+			Password: db.Password,
+			Database: db.Database,
+			Path:     db.Path,
+			Command:  db.Command,
+			Args:     db.Args,
+			Tags:     db.Tags,
+		})
+	}
+	return sources
+}
 
-	for range ticker.C {
+// runDatabaseBackups sauvegarde chaque base configurée dans son propre snapshot.
+// Retourne les résultats et le nombre de sauvegardes en échec.
+func runDatabaseBackups(wrapper *backup.ResticWrapper) ([]*backup.BackupResult, int) {
+	var results []*backup.BackupResult
+	failed := 0
+	for _, source := range databaseSources() {
+		result, err := wrapper.BackupDatabase(context.Background(), source)
+		results = append(results, result)
+		details := map[string]interface{}{
+			"database": source.Name,
+			"type":     source.Type,
+			"tags":     source.SnapshotTags(),
+		}
+
+		if err != nil {
+			failed++
+			slog.Error("❌ Échec sauvegarde de base", "name", source.Name, "error", err)
+			sendLogWithDetails("failed", fmt.Sprintf("Base %s: %v", source.Name, err), 0, 0, 0, 0, details)
+			continue
+		}
+
+		sendLogWithDetails("success",
+			fmt.Sprintf("Base %s sauvegardée (snapshot %s)", source.Name, result.SnapshotID),
+			result.BytesProcessed,
+			result.FilesNew,
+			result.FilesChanged,
+			int(result.Duration),
+			details,
+		)
+	}
+	return results, failed
+}
+
+// backupOptions retourne les options de sauvegarde issues de la configuration
+// effective (config.json et politique du Dashboard)
+func backupOptions() backup.BackupOptions {
+	cfg := currentConfig()
+	opts := backup.BackupOptions{Excludes: cfg.ExcludePaths}
+	h := cfg.Hooks
+	if len(h.PreBackup) == 0 && len(h.PostBackup) == 0 && len(h.OnFailure) == 0 {
+		return opts
+	}
+
+	opts.Hooks = &backup.HookSet{
+		PreBackup:         h.PreBackup,
+		PostBackup:        h.PostBackup,
+		OnFailure:         h.OnFailure,
+		Timeout:           time.Duration(h.TimeoutSeconds) * time.Second,
+		AbortOnPreFailure: h.OnPreHookFailure != "warn",
+	}
+	return opts
+}
+
+// hookDetails retourne la sortie des hooks à joindre au log de sauvegarde
+func hookDetails(result *backup.BackupResult) map[string]interface{} {
+	if result == nil || len(result.Hooks) == 0 {
+		return nil
+	}
+	return map[string]interface{}{"hooks": result.Hooks}
+}
+
+// backupPaths retourne les répertoires configurés, sinon un dossier de test
+func backupPaths() []string {
+	cfg := currentConfig()
+	if len(cfg.BackupPaths) > 0 {
+		return cfg.BackupPaths
+	}
+
+	testDir := "./test_data"
+	if _, err := os.Stat(testDir); os.IsNotExist(err) {
+		os.MkdirAll(testDir, 0755)
+		testFile := testDir + "/test.txt"
+		os.WriteFile(testFile, []byte("Mon Rempart - Fichier de test\n"+time.Now().String()), 0644)
+		slog.Info("📝 Dossier de test créé", "path", testDir)
+	}
+	return []string{testDir}
+}
+
+// runPreview simule une sauvegarde et envoie l'aperçu (volume, coût) au Dashboard
+func runPreview() (*backup.BackupPreview, error) {
+	wrapper, end := beginJob()
+	defer end()
+	defer trackJob("preview")()
+
+	if wrapper == nil {
+		slog.Warn("⚠️  Wrapper Restic non initialisé - aperçu ignoré")
+		return nil, errors.New("système de sauvegarde non initialisé")
+	}
+
+	slog.Info("🔍 Aperçu de sauvegarde demandé...")
+
+	result, err := wrapper.RunBackupWithOptions(backup.BackupOptions{DryRun: true}, backupPaths()...)
+	if err != nil || result.Preview == nil {
+		slog.Error("❌ Échec aperçu de sauvegarde", "error", err)
+		sendActivityLog("error", fmt.Sprintf("Aperçu de sauvegarde échoué: %v", err), nil)
+		if err == nil {
+			err = errors.New("aperçu indisponible")
+		}
+		return nil, err
+	}
+
+	preview := result.Preview
+	preview.EstimateCost(currentConfig().StoragePricePerGB)
+
+	sendActivityLog("info",
+		fmt.Sprintf("Aperçu de sauvegarde: %d fichiers, %s à envoyer, ~%.2f €/mois",
+			preview.FilesTotal, backup.FormatBytes(preview.BytesToUpload), preview.EstimatedMonthlyCost),
+		map[string]interface{}{
+			"preview": preview,
+		},
+	)
+	return preview, nil
+}
+
+// heartbeatLoop envoie des signaux de vie à chaque intervalle,
+// dans le créneau propre à l'agent, repoussé si le Dashboard demande de ralentir
+func heartbeatLoop() {
+	offset := agentJitter("heartbeat", HeartbeatInterval)
+	for {
+		next := heartbeatBackoff.next(time.Now(), HeartbeatInterval, offset)
+		nextHeartbeatTick.Store(next.UnixNano())
+		time.Sleep(time.Until(next))
 		sendHeartbeat()
 	}
 }
 
-// sendHeartbeat envoie un signal de vie au Dashboard
-func sendHeartbeat() string {
-	timestamp := time.Now().Format("15:04:05")
+// agentHealthy indique si la boucle de heartbeat a tourné à l'heure prévue.
+// Si elle est bloquée, le watchdog n'est plus notifié et systemd redémarre l'agent.
+func agentHealthy() bool {
+	next := time.Unix(0, nextHeartbeatTick.Load())
+	return time.Since(next) < 2*HeartbeatInterval
+}
 
+// sendHeartbeat envoie un signal de vie au Dashboard
+func sendHeartbeat() {
 	payload := HeartbeatPayload{
-		Hostname: hostname,
-		Status:   "online",
+		Hostname:     hostname,
+		Status:       "online",
+		Capabilities: []string{"command_ack"},
+	}
+	if connectivity.Offline() {
+		// Premier contact après un fonctionnement sur la configuration en cache
+		payload.Status = "degraded"
 	}
+	fillHealth(&payload)
 
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
-		fmt.Printf("[%s] ❌ Erreur sérialisation: %v\n", timestamp, err)
-		return agentID
+		slog.Error("❌ Erreur sérialisation", "error", err)
+		return
 	}
 
-	url := cfg.APIEndpoint + "/api/agent/heartbeat"
+	url := currentConfig().APIEndpoint + "/api/agent/heartbeat"
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
-		fmt.Printf("[%s] ❌ Erreur création requête: %v\n", timestamp, err)
-		return agentID
+		slog.Error("❌ Erreur création requête", "error", err)
+		return
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", fmt.Sprintf("%s/%s", AppName, Version))
 
-	client := &http.Client{Timeout: 10 * time.Second}
+	client := newDashboardClient(10 * time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
-		fmt.Printf("[%s] ⚠️  Dashboard injoignable: %v\n", timestamp, err)
-		return agentID
+		slog.Warn("⚠️  Dashboard injoignable", "error", err)
+		return
 	}
 	defer resp.Body.Close()
 
 	body, _ := io.ReadAll(resp.Body)
+	heartbeatBackoff.observe(resp, body)
 	var response HeartbeatResponse
 	if err := json.Unmarshal(body, &response); err != nil {
-		fmt.Printf("[%s] ❌ Erreur parsing réponse: %v\n", timestamp, err)
-		return agentID
+		slog.Error("❌ Erreur parsing réponse", "error", err)
+		return
 	}
 
 	if response.Success {
-		fmt.Printf("[%s] 💓 Heartbeat OK\n", timestamp)
+		slog.Info("💓 Heartbeat OK")
+
+		// Premier enrôlement : aucun ID enregistré, attribué par cette réponse
+		enrolling := response.AgentID != "" && agentIdentity != nil && agentIdentity.ID() == ""
+		pinAnnouncedCommandKey(response.CommandPublicKey, enrolling)
 
 		if response.AgentID != "" {
-			agentID = response.AgentID
+			setAgentID(response.AgentID)
+			if agentIdentity != nil {
+				if err := agentIdentity.SetAgentID(response.AgentID); err != nil {
+					slog.Warn("⚠️  ID de l'agent non enregistré", "error", err)
+				}
+			}
+		}
+
+		// Hors ligne, les logs en attente sont rejoués après la mise à jour de la configuration
+		if !connectivity.Offline() {
+			go flushOutbox()
 		}
 
-		switch response.Command {
-		case "backup_now":
-			fmt.Printf("[%s] 📦 Commande de sauvegarde reçue!\n", timestamp)
-			go runInitialBackup()
-		case "restore":
-			if response.RestoreConfig != nil {
-				fmt.Printf("[%s] 🔄 Commande de restauration reçue!\n", timestamp)
-				go runRestore(response.RestoreConfig)
+		// Commande portée par le heartbeat : sans ID (ancien Dashboard), exécutée
+		// directement. Une commande signée passe par le journal des commandes
+		// reçues et l'expiration : sans ID, elle est refusée.
+		if response.Command != "" && response.Command != "idle" {
+			cmd := AgentCommand{
+				ID:            response.CommandID,
+				Command:       response.Command,
+				Params:        response.Params,
+				ExpiresAt:     response.ExpiresAt,
+				SignedPayload: response.SignedPayload,
+				Signature:     response.Signature,
+				LogLevel:      response.LogLevel,
+			}
+			switch {
+			case cmd.ID != "":
+				receiveCommands([]AgentCommand{cmd})
+			case cmd.SignedPayload != "" || cmd.Signature != "":
+				rejectCommand(cmd, errCommandNoID)
+			default:
+				// Commande sensible non signée refusée
+				if verified, err := verifyCommand(cmd); err != nil {
+					rejectCommand(cmd, err)
+				} else {
+					enqueueCommand(verified)
+				}
 			}
-		case "sync_snapshots":
-			fmt.Printf("[%s] 📸 Synchronisation des snapshots demandée\n", timestamp)
-			go syncSnapshots()
-		case "shutdown":
-			fmt.Printf("[%s] 🛑 Arrêt demandé par le serveur\n", timestamp)
-			os.Exit(0)
 		}
 	}
-
-	return agentID
 }
 
 // sendLog envoie un log de sauvegarde à l'API
 func sendLog(status, message string, bytesProcessed int64, filesNew, filesChanged, duration int) {
-	timestamp := time.Now().Format("15:04:05")
+	sendLogWithDetails(status, message, bytesProcessed, filesNew, filesChanged, duration, nil)
+}
 
+// sendLogWithDetails envoie un log de sauvegarde accompagné de détails (sortie des hooks...)
+func sendLogWithDetails(status, message string, bytesProcessed int64, filesNew, filesChanged, duration int, details map[string]interface{}) {
 	payload := LogPayload{
-		AgentID:         agentID,
+		AgentID:         currentAgentID(),
 		Hostname:        hostname,
 		Status:          status,
 		Message:         message,
@@ -408,45 +986,48 @@ func sendLog(status, message string, bytesProcessed int64, filesNew, filesChange
 		DataAdded:       bytesProcessed,
 		DurationSeconds: duration,
 		LogType:         "backup",
+		Details:         details,
 	}
 
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
-		fmt.Printf("[%s] ❌ Erreur sérialisation log: %v\n", timestamp, err)
+		slog.Error("❌ Erreur sérialisation log", "error", err)
 		return
 	}
 
-	url := cfg.APIEndpoint + "/api/agent/log"
+	url := currentConfig().APIEndpoint + "/api/agent/log"
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
-		fmt.Printf("[%s] ❌ Erreur création requête log: %v\n", timestamp, err)
+		slog.Error("❌ Erreur création requête log", "error", err)
 		return
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", fmt.Sprintf("%s/%s", AppName, Version))
 
-	client := &http.Client{Timeout: 10 * time.Second}
+	client := newDashboardClient(10 * time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
-		fmt.Printf("[%s] ⚠️  Impossible d'envoyer le log: %v\n", timestamp, err)
+		slog.Warn("⚠️  Impossible d'envoyer le log - conservé pour envoi ultérieur", "error", err)
+		enqueueOutbox("/api/agent/log", jsonData)
 		return
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated {
-		fmt.Printf("[%s] 📝 Log backup envoyé: %s\n", timestamp, status)
+		slog.Info("📝 Log backup envoyé", "status", status)
+	} else if resp.StatusCode >= 500 {
+		slog.Warn("⚠️  Dashboard en erreur - log conservé pour envoi ultérieur", "status", resp.StatusCode)
+		enqueueOutbox("/api/agent/log", jsonData)
 	} else {
-		fmt.Printf("[%s] ⚠️  Erreur envoi log: %d\n", timestamp, resp.StatusCode)
+		slog.Warn("⚠️  Erreur envoi log", "status", resp.StatusCode)
 	}
 }
 
 // sendActivityLog envoie un log d'activité générale à l'API
 func sendActivityLog(level, message string, details map[string]interface{}) {
-	timestamp := time.Now().Format("15:04:05")
-
 	payload := ActivityLogPayload{
-		AgentID:  agentID,
+		AgentID:  currentAgentID(),
 		Hostname: hostname,
 		Level:    level,
 		Message:  message,
@@ -456,75 +1037,93 @@ func sendActivityLog(level, message string, details map[string]interface{}) {
 
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
-		fmt.Printf("[%s] ❌ Erreur sérialisation activity log: %v\n", timestamp, err)
+		slog.Error("❌ Erreur sérialisation activity log", "error", err)
 		return
 	}
 
-	url := cfg.APIEndpoint + "/api/agent/log"
+	url := currentConfig().APIEndpoint + "/api/agent/log"
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
-		fmt.Printf("[%s] ❌ Erreur création requête activity log: %v\n", timestamp, err)
+		slog.Error("❌ Erreur création requête activity log", "error", err)
 		return
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", fmt.Sprintf("%s/%s", AppName, Version))
 
-	client := &http.Client{Timeout: 10 * time.Second}
+	client := newDashboardClient(10 * time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
-		fmt.Printf("[%s] ⚠️  Impossible d'envoyer l'activity log: %v\n", timestamp, err)
+		slog.Warn("⚠️  Impossible d'envoyer l'activity log - conservé pour envoi ultérieur", "error", err)
+		enqueueOutbox("/api/agent/log", jsonData)
 		return
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated {
-		fmt.Printf("[%s] 📋 Activity log envoyé: [%s] %s\n", timestamp, level, message)
+	switch {
+	case resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated:
+		slog.Debug("📋 Activity log envoyé", "level", level, "message", message)
+	case resp.StatusCode >= 500:
+		enqueueOutbox("/api/agent/log", jsonData)
 	}
 }
 
 // SnapshotSyncPayload représente les données de sync envoyées à l'API
 type SnapshotSyncPayload struct {
-	AgentID   string            `json:"agent_id"`
-	Hostname  string            `json:"hostname"`
-	Snapshots []backup.Snapshot `json:"snapshots"`
+	AgentID   string         `json:"agent_id"`
+	Hostname  string         `json:"hostname"`
+	Snapshots []SnapshotInfo `json:"snapshots"`
+}
+
+// SnapshotInfo complète un snapshot avec son état de réplication
+type SnapshotInfo struct {
+	backup.Snapshot
+	// Nombre d'emplacements (données d'origine, dépôt principal, dépôt secondaire)
+	Locations    int        `json:"locations"`
+	ReplicatedAt *time.Time `json:"replicated_at,omitempty"`
 }
 
 // runRestore exécute une restauration demandée par le serveur
-func runRestore(restoreConfig *RestoreConfig) {
-	timestamp := time.Now().Format("15:04:05")
+func runRestore(restoreConfig *RestoreConfig) error {
+	wrapper, end := beginJob()
+	defer end()
+	defer trackJob("restore")()
 
-	if resticWrapper == nil {
-		fmt.Printf("[%s] ⚠️  Wrapper Restic non initialisé - restauration ignorée\n", timestamp)
+	if wrapper == nil {
+		slog.Warn("⚠️  Wrapper Restic non initialisé - restauration ignorée")
 		updateRestoreStatus(restoreConfig.RequestID, "failed", "Wrapper Restic non initialisé")
-		return
+		return errors.New("système de sauvegarde non initialisé")
 	}
 
-	fmt.Printf("[%s] 🔄 Démarrage de la restauration...\n", timestamp)
-	fmt.Printf("   📸 Snapshot: %s\n", restoreConfig.SnapshotID)
-	fmt.Printf("   📁 Destination: %s\n", restoreConfig.TargetPath)
+	slog.Info("🔄 Démarrage de la restauration...",
+		"snapshot", restoreConfig.SnapshotID,
+		"target", restoreConfig.TargetPath,
+	)
 
 	// Exécution de la restauration
-	result, err := resticWrapper.Restore(restoreConfig.SnapshotID, restoreConfig.TargetPath)
+	result, err := wrapper.Restore(restoreConfig.SnapshotID, restoreConfig.TargetPath)
 	if err != nil {
-		fmt.Printf("[%s] ❌ Échec restauration: %v\n", timestamp, err)
+		slog.Error("❌ Échec restauration", "error", err)
 		updateRestoreStatus(restoreConfig.RequestID, "failed", err.Error())
 		sendActivityLog("error", fmt.Sprintf("Restauration échouée: %v", err), nil)
-		return
+		return err
 	}
 
 	if result.Success {
-		fmt.Printf("[%s] ✅ Restauration réussie!\n", timestamp)
+		slog.Info("✅ Restauration réussie!")
 		updateRestoreStatus(restoreConfig.RequestID, "success", "Restauration terminée avec succès")
 		sendActivityLog("info", fmt.Sprintf("Restauration du snapshot %s vers %s réussie",
 			restoreConfig.SnapshotID, restoreConfig.TargetPath), nil)
+		return nil
+	}
+	if result.Error != "" {
+		return errors.New(result.Error)
 	}
+	return errors.New("restauration incomplète")
 }
 
 // updateRestoreStatus met à jour le statut d'une demande de restauration
 func updateRestoreStatus(requestID, status, message string) {
-	timestamp := time.Now().Format("15:04:05")
-
 	payload := map[string]interface{}{
 		"request_id": requestID,
 		"status":     status,
@@ -533,85 +1132,92 @@ func updateRestoreStatus(requestID, status, message string) {
 
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
-		fmt.Printf("[%s] ❌ Erreur sérialisation restore status: %v\n", timestamp, err)
+		slog.Error("❌ Erreur sérialisation restore status", "error", err)
 		return
 	}
 
-	url := cfg.APIEndpoint + "/api/restore/status"
+	url := currentConfig().APIEndpoint + "/api/restore/status"
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
-		fmt.Printf("[%s] ❌ Erreur création requête restore status: %v\n", timestamp, err)
+		slog.Error("❌ Erreur création requête restore status", "error", err)
 		return
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", fmt.Sprintf("%s/%s", AppName, Version))
 
-	client := &http.Client{Timeout: 10 * time.Second}
+	client := newDashboardClient(10 * time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
-		fmt.Printf("[%s] ⚠️  Impossible d'envoyer le status restore: %v\n", timestamp, err)
+		slog.Warn("⚠️  Impossible d'envoyer le status restore", "error", err)
 		return
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated {
-		fmt.Printf("[%s] 📝 Restore status envoyé: %s\n", timestamp, status)
+		slog.Info("📝 Restore status envoyé", "status", status)
 	}
 }
 
 // syncSnapshots envoie la liste des snapshots au serveur
-func syncSnapshots() {
-	timestamp := time.Now().Format("15:04:05")
+func syncSnapshots() error {
+	wrapper, end := beginJob()
+	defer end()
 
-	if resticWrapper == nil {
-		fmt.Printf("[%s] ⚠️  Wrapper Restic non initialisé - sync ignorée\n", timestamp)
-		return
+	if wrapper == nil {
+		slog.Warn("⚠️  Wrapper Restic non initialisé - sync ignorée")
+		return errors.New("système de sauvegarde non initialisé")
 	}
 
 	// Récupération des snapshots
-	snapshots, err := resticWrapper.GetSnapshots()
+	snapshots, err := wrapper.GetSnapshots()
 	if err != nil {
-		fmt.Printf("[%s] ❌ Échec récupération snapshots: %v\n", timestamp, err)
-		return
+		slog.Error("❌ Échec récupération snapshots", "error", err)
+		return err
 	}
 
-	fmt.Printf("[%s] 📸 %d snapshots trouvés, synchronisation...\n", timestamp, len(snapshots))
+	slog.Info("📸 Snapshots trouvés, synchronisation...", "count", len(snapshots))
 
 	// Envoi au serveur
 	payload := SnapshotSyncPayload{
-		AgentID:   agentID,
+		AgentID:   currentAgentID(),
 		Hostname:  hostname,
-		Snapshots: snapshots,
+		Snapshots: make([]SnapshotInfo, 0, len(snapshots)),
+	}
+	for _, snap := range snapshots {
+		info := SnapshotInfo{Snapshot: snap}
+		info.Locations, info.ReplicatedAt = snapshotLocations(snap.ID)
+		payload.Snapshots = append(payload.Snapshots, info)
 	}
 
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
-		fmt.Printf("[%s] ❌ Erreur sérialisation snapshots: %v\n", timestamp, err)
-		return
+		slog.Error("❌ Erreur sérialisation snapshots", "error", err)
+		return err
 	}
 
-	url := cfg.APIEndpoint + "/api/agent/snapshots"
+	url := currentConfig().APIEndpoint + "/api/agent/snapshots"
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
-		fmt.Printf("[%s] ❌ Erreur création requête snapshots: %v\n", timestamp, err)
-		return
+		slog.Error("❌ Erreur création requête snapshots", "error", err)
+		return err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", fmt.Sprintf("%s/%s", AppName, Version))
 
-	client := &http.Client{Timeout: 30 * time.Second}
+	client := newDashboardClient(30 * time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
-		fmt.Printf("[%s] ⚠️  Impossible d'envoyer les snapshots: %v\n", timestamp, err)
-		return
+		slog.Warn("⚠️  Impossible d'envoyer les snapshots", "error", err)
+		return err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated {
-		fmt.Printf("[%s] ✅ Snapshots synchronisés avec le serveur\n", timestamp)
-	} else {
-		fmt.Printf("[%s] ⚠️  Erreur sync snapshots: status %d\n", timestamp, resp.StatusCode)
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		slog.Warn("⚠️  Erreur sync snapshots", "status", resp.StatusCode)
+		return fmt.Errorf("statut %d", resp.StatusCode)
 	}
+	slog.Info("✅ Snapshots synchronisés avec le serveur")
+	return nil
 }
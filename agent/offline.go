@@ -0,0 +1,425 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mon-rempart/agent/identity"
+)
+
+// Fichiers du fonctionnement hors ligne, dans le dossier de configuration
+const (
+	// Dernière configuration distante valide, chiffrée
+	configCacheFile = "remote-config.enc"
+	// Mode de fonctionnement (en ligne / hors ligne), lu par `status`
+	connectivityFile = "connectivity.json"
+	// Logs non envoyés, rejoués au retour du Dashboard
+	outboxFile = "outbox.jsonl"
+
+	// Usage de la clé de chiffrement du cache
+	configCachePurpose = "remote-config"
+
+	// Au-delà, les logs les plus anciens de l'outbox sont abandonnés
+	maxOutboxEntries = 1000
+)
+
+// Modes de fonctionnement de l'agent
+const (
+	ModeOnline = "online"
+	// Dashboard injoignable : sauvegardes lancées depuis la configuration en cache
+	ModeOffline = "offline"
+)
+
+// errDashboardUnreachable : le Dashboard n'a pas répondu (réseau, erreur serveur)
+var errDashboardUnreachable = errors.New("dashboard injoignable")
+
+// Identité persistante de l'agent (ID, clé du cache)
+var agentIdentity *identity.Identity
+
+// loadIdentity charge l'identité de l'agent ; sans elle, pas de cache de configuration
+func loadIdentity() {
+	id, err := identity.Load(currentConfig().Dir())
+	if err != nil {
+		slog.Warn("⚠️  Identité de l'agent indisponible - pas de fonctionnement hors ligne", "error", err)
+		return
+	}
+	agentIdentity = id
+}
+
+// cachedRemoteConfig est le contenu chiffré du cache de configuration
+type cachedRemoteConfig struct {
+	CachedAt time.Time    `json:"cached_at"`
+	Config   RemoteConfig `json:"config"`
+}
+
+// saveConfigCache chiffre et enregistre la dernière configuration valide
+func saveConfigCache(config *RemoteConfig) {
+	if agentIdentity == nil {
+		return
+	}
+
+	data, err := json.Marshal(cachedRemoteConfig{CachedAt: time.Now(), Config: *config})
+	if err != nil {
+		slog.Warn("⚠️  Cache de configuration non enregistré", "error", err)
+		return
+	}
+	sealed, err := agentIdentity.Seal(configCachePurpose, data)
+	if err != nil {
+		slog.Warn("⚠️  Cache de configuration non enregistré", "error", err)
+		return
+	}
+
+	path := filepath.Join(currentConfig().Dir(), configCacheFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, sealed, 0600); err != nil {
+		slog.Warn("⚠️  Cache de configuration non enregistré", "error", err)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		slog.Warn("⚠️  Cache de configuration non enregistré", "error", err)
+	}
+}
+
+// loadConfigCache déchiffre la dernière configuration valide
+func loadConfigCache() (*cachedRemoteConfig, error) {
+	if agentIdentity == nil {
+		return nil, fmt.Errorf("identité de l'agent indisponible")
+	}
+
+	sealed, err := os.ReadFile(filepath.Join(currentConfig().Dir(), configCacheFile))
+	if err != nil {
+		return nil, err
+	}
+	data, err := agentIdentity.Open(configCachePurpose, sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	var cached cachedRemoteConfig
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, fmt.Errorf("cache de configuration illisible: %w", err)
+	}
+	if !cached.Config.Configured {
+		return nil, fmt.Errorf("cache de configuration incomplet")
+	}
+	return &cached, nil
+}
+
+// useCachedConfig utilise la configuration en cache quand le Dashboard est
+// injoignable et passe l'agent en mode hors ligne. Elle est retournée avec
+// ses secrets (nil si le cache est inutilisable).
+func useCachedConfig() *RemoteConfig {
+	cached, err := loadConfigCache()
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("⚠️  Cache de configuration inutilisable", "error", err)
+		}
+		return nil
+	}
+
+	applyRepositoryKeys(&cached.Config)
+	setRemoteConfig(cached.Config, remoteConfigETag())
+	connectivity.enterOffline(cached.CachedAt)
+
+	slog.Warn("📴 Dashboard injoignable - mode hors ligne avec la configuration en cache",
+		"cached_at", cached.CachedAt.Local().Format("02/01/2006 15:04"))
+	return &cached.Config
+}
+
+// ConnectivityState décrit le mode de fonctionnement de l'agent
+type ConnectivityState struct {
+	Mode  string    `json:"mode"`
+	Since time.Time `json:"since"`
+	// Date de la configuration en cache utilisée hors ligne
+	ConfigCachedAt *time.Time `json:"config_cached_at,omitempty"`
+	// Sauvegardes effectuées depuis le passage hors ligne
+	OfflineBackups int `json:"offline_backups,omitempty"`
+	// Interception TLS en cours (pare-feu avec inspection, proxy)
+	Intercepted string `json:"intercepted,omitempty"`
+
+	mu sync.Mutex
+	// Fichier d'état, renseigné par le service seulement : une commande
+	// ponctuelle hors ligne ne change pas le mode affiché du service
+	path string
+}
+
+// Mode de fonctionnement courant
+var connectivity = &ConnectivityState{Mode: ModeOnline, Since: time.Now()}
+
+// trackConnectivity enregistre le mode du service, en ligne au démarrage
+func trackConnectivity() {
+	connectivity.mu.Lock()
+	defer connectivity.mu.Unlock()
+	connectivity.path = filepath.Join(currentConfig().Dir(), connectivityFile)
+	connectivity.save()
+}
+
+// loadConnectivityState lit le mode enregistré par le service
+func loadConnectivityState() (*ConnectivityState, error) {
+	data, err := os.ReadFile(filepath.Join(currentConfig().Dir(), connectivityFile))
+	if err != nil {
+		return nil, err
+	}
+	state := &ConnectivityState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Offline indique si l'agent fonctionne sur la configuration en cache
+func (c *ConnectivityState) Offline() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Mode == ModeOffline
+}
+
+// enterOffline passe en mode hors ligne
+func (c *ConnectivityState) enterOffline(cachedAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Mode != ModeOffline {
+		c.Mode = ModeOffline
+		c.Since = time.Now()
+		c.OfflineBackups = 0
+	}
+	c.ConfigCachedAt = &cachedAt
+	c.save()
+}
+
+// setIntercepted enregistre l'interception en cours (vide : connexion vérifiée)
+func (c *ConnectivityState) setIntercepted(reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Intercepted != reason {
+		c.Intercepted = reason
+		c.save()
+	}
+}
+
+// interception retourne l'interception TLS en cours (vide : aucune)
+func (c *ConnectivityState) interception() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Intercepted
+}
+
+// recordBackup compte les sauvegardes effectuées hors ligne
+func (c *ConnectivityState) recordBackup() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Mode == ModeOffline {
+		c.OfflineBackups++
+		c.save()
+	}
+}
+
+// leaveOffline repasse en ligne et retourne l'état hors ligne quitté
+func (c *ConnectivityState) leaveOffline() (*ConnectivityState, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Mode != ModeOffline {
+		return nil, false
+	}
+	previous := &ConnectivityState{
+		Mode:           c.Mode,
+		Since:          c.Since,
+		ConfigCachedAt: c.ConfigCachedAt,
+		OfflineBackups: c.OfflineBackups,
+	}
+	c.Mode = ModeOnline
+	c.Since = time.Now()
+	c.ConfigCachedAt = nil
+	c.OfflineBackups = 0
+	c.save()
+	return previous, true
+}
+
+// save enregistre l'état (appelé verrou pris)
+func (c *ConnectivityState) save() {
+	if c.path == "" {
+		return
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(c.path, data, 0600); err != nil {
+		slog.Debug("État de connectivité non enregistré", "error", err)
+	}
+}
+
+// reconcileOnline rattrape le fonctionnement hors ligne quand le Dashboard
+// répond de nouveau : logs en attente, sauvegardes effectuées, snapshots
+func reconcileOnline() {
+	previous, wasOffline := connectivity.leaveOffline()
+	if !wasOffline {
+		return
+	}
+
+	duration := time.Since(previous.Since)
+	slog.Info("🌐 Dashboard de nouveau joignable - fin du mode hors ligne",
+		"duration", duration.Round(time.Second).String(),
+		"backups", previous.OfflineBackups,
+	)
+
+	flushOutbox()
+	sendActivityLog("warning", "Agent reconnecté après un fonctionnement hors ligne", map[string]interface{}{
+		"offline_since":    previous.Since,
+		"duration_seconds": int(duration.Seconds()),
+		"offline_backups":  previous.OfflineBackups,
+	})
+	syncSnapshots()
+}
+
+// outboxEntry est un envoi au Dashboard en attente
+type outboxEntry struct {
+	Path     string          `json:"path"`
+	Body     json.RawMessage `json:"body"`
+	QueuedAt time.Time       `json:"queued_at"`
+}
+
+var outboxMu sync.Mutex
+
+// outboxPath retourne le fichier des envois en attente
+func outboxPath() string {
+	return filepath.Join(currentConfig().Dir(), outboxFile)
+}
+
+// enqueueOutbox conserve un envoi qui n'a pas pu aboutir
+func enqueueOutbox(path string, body []byte) {
+	outboxMu.Lock()
+	defer outboxMu.Unlock()
+
+	entries := readOutbox()
+	entries = append(entries, outboxEntry{Path: path, Body: body, QueuedAt: time.Now()})
+	if len(entries) > maxOutboxEntries {
+		slog.Warn("⚠️  Outbox pleine - logs les plus anciens abandonnés", "dropped", len(entries)-maxOutboxEntries)
+		entries = entries[len(entries)-maxOutboxEntries:]
+	}
+	if err := writeOutbox(entries); err != nil {
+		slog.Warn("⚠️  Log non conservé pour envoi ultérieur", "error", err)
+		return
+	}
+	slog.Debug("📥 Log conservé pour envoi ultérieur", "path", path, "pending", len(entries))
+}
+
+// outboxDepth retourne le nombre d'envois en attente
+func outboxDepth() int {
+	outboxMu.Lock()
+	defer outboxMu.Unlock()
+	return len(readOutbox())
+}
+
+// flushOutbox rejoue les envois en attente dans l'ordre, jusqu'au premier échec
+func flushOutbox() {
+	outboxMu.Lock()
+	defer outboxMu.Unlock()
+
+	entries := readOutbox()
+	if len(entries) == 0 {
+		return
+	}
+
+	sent := 0
+	for _, entry := range entries {
+		if err := postOutboxEntry(entry); err != nil {
+			if errors.Is(err, errDashboardUnreachable) {
+				break
+			}
+			// Refusé par le serveur : le rejouer ne servirait à rien
+			slog.Warn("⚠️  Log en attente refusé par le Dashboard - abandonné", "path", entry.Path, "error", err)
+		}
+		sent++
+	}
+
+	if err := writeOutbox(entries[sent:]); err != nil {
+		slog.Warn("⚠️  Outbox non mise à jour", "error", err)
+	}
+	slog.Info("📤 Logs en attente envoyés", "sent", sent, "pending", len(entries)-sent)
+}
+
+// postOutboxEntry envoie un élément de l'outbox
+func postOutboxEntry(entry outboxEntry) error {
+	req, err := http.NewRequest("POST", currentConfig().APIEndpoint+entry.Path, bytes.NewReader(entry.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", fmt.Sprintf("%s/%s", AppName, Version))
+
+	client := newDashboardClient(10 * time.Second)
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errDashboardUnreachable, err)
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("%w: statut %d", errDashboardUnreachable, resp.StatusCode)
+	case resp.StatusCode >= 400:
+		return fmt.Errorf("statut %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// readOutbox lit les envois en attente (verrou pris)
+func readOutbox() []outboxEntry {
+	f, err := os.Open(outboxPath())
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var entries []outboxEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var entry outboxEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// writeOutbox remplace les envois en attente (verrou pris)
+func writeOutbox(entries []outboxEntry) error {
+	if len(entries) == 0 {
+		err := os.Remove(outboxPath())
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			continue
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	tmp := outboxPath() + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, outboxPath())
+}
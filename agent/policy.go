@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/mon-rempart/agent/backup"
+	"github.com/mon-rempart/agent/config"
+)
+
+// Dernière politique appliquée, dans le dossier de configuration : elle reste
+// en vigueur au redémarrage si le Dashboard envoie ensuite une politique refusée
+const policyFile = "policy.json"
+
+var (
+	// Configuration locale (config.json + environnement), avant la politique ;
+	// currentConfig retourne la configuration effective
+	baseCfg *config.Config
+
+	// Écrites par la boucle de configuration, lues par le heartbeat
+	policyMu sync.Mutex
+	// Politique en vigueur (telle que reçue, variables non développées)
+	appliedPolicy *config.Policy
+	// Dernière version refusée : pas de nouveau rapport tant qu'elle ne change pas
+	rejectedPolicyVersion int
+)
+
+// PolicyReport est le compte rendu d'application d'une politique envoyé au Dashboard
+type PolicyReport struct {
+	AgentID  string   `json:"agent_id"`
+	Hostname string   `json:"hostname"`
+	Version  int      `json:"version"`
+	Status   string   `json:"status"` // applied ou rejected
+	Errors   []string `json:"errors,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// policyPath retourne le fichier de la politique appliquée
+func policyPath() string {
+	return filepath.Join(baseCfg.Dir(), policyFile)
+}
+
+// loadAppliedPolicy applique au démarrage la dernière politique enregistrée
+func loadAppliedPolicy() {
+	baseCfg = currentConfig()
+
+	data, err := os.ReadFile(policyPath())
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("⚠️  Politique enregistrée illisible", "error", err)
+		}
+		return
+	}
+
+	var policy config.Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		slog.Warn("⚠️  Politique enregistrée illisible", "error", err)
+		return
+	}
+	// Validée à nouveau : les variables dépendent de l'environnement du processus
+	effective := policy
+	if _, err := effective.Validate(baseCfg.AllowRemoteHooks); err != nil {
+		slog.Warn("⚠️  Politique enregistrée ignorée", "version", policy.Version, "error", err)
+		return
+	}
+
+	setAppliedPolicy(&policy)
+	activeConfig.Store(baseCfg.WithPolicy(&effective))
+	slog.Debug("📜 Politique de sauvegarde chargée", "version", policy.Version)
+}
+
+// appliedPolicyVersion retourne la version de la politique en vigueur (0 : aucune)
+func appliedPolicyVersion() int {
+	policyMu.Lock()
+	defer policyMu.Unlock()
+	if appliedPolicy == nil {
+		return 0
+	}
+	return appliedPolicy.Version
+}
+
+// setAppliedPolicy enregistre la politique en vigueur (nil : aucune)
+func setAppliedPolicy(policy *config.Policy) {
+	policyMu.Lock()
+	appliedPolicy = policy
+	policyMu.Unlock()
+}
+
+// applyPolicy applique la politique reçue du Dashboard entre deux tâches.
+// Une politique invalide est refusée et la précédente reste en vigueur.
+func applyPolicy(policy *config.Policy) {
+	policyMu.Lock()
+	applied, rejected := appliedPolicy, rejectedPolicyVersion
+	policyMu.Unlock()
+
+	if policy == nil {
+		if applied != nil {
+			slog.Info("📜 Politique retirée du Dashboard - retour à la configuration locale", "version", applied.Version)
+			swapWrappers(func() {
+				activeConfig.Store(baseCfg)
+				setAppliedPolicy(nil)
+			})
+			if err := os.Remove(policyPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+				slog.Warn("⚠️  Politique enregistrée non supprimée", "error", err)
+			}
+		}
+		return
+	}
+	if (applied != nil && reflect.DeepEqual(*policy, *applied)) || policy.Version == rejected {
+		return
+	}
+
+	effective := *policy
+	warnings, err := effective.Validate(baseCfg.AllowRemoteHooks)
+	if err != nil {
+		policyMu.Lock()
+		rejectedPolicyVersion = policy.Version
+		policyMu.Unlock()
+		errs := joinedErrors(err)
+		slog.Error("❌ Politique de sauvegarde refusée", "version", policy.Version, "errors", errs)
+		sendActivityLog("error", fmt.Sprintf("Politique de sauvegarde v%d refusée", policy.Version), map[string]interface{}{
+			"errors":          errs,
+			"applied_version": appliedPolicyVersion(),
+		})
+		reportPolicy(policy.Version, "rejected", errs, warnings)
+		return
+	}
+
+	swapWrappers(func() {
+		activeConfig.Store(baseCfg.WithPolicy(&effective))
+		current := *policy
+		policyMu.Lock()
+		appliedPolicy = &current
+		rejectedPolicyVersion = 0
+		policyMu.Unlock()
+	})
+	savePolicy(policy)
+
+	cfg := currentConfig()
+	slog.Info("📜 Politique de sauvegarde appliquée",
+		"version", policy.Version,
+		"paths", len(cfg.BackupPaths),
+		"schedule", cfg.BackupSchedule,
+	)
+	for _, w := range warnings {
+		slog.Warn("⚠️  Politique", "warning", w)
+	}
+	sendActivityLog("info", fmt.Sprintf("Politique de sauvegarde v%d appliquée", policy.Version), map[string]interface{}{
+		"warnings": warnings,
+	})
+	reportPolicy(policy.Version, "applied", nil, warnings)
+}
+
+// joinedErrors sépare les erreurs regroupées par errors.Join
+func joinedErrors(err error) []string {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var errs []string
+		for _, e := range joined.Unwrap() {
+			errs = append(errs, e.Error())
+		}
+		return errs
+	}
+	return []string{err.Error()}
+}
+
+// savePolicy enregistre la politique appliquée (écriture atomique)
+func savePolicy(policy *config.Policy) {
+	data, err := json.MarshalIndent(policy, "", "  ")
+	if err != nil {
+		slog.Warn("⚠️  Politique non enregistrée", "error", err)
+		return
+	}
+	tmp := policyPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		slog.Warn("⚠️  Politique non enregistrée", "error", err)
+		return
+	}
+	if err := os.Rename(tmp, policyPath()); err != nil {
+		slog.Warn("⚠️  Politique non enregistrée", "error", err)
+	}
+}
+
+// reportPolicy envoie au Dashboard le résultat de l'application d'une politique
+func reportPolicy(version int, status string, errs, warnings []string) {
+	payload := PolicyReport{
+		AgentID:  currentAgentID(),
+		Hostname: hostname,
+		Version:  version,
+		Status:   status,
+		Errors:   errs,
+		Warnings: warnings,
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("❌ Erreur sérialisation rapport de politique", "error", err)
+		return
+	}
+
+	url := currentConfig().APIEndpoint + "/api/agent/policy"
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		slog.Error("❌ Erreur création requête rapport de politique", "error", err)
+		return
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", fmt.Sprintf("%s/%s", AppName, Version))
+
+	client := newDashboardClient(10 * time.Second)
+	resp, err := client.Do(req)
+	if err != nil {
+		slog.Warn("⚠️  Impossible d'envoyer le rapport de politique - conservé pour envoi ultérieur", "error", err)
+		enqueueOutbox("/api/agent/policy", jsonData)
+		return
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated:
+		slog.Debug("📝 Rapport de politique envoyé", "version", version, "status", status)
+	case resp.StatusCode >= 500:
+		enqueueOutbox("/api/agent/policy", jsonData)
+	default:
+		slog.Warn("⚠️  Erreur envoi rapport de politique", "status", resp.StatusCode)
+	}
+}
+
+// applyRetention supprime les snapshots hors de la politique de rétention
+func applyRetention(wrapper *backup.ResticWrapper) {
+	r := currentConfig().Retention
+	if !r.Enabled() {
+		return
+	}
+	if backup.IsAppendOnly(wrapper.Backend()) {
+		slog.Debug("Rétention non appliquée : dépôt en ajout seul")
+		return
+	}
+
+	result, err := wrapper.Forget(backup.RetentionPolicy{
+		KeepLast:    r.KeepLast,
+		KeepDaily:   r.KeepDaily,
+		KeepWeekly:  r.KeepWeekly,
+		KeepMonthly: r.KeepMonthly,
+		KeepYearly:  r.KeepYearly,
+		// Snapshots antérieurs à une attaque détectée
+		KeepTags: []string{backup.ProtectedTag},
+	})
+	if err != nil {
+		slog.Error("❌ Échec de la rétention", "error", err)
+		sendActivityLog("error", "Échec de la rétention des snapshots", map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if len(result.Removed) > 0 {
+		sendActivityLog("info", fmt.Sprintf("Rétention : %d snapshot(s) supprimé(s)", len(result.Removed)), map[string]interface{}{
+			"removed": result.Removed,
+			"kept":    result.Kept,
+		})
+	}
+}
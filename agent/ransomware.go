@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"github.com/mon-rempart/agent/backup"
+)
+
+// ransomwareStatePath retourne l'index des fichiers de la détection de rançongiciel
+func ransomwareStatePath() string {
+	return filepath.Join(currentConfig().Dir(), "ransomware.json")
+}
+
+// checkRansomware analyse les chemins configurés avant leur sauvegarde et
+// marque le snapshot suspect au-delà du seuil. Retourne nil si l'analyse est
+// désactivée ou impossible : la sauvegarde n'est jamais bloquée.
+func checkRansomware(opts *backup.BackupOptions, paths []string) *backup.RansomwareReport {
+	cfg := currentConfig()
+	if cfg.Ransomware.Disabled {
+		return nil
+	}
+
+	detector := backup.NewRansomwareDetector(ransomwareStatePath(), cfg.Ransomware.Threshold)
+	report, err := detector.Analyze(paths, opts.Excludes)
+	if err != nil {
+		slog.Warn("⚠️  Analyse anti-rançongiciel impossible", "error", err)
+		return nil
+	}
+
+	slog.Debug("🔎 Analyse anti-rançongiciel",
+		"files", report.FilesScanned,
+		"changed", report.FilesChanged,
+		"score", report.Score,
+		"duration_seconds", report.Duration,
+	)
+	if report.Suspect {
+		opts.Tags = append(opts.Tags, backup.SuspectTag)
+	}
+	return report
+}
+
+// handleSuspectBackup protège les snapshots antérieurs de la rétention et
+// alerte le Dashboard après une sauvegarde suspecte. Retourne false si
+// l'historique n'a pas pu être protégé : la rétention et la réplication ne
+// doivent pas s'exécuter juste après une attaque.
+func handleSuspectBackup(wrapper *backup.ResticWrapper, report *backup.RansomwareReport, result *backup.BackupResult) bool {
+	if report == nil || !report.Suspect {
+		return true
+	}
+
+	kinds := make([]string, 0, len(report.Signals))
+	for _, s := range report.Signals {
+		kinds = append(kinds, s.Kind)
+	}
+	slog.Error("🚨 Rançongiciel probable - snapshot marqué suspect",
+		"score", report.Score,
+		"threshold", report.Threshold,
+		"signals", strings.Join(kinds, ","),
+	)
+
+	details := map[string]interface{}{
+		"score":          report.Score,
+		"threshold":      report.Threshold,
+		"signals":        report.Signals,
+		"files_scanned":  report.FilesScanned,
+		"files_changed":  report.FilesChanged,
+		"change_ratio":   report.ChangeRatio,
+		"baseline_ratio": report.Baseline,
+	}
+	if result != nil && result.SnapshotID != "" {
+		details["snapshot_id"] = result.SnapshotID
+	}
+
+	message := fmt.Sprintf("Rançongiciel probable : snapshot suspect (score %d/100)", report.Score)
+	protected, err := protectGoodSnapshots(wrapper, result)
+	if err != nil {
+		slog.Error("❌ Snapshots antérieurs non protégés - rétention et réplication suspendues", "error", err)
+		details["protect_error"] = err.Error()
+		details["retention_skipped"] = true
+		details["replication_skipped"] = true
+		message += ", rétention et réplication suspendues (snapshots antérieurs non protégés)"
+	} else {
+		details["protected"] = protected
+	}
+
+	sendActivityLog("critical", message, details)
+	return err == nil
+}
+
+// protectGoodSnapshots ajoute le tag protected aux snapshots non suspects
+// antérieurs : la rétention les conserve (--keep-tag) tant que le tag n'est
+// pas retiré (restic tag --remove protected)
+func protectGoodSnapshots(wrapper *backup.ResticWrapper, suspect *backup.BackupResult) ([]string, error) {
+	if backup.IsAppendOnly(wrapper.Backend()) {
+		// Rien ne peut être supprimé par l'agent : la rétention relève du serveur
+		return nil, nil
+	}
+
+	snapshots, err := wrapper.GetSnapshots()
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, s := range snapshots {
+		if suspect != nil && suspect.SnapshotID != "" && (strings.HasPrefix(s.ID, suspect.SnapshotID) || strings.HasPrefix(suspect.SnapshotID, s.ID)) {
+			continue
+		}
+		if hasTag(s.Tags, backup.SuspectTag) || hasTag(s.Tags, backup.ProtectedTag) {
+			continue
+		}
+		ids = append(ids, s.ShortID)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	if err := wrapper.AddTags(ids, backup.ProtectedTag); err != nil {
+		return nil, err
+	}
+	slog.Info("🛡️  Snapshots antérieurs protégés de la rétention", "count", len(ids))
+	return ids, nil
+}
+
+// hasTag indique si un snapshot porte un tag
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
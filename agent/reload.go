@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/mon-rempart/agent/backup"
+)
+
+// Les tâches (sauvegarde, restauration, réplication, rotation de clé...)
+// tiennent jobMu en lecture pendant toute leur durée. Le remplacement des
+// wrappers après un changement de configuration le prend en écriture : il
+// attend la fin des tâches en cours et n'interrompt jamais une sauvegarde.
+var jobMu sync.RWMutex
+
+// beginJob réserve le wrapper courant pour une tâche ; end doit être appelé
+// à la fin de la tâche. Une tâche ne doit pas en démarrer une autre de façon
+// synchrone (verrou non réentrant).
+func beginJob() (wrapper *backup.ResticWrapper, end func()) {
+	jobMu.RLock()
+	return resticWrapper, jobMu.RUnlock
+}
+
+// swapWrappers installe les nouveaux wrappers entre deux tâches
+func swapWrappers(install func()) {
+	if !jobMu.TryLock() {
+		slog.Info("⏳ Nouvelle configuration en attente de la fin des tâches en cours")
+		jobMu.Lock()
+	}
+	defer jobMu.Unlock()
+	install()
+}
+
+// sanitizedConfig retourne une copie de la configuration dont les champs
+// marqués secret:"true" sont remplacés par une empreinte : les changements
+// restent détectables sans conserver ni afficher les valeurs
+func sanitizedConfig(c *RemoteConfig) RemoteConfig {
+	sanitized := *c
+	v := reflect.ValueOf(&sanitized).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("secret") != "true" || v.Field(i).Kind() != reflect.String {
+			continue
+		}
+		if value := v.Field(i).String(); value != "" {
+			sum := sha256.Sum256([]byte(value))
+			v.Field(i).SetString("sha256:" + hex.EncodeToString(sum[:8]))
+		}
+	}
+	return sanitized
+}
+
+// diffRemoteConfig liste les champs modifiés entre deux configurations
+// assainies. Les valeurs secrètes ne sont jamais affichées.
+func diffRemoteConfig(previous, current RemoteConfig) []string {
+	var changes []string
+	ov, nv := reflect.ValueOf(previous), reflect.ValueOf(current)
+	t := ov.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		// Champs de la réponse, pas de la configuration
+		if name == "" || name == "-" || name == "success" || name == "message" || name == "version" {
+			continue
+		}
+
+		a, b := ov.Field(i).Interface(), nv.Field(i).Interface()
+		if reflect.DeepEqual(a, b) {
+			continue
+		}
+
+		switch {
+		case field.Tag.Get("secret") == "true":
+			changes = append(changes, name+" (secret modifié)")
+		case ov.Field(i).Kind() == reflect.String || ov.Field(i).Kind() == reflect.Bool:
+			changes = append(changes, fmt.Sprintf("%s: %v → %v", name, a, b))
+		default:
+			changes = append(changes, name)
+		}
+	}
+	return changes
+}
+
+// applyConfigChanges reconstruit le système de sauvegarde après un
+// changement de la configuration distante
+func applyConfigChanges(remote *RemoteConfig, changes []string) {
+	slog.Info("🔧 Configuration distante modifiée", "version", remote.Version, "changes", strings.Join(changes, ", "))
+	sendActivityLog("info", "Configuration distante mise à jour", map[string]interface{}{
+		"version": remote.Version,
+		"changes": changes,
+	})
+	initBackupSystem(remote)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mon-rempart/agent/backup"
+)
+
+// État de la réplication vers le dépôt secondaire
+var (
+	replicaWrapper   *backup.ResticWrapper
+	replicationState *backup.ReplicationState
+
+	// Une seule copie à la fois (après sauvegarde, périodique ou manuelle)
+	replicationMu sync.Mutex
+)
+
+// newReplicaWrapper crée le wrapper du dépôt secondaire ; les identifiants
+// absents de sa configuration sont repris du dépôt principal, sauf le mot de
+// passe conservé après une rotation de clé en échec sur ce dépôt
+func newReplicaWrapper(primary *backup.ResticWrapper) (*backup.ResticWrapper, error) {
+	cfg := currentConfig()
+	backend, err := repositoryBackend(cfg.Replication.RepositoryConfig)
+	if err != nil {
+		return nil, err
+	}
+	password := cfg.Replication.Password
+	if password == "" {
+		password = storedReplicaPassword()
+	}
+	return primary.NewReplicaWrapper(backend, password)
+}
+
+// replicationStatePath retourne le fichier d'état de la réplication
+func replicationStatePath() string {
+	return filepath.Join(currentConfig().Dir(), "replication.json")
+}
+
+// initReplication prépare le dépôt secondaire s'il est configuré
+func initReplication(primary *backup.ResticWrapper) error {
+	cfg := currentConfig()
+	if !cfg.Replication.Enabled() {
+		return nil
+	}
+
+	state, err := backup.LoadReplicationState(replicationStatePath())
+	if err != nil {
+		slog.Warn("⚠️  État de réplication réinitialisé", "error", err)
+	}
+	replicationState = state
+
+	wrapper, err := newReplicaWrapper(primary)
+	if err != nil {
+		return err
+	}
+	if err := primary.InitReplica(context.Background(), wrapper); err != nil {
+		return err
+	}
+
+	replicaWrapper = wrapper
+	slog.Info("✅ Réplication 3-2-1 active", "mode", cfg.Replication.Mode)
+	return nil
+}
+
+// runReplication copie les snapshots manquants vers le dépôt secondaire
+// et signale le résultat au Dashboard
+func runReplication(primary *backup.ResticWrapper) *backup.ReplicationResult {
+	if replicaWrapper == nil || primary == nil {
+		return nil
+	}
+
+	replicationMu.Lock()
+	defer replicationMu.Unlock()
+	defer trackJob("replication")()
+
+	retryReplicaRotation(primary)
+	result, err := primary.CopyTo(context.Background(), replicaWrapper)
+	if saveErr := replicationState.Record(result); saveErr != nil {
+		slog.Warn("⚠️  État de réplication non enregistré", "error", saveErr)
+	}
+
+	details := map[string]interface{}{
+		"replicated":       result.Replicated,
+		"missing":          result.Missing,
+		"duration_seconds": result.Duration,
+	}
+	if err != nil {
+		slog.Error("❌ Échec réplication", "error", err)
+		details["error"] = result.Error
+		sendActivityLog("error", "Échec de la copie vers le dépôt secondaire", details)
+		return result
+	}
+
+	sendActivityLog("info", "Snapshots copiés vers le dépôt secondaire", details)
+	return result
+}
+
+// replicateAfterBackup lance la réplication si elle suit chaque sauvegarde
+func replicateAfterBackup(primary *backup.ResticWrapper) {
+	if currentConfig().Replication.Mode == "after_backup" {
+		runReplication(primary)
+	}
+}
+
+// replicationLoop copie périodiquement les snapshots en mode interval
+func replicationLoop() {
+	cfg := currentConfig()
+	if cfg.Replication.Mode != "interval" {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(cfg.Replication.IntervalMinutes) * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		wrapper, end := beginJob()
+		result := runReplication(wrapper)
+		end()
+		if result != nil {
+			syncSnapshots()
+		}
+	}
+}
+
+// snapshotLocations retourne le nombre d'emplacements d'un snapshot :
+// données d'origine, dépôt principal et, s'il y a été copié, dépôt secondaire
+func snapshotLocations(snapshotID string) (int, *time.Time) {
+	if replicationState == nil {
+		return 2, nil
+	}
+	if t, ok := replicationState.Replicated(snapshotID); ok {
+		return 3, &t
+	}
+	return 2, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"log/slog"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/mon-rempart/agent/backup"
+	"github.com/mon-rempart/agent/governor"
+)
+
+// Mesure de la charge, du processeur et de l'alimentation du poste
+var systemGovernor = governor.New()
+
+// BackupDeferral est une sauvegarde planifiée reportée : poste chargé,
+// processeur occupé ou sur batterie
+type BackupDeferral struct {
+	Since   time.Time         `json:"since"`
+	Reasons []governor.Reason `json:"reasons"`
+	Sample  governor.Sample   `json:"sample"`
+	// Au-delà, la sauvegarde est lancée quelle que soit l'activité du poste
+	Deadline time.Time `json:"deadline"`
+}
+
+var (
+	deferralMu sync.Mutex
+	deferral   *BackupDeferral
+)
+
+// resticPriority retourne la priorité de restic : par défaut, la moitié des
+// processeurs du poste
+func resticPriority() backup.Priority {
+	cfg := currentConfig()
+	procs := cfg.Resources.MaxProcs
+	if procs == 0 {
+		procs = max(1, runtime.NumCPU()/2)
+	}
+	return backup.Priority{
+		Nice:     cfg.Resources.Nice,
+		IOClass:  cfg.Resources.IOClass,
+		MaxProcs: procs,
+	}
+}
+
+// busyReasons mesure le poste et retourne les raisons de reporter une
+// sauvegarde automatique, vides si elle peut partir
+func busyReasons() (governor.Sample, []governor.Reason) {
+	cfg := currentConfig()
+	sample := systemGovernor.Sample()
+	return sample, sample.Reasons(governor.Limits{
+		MaxLoad:       cfg.Resources.MaxLoad,
+		MaxCPUPercent: cfg.Resources.MaxCPUPercent,
+		RunOnBattery:  cfg.Resources.RunOnBattery,
+	})
+}
+
+// deferScheduledBackup enregistre le report de la sauvegarde planifiée due
+// depuis since ; le Dashboard est prévenu au premier report et quand les
+// raisons changent
+func deferScheduledBackup(since time.Time, sample governor.Sample, reasons []governor.Reason) {
+	deadline := since.Add(time.Duration(currentConfig().Resources.MaxDeferMinutes) * time.Minute)
+
+	deferralMu.Lock()
+	changed := deferral == nil || governor.Codes(deferral.Reasons) != governor.Codes(reasons)
+	deferral = &BackupDeferral{Since: since, Reasons: reasons, Sample: sample, Deadline: deadline}
+	deferralMu.Unlock()
+
+	if !changed {
+		slog.Debug("⏳ Sauvegarde planifiée toujours reportée", "reasons", governor.Messages(reasons))
+		return
+	}
+	slog.Info("⏳ Sauvegarde planifiée reportée",
+		"reasons", governor.Messages(reasons),
+		"deadline", deadline.Format("15:04"),
+	)
+	go sendActivityLog("warning", "Sauvegarde planifiée reportée : "+governor.Messages(reasons), map[string]interface{}{
+		"reasons":  reasons,
+		"sample":   sample,
+		"since":    since,
+		"deadline": deadline,
+	})
+}
+
+// cancelDeferral abandonne le report en cours (sauvegardes suspendues)
+func cancelDeferral() {
+	deferralMu.Lock()
+	deferral = nil
+	deferralMu.Unlock()
+}
+
+// endDeferral termine le report en cours à la sauvegarde ; forced : report
+// maximal atteint, le poste est toujours chargé
+func endDeferral(forced bool) {
+	deferralMu.Lock()
+	d := deferral
+	deferral = nil
+	deferralMu.Unlock()
+	if d == nil {
+		return
+	}
+
+	waited := time.Since(d.Since).Round(time.Minute)
+	if forced {
+		slog.Warn("⏰ Report maximal atteint - sauvegarde planifiée lancée", "reasons", governor.Messages(d.Reasons), "waited", waited)
+	} else {
+		slog.Info("▶️  Poste disponible - sauvegarde planifiée lancée", "waited", waited)
+	}
+	go sendActivityLog("info", "Sauvegarde planifiée lancée après un report", map[string]interface{}{
+		"waited_minutes": int(waited.Minutes()),
+		"forced":         forced,
+	})
+}
+
+// currentDeferral retourne le report en cours (nil : aucun)
+func currentDeferral() *BackupDeferral {
+	deferralMu.Lock()
+	defer deferralMu.Unlock()
+	if deferral == nil {
+		return nil
+	}
+	d := *deferral
+	return &d
+}
@@ -0,0 +1,194 @@
+// Package schedule - Planification des sauvegardes de l'agent Mon Rempart
+// Expressions cron à 5 champs : minute heure jour-du-mois mois jour-de-semaine,
+// plages horaires et périodes sans sauvegarde (window.go)
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limites de chaque champ cron
+var fields = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"heure", 0, 23},
+	{"jour du mois", 1, 31},
+	{"mois", 1, 12},
+	{"jour de la semaine", 0, 7},
+}
+
+// Raccourcis acceptés
+var aliases = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+// Schedule est une expression cron analysée
+type Schedule struct {
+	expr string
+	// Valeurs autorisées de chaque champ
+	minute, hour, dom, month, dow map[int]bool
+	// Jour du mois ou de la semaine restreint (sémantique cron : si les deux
+	// le sont, l'un ou l'autre suffit)
+	domRestricted, dowRestricted bool
+}
+
+// Parse analyse une expression cron (ex: "0 2 * * *", "*/15 8-18 * * 1-5", "@daily")
+func Parse(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	normalized := expr
+	if alias, ok := aliases[expr]; ok {
+		normalized = alias
+	}
+
+	parts := strings.Fields(normalized)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("expression cron à 5 champs attendue: %q", expr)
+	}
+
+	s := &Schedule{expr: expr}
+	sets := make([]map[int]bool, len(fields))
+	for i, part := range parts {
+		set, err := parseField(part, fields[i].min, fields[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("%s %q: %w", fields[i].name, part, err)
+		}
+		sets[i] = set
+	}
+	s.minute, s.hour, s.dom, s.month, s.dow = sets[0], sets[1], sets[2], sets[3], sets[4]
+	// 7 = dimanche, comme 0
+	if s.dow[7] {
+		s.dow[0] = true
+	}
+	s.domRestricted = parts[2] != "*"
+	s.dowRestricted = parts[4] != "*"
+	return s, nil
+}
+
+// parseField analyse un champ : *, valeur, plage a-b, pas */n ou a-b/n, listes séparées par des virgules
+func parseField(field string, min, max int) (map[int]bool, error) {
+	set := make(map[int]bool)
+	for _, item := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("pas invalide")
+			}
+			step = n
+		}
+
+		lo, hi := min, max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			a, b, _ := strings.Cut(rangePart, "-")
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(a)
+			hi, err2 = strconv.Atoi(b)
+			if err1 != nil || err2 != nil || lo > hi {
+				return nil, fmt.Errorf("plage invalide")
+			}
+		default:
+			n, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return nil, fmt.Errorf("valeur invalide")
+			}
+			lo = n
+			if !hasStep {
+				hi = n
+			}
+		}
+		if lo < min || hi > max {
+			return nil, fmt.Errorf("hors limites (%d-%d)", min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+// String retourne l'expression d'origine
+func (s *Schedule) String() string {
+	return s.expr
+}
+
+// Matches indique si la minute de t correspond à l'expression
+func (s *Schedule) Matches(t time.Time) bool {
+	return s.minute[t.Minute()] && s.hour[t.Hour()] && s.month[int(t.Month())] && s.dayMatches(t)
+}
+
+// Next retourne la prochaine échéance strictement après t (zéro si aucune
+// dans les cinq ans, ex: 31 février)
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = startOfMinute(t).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !s.month[int(t.Month())]:
+			// Premier jour du mois suivant
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !s.hour[t.Hour()]:
+			t = startOfHour(t).Add(time.Hour)
+		case !s.minute[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Prev retourne la dernière échéance au plus tard à t (zéro si aucune dans les cinq ans)
+func (s *Schedule) Prev(t time.Time) time.Time {
+	t = startOfMinute(t)
+	limit := t.AddDate(-5, 0, 0)
+	for t.After(limit) {
+		switch {
+		case !s.month[int(t.Month())]:
+			// Dernière minute du mois précédent
+			t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location()).Add(-time.Minute)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()).Add(-time.Minute)
+		case !s.hour[t.Hour()]:
+			t = startOfHour(t).Add(-time.Minute)
+		case !s.minute[t.Minute()]:
+			t = t.Add(-time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches applique la règle cron jour du mois / jour de la semaine
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom, dow := s.dom[t.Day()], s.dow[int(t.Weekday())]
+	if s.domRestricted && s.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// startOfMinute et startOfHour arrondissent dans le fuseau de t (Truncate
+// travaille en temps absolu, faux pour les fuseaux décalés d'une demi-heure)
+func startOfMinute(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, t.Location())
+}
+
+func startOfHour(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+}
@@ -0,0 +1,137 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+// at retourne une date UTC ; le 19/10/2026 est un lundi
+func at(year int, month time.Month, day, hour, minute int) time.Time {
+	return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"0 2 * *",
+		"0 2 * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"@yearly",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q): erreur attendue", expr)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	monday := at(2026, 10, 19, 2, 0)
+	tests := []struct {
+		expr string
+		t    time.Time
+		want bool
+	}{
+		{"0 2 * * *", monday, true},
+		{"0 2 * * *", monday.Add(time.Minute), false},
+		{"@daily", at(2026, 10, 19, 0, 0), true},
+		{"@hourly", at(2026, 10, 19, 13, 0), true},
+		{"*/15 8-18 * * 1-5", at(2026, 10, 19, 8, 45), true},
+		{"*/15 8-18 * * 1-5", at(2026, 10, 19, 8, 50), false},
+		{"*/15 8-18 * * 1-5", at(2026, 10, 24, 9, 0), false}, // samedi
+		{"0 9 * * 7", at(2026, 10, 25, 9, 0), true},          // 7 = dimanche
+		{"0 9 * * 0", at(2026, 10, 25, 9, 0), true},
+		{"0 0 1,15 * *", at(2026, 10, 15, 0, 0), true},
+		{"0 0 10-20/5 * *", at(2026, 10, 15, 0, 0), true},
+		{"0 0 10-20/5 * *", at(2026, 10, 16, 0, 0), false},
+		{"5/20 * * * *", at(2026, 10, 19, 3, 45), true},
+		{"0 0 * 11 *", monday, false},
+		// Jour du mois et jour de la semaine restreints : l'un ou l'autre suffit
+		{"0 0 1 * 1", at(2026, 10, 19, 0, 0), true},
+		{"0 0 1 * 1", at(2026, 10, 1, 0, 0), true},
+		{"0 0 1 * 1", at(2026, 10, 20, 0, 0), false},
+		// Un seul restreint : il doit correspondre
+		{"0 0 1 * *", at(2026, 10, 19, 0, 0), false},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.expr, err)
+		}
+		if got := s.Matches(tt.t); got != tt.want {
+			t.Errorf("%q.Matches(%s) = %v, attendu %v", tt.expr, tt.t.Format("Mon 02/01 15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestNextPrev(t *testing.T) {
+	tests := []struct {
+		expr       string
+		t          time.Time
+		next, prev time.Time
+	}{
+		{"0 2 * * *", at(2026, 10, 19, 2, 0), at(2026, 10, 20, 2, 0), at(2026, 10, 19, 2, 0)},
+		{"0 2 * * *", at(2026, 10, 19, 1, 59), at(2026, 10, 19, 2, 0), at(2026, 10, 18, 2, 0)},
+		{"*/15 8-18 * * 1-5", at(2026, 10, 23, 18, 50), at(2026, 10, 26, 8, 0), at(2026, 10, 23, 18, 45)},
+		{"0 0 1 * *", at(2026, 12, 15, 12, 0), at(2027, 1, 1, 0, 0), at(2026, 12, 1, 0, 0)},
+		{"30 23 31 * *", at(2026, 11, 1, 0, 0), at(2026, 12, 31, 23, 30), at(2026, 10, 31, 23, 30)},
+		{"0 12 29 2 *", at(2026, 3, 1, 0, 0), at(2028, 2, 29, 12, 0), at(2024, 2, 29, 12, 0)},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.expr, err)
+		}
+		if got := s.Next(tt.t); !got.Equal(tt.next) {
+			t.Errorf("%q.Next(%s) = %s, attendu %s", tt.expr, tt.t, got, tt.next)
+		}
+		if got := s.Prev(tt.t); !got.Equal(tt.prev) {
+			t.Errorf("%q.Prev(%s) = %s, attendu %s", tt.expr, tt.t, got, tt.prev)
+		}
+	}
+}
+
+func TestNextSecondsAndImpossible(t *testing.T) {
+	s, _ := Parse("0 2 * * *")
+	// Strictement après t, même à quelques secondes de l'échéance
+	if got, want := s.Next(at(2026, 10, 19, 2, 0).Add(30*time.Second)), at(2026, 10, 20, 2, 0); !got.Equal(want) {
+		t.Errorf("Next = %s, attendu %s", got, want)
+	}
+
+	never, err := Parse("0 0 31 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := never.Next(at(2026, 1, 1, 0, 0)); !got.IsZero() {
+		t.Errorf("31 février: Next = %s, attendu zéro", got)
+	}
+	if got := never.Prev(at(2026, 1, 1, 0, 0)); !got.IsZero() {
+		t.Errorf("31 février: Prev = %s, attendu zéro", got)
+	}
+}
+
+func TestNextHalfHourZone(t *testing.T) {
+	// Fuseau décalé d'une demi-heure : les échéances restent à l'heure locale
+	india := time.FixedZone("IST", 5*3600+1800)
+	s, _ := Parse("0 * * * *")
+	from := time.Date(2026, 10, 19, 10, 10, 0, 0, india)
+	if got, want := s.Next(from), time.Date(2026, 10, 19, 11, 0, 0, 0, india); !got.Equal(want) {
+		t.Errorf("Next = %s, attendu %s", got, want)
+	}
+	if got, want := s.Prev(from), time.Date(2026, 10, 19, 10, 0, 0, 0, india); !got.Equal(want) {
+		t.Errorf("Prev = %s, attendu %s", got, want)
+	}
+}
+
+func TestString(t *testing.T) {
+	s, _ := Parse("  @weekly ")
+	if s.String() != "@weekly" {
+		t.Errorf("String() = %q", s.String())
+	}
+}
@@ -0,0 +1,230 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Jours de la semaine acceptés dans les plages (français ou anglais)
+var weekdays = map[string]time.Weekday{
+	"dim": time.Sunday, "lun": time.Monday, "mar": time.Tuesday, "mer": time.Wednesday,
+	"jeu": time.Thursday, "ven": time.Friday, "sam": time.Saturday,
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Window est une plage horaire autorisée, éventuellement limitée à certains
+// jours : "22:00-06:00", "lun-ven 12:00-14:00", "sam,dim". Une plage qui
+// passe minuit appartient au jour où elle commence.
+type Window struct {
+	expr string
+	days map[time.Weekday]bool // nil : tous les jours
+	// Minutes depuis minuit ; start == end : toute la journée
+	start, end int
+}
+
+// ParseWindow analyse une plage horaire
+func ParseWindow(expr string) (*Window, error) {
+	w := &Window{expr: strings.TrimSpace(expr)}
+	parts := strings.Fields(w.expr)
+	if len(parts) == 0 || len(parts) > 2 {
+		return nil, fmt.Errorf("plage attendue (ex: \"22:00-06:00\", \"lun-ven 12:00-14:00\"): %q", expr)
+	}
+
+	if !strings.Contains(parts[0], ":") {
+		days, err := parseDays(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", expr, err)
+		}
+		w.days = days
+		parts = parts[1:]
+	}
+	if len(parts) == 0 {
+		return w, nil
+	}
+	if len(parts) > 1 {
+		return nil, fmt.Errorf("%q: jours puis horaires attendus", expr)
+	}
+
+	from, to, ok := strings.Cut(parts[0], "-")
+	if !ok {
+		return nil, fmt.Errorf("%q: horaires début-fin attendus (ex: 22:00-06:00)", expr)
+	}
+	var err error
+	if w.start, err = parseClock(from); err != nil {
+		return nil, fmt.Errorf("%q: %w", expr, err)
+	}
+	if w.end, err = parseClock(to); err != nil {
+		return nil, fmt.Errorf("%q: %w", expr, err)
+	}
+	if w.start == 24*60 {
+		return nil, fmt.Errorf("%q: début 24:00 invalide", expr)
+	}
+	if w.end == 24*60 {
+		w.end = 0
+	}
+	return w, nil
+}
+
+// String retourne l'expression d'origine
+func (w *Window) String() string {
+	return w.expr
+}
+
+// Contains indique si t est dans la plage
+func (w *Window) Contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	switch {
+	case w.start == w.end:
+		return w.day(t.Weekday())
+	case w.start < w.end:
+		return minute >= w.start && minute < w.end && w.day(t.Weekday())
+	case minute >= w.start:
+		return w.day(t.Weekday())
+	case minute < w.end:
+		// Après minuit : plage commencée la veille
+		return w.day((t.Weekday() + 6) % 7)
+	}
+	return false
+}
+
+// day indique si la plage s'applique au jour d
+func (w *Window) day(d time.Weekday) bool {
+	return w.days == nil || w.days[d]
+}
+
+// parseDays analyse "lun-ven", "sam,dim" ou "lun,mer-ven"
+func parseDays(spec string) (map[time.Weekday]bool, error) {
+	days := make(map[time.Weekday]bool)
+	for _, item := range strings.Split(strings.ToLower(spec), ",") {
+		from, to, isRange := strings.Cut(item, "-")
+		first, ok := weekdays[from]
+		if !ok {
+			return nil, fmt.Errorf("jour inconnu %q (lun, mar, mer, jeu, ven, sam, dim)", from)
+		}
+		last := first
+		if isRange {
+			if last, ok = weekdays[to]; !ok {
+				return nil, fmt.Errorf("jour inconnu %q (lun, mar, mer, jeu, ven, sam, dim)", to)
+			}
+		}
+		// lun-dim, ven-lun : la semaine est parcourue dans l'ordre
+		for d := first; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// parseClock analyse "HH:MM" (00:00 à 24:00) en minutes depuis minuit
+func parseClock(s string) (int, error) {
+	h, m, ok := strings.Cut(s, ":")
+	hour, errH := strconv.Atoi(h)
+	minute, errM := strconv.Atoi(m)
+	if !ok || errH != nil || errM != nil || hour < 0 || hour > 24 || minute < 0 || minute > 59 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("heure invalide %q (HH:MM)", s)
+	}
+	return hour*60 + minute, nil
+}
+
+// Blackout est une période sans sauvegarde automatique, en jours entiers :
+// "2027-03-14" ou "2027-03-14/2027-03-21" (bornes incluses)
+type Blackout struct {
+	expr     string
+	from, to string // AAAA-MM-JJ, comparées dans le fuseau local
+}
+
+// ParseBlackout analyse une date ou une période
+func ParseBlackout(expr string) (Blackout, error) {
+	b := Blackout{expr: strings.TrimSpace(expr)}
+	from, to, isRange := strings.Cut(b.expr, "/")
+	if !isRange {
+		to = from
+	}
+	for _, date := range []string{from, to} {
+		if _, err := time.Parse(time.DateOnly, date); err != nil {
+			return Blackout{}, fmt.Errorf("date attendue AAAA-MM-JJ ou AAAA-MM-JJ/AAAA-MM-JJ: %q", expr)
+		}
+	}
+	if to < from {
+		return Blackout{}, fmt.Errorf("%q: fin avant le début", expr)
+	}
+	b.from, b.to = from, to
+	return b, nil
+}
+
+// String retourne l'expression d'origine
+func (b Blackout) String() string {
+	return b.expr
+}
+
+// Contains indique si le jour de t est dans la période
+func (b Blackout) Contains(t time.Time) bool {
+	day := t.Format(time.DateOnly)
+	return day >= b.from && day <= b.to
+}
+
+// Windows regroupe les plages autorisées et les périodes exclues des
+// sauvegardes automatiques
+type Windows struct {
+	windows   []*Window
+	blackouts []Blackout
+}
+
+// ParseWindows analyse les plages (vide : à toute heure) et les périodes exclues
+func ParseWindows(windows, blackouts []string) (*Windows, error) {
+	w := &Windows{}
+	for _, expr := range windows {
+		window, err := ParseWindow(expr)
+		if err != nil {
+			return nil, err
+		}
+		w.windows = append(w.windows, window)
+	}
+	for _, expr := range blackouts {
+		blackout, err := ParseBlackout(expr)
+		if err != nil {
+			return nil, err
+		}
+		w.blackouts = append(w.blackouts, blackout)
+	}
+	return w, nil
+}
+
+// Allows indique si une sauvegarde automatique peut s'exécuter à t ; sinon,
+// reason explique pourquoi
+func (w *Windows) Allows(t time.Time) (ok bool, reason string) {
+	for _, b := range w.blackouts {
+		if b.Contains(t) {
+			return false, fmt.Sprintf("période sans sauvegarde (%s)", b)
+		}
+	}
+	if len(w.windows) == 0 {
+		return true, ""
+	}
+	names := make([]string, len(w.windows))
+	for i, window := range w.windows {
+		if window.Contains(t) {
+			return true, ""
+		}
+		names[i] = window.String()
+	}
+	return false, fmt.Sprintf("hors des plages de sauvegarde (%s)", strings.Join(names, ", "))
+}
+
+// NextAllowed retourne la prochaine minute autorisée au plus tôt à t (zéro
+// si aucune dans l'année)
+func (w *Windows) NextAllowed(t time.Time) time.Time {
+	t = startOfMinute(t)
+	for limit := t.AddDate(1, 0, 0); t.Before(limit); t = t.Add(time.Minute) {
+		if ok, _ := w.Allows(t); ok {
+			return t
+		}
+	}
+	return time.Time{}
+}
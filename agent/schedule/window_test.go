@@ -0,0 +1,139 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseWindowInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"22:00",
+		"lun-ven 12:00-14:00 extra",
+		"lundi 12:00-14:00",
+		"lun-xyz",
+		"25:00-06:00",
+		"22:60-06:00",
+		"24:00-06:00",
+		"22:00-24:30",
+		"lun 12:00-14:00 mar",
+	} {
+		if _, err := ParseWindow(expr); err == nil {
+			t.Errorf("ParseWindow(%q): erreur attendue", expr)
+		}
+	}
+}
+
+func TestWindowContains(t *testing.T) {
+	tests := []struct {
+		expr string
+		t    time.Time
+		want bool
+	}{
+		{"12:00-14:00", at(2026, 10, 19, 12, 0), true},
+		{"12:00-14:00", at(2026, 10, 19, 14, 0), false},
+		{"12:00-14:00", at(2026, 10, 19, 11, 59), false},
+		{"22:00-06:00", at(2026, 10, 19, 23, 30), true},
+		{"22:00-06:00", at(2026, 10, 19, 5, 59), true},
+		{"22:00-06:00", at(2026, 10, 19, 6, 0), false},
+		{"20:00-24:00", at(2026, 10, 19, 23, 59), true},
+		{"lun-ven 12:00-14:00", at(2026, 10, 19, 13, 0), true},
+		{"lun-ven 12:00-14:00", at(2026, 10, 24, 13, 0), false},
+		{"sam,dim", at(2026, 10, 25, 3, 0), true},
+		{"sat,sun", at(2026, 10, 19, 3, 0), false},
+		{"ven-lun", at(2026, 10, 25, 3, 0), true},
+		{"ven-lun", at(2026, 10, 21, 3, 0), false},
+		// Plage passant minuit : rattachée au jour où elle commence
+		{"ven 22:00-06:00", at(2026, 10, 24, 2, 0), true},
+		{"ven 22:00-06:00", at(2026, 10, 23, 2, 0), false},
+		{"lun,mer-ven 00:00-00:00", at(2026, 10, 22, 8, 0), true},
+		{"lun,mer-ven 00:00-00:00", at(2026, 10, 20, 8, 0), false},
+	}
+	for _, tt := range tests {
+		w, err := ParseWindow(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseWindow(%q): %v", tt.expr, err)
+		}
+		if got := w.Contains(tt.t); got != tt.want {
+			t.Errorf("%q.Contains(%s) = %v, attendu %v", tt.expr, tt.t.Format("Mon 02/01 15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestParseBlackout(t *testing.T) {
+	for _, expr := range []string{"2027-03-14", "2027-03-14/2027-03-21", " 2027-03-14/2027-03-14 "} {
+		if _, err := ParseBlackout(expr); err != nil {
+			t.Errorf("ParseBlackout(%q): %v", expr, err)
+		}
+	}
+	for _, expr := range []string{"", "14/03/2027", "2027-03-21/2027-03-14", "2027-02-30", "2027-03-14/"} {
+		if _, err := ParseBlackout(expr); err == nil {
+			t.Errorf("ParseBlackout(%q): erreur attendue", expr)
+		}
+	}
+
+	b, _ := ParseBlackout("2027-03-14/2027-03-21")
+	for day, want := range map[int]bool{13: false, 14: true, 21: true, 22: false} {
+		if got := b.Contains(at(2027, 3, day, 23, 59)); got != want {
+			t.Errorf("Contains(%d/03) = %v, attendu %v", day, got, want)
+		}
+	}
+}
+
+func TestWindowsAllows(t *testing.T) {
+	w, err := ParseWindows([]string{"lun-ven 22:00-06:00", "sam,dim"}, []string{"2026-10-31/2026-11-01"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		t      time.Time
+		want   bool
+		reason string
+	}{
+		{at(2026, 10, 19, 23, 0), true, ""},
+		{at(2026, 10, 19, 12, 0), false, "hors des plages de sauvegarde (lun-ven 22:00-06:00, sam,dim)"},
+		{at(2026, 10, 24, 12, 0), true, ""},
+		{at(2026, 10, 31, 12, 0), false, "période sans sauvegarde (2026-10-31/2026-11-01)"},
+	}
+	for _, tt := range tests {
+		ok, reason := w.Allows(tt.t)
+		if ok != tt.want || reason != tt.reason {
+			t.Errorf("Allows(%s) = %v, %q ; attendu %v, %q", tt.t.Format("Mon 02/01 15:04"), ok, reason, tt.want, tt.reason)
+		}
+	}
+
+	if _, err := ParseWindows([]string{"12:00"}, nil); err == nil {
+		t.Error("plage invalide acceptée")
+	}
+	if _, err := ParseWindows(nil, []string{"demain"}); err == nil {
+		t.Error("période invalide acceptée")
+	}
+	empty, _ := ParseWindows(nil, nil)
+	if ok, _ := empty.Allows(at(2026, 10, 19, 12, 0)); !ok {
+		t.Error("sans plage : sauvegarde refusée")
+	}
+}
+
+func TestWindowsNextAllowed(t *testing.T) {
+	w, _ := ParseWindows([]string{"lun-ven 22:00-06:00"}, []string{"2026-10-20"})
+	tests := []struct {
+		from, want time.Time
+	}{
+		{at(2026, 10, 19, 12, 0), at(2026, 10, 19, 22, 0)},
+		{at(2026, 10, 19, 23, 0).Add(30 * time.Second), at(2026, 10, 19, 23, 0)},
+		// Le 20 est exclu, y compris la fin de la plage commencée la veille
+		{at(2026, 10, 20, 1, 0), at(2026, 10, 21, 0, 0)},
+		// Vendredi soir jusqu'à samedi 06:00, puis lundi soir
+		{at(2026, 10, 24, 6, 0), at(2026, 10, 26, 22, 0)},
+	}
+	for _, tt := range tests {
+		if got := w.NextAllowed(tt.from); !got.Equal(tt.want) {
+			t.Errorf("NextAllowed(%s) = %s, attendu %s", tt.from.Format("Mon 02/01 15:04"), got.Format("Mon 02/01 15:04"), tt.want.Format("Mon 02/01 15:04"))
+		}
+	}
+
+	never, _ := ParseWindows(nil, []string{"2026-01-01/2027-12-31"})
+	if got := never.NextAllowed(at(2026, 10, 19, 12, 0)); !got.IsZero() {
+		t.Errorf("NextAllowed = %s, attendu zéro", got)
+	}
+}
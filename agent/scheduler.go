@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/mon-rempart/agent/schedule"
+)
+
+// Une seule sauvegarde de fichiers à la fois (initiale, planifiée, rattrapage...)
+var backupRunning atomic.Bool
+
+// Délai avant le rattrapage d'une échéance manquée, après le démarrage ou la
+// sortie de veille (réseau, session...), et entre deux tentatives de rattrapage
+const (
+	catchUpDelay = 2 * time.Minute
+	catchUpRetry = 15 * time.Minute
+)
+
+// Écart d'horloge entre deux réveils de la boucle au-delà duquel le poste
+// sortait de veille : l'horloge monotone s'arrête pendant la veille
+const resumeGap = 3 * time.Minute
+
+// scheduleLoop lance les sauvegardes selon l'expression cron en vigueur,
+// relue à chaque minute : un changement de politique s'applique sans redémarrage.
+// Une échéance manquée (poste éteint, en veille, hors plage) est rattrapée peu
+// après le démarrage ou la sortie de veille, ou à l'ouverture de la plage.
+// Chaque agent décale ses sauvegardes d'un délai qui lui est propre
+// (schedule_jitter_minutes). Une sauvegarde due sur un poste chargé, au
+// processeur occupé ou sur batterie est reportée de minute en minute, au plus
+// de resources.max_defer_minutes.
+func scheduleLoop() {
+	var current string
+	// Échéance de la sauvegarde reportée (zéro : aucune) et son origine
+	var pending time.Time
+	var pendingTrigger string
+	// Lancement de la sauvegarde en attente, décalé selon l'agent
+	var launchAt time.Time
+	// Rattrapage possible à partir de catchUpAt ; immédiat sans aucune sauvegarde
+	catchUpAt := time.Now().Add(catchUpDelay)
+	if loadBackupHistory().LastAttempt.IsZero() {
+		catchUpAt = time.Now()
+	}
+	var launched time.Time
+	lastWake := time.Now()
+	for {
+		now := time.Now()
+		time.Sleep(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+		now = time.Now()
+
+		// Comparaison des horloges murales (Round(0) retire l'horloge monotone)
+		if gap := now.Round(0).Sub(lastWake.Round(0)); gap > resumeGap {
+			slog.Info("💤 Sortie de veille détectée", "asleep", gap.Round(time.Minute))
+			catchUpAt = now.Add(catchUpDelay)
+		}
+		lastWake = now
+
+		// Un seul instantané de la configuration par tour
+		cfg := currentConfig()
+		expr := cfg.BackupSchedule
+		s, err := schedule.Parse(expr)
+		if err != nil {
+			if expr != current {
+				slog.Error("❌ Planification invalide - sauvegardes planifiées suspendues", "schedule", expr, "error", err)
+				current = expr
+			}
+			continue
+		}
+		if expr != current {
+			slog.Info("⏰ Planification des sauvegardes", "schedule", expr, "next", s.Next(now).Format("02/01/2006 15:04"))
+			current = expr
+		}
+
+		due := s.Matches(now)
+		trigger := "planifiée"
+		switch {
+		case !pending.IsZero():
+			trigger = pendingTrigger
+		case due:
+		case !now.Before(catchUpAt) && now.Sub(launched) >= catchUpRetry:
+			if trigger = missedRun(s, now); trigger == "" {
+				continue
+			}
+		default:
+			continue
+		}
+
+		if ok, reason := backupWindows().Allows(now); !ok {
+			if due {
+				slog.Info("🕒 Sauvegarde planifiée hors plage - rattrapée à l'ouverture",
+					"reason", reason, "next", formatNext(backupWindows().NextAllowed(now)))
+			}
+			pending = time.Time{}
+			cancelDeferral()
+			continue
+		}
+		if reason := backupPausedReason(); reason != "" {
+			if due {
+				slog.Warn("⏸️  Sauvegarde planifiée suspendue", "reason", reason)
+			}
+			pending = time.Time{}
+			cancelDeferral()
+			continue
+		}
+		if pending.IsZero() {
+			pending, pendingTrigger = now, trigger
+			launchAt = now.Add(scheduleJitter(s, now, trigger))
+			if trigger == "rattrapage" {
+				reportCatchUp(s, now)
+			}
+			if launchAt.After(now) {
+				slog.Info("⏱️  Sauvegarde décalée (créneau propre à l'agent)", "trigger", trigger, "at", launchAt.Format("15:04:05"))
+			}
+		}
+		// Minute du lancement pas encore atteinte
+		if launchAt.Sub(now) >= time.Minute {
+			continue
+		}
+
+		sample, reasons := busyReasons()
+		forced := len(reasons) > 0
+		// Report compté depuis le créneau de l'agent : le décalage n'entame pas
+		// max_defer_minutes
+		if forced && now.Sub(launchAt) < time.Duration(cfg.Resources.MaxDeferMinutes)*time.Minute {
+			deferScheduledBackup(launchAt, sample, reasons)
+			continue
+		}
+		pending, launched = time.Time{}, now
+		endDeferral(forced)
+		go func(trigger string, delay time.Duration) {
+			time.Sleep(delay)
+			runBackupJob(trigger)
+		}(trigger, time.Until(launchAt))
+	}
+}
+
+// scheduleJitter retourne le décalage de la sauvegarde, propre à l'agent :
+// au plus schedule_jitter_minutes et la moitié de l'intervalle entre deux
+// échéances. La toute première sauvegarde n'est pas décalée.
+func scheduleJitter(s *schedule.Schedule, now time.Time, trigger string) time.Duration {
+	if trigger == "initiale" {
+		return 0
+	}
+	limit := time.Duration(currentConfig().ScheduleJitterMinutes) * time.Minute
+	if next := s.Next(now); !next.IsZero() {
+		limit = min(limit, next.Sub(s.Prev(now))/2)
+	}
+	return agentJitter("backup", limit)
+}
+
+// missedRun retourne l'origine de la sauvegarde à rattraper : "initiale" si
+// aucune n'a jamais été lancée, "rattrapage" si une échéance est passée
+// depuis la dernière tentative, vide sinon
+func missedRun(s *schedule.Schedule, now time.Time) string {
+	history := loadBackupHistory()
+	if history.LastAttempt.IsZero() {
+		return "initiale"
+	}
+	if missed := s.Prev(now); !missed.IsZero() && history.LastAttempt.Before(missed) {
+		return "rattrapage"
+	}
+	return ""
+}
+
+// reportCatchUp signale au Dashboard le rattrapage d'une échéance manquée
+func reportCatchUp(s *schedule.Schedule, now time.Time) {
+	history := loadBackupHistory()
+	missed := s.Prev(now)
+	slog.Info("🔁 Échéance manquée - sauvegarde de rattrapage",
+		"missed", missed.Format("02/01/2006 15:04"),
+		"last_attempt", history.LastAttempt.Local().Format("02/01/2006 15:04"),
+	)
+	go sendActivityLog("info", "Sauvegarde de rattrapage : échéance du "+missed.Format("02/01/2006 15:04")+" manquée", map[string]interface{}{
+		"missed":       missed,
+		"last_attempt": history.LastAttempt,
+		"last_success": history.LastSuccess,
+	})
+}
+
+// backupWindows retourne les plages et périodes exclues en vigueur
+// (configuration validée : une erreur laisse les sauvegardes à toute heure)
+func backupWindows() *schedule.Windows {
+	cfg := currentConfig()
+	windows, err := schedule.ParseWindows(cfg.BackupWindows, cfg.BlackoutDates)
+	if err != nil {
+		return &schedule.Windows{}
+	}
+	return windows
+}
+
+// formatNext formate une échéance (vide : aucune dans l'année)
+func formatNext(t time.Time) string {
+	if t.IsZero() {
+		return "aucune dans l'année"
+	}
+	return t.Format("02/01/2006 15:04")
+}
+
+// backupPausedReason retourne la raison de la suspension des sauvegardes
+// automatiques, vide si elles peuvent s'exécuter. Une sauvegarde demandée
+// depuis le Dashboard ou la ligne de commande n'est pas concernée.
+func backupPausedReason() string {
+	if t := canaryTriggered(); t != nil {
+		return fmt.Sprintf("fichier témoin %s (%s) le %s", t.Reason, t.Path, t.Time.Local().Format("02/01/2006 15:04"))
+	}
+	if ok, reason := backupWindows().Allows(time.Now()); !ok {
+		return reason
+	}
+	return ""
+}
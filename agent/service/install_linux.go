@@ -0,0 +1,252 @@
+//go:build linux
+
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Install installe l'agent comme service systemd puis l'active et le démarre
+func Install(opts Options) error {
+	opts = opts.withDefaults()
+
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("l'installation du service nécessite les droits root (sudo)")
+	}
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		return fmt.Errorf("systemctl introuvable: %w", err)
+	}
+
+	unit, err := UnitFile(opts)
+	if err != nil {
+		return err
+	}
+
+	// 1. Copie du binaire courant
+	if err := installBinary(opts.BinaryPath); err != nil {
+		return err
+	}
+
+	// 2. Utilisateur système dédié
+	if err := ensureUser(opts.User, opts.StateDir); err != nil {
+		return err
+	}
+
+	// 3. Dossier d'état appartenant à l'utilisateur dédié
+	if err := os.MkdirAll(opts.StateDir, 0700); err != nil {
+		return fmt.Errorf("création de %s: %w", opts.StateDir, err)
+	}
+	if err := run("chown", "-R", opts.User+":"+opts.User, opts.StateDir); err != nil {
+		return err
+	}
+
+	// Fichiers témoins déposés avant le démarrage : réécrits par l'utilisateur dédié
+	if len(opts.CanaryFiles) > 0 {
+		if err := run("chown", append([]string{opts.User + ":" + opts.User}, opts.CanaryFiles...)...); err != nil {
+			return err
+		}
+	}
+
+	// 4. Fichier d'environnement (conservé s'il existe déjà)
+	if err := writeEnvFile(opts.EnvFile, opts.Environment); err != nil {
+		return err
+	}
+
+	// 5. Unité systemd
+	if err := os.WriteFile(UnitPath, []byte(unit), 0644); err != nil {
+		return fmt.Errorf("écriture de l'unité: %w", err)
+	}
+	slog.Info("📝 Unité systemd écrite", "path", UnitPath)
+
+	// 6. Activation et démarrage
+	if err := run("systemctl", "daemon-reload"); err != nil {
+		return err
+	}
+	if err := run("systemctl", "enable", "--now", UnitName); err != nil {
+		return err
+	}
+
+	slog.Info("✅ Service installé et démarré", "unit", UnitName)
+	return nil
+}
+
+// Uninstall arrête et désactive le service puis supprime l'unité et le binaire.
+// Avec purge, le fichier d'environnement, le dossier d'état et l'utilisateur sont aussi supprimés.
+func Uninstall(opts Options, purge bool) error {
+	opts = opts.withDefaults()
+
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("la désinstallation du service nécessite les droits root (sudo)")
+	}
+
+	if _, err := os.Stat(UnitPath); err == nil {
+		// L'unité peut déjà être arrêtée : on ne bloque pas sur cette étape
+		if err := run("systemctl", "disable", "--now", UnitName); err != nil {
+			slog.Warn("⚠️  Arrêt du service", "error", err)
+		}
+		if err := os.Remove(UnitPath); err != nil {
+			return fmt.Errorf("suppression de l'unité: %w", err)
+		}
+		if err := run("systemctl", "daemon-reload"); err != nil {
+			return err
+		}
+		slog.Info("🗑️  Unité systemd supprimée", "path", UnitPath)
+	} else {
+		slog.Info("ℹ️  Aucune unité installée", "path", UnitPath)
+	}
+
+	if err := os.Remove(opts.BinaryPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("suppression du binaire: %w", err)
+	}
+
+	if !purge {
+		slog.Info("ℹ️  Configuration et données conservées",
+			"env_file", opts.EnvFile,
+			"state_dir", opts.StateDir,
+		)
+		return nil
+	}
+
+	if err := os.Remove(opts.EnvFile); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("suppression de %s: %w", opts.EnvFile, err)
+	}
+	// Le dossier parent n'est supprimé que s'il est vide
+	os.Remove(filepath.Dir(opts.EnvFile))
+	if err := os.RemoveAll(opts.StateDir); err != nil {
+		return fmt.Errorf("suppression de %s: %w", opts.StateDir, err)
+	}
+	if exec.Command("id", "-u", opts.User).Run() == nil {
+		if err := run("userdel", opts.User); err != nil {
+			return err
+		}
+	}
+
+	slog.Info("🧹 Configuration, données et utilisateur supprimés")
+	return nil
+}
+
+// Query retourne l'état courant du service
+func Query() (*State, error) {
+	state := &State{UnitPath: UnitPath}
+
+	if _, err := os.Stat(UnitPath); err == nil {
+		state.Installed = true
+	}
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		return state, fmt.Errorf("systemctl introuvable: %w", err)
+	}
+
+	// is-enabled / is-active retournent un code non nul quand le service est inactif :
+	// seule la sortie nous intéresse
+	out, _ := exec.Command("systemctl", "is-enabled", UnitName).Output()
+	state.Enabled = strings.TrimSpace(string(out))
+	out, _ = exec.Command("systemctl", "is-active", UnitName).Output()
+	state.Active = strings.TrimSpace(string(out))
+
+	return state, nil
+}
+
+// installBinary copie l'exécutable courant vers dest
+func installBinary(dest string) error {
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("localisation du binaire: %w", err)
+	}
+	self, _ = filepath.EvalSymlinks(self)
+
+	if resolved, err := filepath.EvalSymlinks(dest); err == nil && resolved == self {
+		return nil
+	}
+
+	src, err := os.Open(self)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	// Écriture dans un fichier temporaire puis renommage (binaire en cours d'exécution)
+	tmp := dest + ".new"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return fmt.Errorf("copie du binaire: %w", err)
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("copie du binaire: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("copie du binaire: %w", err)
+	}
+
+	slog.Info("📦 Binaire installé", "path", dest)
+	return nil
+}
+
+// ensureUser crée l'utilisateur système dédié s'il n'existe pas
+func ensureUser(user, home string) error {
+	if exec.Command("id", "-u", user).Run() == nil {
+		return nil
+	}
+
+	nologin := "/usr/sbin/nologin"
+	if _, err := os.Stat(nologin); err != nil {
+		nologin = "/bin/false"
+	}
+
+	if err := run("useradd", "--system", "--user-group",
+		"--home-dir", home, "--no-create-home",
+		"--shell", nologin, user); err != nil {
+		return err
+	}
+
+	slog.Info("👤 Utilisateur système créé", "user", user)
+	return nil
+}
+
+// writeEnvFile écrit le fichier d'environnement en 0600 s'il n'existe pas
+func writeEnvFile(path string, env map[string]string) error {
+	if _, err := os.Stat(path); err == nil {
+		slog.Info("ℹ️  Fichier d'environnement existant conservé", "path", path)
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(EnvFileContent(env)), 0600); err != nil {
+		return fmt.Errorf("écriture du fichier d'environnement: %w", err)
+	}
+
+	slog.Info("🔐 Fichier d'environnement écrit", "path", path)
+	return nil
+}
+
+// run exécute une commande système et inclut sa sortie en cas d'échec
+func run(name string, args ...string) error {
+	var out bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s: %w - %s", name, strings.Join(args, " "), err, strings.TrimSpace(out.String()))
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package service
+
+// Install n'est pas supporté hors Linux
+func Install(opts Options) error {
+	return ErrUnsupported
+}
+
+// Uninstall n'est pas supporté hors Linux
+func Uninstall(opts Options, purge bool) error {
+	return ErrUnsupported
+}
+
+// Query n'est pas supporté hors Linux
+func Query() (*State, error) {
+	return nil, ErrUnsupported
+}
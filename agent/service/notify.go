@@ -0,0 +1,67 @@
+package service
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Notify envoie un état à systemd (protocole sd_notify).
+// Sans NOTIFY_SOCKET (lancement manuel, autre OS), l'appel est ignoré.
+func Notify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+
+	// Socket abstrait Linux
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// Ready signale à systemd que l'agent est démarré
+func Ready() error {
+	return Notify("READY=1")
+}
+
+// Stopping signale à systemd que l'agent s'arrête
+func Stopping() error {
+	return Notify("STOPPING=1")
+}
+
+// SetStatus publie un message d'état visible dans systemctl status
+func SetStatus(message string) error {
+	return Notify("STATUS=" + message)
+}
+
+// WatchdogPing signale à systemd que l'agent est toujours vivant
+func WatchdogPing() error {
+	return Notify("WATCHDOG=1")
+}
+
+// WatchdogInterval retourne le délai du watchdog configuré par systemd
+// (0 si le watchdog n'est pas actif pour ce processus)
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+
+	// WATCHDOG_PID, si présent, doit désigner ce processus
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+
+	return time.Duration(usec) * time.Microsecond
+}
@@ -0,0 +1,193 @@
+// Package service - Intégration de l'agent Mon Rempart au gestionnaire de services
+// Génère l'unité systemd, installe/désinstalle le service et dialogue avec systemd (sd_notify)
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const (
+	// Nom de l'unité systemd
+	UnitName = "mon-rempart-agent.service"
+
+	// Emplacement de l'unité générée
+	UnitPath = "/etc/systemd/system/" + UnitName
+
+	// Emplacement du binaire installé
+	DefaultBinaryPath = "/usr/local/bin/mon-rempart-agent"
+
+	// Fichier d'environnement (MONREMPART_*), lisible par root uniquement
+	DefaultEnvFile = "/etc/mon-rempart/agent.env"
+
+	// Utilisateur système dédié
+	DefaultUser = "monrempart"
+
+	// Dossier d'état du service (HOME de l'utilisateur dédié)
+	DefaultStateDir = "/var/lib/mon-rempart"
+
+	// Délai du watchdog systemd
+	DefaultWatchdogSec = 180
+)
+
+// ErrUnsupported est retourné sur les systèmes sans systemd
+var ErrUnsupported = errors.New("installation du service supportée uniquement sous Linux (systemd)")
+
+// Options contient les paramètres d'installation du service
+type Options struct {
+	// Binaire à exécuter par le service
+	BinaryPath string
+	// Utilisateur système dédié
+	User string
+	// Fichier d'environnement chargé par systemd
+	EnvFile string
+	// Dossier d'état (HOME, config et logs de l'agent)
+	StateDir string
+	// Répertoires sauvegardés, montés en lecture seule
+	BackupPaths []string
+	// Répertoires accessibles en écriture (destinations de restauration)
+	WritablePaths []string
+	// Fichiers témoins déposés dans les répertoires sauvegardés : seuls
+	// fichiers de ces répertoires accessibles en écriture
+	CanaryFiles []string
+	// Délai du watchdog en secondes (0 = désactivé)
+	WatchdogSec int
+	// Variables d'environnement à écrire dans le fichier d'environnement
+	Environment map[string]string
+}
+
+// State décrit l'état du service systemd
+type State struct {
+	Installed bool   `json:"installed"`
+	Enabled   string `json:"enabled"`
+	Active    string `json:"active"`
+	UnitPath  string `json:"unit_path"`
+}
+
+// withDefaults complète les options non renseignées
+func (o Options) withDefaults() Options {
+	if o.BinaryPath == "" {
+		o.BinaryPath = DefaultBinaryPath
+	}
+	if o.User == "" {
+		o.User = DefaultUser
+	}
+	if o.EnvFile == "" {
+		o.EnvFile = DefaultEnvFile
+	}
+	if o.StateDir == "" {
+		o.StateDir = DefaultStateDir
+	}
+	if o.WatchdogSec < 0 {
+		o.WatchdogSec = 0
+	}
+	return o
+}
+
+var unitTemplate = template.Must(template.New("unit").Parse(`# Généré par mon-rempart-agent install - ne pas modifier à la main
+[Unit]
+Description=Mon Rempart Agent - sauvegarde et cybersécurité
+Documentation=https://mon-rempart.fr/docs
+After=network-online.target
+Wants=network-online.target
+StartLimitIntervalSec=0
+
+[Service]
+Type=notify
+NotifyAccess=main
+ExecStart={{.BinaryPath}}
+User={{.User}}
+Group={{.User}}
+EnvironmentFile=-{{.EnvFile}}
+Environment=HOME={{.StateDir}}
+WorkingDirectory={{.StateDir}}
+Restart=on-failure
+RestartSec=30s
+TimeoutStopSec=60s
+{{- if .WatchdogSec}}
+WatchdogSec={{.WatchdogSec}}s
+{{- end}}
+
+# Lecture de tous les fichiers à sauvegarder sans être root
+AmbientCapabilities=CAP_DAC_READ_SEARCH
+CapabilityBoundingSet=CAP_DAC_READ_SEARCH
+
+# Durcissement
+NoNewPrivileges=true
+ProtectSystem=strict
+ProtectHome=read-only
+PrivateTmp=true
+PrivateDevices=true
+ProtectKernelTunables=true
+ProtectKernelModules=true
+ProtectKernelLogs=true
+ProtectControlGroups=true
+ProtectClock=true
+ProtectHostname=true
+RestrictSUIDSGID=true
+RestrictRealtime=true
+RestrictNamespaces=true
+LockPersonality=true
+RestrictAddressFamilies=AF_UNIX AF_INET AF_INET6
+UMask=0077
+ReadWritePaths={{.StateDir}}
+{{- range .WritablePaths}}
+ReadWritePaths={{.}}
+{{- end}}
+{{- range .BackupPaths}}
+ReadOnlyPaths={{.}}
+{{- end}}
+{{- range .CanaryFiles}}
+ReadWritePaths=-{{.}}
+{{- end}}
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+// UnitFile génère le contenu de l'unité systemd durcie
+func UnitFile(opts Options) (string, error) {
+	opts = opts.withDefaults()
+
+	// systemd n'accepte pas d'espaces non échappés dans ces directives
+	for _, p := range append(append(append([]string{}, opts.BackupPaths...), opts.WritablePaths...), opts.CanaryFiles...) {
+		if strings.ContainsAny(p, " \t\n") {
+			return "", fmt.Errorf("chemin avec espaces non supporté dans l'unité: %q", p)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := unitTemplate.Execute(&buf, opts); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// EnvFileContent génère le contenu du fichier d'environnement
+func EnvFileContent(env map[string]string) string {
+	var buf bytes.Buffer
+	buf.WriteString("# Configuration de l'agent Mon Rempart (chargée par systemd)\n")
+	for _, key := range sortedKeys(env) {
+		value := env[key]
+		if strings.ContainsAny(value, " \t\"'\\$") {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&buf, "%s=%s\n", key, value)
+	}
+	return buf.String()
+}
+
+// sortedKeys retourne les clés triées pour une sortie stable
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/mon-rempart/agent/config"
+)
+
+// Commandes qui écrivent sur le disque, arrêtent l'agent ou touchent aux
+// clés : exécutées seulement si signées par la clé épinglée. Un DNS détourné
+// ou un Dashboard compromis ne peut pas les forger.
+var signedCommands = map[string]bool{
+	"restore":    true,
+	"shutdown":   true,
+	"rotate_key": true,
+	// Reprend les sauvegardes suspendues par un fichier témoin
+	"reset_canaries": true,
+}
+
+// Validité maximale d'une commande signée : au-delà du journal des commandes
+// reçues, l'expiration empêche de la rejouer
+const maxSignedCommandValidity = 24 * time.Hour
+
+// Erreurs de vérification, signalées au Dashboard avec la commande refusée
+var (
+	errCommandUnsigned    = errors.New("commande sensible non signée")
+	errCommandKeyMissing  = errors.New("aucune clé de signature épinglée")
+	errCommandBadSig      = errors.New("signature invalide")
+	errCommandOtherAgent  = errors.New("commande signée pour un autre agent")
+	errCommandEnvelope    = errors.New("enveloppe signée différente de la commande")
+	errCommandNoExpiry    = errors.New("expiration absente de la commande signée")
+	errCommandLongExpiry  = fmt.Errorf("validité supérieure à %s", maxSignedCommandValidity)
+	errCommandKeyMismatch = errors.New("clé annoncée différente de la clé épinglée")
+	errCommandNoID        = errors.New("commande signée sans identifiant")
+)
+
+// commandEnvelope est le contenu signé d'une commande (JSON encodé en base64
+// dans signed_payload) ; ses champs remplacent ceux de la commande
+type commandEnvelope struct {
+	ID        string          `json:"id"`
+	AgentID   string          `json:"agent_id"`
+	Command   string          `json:"command"`
+	Params    json.RawMessage `json:"params"`
+	ExpiresAt *time.Time      `json:"expires_at"`
+}
+
+// Clé annoncée refusée ou ignorée hors enrôlement : signalée une seule fois
+var (
+	commandKeyMismatchReported bool
+	commandKeyMissingReported  bool
+)
+
+// loadCommandKey épingle au démarrage la clé fournie à l'installation
+// (command_public_key) : elle remplace une clé épinglée auparavant
+func loadCommandKey() {
+	cfg := currentConfig()
+	if cfg.CommandPublicKey == "" || agentIdentity == nil {
+		// Agent déjà enrôlé sans clé : le Dashboard ne peut plus en fournir une
+		if commandKey() == nil && (agentIdentity == nil || agentIdentity.ID() != "") {
+			slog.Warn("🔏 Aucune clé de signature des commandes - commandes sensibles désactivées",
+				"commands", "restore, shutdown, rotate_key, reset_canaries",
+				"hint", "renseigner command_public_key dans config.json")
+		}
+		return
+	}
+	key, err := config.ParseCommandKey(cfg.CommandPublicKey)
+	if err != nil {
+		slog.Error("❌ Clé de signature des commandes invalide", "error", err)
+		return
+	}
+	if pinned := agentIdentity.PinnedCommandKey(); pinned != nil && !pinned.Equal(key) {
+		slog.Warn("🔏 Clé de signature des commandes remplacée par la configuration locale")
+	}
+	if err := agentIdentity.PinCommandKey(key); err != nil {
+		slog.Warn("⚠️  Clé de signature non enregistrée", "error", err)
+	}
+}
+
+// commandKey retourne la clé de vérification des commandes (nil : aucune)
+func commandKey() ed25519.PublicKey {
+	cfg := currentConfig()
+	if cfg.CommandPublicKey != "" {
+		key, err := config.ParseCommandKey(cfg.CommandPublicKey)
+		if err != nil {
+			return nil
+		}
+		return key
+	}
+	if agentIdentity == nil {
+		return nil
+	}
+	return agentIdentity.PinnedCommandKey()
+}
+
+// pinAnnouncedCommandKey épingle la clé annoncée par le Dashboard lors du
+// premier enrôlement seulement (enrolling : aucun ID enregistré, ID attribué
+// par cette réponse). Ensuite, seule la configuration locale fournit ou
+// change la clé : un agent mis à jour sans clé n'accepte pas celle d'un
+// Dashboard usurpé (DNS détourné, déploiement compromis).
+func pinAnnouncedCommandKey(announced string, enrolling bool) {
+	if announced == "" || agentIdentity == nil {
+		return
+	}
+	key, err := config.ParseCommandKey(announced)
+	if err != nil {
+		slog.Warn("⚠️  Clé de signature annoncée invalide", "error", err)
+		return
+	}
+
+	current := commandKey()
+	switch {
+	case current == nil && !enrolling:
+		if commandKeyMissingReported {
+			return
+		}
+		commandKeyMissingReported = true
+		slog.Warn("🔏 Clé de signature annoncée hors enrôlement - ignorée, commandes sensibles désactivées",
+			"announced", keyFingerprint(key), "hint", "renseigner command_public_key dans config.json")
+		sendActivityLog("warning", "Clé de signature annoncée hors enrôlement ignorée : commandes sensibles désactivées", map[string]interface{}{
+			"announced": keyFingerprint(key),
+		})
+
+	case current == nil:
+		if err := agentIdentity.PinCommandKey(key); err != nil {
+			slog.Warn("⚠️  Clé de signature non enregistrée", "error", err)
+			return
+		}
+		slog.Info("🔏 Clé de signature des commandes épinglée", "fingerprint", keyFingerprint(key))
+		sendActivityLog("info", "Clé de signature des commandes épinglée", map[string]interface{}{
+			"fingerprint": keyFingerprint(key),
+		})
+
+	case !current.Equal(key):
+		if commandKeyMismatchReported {
+			return
+		}
+		commandKeyMismatchReported = true
+		slog.Error("🚫 Clé de signature annoncée refusée", "error", errCommandKeyMismatch,
+			"pinned", keyFingerprint(current), "announced", keyFingerprint(key))
+		sendActivityLog("error", "Clé de signature des commandes annoncée refusée", map[string]interface{}{
+			"pinned":    keyFingerprint(current),
+			"announced": keyFingerprint(key),
+		})
+
+	default:
+		commandKeyMismatchReported = false
+	}
+}
+
+// keyFingerprint retourne une empreinte courte d'une clé, pour les logs
+func keyFingerprint(key ed25519.PublicKey) string {
+	encoded := base64.StdEncoding.EncodeToString(key)
+	return encoded[:12]
+}
+
+// verifyCommand vérifie la signature d'une commande et retourne la commande
+// telle que signée. Les champs hors de l'enveloppe (restore_config...) sont
+// ignorés : ils ne sont pas couverts par la signature.
+func verifyCommand(cmd AgentCommand) (AgentCommand, error) {
+	if cmd.SignedPayload == "" && cmd.Signature == "" {
+		if signedCommands[cmd.Command] {
+			return cmd, errCommandUnsigned
+		}
+		return cmd, nil
+	}
+
+	key := commandKey()
+	if key == nil {
+		return cmd, errCommandKeyMissing
+	}
+	payload, err := base64.StdEncoding.DecodeString(cmd.SignedPayload)
+	if err != nil {
+		return cmd, fmt.Errorf("%w: enveloppe illisible", errCommandBadSig)
+	}
+	sig, err := base64.StdEncoding.DecodeString(cmd.Signature)
+	if err != nil || !ed25519.Verify(key, payload, sig) {
+		return cmd, errCommandBadSig
+	}
+
+	var env commandEnvelope
+	if err := json.Unmarshal(payload, &env); err != nil {
+		return cmd, fmt.Errorf("%w: %v", errCommandEnvelope, err)
+	}
+	switch {
+	case env.ID != cmd.ID || env.Command != cmd.Command:
+		return cmd, errCommandEnvelope
+	case env.AgentID == "" || env.AgentID != currentAgentID():
+		return cmd, errCommandOtherAgent
+	case env.ExpiresAt == nil:
+		return cmd, errCommandNoExpiry
+	case time.Until(*env.ExpiresAt) > maxSignedCommandValidity:
+		return cmd, errCommandLongExpiry
+	}
+
+	return AgentCommand{
+		ID:        env.ID,
+		Command:   env.Command,
+		Params:    env.Params,
+		ExpiresAt: env.ExpiresAt,
+	}, nil
+}
+
+// rejectCommand refuse une commande dont la signature n'est pas valide et le
+// signale : c'est peut-être une tentative d'attaque
+func rejectCommand(cmd AgentCommand, err error) {
+	slog.Error("🚫 Commande refusée", "id", cmd.ID, "command", cmd.Command, "error", err)
+	sendActivityLog("error", fmt.Sprintf("Commande %s refusée: %v", cmd.Command, err), map[string]interface{}{
+		"command_id": cmd.ID,
+		"command":    cmd.Command,
+	})
+	reportCommand(cmd, CommandRejected, nil, err)
+}
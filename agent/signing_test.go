@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mon-rempart/agent/config"
+	"github.com/mon-rempart/agent/identity"
+)
+
+// signingKey épingle une clé de test dans la configuration et retourne la clé privée
+func signingKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous, previousID := currentConfig(), currentAgentID()
+	activeConfig.Store(&config.Config{CommandPublicKey: base64.StdEncoding.EncodeToString(pub)})
+	setAgentID("agent-1")
+	t.Cleanup(func() {
+		activeConfig.Store(previous)
+		setAgentID(previousID)
+	})
+	return priv
+}
+
+// signedCommand signe l'enveloppe et retourne la commande telle que reçue
+func signedCommand(t *testing.T, key ed25519.PrivateKey, env commandEnvelope) AgentCommand {
+	t.Helper()
+	payload, err := json.Marshal(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return AgentCommand{
+		ID:            env.ID,
+		Command:       env.Command,
+		SignedPayload: base64.StdEncoding.EncodeToString(payload),
+		Signature:     base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload)),
+	}
+}
+
+func TestVerifyCommand(t *testing.T) {
+	key := signingKey(t)
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	expires := time.Now().Add(time.Hour)
+	tooLate := time.Now().Add(48 * time.Hour)
+	params := json.RawMessage(`{"snapshot_id":"abc","target_path":"/tmp/r"}`)
+	env := commandEnvelope{ID: "c1", AgentID: "agent-1", Command: "restore", Params: params, ExpiresAt: &expires}
+
+	tests := []struct {
+		name    string
+		cmd     func() AgentCommand
+		wantErr error
+	}{
+		{"signée", func() AgentCommand { return signedCommand(t, key, env) }, nil},
+		{"non sensible non signée", func() AgentCommand { return AgentCommand{ID: "c2", Command: "backup_now"} }, nil},
+		{"sensible non signée", func() AgentCommand {
+			return AgentCommand{ID: "c3", Command: "restore", Params: params}
+		}, errCommandUnsigned},
+		{"autre clé", func() AgentCommand { return signedCommand(t, otherKey, env) }, errCommandBadSig},
+		{"signature altérée", func() AgentCommand {
+			cmd := signedCommand(t, key, env)
+			cmd.Signature = base64.StdEncoding.EncodeToString(make([]byte, ed25519.SignatureSize))
+			return cmd
+		}, errCommandBadSig},
+		{"commande substituée", func() AgentCommand {
+			cmd := signedCommand(t, key, env)
+			cmd.Command = "shutdown"
+			return cmd
+		}, errCommandEnvelope},
+		{"ID substitué", func() AgentCommand {
+			cmd := signedCommand(t, key, env)
+			cmd.ID = "c9"
+			return cmd
+		}, errCommandEnvelope},
+		{"autre agent", func() AgentCommand {
+			e := env
+			e.AgentID = "agent-2"
+			return signedCommand(t, key, e)
+		}, errCommandOtherAgent},
+		{"sans expiration", func() AgentCommand {
+			e := env
+			e.ExpiresAt = nil
+			return signedCommand(t, key, e)
+		}, errCommandNoExpiry},
+		{"validité trop longue", func() AgentCommand {
+			e := env
+			e.ExpiresAt = &tooLate
+			return signedCommand(t, key, e)
+		}, errCommandLongExpiry},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := verifyCommand(tt.cmd())
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("verifyCommand() erreur = %v, attendu %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyCommandUsesSignedFields(t *testing.T) {
+	key := signingKey(t)
+	expires := time.Now().Add(time.Hour)
+	cmd := signedCommand(t, key, commandEnvelope{
+		ID:        "c1",
+		AgentID:   "agent-1",
+		Command:   "rotate_key",
+		Params:    json.RawMessage(`{"request_id":"r1","new_password":"signé"}`),
+		ExpiresAt: &expires,
+	})
+	// Champs hors enveloppe : non couverts par la signature
+	cmd.Params = json.RawMessage(`{"request_id":"r1","new_password":"forgé"}`)
+	cmd.LogLevel = "debug"
+
+	verified, err := verifyCommand(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rotation KeyRotationConfig
+	if err := verified.decodeParams(&rotation); err != nil {
+		t.Fatal(err)
+	}
+	if rotation.NewPassword != "signé" {
+		t.Errorf("new_password = %q, attendu le paramètre signé", rotation.NewPassword)
+	}
+	if verified.LogLevel != "" || verified.ExpiresAt == nil || !verified.ExpiresAt.Equal(expires) {
+		t.Errorf("commande vérifiée = %+v", verified)
+	}
+}
+
+func TestVerifyCommandWithoutKey(t *testing.T) {
+	signingKey(t)
+	activeConfig.Store(&config.Config{})
+
+	cmd := AgentCommand{ID: "c1", Command: "shutdown", SignedPayload: "e30=", Signature: "AA=="}
+	if _, err := verifyCommand(cmd); !errors.Is(err, errCommandKeyMissing) {
+		t.Errorf("verifyCommand() erreur = %v, attendu %v", err, errCommandKeyMissing)
+	}
+}
+
+func TestPinAnnouncedCommandKey(t *testing.T) {
+	withFakeDashboard(t)
+	previous := agentIdentity
+	t.Cleanup(func() { agentIdentity = previous })
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	announced := base64.StdEncoding.EncodeToString(pub)
+
+	tests := []struct {
+		name      string
+		enrolling bool
+		wantKey   bool
+	}{
+		// Agent mis à jour sans clé : la clé annoncée pourrait venir d'un Dashboard usurpé
+		{"agent déjà enrôlé", false, false},
+		{"premier enrôlement", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := identity.Load(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			agentIdentity = id
+			pinAnnouncedCommandKey(announced, tt.enrolling)
+			if got := id.PinnedCommandKey(); (got != nil) != tt.wantKey {
+				t.Errorf("clé épinglée = %v, attendu %v", got != nil, tt.wantKey)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+// Package tlspolicy - Politique TLS de la connexion au Dashboard
+// Autorités supplémentaires (proxy d'inspection approuvé), épinglage SPKI,
+// certificat client (mTLS) et détection des connexions interceptées
+package tlspolicy
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options décrit la politique TLS
+type Options struct {
+	// Autorités supplémentaires (PEM), en plus du magasin du système
+	CAFile string
+	// Empreintes SHA-256 (base64) des clés publiques acceptées : certificat du
+	// Dashboard ou d'une autorité de sa chaîne. Vide : pas d'épinglage.
+	Pins []string
+	// Certificat client et sa clé (PEM), présentés si le serveur les demande
+	ClientCert string
+	ClientKey  string
+}
+
+// ErrIntercepted signale une connexion TLS vraisemblablement interceptée
+// (pare-feu avec inspection TLS, proxy, portail captif) : aucune donnée n'a été envoyée
+var ErrIntercepted = errors.New("connexion interceptée")
+
+// InterceptionError détaille une interception détectée
+type InterceptionError struct {
+	Reason string // Cause lisible
+	Issuer string // Émetteur du certificat présenté
+	Hint   string // Action conseillée
+	Err    error  // Erreur de vérification d'origine
+}
+
+func (e *InterceptionError) Error() string {
+	msg := fmt.Sprintf("%v : %s", ErrIntercepted, e.Reason)
+	if e.Issuer != "" {
+		msg += fmt.Sprintf(" (émis par %q)", e.Issuer)
+	}
+	return msg + " - " + e.Hint
+}
+
+// Unwrap permet errors.Is(err, ErrIntercepted) et l'accès à l'erreur d'origine
+func (e *InterceptionError) Unwrap() []error {
+	return []error{ErrIntercepted, e.Err}
+}
+
+// pinError : aucune clé de la chaîne ne correspond aux empreintes épinglées
+type pinError struct {
+	leaf *x509.Certificate
+}
+
+func (e *pinError) Error() string {
+	return "certificat hors des empreintes épinglées: " + SPKIFingerprint(e.leaf)
+}
+
+// SPKIFingerprint retourne l'empreinte SHA-256 (base64) de la clé publique d'un certificat
+func SPKIFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// ParsePin vérifie une empreinte SPKI (SHA-256 en base64, préfixe sha256/ accepté)
+func ParsePin(pin string) (string, error) {
+	pin = strings.TrimPrefix(strings.TrimSpace(pin), "sha256/")
+	raw, err := base64.StdEncoding.DecodeString(pin)
+	if err != nil || len(raw) != sha256.Size {
+		return "", fmt.Errorf("empreinte SPKI invalide %q (SHA-256 en base64 attendu)", pin)
+	}
+	return pin, nil
+}
+
+// Config construit la configuration TLS de la politique
+func Config(opts Options) (*tls.Config, error) {
+	conf := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if opts.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("ca_file: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca_file: aucun certificat PEM dans %s", opts.CAFile)
+		}
+		conf.RootCAs = pool
+	}
+
+	if len(opts.Pins) > 0 {
+		pins := make(map[string]bool, len(opts.Pins))
+		for _, p := range opts.Pins {
+			pin, err := ParsePin(p)
+			if err != nil {
+				return nil, err
+			}
+			pins[pin] = true
+		}
+		// Après la vérification habituelle : une clé de la chaîne doit être épinglée
+		conf.VerifyConnection = func(cs tls.ConnectionState) error {
+			for _, chain := range cs.VerifiedChains {
+				for _, cert := range chain {
+					if pins[SPKIFingerprint(cert)] {
+						return nil
+					}
+				}
+			}
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("aucun certificat présenté")
+			}
+			return &pinError{leaf: cs.PeerCertificates[0]}
+		}
+	}
+
+	if (opts.ClientCert == "") != (opts.ClientKey == "") {
+		return nil, errors.New("client_cert et client_key vont ensemble")
+	}
+	if opts.ClientCert != "" {
+		loader := &clientCertLoader{certFile: opts.ClientCert, keyFile: opts.ClientKey}
+		if _, err := loader.load(); err != nil {
+			return nil, err
+		}
+		conf.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return loader.load()
+		}
+	}
+
+	return conf, nil
+}
+
+// clientCertLoader relit le certificat client quand il est renouvelé sur le disque
+type clientCertLoader struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func (l *clientCertLoader) load() (*tls.Certificate, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	info, err := os.Stat(l.certFile)
+	if err != nil {
+		return nil, fmt.Errorf("client_cert: %w", err)
+	}
+	if l.cert != nil && info.ModTime().Equal(l.modTime) {
+		return l.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("certificat client: %w", err)
+	}
+	l.cert, l.modTime = &cert, info.ModTime()
+	return l.cert, nil
+}
+
+// Transport applique la politique TLS et classe les erreurs d'interception
+type Transport struct {
+	base *http.Transport
+}
+
+// NewTransport crée le transport HTTP de la politique
+func NewTransport(opts Options) (*Transport, error) {
+	conf, err := Config(opts)
+	if err != nil {
+		return nil, err
+	}
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.TLSClientConfig = conf
+	return &Transport{base: base}, nil
+}
+
+// RoundTrip implémente http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, Classify(err)
+	}
+	return resp, nil
+}
+
+// Actions conseillées selon la cause
+const (
+	hintProxy = "pare-feu avec inspection TLS ? Ajoutez son autorité (tls.ca_file) si elle est approuvée"
+	hintPin   = "proxy d'inspection ou certificat du Dashboard renouvelé : comparez avec tls check avant de modifier tls.pinned_spki"
+)
+
+// Classify retourne une InterceptionError si err est un échec de vérification
+// typique d'une interception, err sinon. Un certificat expiré n'en est pas une.
+func Classify(err error) error {
+	var unknown x509.UnknownAuthorityError
+	if errors.As(err, &unknown) {
+		return &InterceptionError{Reason: "certificat signé par une autorité inconnue", Issuer: issuer(unknown.Cert), Hint: hintProxy, Err: err}
+	}
+	var pin *pinError
+	if errors.As(err, &pin) {
+		return &InterceptionError{Reason: "certificat hors des empreintes épinglées", Issuer: issuer(pin.leaf), Hint: hintPin, Err: err}
+	}
+	var hostname x509.HostnameError
+	if errors.As(err, &hostname) {
+		return &InterceptionError{Reason: "certificat émis pour un autre nom", Issuer: issuer(hostname.Certificate), Hint: hintProxy, Err: err}
+	}
+	return err
+}
+
+// issuer retourne le nom lisible de l'émetteur d'un certificat
+func issuer(cert *x509.Certificate) string {
+	if cert == nil {
+		return ""
+	}
+	if cert.Issuer.CommonName != "" {
+		return cert.Issuer.CommonName
+	}
+	return cert.Issuer.String()
+}
@@ -0,0 +1,145 @@
+package tlspolicy
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// dashboard démarre un Dashboard de test et écrit son certificat dans un fichier PEM
+func dashboard(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	// Poignées de main refusées par le client : attendues
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return server, caFile
+}
+
+// get envoie une requête au Dashboard avec la politique opts
+func get(t *testing.T, url string, opts Options) error {
+	t.Helper()
+	transport, err := NewTransport(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := (&http.Client{Transport: transport}).Get(url)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func TestTransport(t *testing.T) {
+	server, caFile := dashboard(t)
+	pin := SPKIFingerprint(server.Certificate())
+	otherPin := base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+	// Certificat émis pour 127.0.0.1 et example.com
+	otherName := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+
+	tests := []struct {
+		name   string
+		url    string
+		opts   Options
+		reason string // "" : connexion acceptée
+	}{
+		{"autorité inconnue", server.URL, Options{}, "autorité inconnue"},
+		{"autorité supplémentaire", server.URL, Options{CAFile: caFile}, ""},
+		{"empreinte épinglée", server.URL, Options{CAFile: caFile, Pins: []string{"sha256/" + pin}}, ""},
+		{"une des empreintes", server.URL, Options{CAFile: caFile, Pins: []string{otherPin, pin}}, ""},
+		{"empreinte différente", server.URL, Options{CAFile: caFile, Pins: []string{otherPin}}, "empreintes épinglées"},
+		{"autre nom", otherName, Options{CAFile: caFile}, "autre nom"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := get(t, tt.url, tt.opts)
+			if tt.reason == "" {
+				if err != nil {
+					t.Fatalf("connexion refusée: %v", err)
+				}
+				return
+			}
+			var interception *InterceptionError
+			if !errors.As(err, &interception) || !errors.Is(err, ErrIntercepted) {
+				t.Fatalf("erreur = %v, attendu une interception", err)
+			}
+			if !strings.Contains(interception.Reason, tt.reason) {
+				t.Errorf("cause = %q, attendu %q", interception.Reason, tt.reason)
+			}
+			if interception.Issuer == "" {
+				t.Error("émetteur absent")
+			}
+		})
+	}
+}
+
+func TestClassifyKeepsOtherErrors(t *testing.T) {
+	for _, err := range []error{
+		x509.CertificateInvalidError{Reason: x509.Expired},
+		errors.New("connection refused"),
+	} {
+		if got := Classify(err); got != err || errors.Is(got, ErrIntercepted) {
+			t.Errorf("Classify(%v) = %v, attendu l'erreur d'origine", err, got)
+		}
+	}
+}
+
+func TestParsePin(t *testing.T) {
+	valid := base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+	tests := []struct {
+		pin     string
+		wantErr bool
+	}{
+		{valid, false},
+		{"sha256/" + valid, false},
+		{" " + valid + " ", false},
+		{"pas-du-base64", true},
+		{base64.StdEncoding.EncodeToString([]byte("trop court")), true},
+	}
+	for _, tt := range tests {
+		got, err := ParsePin(tt.pin)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParsePin(%q) erreur = %v, attendu %v", tt.pin, err, tt.wantErr)
+		}
+		if err == nil && got != valid {
+			t.Errorf("ParsePin(%q) = %q", tt.pin, got)
+		}
+	}
+}
+
+func TestConfigInvalid(t *testing.T) {
+	notPEM := filepath.Join(t.TempDir(), "ca.txt")
+	if err := os.WriteFile(notPEM, []byte("pas un certificat"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for name, opts := range map[string]Options{
+		"ca_file absent":     {CAFile: filepath.Join(t.TempDir(), "absent.pem")},
+		"ca_file sans PEM":   {CAFile: notPEM},
+		"empreinte invalide": {Pins: []string{"abc"}},
+		"clé client seule":   {ClientKey: "client.key"},
+	} {
+		if _, err := Config(opts); err == nil {
+			t.Errorf("%s: erreur attendue", name)
+		}
+	}
+}
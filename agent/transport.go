@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mon-rempart/agent/tlspolicy"
+)
+
+// Transport des requêtes vers le Dashboard, selon la politique TLS de la configuration
+var dashboardTransport http.RoundTripper = http.DefaultTransport
+
+// newDashboardClient retourne un client HTTP vers le Dashboard (timeout 0 : aucun)
+func newDashboardClient(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: dashboardTransport}
+}
+
+// setupDashboardTransport applique la politique TLS. Une politique invalide
+// bloque les connexions : l'agent ne se replie pas sur le magasin du système
+// alors qu'un épinglage était demandé.
+func setupDashboardTransport() {
+	cfg := currentConfig()
+	transport, err := tlspolicy.NewTransport(cfg.TLS.Options())
+	if err != nil {
+		slog.Error("❌ Politique TLS invalide - connexions au Dashboard bloquées", "error", err)
+		dashboardTransport = failingTransport{err: err}
+		return
+	}
+	if cfg.TLS.CAFile != "" || len(cfg.TLS.PinnedSPKI) > 0 || cfg.TLS.ClientCert != "" {
+		slog.Info("🔐 Politique TLS du Dashboard",
+			"ca_file", cfg.TLS.CAFile,
+			"pins", len(cfg.TLS.PinnedSPKI),
+			"client_cert", cfg.TLS.ClientCert != "",
+		)
+	}
+	dashboardTransport = &interceptionWatch{next: transport}
+}
+
+// failingTransport refuse toutes les requêtes (politique TLS invalide)
+type failingTransport struct {
+	err error
+}
+
+func (t failingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, t.err
+}
+
+// interceptionWatch signale les connexions interceptées : une seule fois
+// par épisode, puis au retour d'une connexion saine
+type interceptionWatch struct {
+	next http.RoundTripper
+
+	mu    sync.Mutex
+	since time.Time
+	last  string
+}
+
+func (w *interceptionWatch) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := w.next.RoundTrip(req)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	switch {
+	case err != nil && errors.Is(err, tlspolicy.ErrIntercepted):
+		if w.since.IsZero() || err.Error() != w.last {
+			slog.Error("🚨 Connexion au Dashboard interceptée - aucune donnée envoyée", "host", req.URL.Host, "error", err)
+			if w.since.IsZero() {
+				w.since = time.Now()
+			}
+			w.last = err.Error()
+			connectivity.setIntercepted(w.last)
+		}
+	case err == nil && !w.since.IsZero():
+		since, reason := w.since, w.last
+		w.since, w.last = time.Time{}, ""
+		connectivity.setIntercepted("")
+		slog.Info("🔐 Connexion au Dashboard de nouveau vérifiée", "intercepted_since", since.Local().Format("02/01/2006 15:04"))
+		// Envoyé hors du transport : la requête en cours n'attend pas
+		go sendActivityLog("error", "Connexion au Dashboard interceptée", map[string]interface{}{
+			"since":  since,
+			"until":  time.Now(),
+			"reason": reason,
+		})
+	}
+	return resp, err
+}
@@ -0,0 +1,80 @@
+import { NextRequest, NextResponse } from 'next/server';
+import { createClient } from '@supabase/supabase-js';
+
+// Supabase client avec service role pour accès complet
+function getSupabaseAdmin() {
+    const url = process.env.NEXT_PUBLIC_SUPABASE_URL;
+    const key = process.env.SUPABASE_SERVICE_ROLE_KEY;
+
+    if (!url || !key) {
+        return null;
+    }
+
+    return createClient(url, key);
+}
+
+interface CommandAckBody {
+    agent_id: string;
+    ids: string[];
+}
+
+/**
+ * POST /api/agent/commands/ack
+ * Accusé de réception de commandes : elles ne sont plus redistribuées
+ */
+export async function POST(request: NextRequest): Promise<NextResponse> {
+    try {
+        const supabase = getSupabaseAdmin();
+        if (!supabase) {
+            return NextResponse.json(
+                { success: false, message: 'Supabase non configuré' },
+                { status: 500 }
+            );
+        }
+
+        const body: CommandAckBody = await request.json();
+        if (!body.agent_id || !Array.isArray(body.ids) || body.ids.length === 0) {
+            return NextResponse.json(
+                { success: false, message: 'agent_id et ids requis' },
+                { status: 400 }
+            );
+        }
+
+        const { data: acked, error } = await supabase
+            .from('agent_commands')
+            .update({ status: 'acked', acked_at: new Date().toISOString() })
+            .eq('agent_id', body.agent_id)
+            .eq('status', 'pending')
+            .in('id', body.ids)
+            .select('command, params');
+
+        if (error) {
+            console.error('Erreur accusé de réception commandes:', error);
+            return NextResponse.json(
+                { success: false, message: 'Erreur mise à jour' },
+                { status: 500 }
+            );
+        }
+
+        // Restauration prise en charge par l'agent
+        const restoreIds = (acked || [])
+            .filter((row) => row.command === 'restore' && row.params?.request_id)
+            .map((row) => row.params.request_id);
+        if (restoreIds.length > 0) {
+            await supabase
+                .from('restore_requests')
+                .update({ status: 'running', started_at: new Date().toISOString() })
+                .in('id', restoreIds)
+                .eq('status', 'pending');
+        }
+
+        return NextResponse.json({ success: true, acked: acked?.length || 0 });
+
+    } catch (error) {
+        console.error('Erreur API commands ack:', error);
+        return NextResponse.json(
+            { success: false, message: 'Erreur interne' },
+            { status: 500 }
+        );
+    }
+}
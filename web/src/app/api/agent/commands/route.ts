@@ -0,0 +1,57 @@
+import { NextRequest, NextResponse } from 'next/server';
+import { createClient } from '@supabase/supabase-js';
+import { pendingAgentCommands, resolveAgentId } from '@/lib/agentCommands';
+
+// Supabase client avec service role pour accès complet
+function getSupabaseAdmin() {
+    const url = process.env.NEXT_PUBLIC_SUPABASE_URL;
+    const key = process.env.SUPABASE_SERVICE_ROLE_KEY;
+
+    if (!url || !key) {
+        return null;
+    }
+
+    return createClient(url, key);
+}
+
+// Intervalle de consultation de la file pendant l'attente
+const POLL_INTERVAL_MS = 2000;
+// Attente maximale demandée par l'agent (secondes)
+const MAX_WAIT_SECONDS = 25;
+
+export const dynamic = 'force-dynamic';
+
+/**
+ * GET /api/agent/commands?agent_id=xxx&wait=25
+ * Requête longue (repli du flux SSE) : répond dès qu'une commande est en
+ * attente, ou avec une liste vide au bout de `wait` secondes.
+ */
+export async function GET(request: NextRequest): Promise<NextResponse> {
+    const supabase = getSupabaseAdmin();
+    if (!supabase) {
+        return NextResponse.json(
+            { success: false, commands: [], message: 'Supabase non configuré' },
+            { status: 500 }
+        );
+    }
+
+    const { searchParams } = request.nextUrl;
+    const agentId = await resolveAgentId(supabase, searchParams.get('agent_id'), searchParams.get('hostname'));
+    if (!agentId) {
+        return NextResponse.json(
+            { success: false, commands: [], message: 'Agent non trouvé' },
+            { status: 404 }
+        );
+    }
+
+    const wait = Math.min(Math.max(Number(searchParams.get('wait')) || 0, 0), MAX_WAIT_SECONDS);
+    const deadline = Date.now() + wait * 1000;
+
+    for (;;) {
+        const commands = await pendingAgentCommands(supabase, agentId);
+        if (commands.length > 0 || Date.now() >= deadline || request.signal.aborted) {
+            return NextResponse.json({ success: true, commands });
+        }
+        await new Promise((resolve) => setTimeout(resolve, POLL_INTERVAL_MS));
+    }
+}
@@ -0,0 +1,123 @@
+import { NextRequest, NextResponse } from 'next/server';
+import { createClient } from '@supabase/supabase-js';
+import type { AgentCommandStatus } from '@/lib/agentCommands';
+
+// Supabase client avec service role pour accès complet
+function getSupabaseAdmin() {
+    const url = process.env.NEXT_PUBLIC_SUPABASE_URL;
+    const key = process.env.SUPABASE_SERVICE_ROLE_KEY;
+
+    if (!url || !key) {
+        return null;
+    }
+
+    return createClient(url, key);
+}
+
+interface CommandStatusBody {
+    agent_id: string;
+    id: string;
+    command: string;
+    status: AgentCommandStatus;
+    error?: string;
+    result?: unknown;
+    at: string;
+}
+
+const REPORTED_STATUSES: AgentCommandStatus[] = ['queued', 'running', 'done', 'failed', 'rejected'];
+const FINAL_STATUSES: AgentCommandStatus[] = ['done', 'failed', 'rejected'];
+
+/**
+ * POST /api/agent/commands/status
+ * Changement d'état d'une commande signalé par l'agent (file, exécution, résultat)
+ */
+export async function POST(request: NextRequest): Promise<NextResponse> {
+    try {
+        const supabase = getSupabaseAdmin();
+        if (!supabase) {
+            return NextResponse.json(
+                { success: false, message: 'Supabase non configuré' },
+                { status: 500 }
+            );
+        }
+
+        const body: CommandStatusBody = await request.json();
+        if (!body.agent_id || !body.id || !REPORTED_STATUSES.includes(body.status)) {
+            return NextResponse.json(
+                { success: false, message: 'agent_id, id et status valide requis' },
+                { status: 400 }
+            );
+        }
+
+        const at = body.at || new Date().toISOString();
+        const update: Record<string, unknown> = {
+            status: body.status,
+            updated_at: at,
+        };
+        if (body.status === 'running') {
+            update.started_at = at;
+        }
+        if (FINAL_STATUSES.includes(body.status)) {
+            update.completed_at = at;
+            update.error = body.error || null;
+            update.result = body.result ?? null;
+        }
+
+        // Un état rejoué depuis l'outbox ne remplace pas un état final plus récent
+        let query = supabase
+            .from('agent_commands')
+            .update(update)
+            .eq('agent_id', body.agent_id)
+            .eq('id', body.id);
+        if (!FINAL_STATUSES.includes(body.status)) {
+            query = query.not('status', 'in', `(${FINAL_STATUSES.join(',')})`);
+        }
+        const { data: updated, error } = await query.select('command, params');
+
+        if (error) {
+            console.error('Erreur mise à jour état commande:', error);
+            return NextResponse.json(
+                { success: false, message: 'Erreur mise à jour' },
+                { status: 500 }
+            );
+        }
+
+        // Restauration refusée ou en échec avant d'avoir démarré
+        const row = updated?.[0];
+        if (row?.command === 'restore' && row.params?.request_id &&
+            (body.status === 'failed' || body.status === 'rejected')) {
+            await supabase
+                .from('restore_requests')
+                .update({
+                    status: 'failed',
+                    message: body.error || null,
+                    completed_at: at,
+                })
+                .eq('id', row.params.request_id)
+                .in('status', ['pending', 'running']);
+        }
+
+        // Rotation de clé refusée (signature, expiration) ou en échec avant d'avoir démarré
+        if (row?.command === 'rotate_key' && row.params?.request_id &&
+            (body.status === 'failed' || body.status === 'rejected')) {
+            await supabase
+                .from('key_rotations')
+                .update({
+                    status: 'failed',
+                    message: body.error || null,
+                    completed_at: at,
+                })
+                .eq('id', row.params.request_id)
+                .eq('status', 'pending');
+        }
+
+        return NextResponse.json({ success: true });
+
+    } catch (error) {
+        console.error('Erreur API commands status:', error);
+        return NextResponse.json(
+            { success: false, message: 'Erreur interne' },
+            { status: 500 }
+        );
+    }
+}
@@ -0,0 +1,84 @@
+import { NextRequest } from 'next/server';
+import { createClient } from '@supabase/supabase-js';
+import { pendingAgentCommands, resolveAgentId } from '@/lib/agentCommands';
+
+// Supabase client avec service role pour accès complet
+function getSupabaseAdmin() {
+    const url = process.env.NEXT_PUBLIC_SUPABASE_URL;
+    const key = process.env.SUPABASE_SERVICE_ROLE_KEY;
+
+    if (!url || !key) {
+        return null;
+    }
+
+    return createClient(url, key);
+}
+
+// Consultation de la file, keepalive et durée d'un flux : l'agent se
+// reconnecte aussitôt après la fermeture (limite d'exécution des fonctions)
+const POLL_INTERVAL_MS = 2000;
+const KEEPALIVE_MS = 15000;
+const STREAM_DURATION_MS = 55000;
+
+export const dynamic = 'force-dynamic';
+export const maxDuration = 60;
+
+/**
+ * GET /api/agent/commands/stream?agent_id=xxx
+ * Flux SSE des commandes d'un agent. Une commande est renvoyée à chaque
+ * connexion tant que l'agent n'en a pas accusé réception.
+ */
+export async function GET(request: NextRequest): Promise<Response> {
+    const supabase = getSupabaseAdmin();
+    if (!supabase) {
+        return new Response('Supabase non configuré', { status: 500 });
+    }
+
+    const { searchParams } = request.nextUrl;
+    const agentId = await resolveAgentId(supabase, searchParams.get('agent_id'), searchParams.get('hostname'));
+    if (!agentId) {
+        return new Response('Agent non trouvé', { status: 404 });
+    }
+
+    const encoder = new TextEncoder();
+    const stream = new ReadableStream({
+        async start(controller) {
+            const sent = new Set<string>();
+            const end = Date.now() + STREAM_DURATION_MS;
+            let lastWrite = Date.now();
+
+            try {
+                while (Date.now() < end && !request.signal.aborted) {
+                    const commands = (await pendingAgentCommands(supabase, agentId))
+                        .filter((command) => !sent.has(command.id));
+
+                    if (commands.length > 0) {
+                        commands.forEach((command) => sent.add(command.id));
+                        controller.enqueue(encoder.encode(
+                            `event: commands\ndata: ${JSON.stringify({ success: true, commands })}\n\n`
+                        ));
+                        lastWrite = Date.now();
+                    } else if (Date.now() - lastWrite >= KEEPALIVE_MS) {
+                        controller.enqueue(encoder.encode(': keepalive\n\n'));
+                        lastWrite = Date.now();
+                    }
+
+                    await new Promise((resolve) => setTimeout(resolve, POLL_INTERVAL_MS));
+                }
+            } catch (error) {
+                console.error('Erreur flux de commandes:', error);
+            } finally {
+                controller.close();
+            }
+        },
+    });
+
+    return new Response(stream, {
+        headers: {
+            'Content-Type': 'text/event-stream',
+            'Cache-Control': 'no-cache, no-transform',
+            Connection: 'keep-alive',
+            'X-Accel-Buffering': 'no',
+        },
+    });
+}
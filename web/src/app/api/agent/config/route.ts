@@ -1,5 +1,8 @@
-import { NextResponse } from 'next/server';
+import { NextRequest, NextResponse } from 'next/server';
 import { createClient, SupabaseClient } from '@supabase/supabase-js';
+import { createHash } from 'crypto';
+import { withAgentBackoff } from '@/lib/agentBackoff';
+import { openSecret } from '@/lib/secretBox';
 
 // Type pour la configuration
 interface ConfigResponse {
@@ -12,6 +15,32 @@ interface ConfigResponse {
     secretKey?: string;
     repoPassword?: string;
     message?: string;
+    // Stockage hors S3 : local, sftp ou rest (adresse de base du dépôt)
+    backend?: string;
+    repository?: string;
+    pathStyle?: boolean;
+    restUsername?: string;
+    restPassword?: string;
+    appendOnly?: boolean;
+    // Version de la configuration (empreinte), renvoyée aussi en ETag
+    version?: string;
+    // Politique de sauvegarde versionnée (propre à l'agent, sinon par défaut)
+    policy?: BackupPolicy;
+}
+
+// Politique de sauvegarde, appliquée par l'agent par-dessus son config.json
+interface BackupPolicy {
+    version: number;
+    backup_paths?: string[];
+    exclude_paths?: string[];
+    schedule?: string;
+    // Plages des sauvegardes automatiques ("22:00-06:00", "lun-ven 12:00-14:00")
+    // et jours sans sauvegarde ("2027-03-14", "2027-03-14/2027-03-21")
+    backup_windows?: string[];
+    blackout_dates?: string[];
+    retention?: Record<string, number>;
+    bandwidth?: Record<string, number>;
+    hooks?: Record<string, unknown>;
 }
 
 // Client Supabase lazy loading
@@ -34,7 +63,11 @@ function getSupabaseClient(): SupabaseClient | null {
  * pour s'assurer que seuls les agents autorisés peuvent récupérer la config.
  * Exemple: Authorization: Bearer <agent_token>
  */
-export async function GET(): Promise<NextResponse<ConfigResponse>> {
+export async function GET(request: NextRequest): Promise<NextResponse<ConfigResponse>> {
+    return withAgentBackoff(await handleConfig(request));
+}
+
+async function handleConfig(request: NextRequest): Promise<NextResponse<ConfigResponse>> {
     try {
         const supabase = getSupabaseClient();
 
@@ -62,8 +95,12 @@ export async function GET(): Promise<NextResponse<ConfigResponse>> {
             }, { status: 500 });
         }
 
-        // Vérification que la config est complète
-        if (!data || !data.s3_bucket || !data.s3_access_key || !data.s3_secret_key || !data.restic_password) {
+        // Vérification que la config est complète (adresse du dépôt hors S3)
+        const backend = data?.storage_backend || 's3';
+        const storageConfigured = backend === 's3'
+            ? data?.s3_bucket && data?.s3_access_key && data?.s3_secret_key
+            : data?.repository_url;
+        if (!data || !storageConfigured || !data.restic_password) {
             return NextResponse.json({
                 success: true,
                 configured: false,
@@ -71,8 +108,40 @@ export async function GET(): Promise<NextResponse<ConfigResponse>> {
             });
         }
 
+        // Mot de passe propre à l'agent après une rotation de clé réussie
+        let repoPassword = data.restic_password;
+        let agentId: string | null = null;
+        const hostname = request.nextUrl.searchParams.get('hostname');
+        if (hostname) {
+            const { data: agent } = await supabase
+                .from('agents')
+                .select('id')
+                .eq('hostname', hostname)
+                .single();
+
+            if (agent) {
+                agentId = agent.id;
+                const { data: rotation } = await supabase
+                    .from('key_rotations')
+                    .select('new_password_sealed')
+                    .eq('agent_id', agent.id)
+                    .eq('status', 'success')
+                    .order('completed_at', { ascending: false })
+                    .limit(1)
+                    .single();
+
+                if (rotation) {
+                    // Indéchiffrable : l'erreur interne garde l'agent sur sa
+                    // configuration et son mot de passe locaux
+                    repoPassword = openSecret(rotation.new_password_sealed);
+                }
+            }
+        }
+
+        const policy = await getBackupPolicy(supabase, agentId);
+
         // Configuration complète - on renvoie tout
-        return NextResponse.json({
+        const config: ConfigResponse = {
             success: true,
             configured: true,
             endpoint: data.s3_endpoint,
@@ -80,8 +149,25 @@ export async function GET(): Promise<NextResponse<ConfigResponse>> {
             region: data.s3_region,
             accessKey: data.s3_access_key,
             secretKey: data.s3_secret_key,
-            repoPassword: data.restic_password,
-        });
+            repoPassword,
+            backend,
+            repository: data.repository_url || undefined,
+            pathStyle: data.s3_path_style || false,
+            restUsername: data.rest_username || undefined,
+            restPassword: data.rest_password || undefined,
+            appendOnly: data.rest_append_only || false,
+            policy,
+        };
+
+        // Les agents interrogent la configuration en continu : sans changement,
+        // réponse 304 sans corps (ni secrets)
+        const version = createHash('sha256').update(JSON.stringify(config)).digest('hex').slice(0, 32);
+        const etag = `"${version}"`;
+        if (request.headers.get('if-none-match') === etag) {
+            return new NextResponse(null, { status: 304, headers: { ETag: etag } }) as NextResponse<ConfigResponse>;
+        }
+
+        return NextResponse.json({ ...config, version }, { headers: { ETag: etag } });
 
     } catch (error) {
         console.error('Erreur config:', error);
@@ -92,3 +178,32 @@ export async function GET(): Promise<NextResponse<ConfigResponse>> {
         }, { status: 500 });
     }
 }
+
+/**
+ * Dernière version de la politique de l'agent, sinon de la politique par défaut
+ */
+async function getBackupPolicy(supabase: SupabaseClient, agentId: string | null): Promise<BackupPolicy | undefined> {
+    if (agentId) {
+        const { data } = await supabase
+            .from('backup_policies')
+            .select('version, policy')
+            .eq('agent_id', agentId)
+            .order('version', { ascending: false })
+            .limit(1)
+            .single();
+
+        if (data) {
+            return { ...data.policy, version: data.version };
+        }
+    }
+
+    const { data } = await supabase
+        .from('backup_policies')
+        .select('version, policy')
+        .is('agent_id', null)
+        .order('version', { ascending: false })
+        .limit(1)
+        .single();
+
+    return data ? { ...data.policy, version: data.version } : undefined;
+}
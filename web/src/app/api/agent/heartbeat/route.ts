@@ -1,18 +1,95 @@
 import { NextRequest, NextResponse } from 'next/server';
 import { createClient, SupabaseClient } from '@supabase/supabase-js';
+import { legacyCommandFields, pendingAgentCommands } from '@/lib/agentCommands';
+import { commandPublicKey } from '@/lib/commandSigning';
+import { agentBackoffSeconds, withAgentBackoff } from '@/lib/agentBackoff';
 
 // Types pour les requêtes/réponses
 interface HeartbeatPayload {
     hostname: string;
-    status: 'online' | 'offline' | 'error';
+    // degraded : premier heartbeat après un fonctionnement hors ligne (configuration en cache)
+    status: 'online' | 'offline' | 'error' | 'degraded';
     ip_address?: string;
+    // command_ack : l'agent acquitte les commandes (sinon acquittées à l'envoi)
+    capabilities?: string[];
+
+    // État détaillé (agents récents)
+    agent_version?: string;
+    os?: string;
+    arch?: string;
+    uptime_seconds?: number;
+    ip_addresses?: string[];
+    disks?: { path: string; free_bytes: number; total_bytes: number }[];
+    restic_version?: string;
+    config_version?: string;
+    policy_version?: number;
+    last_backup?: {
+        time: string;
+        status: 'success' | 'failed';
+        snapshot_id?: string;
+        error?: string;
+        trigger?: string;
+    };
+    // Dernière sauvegarde complète réussie, conservée par l'agent entre deux démarrages
+    last_success_at?: string;
+    current_job?: string;
+    outbox_depth?: number;
+    // Fichiers témoins : triggered tant que l'alerte n'est pas levée
+    canary?: {
+        files: number;
+        triggered?: { time: string; path: string; reason: string; others?: string[] };
+    };
+    // Sauvegarde planifiée reportée (poste chargé, processeur occupé ou sur batterie)
+    backup_deferred?: {
+        since: string;
+        deadline: string;
+        reasons: { code: 'load' | 'cpu' | 'battery'; message: string }[];
+        sample: { load: number; cpus: number; cpu_percent: number; on_battery: boolean; battery?: number };
+    };
+}
+
+// Colonnes de l'état détaillé ; un ancien agent ne l'envoie pas : rien n'est effacé
+function healthColumns(body: HeartbeatPayload): Record<string, unknown> {
+    if (!body.agent_version) {
+        return {};
+    }
+    return {
+        agent_version: body.agent_version,
+        os: body.os,
+        arch: body.arch,
+        restic_version: body.restic_version || null,
+        uptime_seconds: body.uptime_seconds ?? null,
+        ip_addresses: body.ip_addresses || [],
+        last_backup_at: body.last_backup?.time || null,
+        last_backup_status: body.last_backup?.status || null,
+        last_backup_snapshot: body.last_backup?.snapshot_id || null,
+        last_backup_success_at: body.last_success_at || null,
+        current_job: body.current_job || null,
+        outbox_depth: body.outbox_depth ?? 0,
+        canary_files: body.canary?.files ?? null,
+        canary_triggered_at: body.canary?.triggered?.time || null,
+        backup_deferred_since: body.backup_deferred?.since || null,
+        backup_deferred_reasons: body.backup_deferred?.reasons.map((r) => r.code) ?? null,
+        health: body,
+        health_updated_at: new Date().toISOString(),
+    };
 }
 
 interface HeartbeatResponse {
     success: boolean;
-    command: 'idle' | 'backup_now' | 'update' | 'shutdown' | 'restore' | 'sync_snapshots';
+    command: 'idle' | 'backup_now' | 'update' | 'shutdown' | 'restore' | 'sync_snapshots' | 'rotate_key' | 'preview_backup' | 'set_log_level' | 'reset_canaries';
     message?: string;
     agent_id?: string;
+    // ID de la commande (file agent_commands), à acquitter par l'agent
+    command_id?: string;
+    params?: Record<string, unknown>;
+    expires_at?: string;
+    signed_payload?: string;
+    signature?: string;
+    // Clé publique des commandes signées, épinglée par l'agent à l'enrôlement
+    command_public_key?: string;
+    // Délai minimal avant le prochain heartbeat (incident, voir agentBackoff.ts)
+    backoff_seconds?: number;
     restore_config?: {
         request_id: string;
         snapshot_id: string;
@@ -38,6 +115,10 @@ function getSupabaseClient(): SupabaseClient | null {
  * Reçoit les signaux de vie des agents et met à jour leur statut
  */
 export async function POST(request: NextRequest): Promise<NextResponse<HeartbeatResponse>> {
+    return withAgentBackoff(await handleHeartbeat(request));
+}
+
+async function handleHeartbeat(request: NextRequest): Promise<NextResponse<HeartbeatResponse>> {
     try {
         // Vérification de la configuration Supabase
         const supabase = getSupabaseClient();
@@ -83,6 +164,7 @@ export async function POST(request: NextRequest): Promise<NextResponse<Heartbeat
                     status: body.status || 'online',
                     last_seen_at: new Date().toISOString(),
                     ip_address: ipAddress,
+                    ...healthColumns(body),
                 })
                 .eq('id', existingAgent.id);
 
@@ -105,6 +187,7 @@ export async function POST(request: NextRequest): Promise<NextResponse<Heartbeat
                     status: body.status || 'online',
                     last_seen_at: new Date().toISOString(),
                     ip_address: ipAddress,
+                    ...healthColumns(body),
                 })
                 .select('id')
                 .single();
@@ -121,35 +204,32 @@ export async function POST(request: NextRequest): Promise<NextResponse<Heartbeat
             console.log(`🆕 Nouvel agent "${body.hostname}" créé (ID: ${agentId})`);
         }
 
-        // Vérifier s'il y a une demande de restauration en attente
-        const { data: pendingRestore } = await supabase
-            .from('restore_requests')
-            .select('id, snapshot_id, target_path')
-            .eq('agent_id', agentId)
-            .eq('status', 'pending')
-            .order('created_at', { ascending: true })
-            .limit(1)
-            .single();
-
-        if (pendingRestore) {
-            // Marquer comme "running"
-            await supabase
-                .from('restore_requests')
-                .update({ status: 'running', started_at: new Date().toISOString() })
-                .eq('id', pendingRestore.id);
-
-            console.log(`🔄 Envoi commande restore à "${body.hostname}" - Snapshot: ${pendingRestore.snapshot_id}`);
+        // Commande en attente (restauration, sauvegarde immédiate...) : les agents
+        // récents la reçoivent aussi par le canal temps réel ; l'ID permet d'ignorer
+        // le doublon. Elle est redistribuée jusqu'à l'accusé de réception.
+        const [pendingCommand] = await pendingAgentCommands(supabase, agentId);
+        if (pendingCommand) {
+            const { id, command } = pendingCommand;
+            if (!body.capabilities?.includes('command_ack')) {
+                await supabase
+                    .from('agent_commands')
+                    .update({ status: 'acked', acked_at: new Date().toISOString() })
+                    .eq('id', id);
+            }
+            console.log(`📨 Envoi commande ${command} à "${body.hostname}" (heartbeat)`);
 
             return NextResponse.json({
+                ...legacyCommandFields(pendingCommand),
+                params: pendingCommand.params,
+                expires_at: pendingCommand.expires_at,
+                signed_payload: pendingCommand.signed_payload,
+                signature: pendingCommand.signature,
                 success: true,
-                command: 'restore',
+                command,
+                command_id: id,
                 agent_id: agentId,
-                restore_config: {
-                    request_id: pendingRestore.id,
-                    snapshot_id: pendingRestore.snapshot_id,
-                    target_path: pendingRestore.target_path
-                }
-            });
+                command_public_key: commandPublicKey(),
+            } as HeartbeatResponse);
         }
 
         // Réponse normale - idle
@@ -157,6 +237,8 @@ export async function POST(request: NextRequest): Promise<NextResponse<Heartbeat
             success: true,
             command: 'idle',
             agent_id: agentId,
+            command_public_key: commandPublicKey(),
+            backoff_seconds: agentBackoffSeconds() || undefined,
         });
 
     } catch (error) {
@@ -0,0 +1,105 @@
+import { NextRequest, NextResponse } from 'next/server';
+import { createClient } from '@supabase/supabase-js';
+
+// Supabase client avec service role pour accès complet
+function getSupabaseAdmin() {
+    const url = process.env.NEXT_PUBLIC_SUPABASE_URL;
+    const key = process.env.SUPABASE_SERVICE_ROLE_KEY;
+
+    if (!url || !key) {
+        return null;
+    }
+
+    return createClient(url, key);
+}
+
+interface KeyRotationStatusBody {
+    agent_id?: string;
+    request_id: string;
+    status: 'pending' | 'running' | 'success' | 'failed';
+    message?: string;
+    new_key_id?: string;
+    old_key_kept?: boolean;
+}
+
+/**
+ * POST /api/agent/key-rotation
+ * Reçoit la confirmation d'une rotation de clé depuis un agent.
+ * Une fois la rotation réussie, /api/agent/config renvoie le nouveau mot de passe à cet agent.
+ */
+export async function POST(request: NextRequest): Promise<NextResponse> {
+    try {
+        const supabase = getSupabaseAdmin();
+        if (!supabase) {
+            return NextResponse.json(
+                { success: false, message: 'Supabase non configuré' },
+                { status: 500 }
+            );
+        }
+
+        const body: KeyRotationStatusBody = await request.json();
+        const { request_id, status, message } = body;
+
+        if (!request_id || !status) {
+            return NextResponse.json(
+                { success: false, message: 'request_id et status requis' },
+                { status: 400 }
+            );
+        }
+
+        const updateData: Record<string, unknown> = {
+            status: status,
+            message: message || null,
+        };
+
+        if (status === 'running') {
+            updateData.started_at = new Date().toISOString();
+        }
+        // Si le statut est final, ajouter la date de complétion
+        if (status === 'success' || status === 'failed') {
+            updateData.completed_at = new Date().toISOString();
+        }
+        if (body.new_key_id) {
+            updateData.new_key_id = body.new_key_id;
+        }
+        if (body.old_key_kept !== undefined) {
+            updateData.old_key_kept = body.old_key_kept;
+        }
+
+        // Statut rejoué depuis l'outbox de l'agent : limité à sa propre
+        // rotation, sans remplacer un statut final
+        let query = supabase
+            .from('key_rotations')
+            .update(updateData)
+            .eq('id', request_id);
+        if (body.agent_id) {
+            query = query.eq('agent_id', body.agent_id);
+        }
+        if (status !== 'success' && status !== 'failed') {
+            query = query.not('status', 'in', '(success,failed)');
+        }
+        const { error } = await query;
+
+        if (error) {
+            console.error('Erreur mise à jour key_rotation:', error);
+            return NextResponse.json(
+                { success: false, message: 'Erreur mise à jour' },
+                { status: 500 }
+            );
+        }
+
+        console.log(`🔑 Rotation de clé mise à jour: ${request_id} → ${status}`);
+
+        return NextResponse.json({
+            success: true,
+            message: `Statut mis à jour: ${status}`
+        });
+
+    } catch (error) {
+        console.error('Erreur API key rotation:', error);
+        return NextResponse.json(
+            { success: false, message: 'Erreur interne' },
+            { status: 500 }
+        );
+    }
+}
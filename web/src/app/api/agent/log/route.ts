@@ -16,7 +16,7 @@ interface LogPayload {
     data_added?: number;
     duration_seconds?: number;
     // Pour agent_logs (activité générale)
-    level?: 'info' | 'warning' | 'error';
+    level?: 'info' | 'warning' | 'error' | 'critical';
     details?: Record<string, unknown>;
     log_type?: 'backup' | 'activity';
 }
@@ -170,6 +170,8 @@ export async function POST(request: NextRequest): Promise<NextResponse<LogRespon
                         files_changed: body.files_changed || 0,
                         data_added: body.data_added || 0,
                         duration_seconds: body.duration_seconds || 0,
+                        // Détails fournis par l'agent (sortie des hooks...)
+                        ...(body.details || {}),
                     },
                 });
 
@@ -0,0 +1,83 @@
+import { NextRequest, NextResponse } from 'next/server';
+import { createClient } from '@supabase/supabase-js';
+
+// Supabase client avec service role pour accès complet
+function getSupabaseAdmin() {
+    const url = process.env.NEXT_PUBLIC_SUPABASE_URL;
+    const key = process.env.SUPABASE_SERVICE_ROLE_KEY;
+
+    if (!url || !key) {
+        return null;
+    }
+
+    return createClient(url, key);
+}
+
+interface PolicyReportBody {
+    agent_id?: string;
+    hostname: string;
+    version: number;
+    status: 'applied' | 'rejected';
+    errors?: string[];
+    warnings?: string[];
+}
+
+/**
+ * POST /api/agent/policy
+ * Reçoit le compte rendu d'application d'une politique de sauvegarde :
+ * version appliquée, ou refusée avec les erreurs de validation.
+ */
+export async function POST(request: NextRequest): Promise<NextResponse> {
+    try {
+        const supabase = getSupabaseAdmin();
+        if (!supabase) {
+            return NextResponse.json(
+                { success: false, message: 'Supabase non configuré' },
+                { status: 500 }
+            );
+        }
+
+        const body: PolicyReportBody = await request.json();
+        const { agent_id, hostname, version, status } = body;
+
+        if ((!agent_id && !hostname) || !version || (status !== 'applied' && status !== 'rejected')) {
+            return NextResponse.json(
+                { success: false, message: 'agent_id ou hostname, version et status requis' },
+                { status: 400 }
+            );
+        }
+
+        const query = supabase
+            .from('agents')
+            .update({
+                policy_version: version,
+                policy_status: status,
+                policy_errors: body.errors || null,
+                policy_warnings: body.warnings || null,
+                policy_reported_at: new Date().toISOString(),
+            });
+
+        const { error } = agent_id
+            ? await query.eq('id', agent_id)
+            : await query.eq('hostname', hostname);
+
+        if (error) {
+            console.error('Erreur mise à jour politique agent:', error);
+            return NextResponse.json(
+                { success: false, message: 'Erreur mise à jour' },
+                { status: 500 }
+            );
+        }
+
+        console.log(`📜 Politique v${version} ${status === 'applied' ? 'appliquée' : 'refusée'} par ${hostname}`);
+
+        return NextResponse.json({ success: true });
+
+    } catch (error) {
+        console.error('Erreur API policy:', error);
+        return NextResponse.json(
+            { success: false, message: 'Erreur interne' },
+            { status: 500 }
+        );
+    }
+}
@@ -23,6 +23,8 @@ interface SnapshotPayload {
         hostname: string;
         paths: string[];
         tags?: string[];
+        locations?: number;      // 1 à 3 : origine, dépôt principal, dépôt secondaire
+        replicated_at?: string;  // Date de la copie vers le dépôt secondaire
     }>;
 }
 
@@ -68,6 +70,8 @@ export async function POST(request: NextRequest): Promise<NextResponse> {
                 hostname: s.hostname,
                 paths: s.paths,
                 tags: s.tags || [],
+                locations: s.locations || 2,
+                replicated_at: s.replicated_at || null,
                 synced_at: new Date().toISOString()
             }));
 
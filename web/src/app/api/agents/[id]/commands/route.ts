@@ -0,0 +1,52 @@
+import { NextRequest, NextResponse } from 'next/server';
+import { createClient, SupabaseClient } from '@supabase/supabase-js';
+
+// Fonction pour créer le client Supabase
+function getSupabaseClient(): SupabaseClient | null {
+    const supabaseUrl = process.env.NEXT_PUBLIC_SUPABASE_URL;
+    const supabaseKey = process.env.SUPABASE_SERVICE_ROLE_KEY || process.env.NEXT_PUBLIC_SUPABASE_ANON_KEY;
+
+    if (!supabaseUrl || !supabaseKey) {
+        return null;
+    }
+
+    return createClient(supabaseUrl, supabaseKey);
+}
+
+/**
+ * GET /api/agents/[id]/commands
+ * Historique des commandes d'un agent, les plus récentes d'abord
+ */
+export async function GET(
+    request: NextRequest,
+    { params }: { params: Promise<{ id: string }> }
+): Promise<NextResponse> {
+    const { id } = await params;
+
+    const supabase = getSupabaseClient();
+    if (!supabase) {
+        return NextResponse.json(
+            { success: false, message: 'Supabase non configuré' },
+            { status: 500 }
+        );
+    }
+
+    const limit = Math.min(Number(request.nextUrl.searchParams.get('limit')) || 50, 200);
+
+    const { data: commands, error } = await supabase
+        .from('agent_commands')
+        .select('id, command, params, status, error, result, created_at, expires_at, acked_at, started_at, completed_at')
+        .eq('agent_id', id)
+        .order('created_at', { ascending: false })
+        .limit(limit);
+
+    if (error) {
+        console.error('Erreur historique commandes:', error);
+        return NextResponse.json(
+            { success: false, message: 'Erreur récupération commandes' },
+            { status: 500 }
+        );
+    }
+
+    return NextResponse.json({ success: true, commands: commands || [] });
+}
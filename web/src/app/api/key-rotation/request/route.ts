@@ -0,0 +1,139 @@
+import { NextRequest, NextResponse } from 'next/server';
+import { createClient } from '@supabase/supabase-js';
+import { randomBytes } from 'crypto';
+import { enqueueAgentCommand } from '@/lib/agentCommands';
+import { sealSecret } from '@/lib/secretBox';
+
+// Supabase client avec service role pour accès complet
+function getSupabaseAdmin() {
+    const url = process.env.NEXT_PUBLIC_SUPABASE_URL;
+    const key = process.env.SUPABASE_SERVICE_ROLE_KEY;
+
+    if (!url || !key) {
+        return null;
+    }
+
+    return createClient(url, key);
+}
+
+interface KeyRotationRequestBody {
+    agentId: string;
+}
+
+/**
+ * POST /api/key-rotation/request
+ * Demande la rotation du mot de passe du dépôt d'un agent : le nouveau mot de
+ * passe est généré ici, enregistré chiffré, et transmis à l'agent par la file
+ * de commandes (rotate_key signée, avec accusé de réception et expiration)
+ */
+export async function POST(request: NextRequest): Promise<NextResponse> {
+    try {
+        const supabase = getSupabaseAdmin();
+        if (!supabase) {
+            return NextResponse.json(
+                { success: false, message: 'Supabase non configuré' },
+                { status: 500 }
+            );
+        }
+
+        const body: KeyRotationRequestBody = await request.json();
+        const { agentId } = body;
+
+        if (!agentId) {
+            return NextResponse.json(
+                { success: false, message: 'agentId requis' },
+                { status: 400 }
+            );
+        }
+
+        // Vérifier que l'agent existe
+        const { data: agent, error: agentError } = await supabase
+            .from('agents')
+            .select('id, hostname')
+            .eq('id', agentId)
+            .single();
+
+        if (agentError || !agent) {
+            return NextResponse.json(
+                { success: false, message: 'Agent non trouvé' },
+                { status: 404 }
+            );
+        }
+
+        // Une seule rotation en cours par agent
+        const { data: running } = await supabase
+            .from('key_rotations')
+            .select('id')
+            .eq('agent_id', agentId)
+            .eq('status', 'running')
+            .limit(1);
+
+        if (running && running.length > 0) {
+            return NextResponse.json(
+                { success: false, message: 'Une rotation de clé est déjà en cours pour cet agent' },
+                { status: 409 }
+            );
+        }
+
+        let sealedPassword: string;
+        try {
+            sealedPassword = sealSecret(randomBytes(32).toString('base64url'));
+        } catch (error) {
+            console.error('Chiffrement du mot de passe impossible:', error);
+            return NextResponse.json(
+                { success: false, message: 'AGENT_SECRETS_KEY non configurée' },
+                { status: 500 }
+            );
+        }
+
+        const { data: rotation, error: insertError } = await supabase
+            .from('key_rotations')
+            .insert({
+                agent_id: agentId,
+                new_password_sealed: sealedPassword,
+                status: 'pending',
+            })
+            .select('id')
+            .single();
+
+        if (insertError || !rotation) {
+            console.error('Erreur création key_rotation:', insertError);
+            return NextResponse.json(
+                { success: false, message: 'Erreur lors de la création de la demande' },
+                { status: 500 }
+            );
+        }
+
+        // Le mot de passe n'est pas dans la commande : ajouté, déchiffré, à la distribution
+        const commandId = await enqueueAgentCommand(supabase, agentId, 'rotate_key', {
+            request_id: rotation.id,
+        });
+        if (!commandId) {
+            await supabase
+                .from('key_rotations')
+                .update({ status: 'failed', message: 'Commande non créée', completed_at: new Date().toISOString() })
+                .eq('id', rotation.id);
+            return NextResponse.json(
+                { success: false, message: 'Erreur lors de la création de la commande' },
+                { status: 500 }
+            );
+        }
+
+        console.log(`🔑 Rotation de clé demandée pour agent "${agent.hostname}"`);
+
+        return NextResponse.json({
+            success: true,
+            message: 'Rotation de clé demandée',
+            requestId: rotation.id,
+            commandId,
+            agentHostname: agent.hostname,
+        });
+
+    } catch (error) {
+        console.error('Erreur API key rotation request:', error);
+        return NextResponse.json(
+            { success: false, message: 'Erreur interne' },
+            { status: 500 }
+        );
+    }
+}
@@ -1,5 +1,6 @@
 import { NextRequest, NextResponse } from 'next/server';
 import { createClient } from '@supabase/supabase-js';
+import { enqueueAgentCommand } from '@/lib/agentCommands';
 
 // Supabase client avec service role pour accès complet
 function getSupabaseAdmin() {
@@ -93,6 +94,13 @@ export async function POST(request: NextRequest): Promise<NextResponse> {
             );
         }
 
+        // Envoi immédiat par le canal de commandes de l'agent
+        await enqueueAgentCommand(supabase, agentId, 'restore', {
+            request_id: restoreRequest.id,
+            snapshot_id: snapshotId,
+            target_path: targetPath,
+        });
+
         console.log(`🔄 Restauration demandée pour agent "${agent.hostname}" - Snapshot: ${snapshotId}`);
 
         return NextResponse.json({
@@ -41,7 +41,7 @@ interface Agent {
 
 interface ActivityLog {
     id: string;
-    level: 'info' | 'warning' | 'error';
+    level: 'info' | 'warning' | 'error' | 'critical';
     message: string;
     details: Record<string, unknown>;
     created_at: string;
@@ -124,6 +124,8 @@ function getLevelIcon(level: string) {
             return <AlertTriangle className="w-4 h-4 text-amber-400" />;
         case 'error':
             return <AlertCircle className="w-4 h-4 text-red-400" />;
+        case 'critical':
+            return <XCircle className="w-4 h-4 text-red-300" />;
         default:
             return <Info className="w-4 h-4 text-slate-400" />;
     }
@@ -134,6 +136,7 @@ function getLevelColor(level: string) {
         case 'info': return 'bg-blue-500/10 border-blue-500/30 text-blue-400';
         case 'warning': return 'bg-amber-500/10 border-amber-500/30 text-amber-400';
         case 'error': return 'bg-red-500/10 border-red-500/30 text-red-400';
+        case 'critical': return 'bg-red-600/20 border-red-500 text-red-300';
         default: return 'bg-slate-500/10 border-slate-500/30 text-slate-400';
     }
 }
@@ -233,7 +236,7 @@ export default function AgentDetailPage() {
     }
 
     // Stats
-    const errorCount = activityLogs.filter(l => l.level === 'error').length;
+    const errorCount = activityLogs.filter(l => l.level === 'error' || l.level === 'critical').length;
     const successfulBackups = backupLogs.filter(l => l.status === 'success').length;
 
     return (
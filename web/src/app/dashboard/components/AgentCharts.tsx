@@ -14,7 +14,7 @@ interface BackupLog {
 }
 
 interface ActivityLog {
-    level: 'info' | 'warning' | 'error';
+    level: 'info' | 'warning' | 'error' | 'critical';
     created_at: string;
 }
 
@@ -135,10 +135,15 @@ function HealthScore({ backupLogs, activityLogs, agentCreatedAt }: {
             log.level === 'error' && new Date(log.created_at) > recentDate
         ).length;
 
+        const recentCritical = activityLogs.filter(log =>
+            log.level === 'critical' && new Date(log.created_at) > recentDate
+        ).length;
+
         const recentWarnings = activityLogs.filter(log =>
             log.level === 'warning' && new Date(log.created_at) > recentDate
         ).length;
 
+        points -= recentCritical * 40;  // -40 par alerte critique
         points -= recentErrors * 10;  // -10 par erreur
         points -= recentWarnings * 3;  // -3 par warning
 
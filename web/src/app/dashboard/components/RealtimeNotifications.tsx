@@ -33,7 +33,7 @@ interface AgentLogPayload {
     new: {
         id: string;
         agent_id: string;
-        level: 'info' | 'warning' | 'error';
+        level: 'info' | 'warning' | 'error' | 'critical';
         message: string;
     };
 }
@@ -89,7 +89,14 @@ export default function RealtimeNotifications() {
                     const data = payload as unknown as AgentLogPayload;
                     const { level, message } = data.new;
 
-                    if (level === 'error') {
+                    if (level === 'critical') {
+                        addNotification({
+                            type: 'error',
+                            title: 'Alerte critique',
+                            message: message,
+                            agentId: data.new.agent_id,
+                        });
+                    } else if (level === 'error') {
                         addNotification({
                             type: 'error',
                             title: 'Erreur Agent',
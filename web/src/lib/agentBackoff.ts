@@ -0,0 +1,23 @@
+import { NextResponse } from 'next/server';
+
+/**
+ * Délai (secondes) demandé aux agents entre deux appels, lors d'un incident :
+ * AGENT_BACKOFF_SECONDS. Les agents espacent leurs heartbeats et leurs
+ * lectures de configuration d'au moins ce délai (1 h au plus).
+ */
+export function agentBackoffSeconds(): number {
+    const seconds = parseInt(process.env.AGENT_BACKOFF_SECONDS || '', 10);
+    return Number.isFinite(seconds) && seconds > 0 ? seconds : 0;
+}
+
+/**
+ * Ajoute la consigne de ralentissement (en-tête Retry-After) à une réponse
+ * destinée aux agents
+ */
+export function withAgentBackoff<T>(response: NextResponse<T>): NextResponse<T> {
+    const seconds = agentBackoffSeconds();
+    if (seconds > 0) {
+        response.headers.set('Retry-After', String(seconds));
+    }
+    return response;
+}
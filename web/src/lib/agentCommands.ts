@@ -0,0 +1,133 @@
+import { SupabaseClient } from '@supabase/supabase-js';
+import { signAgentCommand } from '@/lib/commandSigning';
+import { openSecret } from '@/lib/secretBox';
+
+// Commande telle que reçue par l'agent
+export interface AgentCommand {
+    id: string;
+    command: string;
+    params?: Record<string, unknown>;
+    expires_at?: string;
+    // Enveloppe signée (base64) et signature Ed25519, voir commandSigning.ts
+    signed_payload?: string;
+    signature?: string;
+}
+
+// États d'une commande : pending jusqu'à l'accusé de réception, puis signalés par l'agent
+export type AgentCommandStatus = 'pending' | 'acked' | 'queued' | 'running' | 'done' | 'failed' | 'rejected';
+
+// Durée de validité par défaut d'une commande
+const DEFAULT_TTL_SECONDS = 3600;
+
+/**
+ * Ajoute une commande à la file d'un agent
+ */
+export async function enqueueAgentCommand(
+    supabase: SupabaseClient,
+    agentId: string,
+    command: string,
+    params?: Record<string, unknown>,
+    ttlSeconds: number = DEFAULT_TTL_SECONDS,
+): Promise<string | null> {
+    const { data, error } = await supabase
+        .from('agent_commands')
+        .insert({
+            agent_id: agentId,
+            command,
+            params: params || null,
+            expires_at: new Date(Date.now() + ttlSeconds * 1000).toISOString(),
+        })
+        .select('id')
+        .single();
+
+    if (error || !data) {
+        console.error('Erreur création commande agent:', error);
+        return null;
+    }
+    return data.id;
+}
+
+/**
+ * Commandes non expirées en attente d'accusé de réception, signées pour
+ * l'agent, dans l'ordre de création
+ */
+export async function pendingAgentCommands(supabase: SupabaseClient, agentId: string): Promise<AgentCommand[]> {
+    const { data, error } = await supabase
+        .from('agent_commands')
+        .select('id, command, params, expires_at')
+        .eq('agent_id', agentId)
+        .eq('status', 'pending')
+        .or(`expires_at.is.null,expires_at.gt.${new Date().toISOString()}`)
+        .order('created_at', { ascending: true })
+        .limit(20);
+
+    if (error || !data) {
+        return [];
+    }
+    const commands = await Promise.all(data.map(async (row) => {
+        const command = await withCommandSecrets(supabase, agentId, {
+            id: row.id,
+            command: row.command,
+            params: row.params || undefined,
+            expires_at: row.expires_at || undefined,
+        });
+        return command && { ...command, ...signAgentCommand(command, agentId) };
+    }));
+    return commands.filter((command): command is AgentCommand => command !== null);
+}
+
+/**
+ * Ajoute à une commande ses paramètres secrets, jamais enregistrés en clair
+ * dans agent_commands : nouveau mot de passe d'une rotation de clé.
+ * Retourne null si le secret est introuvable ou indéchiffrable.
+ */
+async function withCommandSecrets(supabase: SupabaseClient, agentId: string, command: AgentCommand): Promise<AgentCommand | null> {
+    if (command.command !== 'rotate_key') {
+        return command;
+    }
+    const { data } = await supabase
+        .from('key_rotations')
+        .select('new_password_sealed')
+        .eq('id', command.params?.request_id)
+        .eq('agent_id', agentId)
+        .single();
+    if (!data) {
+        console.error(`Rotation de clé introuvable pour la commande ${command.id}`);
+        return null;
+    }
+    try {
+        return { ...command, params: { ...command.params, new_password: openSecret(data.new_password_sealed) } };
+    } catch (error) {
+        console.error('Mot de passe de rotation indéchiffrable:', error);
+        return null;
+    }
+}
+
+/**
+ * Champs d'une commande dans la réponse du heartbeat, pour les agents qui
+ * ne lisent pas encore `params`
+ */
+export function legacyCommandFields(command: AgentCommand): Record<string, unknown> {
+    const params = command.params || {};
+    switch (command.command) {
+        case 'restore':
+            return { restore_config: params };
+        case 'set_log_level':
+            return { log_level: params.log_level };
+        default:
+            return {};
+    }
+}
+
+/**
+ * Résout l'agent d'une requête du canal de commandes (agent_id, sinon hostname)
+ */
+export async function resolveAgentId(supabase: SupabaseClient, agentId: string | null, hostname: string | null): Promise<string | null> {
+    const query = supabase.from('agents').select('id');
+    const { data } = agentId
+        ? await query.eq('id', agentId).single()
+        : hostname
+            ? await query.eq('hostname', hostname).single()
+            : { data: null };
+    return data?.id || null;
+}
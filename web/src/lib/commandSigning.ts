@@ -0,0 +1,64 @@
+import { createPrivateKey, createPublicKey, sign, KeyObject } from 'crypto';
+import type { AgentCommand } from '@/lib/agentCommands';
+
+// Clé privée Ed25519 de signature des commandes (PEM PKCS#8, variable
+// COMMAND_SIGNING_KEY). Les agents épinglent la clé publique à l'enrôlement et
+// refusent les commandes sensibles (restore, shutdown, rotate_key) non signées.
+let cachedKey: KeyObject | null | undefined;
+
+function signingKey(): KeyObject | null {
+    if (cachedKey !== undefined) {
+        return cachedKey;
+    }
+    const pem = process.env.COMMAND_SIGNING_KEY;
+    if (!pem) {
+        console.warn('⚠️ COMMAND_SIGNING_KEY non configurée - commandes sensibles refusées par les agents');
+        cachedKey = null;
+        return null;
+    }
+    try {
+        cachedKey = createPrivateKey(pem.replace(/\\n/g, '\n'));
+    } catch (error) {
+        console.error('Clé de signature des commandes invalide:', error);
+        cachedKey = null;
+    }
+    return cachedKey;
+}
+
+/**
+ * Clé publique Ed25519 brute en base64, annoncée aux agents pour l'enrôlement
+ */
+export function commandPublicKey(): string | undefined {
+    const key = signingKey();
+    if (!key) {
+        return undefined;
+    }
+    const der = createPublicKey(key).export({ format: 'der', type: 'spki' });
+    // SPKI Ed25519 : les 32 derniers octets sont la clé
+    return der.subarray(der.length - 32).toString('base64');
+}
+
+/**
+ * Signe une commande pour un agent : l'enveloppe couvre l'ID, l'agent, les
+ * paramètres et l'expiration. L'agent n'utilise que son contenu.
+ */
+export function signAgentCommand(
+    command: AgentCommand,
+    agentId: string,
+): { signed_payload: string; signature: string } | undefined {
+    const key = signingKey();
+    if (!key) {
+        return undefined;
+    }
+    const payload = Buffer.from(JSON.stringify({
+        id: command.id,
+        agent_id: agentId,
+        command: command.command,
+        params: command.params ?? null,
+        expires_at: command.expires_at ?? null,
+    }));
+    return {
+        signed_payload: payload.toString('base64'),
+        signature: sign(null, payload, key).toString('base64'),
+    };
+}
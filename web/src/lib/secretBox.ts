@@ -0,0 +1,39 @@
+import { createCipheriv, createDecipheriv, randomBytes } from 'crypto';
+
+// Chiffrement des secrets conservés en base (mots de passe de dépôt issus
+// d'une rotation) : AES-256-GCM, clé de 32 octets en base64 dans
+// AGENT_SECRETS_KEY. Format : base64(iv[12] | tag[16] | chiffré).
+const IV_SIZE = 12;
+const TAG_SIZE = 16;
+
+function secretsKey(): Buffer {
+    const encoded = process.env.AGENT_SECRETS_KEY;
+    if (!encoded) {
+        throw new Error('AGENT_SECRETS_KEY non configurée');
+    }
+    const key = Buffer.from(encoded, 'base64');
+    if (key.length !== 32) {
+        throw new Error('AGENT_SECRETS_KEY invalide (32 octets en base64 attendus)');
+    }
+    return key;
+}
+
+/**
+ * Chiffre un secret pour l'enregistrer en base
+ */
+export function sealSecret(plaintext: string): string {
+    const iv = randomBytes(IV_SIZE);
+    const cipher = createCipheriv('aes-256-gcm', secretsKey(), iv);
+    const encrypted = Buffer.concat([cipher.update(plaintext, 'utf8'), cipher.final()]);
+    return Buffer.concat([iv, cipher.getAuthTag(), encrypted]).toString('base64');
+}
+
+/**
+ * Déchiffre un secret enregistré par sealSecret (erreur si altéré)
+ */
+export function openSecret(sealed: string): string {
+    const data = Buffer.from(sealed, 'base64');
+    const decipher = createDecipheriv('aes-256-gcm', secretsKey(), data.subarray(0, IV_SIZE));
+    decipher.setAuthTag(data.subarray(IV_SIZE, IV_SIZE + TAG_SIZE));
+    return Buffer.concat([decipher.update(data.subarray(IV_SIZE + TAG_SIZE)), decipher.final()]).toString('utf8');
+}
@@ -33,7 +33,7 @@ interface AgentLogPayload {
     new: {
         id: string;
         agent_id: string;
-        level: 'info' | 'warning' | 'error';
+        level: 'info' | 'warning' | 'error' | 'critical';
         message: string;
     };
 }
@@ -66,7 +66,14 @@ export function useRealtimeSubscription() {
         const { level, message } = payload.new;
 
         // Only notify for warnings and errors
-        if (level === 'error') {
+        if (level === 'critical') {
+            addNotification({
+                type: 'error',
+                title: 'Alerte critique',
+                message: message,
+                agentId: payload.new.agent_id,
+            });
+        } else if (level === 'error') {
             addNotification({
                 type: 'error',
                 title: 'Erreur Agent',
@@ -0,0 +1,13 @@
+-- =============================================================================
+-- Migration: Sauvegardes planifiées reportées par l'agent
+-- =============================================================================
+-- Exécutez ce script dans Supabase SQL Editor
+-- https://supabase.com/dashboard/project/[VOTRE_PROJET]/sql
+-- =============================================================================
+
+-- Échéance de la sauvegarde planifiée reportée (NULL : aucun report en cours)
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS backup_deferred_since TIMESTAMPTZ;
+-- Codes des raisons du report : load (charge), cpu (poste occupé), battery
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS backup_deferred_reasons TEXT[];
+
+COMMENT ON COLUMN agents.backup_deferred_since IS 'Sauvegarde planifiée reportée depuis (détail dans health.backup_deferred)';
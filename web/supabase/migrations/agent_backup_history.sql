@@ -0,0 +1,16 @@
+-- =============================================================================
+-- Migration: Dernière sauvegarde réussie des agents
+-- =============================================================================
+-- Exécutez ce script dans Supabase SQL Editor
+-- https://supabase.com/dashboard/project/[VOTRE_PROJET]/sql
+-- =============================================================================
+
+-- Dernière sauvegarde complète réussie, conservée par l'agent entre deux
+-- démarrages (last_backup_at : dernière tentative, réussie ou non)
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS last_backup_success_at TIMESTAMPTZ;
+
+COMMENT ON COLUMN agents.last_backup_success_at IS 'Dernière sauvegarde complète réussie (chemins configurés)';
+
+-- Plages horaires et jours sans sauvegarde : champs backup_windows et
+-- blackout_dates de backup_policies.policy
+COMMENT ON TABLE backup_policies IS 'Politiques de sauvegarde versionnées (chemins, exclusions, planification, plages, jours exclus, rétention, débit, hooks)';
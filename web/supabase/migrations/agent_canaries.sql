@@ -0,0 +1,17 @@
+-- =============================================================================
+-- Migration: Fichiers témoins (canaris) des agents
+-- =============================================================================
+-- Exécutez ce script dans Supabase SQL Editor
+-- https://supabase.com/dashboard/project/[VOTRE_PROJET]/sql
+-- =============================================================================
+
+-- Nombre de fichiers témoins déposés (NULL : fonction désactivée sur l'agent)
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS canary_files INTEGER;
+-- Déclenchement en cours : sauvegardes planifiées suspendues jusqu'à la
+-- commande reset_canaries (signée) ou mon-rempart-agent canary reset
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS canary_triggered_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_agents_canary_triggered ON agents(canary_triggered_at)
+    WHERE canary_triggered_at IS NOT NULL;
+
+COMMENT ON COLUMN agents.canary_triggered_at IS 'Fichier témoin modifié, supprimé ou renommé (détail dans health.canary)';
@@ -0,0 +1,31 @@
+-- =============================================================================
+-- Migration: Suivi des commandes des agents (paramètres, expiration, résultats)
+-- =============================================================================
+-- Exécutez ce script après agent_commands.sql dans Supabase SQL Editor
+-- https://supabase.com/dashboard/project/[VOTRE_PROJET]/sql
+-- =============================================================================
+
+-- Les paramètres de la commande (snapshot_id, target_path, log_level...)
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_name = 'agent_commands' AND column_name = 'payload') THEN
+        ALTER TABLE agent_commands RENAME COLUMN payload TO params;
+    END IF;
+END $$;
+
+-- Au-delà de expires_at, l'agent refuse la commande sans l'exécuter (et une
+-- commande rejouée plus tard est refusée)
+ALTER TABLE agent_commands ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ DEFAULT NOW() + INTERVAL '1 hour';
+
+-- États signalés par l'agent : pending (non reçue), acked, queued, running,
+-- done, failed, rejected (expirée)
+ALTER TABLE agent_commands ADD COLUMN IF NOT EXISTS result JSONB;
+ALTER TABLE agent_commands ADD COLUMN IF NOT EXISTS error TEXT;
+ALTER TABLE agent_commands ADD COLUMN IF NOT EXISTS started_at TIMESTAMPTZ;
+ALTER TABLE agent_commands ADD COLUMN IF NOT EXISTS completed_at TIMESTAMPTZ;
+ALTER TABLE agent_commands ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS idx_agent_commands_history ON agent_commands(agent_id, created_at DESC);
+
+COMMENT ON COLUMN agent_commands.status IS 'pending, acked, queued, running, done, failed, rejected';
@@ -0,0 +1,26 @@
+-- =============================================================================
+-- Migration: File de commandes des agents
+-- =============================================================================
+-- Exécutez ce script dans Supabase SQL Editor
+-- https://supabase.com/dashboard/project/[VOTRE_PROJET]/sql
+-- =============================================================================
+
+-- Commandes envoyées aux agents par le canal temps réel (flux SSE ou requête
+-- longue), ou par le heartbeat pour les anciens agents. Une commande est
+-- redistribuée tant que l'agent n'en a pas accusé réception.
+CREATE TABLE IF NOT EXISTS agent_commands (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    agent_id UUID NOT NULL REFERENCES agents(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES auth.users(id),       -- Utilisateur qui a demandé
+    command TEXT NOT NULL,                        -- backup_now, restore, preview_backup, sync_snapshots...
+    payload JSONB,                                -- restore_config, log_level...
+    status TEXT NOT NULL DEFAULT 'pending',       -- pending, acked
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    acked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_agent_commands_pending ON agent_commands(agent_id, status, created_at);
+
+ALTER TABLE agent_commands ENABLE ROW LEVEL SECURITY;
+
+COMMENT ON TABLE agent_commands IS 'Commandes des agents, distribuées jusqu''à accusé de réception';
@@ -0,0 +1,27 @@
+-- =============================================================================
+-- Migration: État détaillé des agents transmis par le heartbeat
+-- =============================================================================
+-- Exécutez ce script dans Supabase SQL Editor
+-- https://supabase.com/dashboard/project/[VOTRE_PROJET]/sql
+-- =============================================================================
+
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS agent_version TEXT;
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS arch TEXT;
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS restic_version TEXT;
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS uptime_seconds BIGINT;
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS ip_addresses TEXT[];
+
+-- Dernière sauvegarde des chemins configurés, vue par l'agent
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS last_backup_at TIMESTAMPTZ;
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS last_backup_status TEXT;     -- success, failed
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS last_backup_snapshot TEXT;
+
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS current_job TEXT;            -- backup, restore, replication...
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS outbox_depth INTEGER;
+
+-- Heartbeat complet : disques (espace libre des chemins sauvegardés),
+-- versions de configuration, erreur de la dernière sauvegarde...
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS health JSONB;
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS health_updated_at TIMESTAMPTZ;
+
+COMMENT ON COLUMN agents.health IS 'Dernier heartbeat détaillé de l''agent (disks, config_version, policy_version, last_backup...)';
@@ -0,0 +1,27 @@
+-- =============================================================================
+-- Migration: Niveau critical des logs d'activité (rançongiciel probable...)
+-- =============================================================================
+-- Exécutez ce script dans Supabase SQL Editor
+-- https://supabase.com/dashboard/project/[VOTRE_PROJET]/sql
+-- =============================================================================
+
+ALTER TABLE agent_logs DROP CONSTRAINT IF EXISTS agent_logs_level_check;
+ALTER TABLE agent_logs ADD CONSTRAINT agent_logs_level_check
+    CHECK (level IN ('info', 'warning', 'error', 'critical'));
+
+COMMENT ON COLUMN agent_logs.level IS 'Niveau: info, warning, error, critical';
+
+-- Statistiques : colonne critical_count ajoutée en fin de vue
+DROP VIEW IF EXISTS agent_logs_stats;
+
+CREATE VIEW agent_logs_stats AS
+SELECT 
+    agent_id,
+    COUNT(*) FILTER (WHERE level = 'info') AS info_count,
+    COUNT(*) FILTER (WHERE level = 'warning') AS warning_count,
+    COUNT(*) FILTER (WHERE level = 'error') AS error_count,
+    COUNT(*) AS total_count,
+    MAX(created_at) AS last_log_at,
+    COUNT(*) FILTER (WHERE level = 'critical') AS critical_count
+FROM agent_logs
+GROUP BY agent_id;
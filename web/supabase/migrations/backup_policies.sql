@@ -0,0 +1,36 @@
+-- =============================================================================
+-- Migration: Politiques de sauvegarde poussées depuis le Dashboard
+-- =============================================================================
+-- Exécutez ce script dans Supabase SQL Editor
+-- https://supabase.com/dashboard/project/[VOTRE_PROJET]/sql
+-- =============================================================================
+
+-- Une ligne par version de politique. agent_id NULL : politique par défaut de
+-- tous les agents ; sinon politique propre à un agent. L'agent reçoit la
+-- version la plus récente avec sa configuration (/api/agent/config).
+CREATE TABLE IF NOT EXISTS backup_policies (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    agent_id UUID REFERENCES agents(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES auth.users(id),       -- Utilisateur qui a publié
+    version INTEGER NOT NULL CHECK (version > 0),
+    -- backup_paths, exclude_paths, schedule, retention, bandwidth, hooks
+    -- Chemins avec variables du poste : %USERPROFILE%\Documents, $HOME/Documents
+    policy JSONB NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_backup_policies_version
+    ON backup_policies(COALESCE(agent_id, '00000000-0000-0000-0000-000000000000'::uuid), version);
+
+ALTER TABLE backup_policies ENABLE ROW LEVEL SECURITY;
+
+-- Compte rendu de l'agent : version appliquée ou refusée (erreurs de validation)
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS policy_version INTEGER;
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS policy_status TEXT;      -- applied, rejected
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS policy_errors JSONB;
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS policy_warnings JSONB;
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS policy_reported_at TIMESTAMPTZ;
+
+COMMENT ON TABLE backup_policies IS 'Politiques de sauvegarde versionnées (chemins, exclusions, planification, rétention, débit, hooks)';
+COMMENT ON COLUMN backup_policies.agent_id IS 'NULL : politique par défaut de tous les agents';
+COMMENT ON COLUMN agents.policy_version IS 'Dernière version de politique signalée par l''agent (voir policy_status)';
@@ -0,0 +1,32 @@
+-- =============================================================================
+-- Migration: Rotation des mots de passe des dépôts Restic
+-- =============================================================================
+-- Exécutez ce script dans Supabase SQL Editor
+-- https://supabase.com/dashboard/project/[VOTRE_PROJET]/sql
+-- =============================================================================
+
+-- Une ligne par rotation demandée (POST /api/key-rotation/request), envoyée à
+-- l'agent par la file agent_commands (commande rotate_key signée). L'agent
+-- ajoute la nouvelle clé, vérifie l'accès puis supprime l'ancienne ; tant que
+-- la rotation n'a pas réussi, l'agent continue de recevoir l'ancien mot de
+-- passe. Le nouveau mot de passe n'est jamais enregistré en clair.
+CREATE TABLE IF NOT EXISTS key_rotations (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    agent_id UUID NOT NULL REFERENCES agents(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES auth.users(id),       -- Utilisateur qui a demandé
+    new_password_sealed TEXT NOT NULL,            -- Nouveau mot de passe chiffré (AES-256-GCM, AGENT_SECRETS_KEY)
+    status TEXT NOT NULL DEFAULT 'pending',       -- pending, running, success, failed
+    message TEXT,                                 -- Message de résultat
+    new_key_id TEXT,                              -- ID restic de la nouvelle clé
+    old_key_kept BOOLEAN DEFAULT FALSE,           -- Ancienne clé non supprimée (dépôt en ajout seul)
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    started_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_key_rotations_agent ON key_rotations(agent_id, status);
+
+ALTER TABLE key_rotations ENABLE ROW LEVEL SECURITY;
+
+COMMENT ON TABLE key_rotations IS 'Rotations du mot de passe des dépôts Restic, confirmées par les agents';
+COMMENT ON COLUMN key_rotations.new_password_sealed IS 'Mot de passe chiffré, servi à l''agent par /api/agent/config une fois la rotation réussie';
@@ -0,0 +1,12 @@
+-- =============================================================================
+-- Migration: Réplication 3-2-1 des snapshots
+-- =============================================================================
+-- Exécutez ce script dans Supabase SQL Editor
+-- https://supabase.com/dashboard/project/[VOTRE_PROJET]/sql
+-- =============================================================================
+
+ALTER TABLE snapshots ADD COLUMN IF NOT EXISTS locations INTEGER DEFAULT 2;
+ALTER TABLE snapshots ADD COLUMN IF NOT EXISTS replicated_at TIMESTAMPTZ;
+
+COMMENT ON COLUMN snapshots.locations IS 'Nombre d''emplacements : données d''origine, dépôt principal, dépôt secondaire (1 à 3)';
+COMMENT ON COLUMN snapshots.replicated_at IS 'Date de la copie vers le dépôt secondaire (NULL si non répliqué)';
@@ -0,0 +1,23 @@
+-- =============================================================================
+-- Migration: Backends de stockage hors Scaleway S3
+-- =============================================================================
+-- Exécutez ce script dans Supabase SQL Editor
+-- https://supabase.com/dashboard/project/[VOTRE_PROJET]/sql
+-- =============================================================================
+
+ALTER TABLE settings ADD COLUMN IF NOT EXISTS storage_backend TEXT NOT NULL DEFAULT 's3';
+ALTER TABLE settings ADD COLUMN IF NOT EXISTS repository_url TEXT;
+ALTER TABLE settings ADD COLUMN IF NOT EXISTS s3_path_style BOOLEAN DEFAULT FALSE;
+ALTER TABLE settings ADD COLUMN IF NOT EXISTS rest_username TEXT;
+ALTER TABLE settings ADD COLUMN IF NOT EXISTS rest_password TEXT;
+ALTER TABLE settings ADD COLUMN IF NOT EXISTS rest_append_only BOOLEAN DEFAULT FALSE;
+
+ALTER TABLE settings DROP CONSTRAINT IF EXISTS settings_storage_backend_check;
+ALTER TABLE settings ADD CONSTRAINT settings_storage_backend_check
+    CHECK (storage_backend IN ('s3', 'local', 'sftp', 'rest'));
+
+COMMENT ON COLUMN settings.storage_backend IS 'Backend du dépôt : s3, local, sftp ou rest';
+COMMENT ON COLUMN settings.repository_url IS 'Adresse de base du dépôt hors S3 (ex: rest:https://backup.mairie.fr:8000), complétée par le hostname de chaque agent';
+COMMENT ON COLUMN settings.s3_path_style IS 'Adressage S3 par chemin (MinIO, passerelles Swift/Azure)';
+COMMENT ON COLUMN settings.rest_password IS 'Mot de passe HTTP du serveur REST - À chiffrer en production';
+COMMENT ON COLUMN settings.rest_append_only IS 'Serveur REST lancé en --append-only';